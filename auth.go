@@ -0,0 +1,266 @@
+package lux
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does
+// not carry the kind of credentials it checks, so that the next one can
+// try. Any other error means the credentials were present but invalid.
+var ErrNoCredentials = errors.New("lux: no credentials")
+
+// Principal is the authenticated identity of a request.
+type Principal struct {
+	ID     string         // user name, subject or key owner
+	Method string         // authenticator that accepted the request: "basic", "jwt", "apikey", ...
+	Roles  []string       // roles or scopes granted to the principal
+	Claims map[string]any // further attributes, such as the claims of a JWT
+	Value  any            // application identity, such as the user a bearer token resolved to
+}
+
+// HasRole reports whether the principal was granted role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator establishes who sent a request.
+type Authenticator interface {
+	Authenticate(c *Context) (*Principal, error)
+}
+
+// Challenger is implemented by authenticators that tell clients how to
+// authenticate, in the WWW-Authenticate header of 401 responses.
+type Challenger interface {
+	Challenge() string
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(c *Context) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(c *Context) (*Principal, error) {
+	return f(c)
+}
+
+// Principal returns the identity established by the Auth middleware, or
+// nil for unauthenticated requests.
+func (c *Context) Principal() *Principal {
+	return c.principal
+}
+
+// Auth returns middleware that authenticates requests with the first of
+// the authenticators that finds credentials, and stores the principal on
+// the Context. Requests without valid credentials are answered 401 with a
+// WWW-Authenticate challenge from every authenticator that offers one.
+// It panics on a JWTAuthenticator that cannot verify tokens, such as one
+// with an empty Secret.
+func Auth(authenticators ...Authenticator) HandlerFunc {
+	var challenges []string
+	for _, a := range authenticators {
+		if jwt, ok := a.(*JWTAuthenticator); ok {
+			if err := jwt.validate(); err != nil {
+				panic(err)
+			}
+		}
+		if ch, ok := a.(Challenger); ok {
+			challenges = append(challenges, ch.Challenge())
+		}
+	}
+
+	return func(c *Context) {
+		for _, a := range authenticators {
+			p, err := a.Authenticate(c)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				c.engine.logger().Debug("authentication failed", "route", c.RouteLabel(), "error", err)
+				break
+			}
+			c.principal = p
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		for _, ch := range challenges {
+			h.Add("WWW-Authenticate", ch)
+		}
+		h.Set("Content-Length", "0")
+		c.Writer.WriteHeader(http.StatusUnauthorized)
+		c.Abort()
+	}
+}
+
+// BasicAuthenticator checks HTTP Basic credentials against a fixed set of
+// accounts.
+type BasicAuthenticator struct {
+	Realm    string
+	Accounts map[string]string // user name to password
+}
+
+func (a *BasicAuthenticator) Authenticate(c *Context) (*Principal, error) {
+	user, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	// Compare against every account so that timing reveals nothing
+	found := false
+	for u, p := range a.Accounts {
+		userOK := subtle.ConstantTimeCompare([]byte(u), []byte(user))
+		passOK := subtle.ConstantTimeCompare([]byte(p), []byte(password))
+		if userOK&passOK == 1 {
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("lux: invalid basic auth credentials")
+	}
+	return &Principal{ID: user, Method: "basic"}, nil
+}
+
+func (a *BasicAuthenticator) Challenge() string {
+	realm := a.Realm
+	if realm == "" {
+		realm = "Authorization Required"
+	}
+	return `Basic realm="` + strings.ReplaceAll(realm, `"`, `\"`) + `"`
+}
+
+// BasicAuth returns middleware requiring HTTP Basic credentials of one of
+// the accounts, a map from user name to password.
+func BasicAuth(accounts map[string]string) HandlerFunc {
+	return BasicAuthForRealm(accounts, "")
+}
+
+// BasicAuthForRealm is BasicAuth announcing realm in its challenge. An
+// empty realm is announced as "Authorization Required".
+func BasicAuthForRealm(accounts map[string]string, realm string) HandlerFunc {
+	return Auth(&BasicAuthenticator{Realm: realm, Accounts: accounts})
+}
+
+// BearerAuthenticator checks opaque bearer tokens, such as session or
+// OAuth access tokens, with an application-supplied function. JWTs can be
+// verified locally with JWTAuthenticator instead.
+type BearerAuthenticator struct {
+	// Realm is announced in the Bearer challenge
+	Realm string
+
+	// Validate reports whether token is valid and returns the identity it
+	// stands for. A *Principal is copied, so it may be shared between
+	// requests; anything else is kept in Principal.Value, with a string
+	// also becoming the ID.
+	Validate func(token string) (any, bool)
+}
+
+func (a *BearerAuthenticator) Authenticate(c *Context) (*Principal, error) {
+	token, ok := bearerToken(c)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	v, ok := a.Validate(token)
+	if !ok {
+		return nil, errors.New("lux: invalid bearer token")
+	}
+	switch v := v.(type) {
+	case *Principal:
+		p := *v
+		if p.Method == "" {
+			p.Method = "bearer"
+		}
+		return &p, nil
+	case string:
+		return &Principal{ID: v, Method: "bearer", Value: v}, nil
+	}
+	return &Principal{Method: "bearer", Value: v}, nil
+}
+
+func (a *BearerAuthenticator) Challenge() string {
+	if a.Realm == "" {
+		return "Bearer"
+	}
+	return `Bearer realm="` + strings.ReplaceAll(a.Realm, `"`, `\"`) + `"`
+}
+
+// BearerAuth returns middleware requiring a bearer token accepted by
+// validate, which returns the identity stored in the request's Principal.
+func BearerAuth(validate func(token string) (any, bool)) HandlerFunc {
+	return BearerAuthForRealm(validate, "")
+}
+
+// BearerAuthForRealm is BearerAuth announcing realm in its challenge.
+func BearerAuthForRealm(validate func(token string) (any, bool), realm string) HandlerFunc {
+	return Auth(&BearerAuthenticator{Realm: realm, Validate: validate})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(c *Context) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Request.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// APIKeyAuthenticator checks an API key sent in a request header.
+type APIKeyAuthenticator struct {
+	// Header carrying the key. Defaults to X-API-Key.
+	Header string
+
+	// Keys maps each valid key to the ID of its owner
+	Keys map[string]string
+
+	// Lookup, if set, resolves keys not found in Keys, for example from a
+	// database. It returns a nil principal or an error for unknown keys.
+	// The principal it returns is copied, so it may be cached and shared.
+	Lookup func(key string) (*Principal, error)
+}
+
+func (a *APIKeyAuthenticator) Authenticate(c *Context) (*Principal, error) {
+	header := a.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+	key := c.Request.Header.Get(header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	owner := ""
+	for k, id := range a.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			owner = id
+		}
+	}
+	if owner != "" {
+		return &Principal{ID: owner, Method: "apikey"}, nil
+	}
+	if a.Lookup != nil {
+		found, err := a.Lookup(key)
+		if err != nil {
+			return nil, err
+		}
+		if found != nil {
+			p := *found
+			if p.Method == "" {
+				p.Method = "apikey"
+			}
+			return &p, nil
+		}
+	}
+	return nil, errors.New("lux: invalid API key")
+}
+
+// APIKeyAuth returns middleware requiring one of the keys, a map from key
+// to owner ID, in the given header (X-API-Key when empty).
+func APIKeyAuth(header string, keys map[string]string) HandlerFunc {
+	return Auth(&APIKeyAuthenticator{Header: header, Keys: keys})
+}
@@ -0,0 +1,245 @@
+package lux
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signHS256(t *testing.T, secret []byte, claims string) string {
+	t.Helper()
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuth(t *testing.T) {
+	secret := []byte("s3cret")
+	engine := NewEngine()
+	engine.Use(Auth(
+		&BasicAuthenticator{Realm: "lux", Accounts: map[string]string{"ann": "pw"}},
+		&JWTAuthenticator{Secret: secret, Issuer: "lux-test"},
+		&APIKeyAuthenticator{Keys: map[string]string{"k1": "svc"}},
+	))
+	engine.Get("/me", func(c *Context) {
+		p := c.Principal()
+		body := p.Method + ":" + p.ID
+		if p.HasRole("admin") {
+			body += ":admin"
+		}
+		c.WriteResponse(body)
+	})
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := signHS256(t, secret, `{"sub":"bob","iss":"lux-test","roles":["admin"],"exp":`+strconv.FormatInt(exp, 10)+`}`)
+	expired := signHS256(t, secret, `{"sub":"bob","iss":"lux-test","exp":1}`)
+	forged := signHS256(t, []byte("other"), `{"sub":"bob","iss":"lux-test"}`)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		code   int
+		body   string
+	}{
+		{"basic", http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("ann:pw"))}}, 200, "basic:ann"},
+		{"basic wrong password", http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("ann:no"))}}, 401, ""},
+		{"jwt", http.Header{"Authorization": {"Bearer " + valid}}, 200, "jwt:bob:admin"},
+		{"jwt expired", http.Header{"Authorization": {"Bearer " + expired}}, 401, ""},
+		{"jwt forged", http.Header{"Authorization": {"Bearer " + forged}}, 401, ""},
+		{"api key", http.Header{"X-Api-Key": {"k1"}}, 200, "apikey:svc"},
+		{"none", nil, 401, ""},
+	}
+	for _, tt := range tests {
+		w := engine.TestRequest(http.MethodGet, "/me", nil, tt.header)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+		if w.Code == 401 && len(w.Header().Values("WWW-Authenticate")) != 2 {
+			t.Errorf("%s: challenges = %q", tt.name, w.Header().Values("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	type user struct{ name string }
+	engine := NewEngine()
+	engine.Use(BearerAuth(func(token string) (any, bool) {
+		return &user{name: "ann"}, token == "t0ken"
+	}))
+	engine.Get("/me", func(c *Context) {
+		c.WriteResponse(c.Principal().Method + ":" + c.Principal().Value.(*user).name)
+	})
+
+	w := engine.TestRequest(http.MethodGet, "/me", nil, http.Header{"Authorization": {"Bearer t0ken"}})
+	if w.Code != 200 || w.Body.String() != "bearer:ann" {
+		t.Errorf("valid token: got %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodGet, "/me", nil, http.Header{"Authorization": {"Bearer nope"}})
+	if w.Code != 401 || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("invalid token: got %d, challenge %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestAuthRealmsAndSharedPrincipal(t *testing.T) {
+	shared := &Principal{ID: "svc", Roles: []string{"read"}}
+	engine := NewEngine()
+	engine.Get("/basic", BasicAuth(map[string]string{"ann": "pw"}), func(c *Context) {})
+	engine.Get("/realm", BasicAuthForRealm(map[string]string{"ann": "pw"}, "admin"), func(c *Context) {})
+	engine.Get("/bearer", BearerAuthForRealm(func(token string) (any, bool) {
+		return shared, token == "t0ken"
+	}, "api"), func(c *Context) {
+		c.WriteResponse(c.Principal().Method)
+	})
+
+	challenges := map[string]string{
+		"/basic":  `Basic realm="Authorization Required"`,
+		"/realm":  `Basic realm="admin"`,
+		"/bearer": `Bearer realm="api"`,
+	}
+	for path, want := range challenges {
+		w := engine.TestRequest(http.MethodGet, path, nil, nil)
+		if w.Code != 401 || w.Header().Get("WWW-Authenticate") != want {
+			t.Errorf("%s: got %d, challenge %q, want %q", path, w.Code, w.Header().Get("WWW-Authenticate"), want)
+		}
+	}
+
+	w := engine.TestRequest(http.MethodGet, "/bearer", nil, http.Header{"Authorization": {"Bearer t0ken"}})
+	if w.Body.String() != "bearer" || shared.Method != "" {
+		t.Errorf("got %q, shared principal Method %q, want it untouched", w.Body.String(), shared.Method)
+	}
+}
+
+func TestAPIKeyLookup(t *testing.T) {
+	engine := NewEngine()
+	engine.Get("/me", Auth(&APIKeyAuthenticator{Lookup: func(key string) (*Principal, error) {
+		if key == "db-key" {
+			return &Principal{ID: "svc"}, nil
+		}
+		return nil, nil
+	}}), func(c *Context) {
+		c.WriteResponse(c.Principal().Method + ":" + c.Principal().ID)
+	})
+
+	w := engine.TestRequest(http.MethodGet, "/me", nil, http.Header{"X-Api-Key": {"db-key"}})
+	if w.Code != 200 || w.Body.String() != "apikey:svc" {
+		t.Errorf("known key: got %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodGet, "/me", nil, http.Header{"X-Api-Key": {"unknown"}})
+	if w.Code != 401 {
+		t.Errorf("unknown key: got %d, want 401", w.Code)
+	}
+}
+
+// signJWT signs claims with alg, using key as the HMAC secret or the
+// private key of the signature.
+func signJWT(t *testing.T, alg string, key any, claims string) string {
+	t.Helper()
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"`+alg+`","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch key := key.(type) {
+	case nil:
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, []byte(signed))
+	}
+	return signed + "." + enc.EncodeToString(sig)
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	const claims = `{"sub":"bob"}`
+
+	tests := []struct {
+		name  string
+		auth  *JWTAuthenticator
+		token string
+		ok    bool
+	}{
+		{"RS256", &JWTAuthenticator{PublicKey: &rsaKey.PublicKey}, signJWT(t, "RS256", rsaKey, claims), true},
+		{"ES256", &JWTAuthenticator{PublicKey: &p256.PublicKey}, signJWT(t, "ES256", p256, claims), true},
+		{"EdDSA", &JWTAuthenticator{PublicKey: edPub}, signJWT(t, "EdDSA", edKey, claims), true},
+		{"RS256 tampered", &JWTAuthenticator{PublicKey: &rsaKey.PublicKey}, signJWT(t, "RS256", rsaKey, claims) + "A", false},
+		{"alg none", &JWTAuthenticator{Secret: []byte("s3cret")}, signJWT(t, "none", nil, claims), false},
+		// A public key must not be used as an HMAC secret
+		{"HS256 to a public key", &JWTAuthenticator{PublicKey: &rsaKey.PublicKey}, signJWT(t, "HS256", []byte("guess"), claims), false},
+		{"HS256 signed with the empty key", &JWTAuthenticator{PublicKey: edPub}, signJWT(t, "HS256", []byte{}, claims), false},
+		{"ES256 on the wrong curve", &JWTAuthenticator{PublicKey: &p256.PublicKey}, signJWT(t, "ES256", p384, claims), false},
+		{"ES256 for a P-384 key", &JWTAuthenticator{PublicKey: &p384.PublicKey}, signJWT(t, "ES256", p384, claims), false},
+		{"RS256 to an ECDSA key", &JWTAuthenticator{PublicKey: &p256.PublicKey}, signJWT(t, "RS256", rsaKey, claims), false},
+	}
+	for _, tt := range tests {
+		engine := NewEngine()
+		engine.Get("/", JWTAuth(tt.auth), func(c *Context) {
+			c.WriteResponse(c.Principal().ID)
+		})
+		w := engine.TestRequest(http.MethodGet, "/", nil, http.Header{"Authorization": {"Bearer " + tt.token}})
+		if ok := w.Code == http.StatusOK && w.Body.String() == "bob"; ok != tt.ok {
+			t.Errorf("%s: got %d %q, want accepted = %v", tt.name, w.Code, w.Body.String(), tt.ok)
+		}
+	}
+}
+
+func TestJWTTimeClaimsOutOfRange(t *testing.T) {
+	secret := []byte("s3cret")
+	engine := NewEngine()
+	engine.Get("/", JWTAuth(&JWTAuthenticator{Secret: secret}), func(c *Context) {})
+
+	// Converted naively to nanoseconds, these wrap around into the past
+	for _, claims := range []string{`{"nbf":1e19}`, `{"nbf":9.3e9}`, `{"exp":-1e19}`, `{"exp":1e300}`} {
+		w := engine.TestRequest(http.MethodGet, "/", nil, http.Header{"Authorization": {"Bearer " + signHS256(t, secret, claims)}})
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", claims, w.Code)
+		}
+	}
+}
+
+func TestJWTAuthRejectsMissingKey(t *testing.T) {
+	for name, a := range map[string]*JWTAuthenticator{
+		"empty Secret": {Secret: []byte(os.Getenv("LUX_TEST_UNSET_SECRET"))},
+		"no key":       {},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: JWTAuth did not panic", name)
+				}
+			}()
+			JWTAuth(a)
+		}()
+	}
+}
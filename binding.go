@@ -0,0 +1,320 @@
+package lux
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShouldBindJSON decodes the JSON request body into obj, which must be a
+// pointer. Fields tagged binding:"required" must be present and non-zero.
+func (c *Context) ShouldBindJSON(obj any) error {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return errEmptyBody
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(obj); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errEmptyBody
+		}
+		return fmt.Errorf("lux: invalid JSON body: %w", err)
+	}
+	return validateRequired(reflect.ValueOf(obj), "")
+}
+
+var errEmptyBody = errors.New("lux: empty request body")
+
+// ShouldBindQuery fills the struct pointed to by obj from the query
+// string. See ShouldBindForm for how fields are matched.
+func (c *Context) ShouldBindQuery(obj any) error {
+	c.initQueryCache()
+	return bindValues(obj, c.queryCache)
+}
+
+// ShouldBindForm fills the struct pointed to by obj from the query string and
+// the urlencoded or multipart form in the body.
+//
+// Fields are matched by their form tag, or else their name, and a tag of
+// "-" skips the field. Struct fields are filled from keys prefixed with
+// their name in dotted or bracketed form, so that both address.city and
+// address[city] set the City field of
+//
+//	Address struct {
+//		City string `form:"city"`
+//	} `form:"address"`
+//
+// Fields of embedded structs are filled as if they belonged to the outer
+// struct. Slices take every value of their key. A field tagged
+// binding:"required" must be present.
+func (c *Context) ShouldBindForm(obj any) error {
+	c.initFormCache()
+	return bindValues(obj, c.Request.Form)
+}
+
+func bindValues(obj any, values url.Values) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("lux: bind target must be a non-nil struct pointer, not %T", obj)
+	}
+
+	form := make(url.Values, len(values))
+	for k, vs := range values {
+		key := normalizeFormKey(k)
+		form[key] = append(form[key], vs...)
+	}
+	return bindStruct(v.Elem(), form, "")
+}
+
+// normalizeFormKey rewrites bracketed keys such as address[city] or
+// tags[] into the dotted form address.city, tags.
+func normalizeFormKey(key string) string {
+	if !strings.Contains(key, "[") {
+		return key
+	}
+	key = strings.ReplaceAll(key, "[]", "")
+	key = strings.ReplaceAll(key, "][", ".")
+	key = strings.ReplaceAll(key, "[", ".")
+	return strings.ReplaceAll(key, "]", "")
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	textUnmarshalType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+func bindStruct(v reflect.Value, form url.Values, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+
+		if f.Anonymous && name == "" && indirectType(f.Type).Kind() == reflect.Struct {
+			if f.Type.Kind() == reflect.Pointer {
+				if !f.IsExported() {
+					continue
+				}
+				if fv.IsNil() {
+					fv.Set(reflect.New(f.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := bindStruct(fv, form, prefix); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if isNestedStruct(f.Type) {
+			if !hasPrefix(form, key+".") {
+				if isRequiredField(f) {
+					return fmt.Errorf("lux: field %s is required", key)
+				}
+				continue
+			}
+			if f.Type.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					fv.Set(reflect.New(f.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := bindStruct(fv, form, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		vals, ok := form[key]
+		if !ok || len(vals) == 0 {
+			if isRequiredField(f) {
+				return fmt.Errorf("lux: field %s is required", key)
+			}
+			continue
+		}
+		if err := setField(fv, f, vals); err != nil {
+			return fmt.Errorf("lux: field %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// validateRequired checks the binding:"required" rules of the structs in
+// v, naming fields as in JSON.
+func validateRequired(v reflect.Value, prefix string) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || v.Type() == timeType {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			if err := validateRequired(v.Field(i), prefix); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if isRequiredField(f) && v.Field(i).IsZero() {
+			return fmt.Errorf("lux: field %s is required", name)
+		}
+		if err := validateRequired(v.Field(i), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// isNestedStruct reports whether values for t come from prefixed keys
+// rather than from a single key.
+func isNestedStruct(t reflect.Type) bool {
+	t = indirectType(t)
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PointerTo(t).Implements(textUnmarshalType)
+}
+
+func hasPrefix(form url.Values, prefix string) bool {
+	for k := range form {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRequiredField reports whether the field carries a binding:"required"
+// rule.
+func isRequiredField(f reflect.StructField) bool {
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func setField(v reflect.Value, f reflect.StructField, vals []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(s.Index(i), f, val); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, f, vals[0])
+}
+
+func setValue(v reflect.Value, f reflect.StructField, val string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		layout := f.Tag.Get("time_format")
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(val))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(orZero(val, "false"))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeFor[time.Duration]() {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(orZero(val, "0"), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(orZero(val, "0"), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(orZero(val, "0"), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// orZero lets empty values such as ?page= bind as the zero value.
+func orZero(val, zero string) string {
+	if val == "" {
+		return zero
+	}
+	return val
+}
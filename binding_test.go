@@ -0,0 +1,140 @@
+package lux
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type bindPaging struct {
+	Page int `form:"page"`
+}
+
+type bindSearch struct {
+	bindPaging
+	Q       string   `form:"q" binding:"required"`
+	Tags    []string `form:"tags"`
+	Address struct {
+		City string `form:"city"`
+		Geo  *struct {
+			Lat float64 `form:"lat"`
+		} `form:"geo"`
+	} `form:"address"`
+}
+
+func TestBindQueryNested(t *testing.T) {
+	engine := NewEngine()
+	var got bindSearch
+	var bindErr error
+	engine.Get("/search", func(c *Context) {
+		got = bindSearch{}
+		bindErr = c.ShouldBindQuery(&got)
+	})
+
+	q := url.Values{
+		"q":               {"lux"},
+		"page":            {"2"},
+		"tags[]":          {"a", "b"},
+		"address[city]":   {"Oslo"},
+		"address.geo.lat": {"59.9"},
+	}
+	engine.TestRequest(http.MethodGet, "/search?"+q.Encode(), nil, nil)
+	if bindErr != nil {
+		t.Fatal(bindErr)
+	}
+	if got.Page != 2 || got.Q != "lux" || !reflect.DeepEqual(got.Tags, []string{"a", "b"}) {
+		t.Errorf("got %+v", got)
+	}
+	if got.Address.City != "Oslo" || got.Address.Geo == nil || got.Address.Geo.Lat != 59.9 {
+		t.Errorf("address = %+v", got.Address)
+	}
+
+	engine.TestRequest(http.MethodGet, "/search?page=1", nil, nil)
+	if bindErr == nil {
+		t.Error("missing required field: want error")
+	}
+}
+
+type bindUser struct {
+	Name  string   `json:"name" form:"name" binding:"required"`
+	Age   int      `json:"age" form:"age"`
+	Roles []string `json:"roles" form:"roles"`
+}
+
+// bindRoute registers a handler that binds with bind and answers 422 on
+// error, recording the result and whether the binding wrote a response.
+func bindRoute(engine *Engine, path string, bind func(*Context, any) error) (got *bindUser, bindErr *error, wrote *bool) {
+	got, bindErr, wrote = new(bindUser), new(error), new(bool)
+	engine.Post(path, func(c *Context) {
+		*got = bindUser{}
+		*bindErr = bind(c, got)
+		*wrote = c.Writer.Written()
+		if *bindErr != nil {
+			c.Writer.Header().Set("Content-Length", "0")
+			c.Writer.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		c.Writer.Header().Set("Content-Length", "2")
+		c.WriteResponse("ok")
+	})
+	return got, bindErr, wrote
+}
+
+func TestShouldBindJSON(t *testing.T) {
+	engine := NewEngine()
+	got, bindErr, wrote := bindRoute(engine, "/users", (*Context).ShouldBindJSON)
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+
+	w := engine.TestRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"ada","age":36,"roles":["admin"]}`), jsonHeader)
+	if *bindErr != nil || w.Code != http.StatusOK {
+		t.Fatalf("valid body: %d, %v", w.Code, *bindErr)
+	}
+	if want := (bindUser{Name: "ada", Age: 36, Roles: []string{"admin"}}); !reflect.DeepEqual(*got, want) {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	for name, body := range map[string]string{
+		"empty body":       ``,
+		"malformed":        `{"name":`,
+		"wrong type":       `{"name":"ada","age":"old"}`,
+		"missing required": `{"age":36}`,
+	} {
+		w := engine.TestRequest(http.MethodPost, "/users", strings.NewReader(body), jsonHeader)
+		if *bindErr == nil {
+			t.Errorf("%s: no error", name)
+		}
+		if *wrote || w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: binding wrote a response (status %d)", name, w.Code)
+		}
+	}
+}
+
+func TestShouldBindForm(t *testing.T) {
+	engine := NewEngine()
+	got, bindErr, wrote := bindRoute(engine, "/users", (*Context).ShouldBindForm)
+	formHeader := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+
+	body := url.Values{"name": {"ada"}, "roles": {"admin", "dev"}}.Encode()
+	w := engine.TestRequest(http.MethodPost, "/users?age=36", strings.NewReader(body), formHeader)
+	if *bindErr != nil || w.Code != http.StatusOK {
+		t.Fatalf("valid form: %d, %v", w.Code, *bindErr)
+	}
+	if want := (bindUser{Name: "ada", Age: 36, Roles: []string{"admin", "dev"}}); !reflect.DeepEqual(*got, want) {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	for name, body := range map[string]string{
+		"missing required": "age=36",
+		"wrong type":       "name=ada&age=old",
+	} {
+		w := engine.TestRequest(http.MethodPost, "/users", strings.NewReader(body), formHeader)
+		if *bindErr == nil {
+			t.Errorf("%s: no error", name)
+		}
+		if *wrote || w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: binding wrote a response (status %d)", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package lux
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// SetTrustedProxies sets the addresses or CIDR ranges of the proxies whose
+// X-Forwarded-For and X-Real-IP headers ClientIP believes. It updates
+// Config.TrustedProxies and is safe to call while serving.
+func (e *Engine) SetTrustedProxies(proxies []string) error {
+	return e.UpdateConfig(func(cfg *Config) {
+		cfg.TrustedProxies = append([]string(nil), proxies...)
+	})
+}
+
+// ClientIP returns the address of the client that sent the request. When
+// the connection comes from a trusted proxy, the client is the last
+// address in X-Forwarded-For not belonging to a trusted proxy, or else
+// the one in X-Real-IP. Forwarding headers from anyone else are ignored,
+// since clients can set them to anything.
+func (c *Context) ClientIP() string {
+	remote := remoteIP(c.Request.RemoteAddr)
+	proxies := c.engine.config().trustedProxies
+	if !remote.IsValid() || !isTrusted(proxies, remote) {
+		return ipString(remote, c.Request.RemoteAddr)
+	}
+
+	// Proxies append to X-Forwarded-For, so the entries are read from the
+	// right, where the trusted ones are
+	if xff := c.Request.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			ip = ip.Unmap()
+			if i == 0 || !isTrusted(proxies, ip) {
+				return ip.String()
+			}
+		}
+	}
+	if ip, err := netip.ParseAddr(strings.TrimSpace(c.Request.Header.Get("X-Real-IP"))); err == nil {
+		return ip.Unmap().String()
+	}
+	return remote.String()
+}
+
+// remoteIP parses the host of a host:port address.
+func remoteIP(addr string) netip.Addr {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
+
+func ipString(ip netip.Addr, addr string) string {
+	if ip.IsValid() {
+		return ip.String()
+	}
+	return addr
+}
+
+func isTrusted(proxies []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range proxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package lux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	engine := NewEngine()
+	if err := engine.SetTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32"}); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	engine.Get("/", func(c *Context) {
+		got = c.ClientIP()
+	})
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{"no headers", "203.0.113.5:1234", nil, "", "203.0.113.5"},
+		{"untrusted peer spoofing X-Forwarded-For", "203.0.113.5:1234", []string{"198.51.100.7"}, "", "203.0.113.5"},
+		{"untrusted peer spoofing X-Real-IP", "203.0.113.5:1234", nil, "198.51.100.7", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:80", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"chain read from the right", "10.0.0.1:80", []string{"198.51.100.7, 203.0.113.9, 10.0.0.2"}, "", "203.0.113.9"},
+		{"spoofed leftmost entry", "10.0.0.1:80", []string{"6.6.6.6, 198.51.100.7"}, "", "198.51.100.7"},
+		{"repeated headers", "10.0.0.1:80", []string{"198.51.100.7", "10.0.0.2"}, "", "198.51.100.7"},
+		{"only trusted hops", "10.0.0.1:80", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"X-Real-IP", "10.0.0.1:80", nil, " 198.51.100.8 ", "198.51.100.8"},
+		{"malformed entry", "10.0.0.1:80", []string{"198.51.100.7, not-an-ip"}, "", "10.0.0.1"},
+		{"malformed entry falls back to X-Real-IP", "10.0.0.1:80", []string{"198.51.100.7, not-an-ip"}, "198.51.100.8", "198.51.100.8"},
+		{"entry with a port", "10.0.0.1:80", []string{"198.51.100.7:5555"}, "", "10.0.0.1"},
+		{"malformed X-Real-IP", "10.0.0.1:80", nil, "198.51.100", "10.0.0.1"},
+		{"IPv6 peer with port", "[2606:4700::1]:443", []string{"198.51.100.7"}, "", "2606:4700::1"},
+		{"trusted IPv6 proxy", "[2001:db8::1]:443", []string{"2606:4700::2, 2001:db8::2"}, "", "2606:4700::2"},
+		{"IPv4-mapped trusted proxy", "[::ffff:10.0.0.1]:80", []string{"::ffff:198.51.100.7"}, "", "198.51.100.7"},
+		{"unparseable remote address", "pipe", []string{"198.51.100.7"}, "", "pipe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			req.Header["X-Forwarded-For"] = tt.xff
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			got = ""
+			engine.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
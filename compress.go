@@ -0,0 +1,295 @@
+package lux
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressEncoder is a compressing writer that can be reused through
+// Reset, as gzip.Writer and flate.Writer can.
+type CompressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// CompressOptions tunes the Compress middleware.
+type CompressOptions struct {
+	// Level is the gzip and deflate compression level. Defaults to
+	// gzip.DefaultCompression.
+	Level int
+
+	// MinLength is the smallest body that is compressed; shorter ones
+	// are not worth the encoding overhead. Defaults to 1KB. Bodies the
+	// handler flushes are compressed regardless.
+	MinLength int
+
+	// Encoders adds content codings by name, such as "br" backed by a
+	// brotli package, or replaces the built-in "gzip" and "deflate".
+	// Added codings are preferred over the built-in ones when the client
+	// accepts them equally.
+	Encoders map[string]func(w io.Writer) CompressEncoder
+}
+
+// Compress returns middleware that compresses response bodies with the
+// best content coding the client's Accept-Encoding allows, gzip and
+// deflate built in. Content types that are compressed already, such as
+// images and archives, short bodies and responses that set their own
+// Content-Encoding are sent as they are. Compressed responses lose their
+// Content-Length, which the engine then works out from the compressed body
+// or replaces with chunked encoding.
+func Compress(opts ...CompressOptions) HandlerFunc {
+	var o CompressOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Level == 0 {
+		o.Level = gzip.DefaultCompression
+	}
+	if o.MinLength <= 0 {
+		o.MinLength = 1 << 10
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, o.Level); err != nil {
+		panic("lux: Compress: " + err.Error())
+	}
+
+	encoders := map[string]func(w io.Writer) CompressEncoder{
+		"gzip": func(w io.Writer) CompressEncoder {
+			enc, _ := gzip.NewWriterLevel(w, o.Level)
+			return enc
+		},
+		"deflate": func(w io.Writer) CompressEncoder {
+			enc, _ := flate.NewWriter(w, o.Level)
+			return enc
+		},
+	}
+	var preferred []string
+	for name, newEncoder := range o.Encoders {
+		if _, builtin := encoders[name]; !builtin {
+			preferred = append(preferred, name)
+		}
+		encoders[name] = newEncoder
+	}
+	slices.Sort(preferred)
+	preferred = append(preferred, "gzip", "deflate")
+
+	pools := make(map[string]*sync.Pool, len(encoders))
+	for name, newEncoder := range encoders {
+		pools[name] = &sync.Pool{New: func() any { return newEncoder(io.Discard) }}
+	}
+
+	return func(c *Context) {
+		if c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		coding := negotiateEncoding(c.Request.Header.Get("Accept-Encoding"), preferred)
+		if coding == "" {
+			c.Next()
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: c.Writer, coding: coding, pool: pools[coding], minLength: o.MinLength}
+		c.Writer = cw
+		defer func() {
+			c.Writer = cw.ResponseWriter
+		}()
+		c.Next()
+		cw.close()
+	}
+}
+
+// negotiateEncoding returns the coding of preferred with the highest
+// quality in the Accept-Encoding header, earlier ones winning ties, or ""
+// if the client accepts none of them.
+func negotiateEncoding(header string, preferred []string) string {
+	if header == "" {
+		return ""
+	}
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		quality[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range preferred {
+		q, ok := quality[name]
+		if !ok {
+			q = quality["*"]
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether a body of the given content type is worth
+// compressing.
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "font/woff"):
+		return false
+	}
+	switch mediaType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/pdf":
+		return false
+	}
+	return true
+}
+
+// compressWriter holds back the start of the body until it knows whether
+// to compress it, then either encodes everything or passes it through.
+type compressWriter struct {
+	ResponseWriter
+	coding    string
+	pool      *sync.Pool
+	minLength int
+
+	buf     []byte
+	wrote   bool
+	decided bool
+	enc     CompressEncoder
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	w.wrote = true
+}
+
+func (w *compressWriter) Written() bool {
+	return w.wrote || w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.wrote = true
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.minLength {
+			return len(data), nil
+		}
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// decide picks compression or pass-through from the headers and the
+// buffered start of the body, which it then writes. Compression needs a
+// body of at least minLength unless forced, as for flushed responses.
+func (w *compressWriter) decide(force bool) error {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if bodyAllowed(w.Status()) && w.Status() != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+		if force || len(w.buf) >= w.minLength {
+			h.Set("Content-Encoding", w.coding)
+			h.Del("Content-Length")
+			h.Del("Accept-Ranges")
+			w.enc = w.pool.Get().(CompressEncoder)
+			w.enc.Reset(w.ResponseWriter)
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+		return err
+	}
+	if w.wrote {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// close completes the body once the handler chain has returned.
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.enc != nil {
+		w.enc.Close()
+		w.enc.Reset(io.Discard)
+		w.pool.Put(w.enc)
+		w.enc = nil
+	}
+}
+
+func (w *compressWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError sends what was written so far, compressed if the response is.
+func (w *compressWriter) FlushError() error {
+	w.wrote = true
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !w.decided {
+		w.decided = true
+		if w.wrote {
+			w.ResponseWriter.WriteHeaderNow()
+		}
+		if len(w.buf) > 0 {
+			if _, err := w.ResponseWriter.Write(w.buf); err != nil {
+				return nil, nil, err
+			}
+			w.buf = nil
+		}
+	}
+	return w.ResponseWriter.Hijack()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,44 @@
+package lux
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	engine := NewEngine()
+	engine.Use(Compress())
+	body := strings.Repeat("compress me ", 200)
+	engine.Get("/text", func(c *Context) {
+		c.WriteResponse(body)
+	})
+	engine.Get("/short", func(c *Context) {
+		c.WriteResponse("short")
+	})
+
+	gzipped := http.Header{"Accept-Encoding": {"deflate;q=0.5, gzip"}}
+	w := engine.TestRequest(http.MethodGet, "/text", nil, gzipped)
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("GET /text: Content-Encoding %q, Vary %q", w.Header().Get("Content-Encoding"), w.Header().Get("Vary"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != body {
+		t.Errorf("GET /text: decompressed %d bytes, want %d", len(got), len(body))
+	}
+
+	w = engine.TestRequest(http.MethodGet, "/short", nil, gzipped)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "short" {
+		t.Errorf("GET /short = %q, Content-Encoding %q", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+
+	w = engine.TestRequest(http.MethodGet, "/text", nil, http.Header{"Accept-Encoding": {"br, gzip;q=0"}})
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Errorf("GET /text without an accepted coding: Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+}
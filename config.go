@@ -0,0 +1,269 @@
+package lux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds the settings that can be changed while the engine is
+// serving. Every request reads one consistent snapshot, so an update never
+// applies half way through a request.
+type Config struct {
+	// TrustedProxies lists the addresses or CIDR ranges of proxies whose
+	// forwarding headers are believed
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+
+	// ReadHeaderTimeout bounds reading the request line and headers of
+	// the first request on a connection, ReadTimeout reading the body once
+	// the headers are in, WriteTimeout writing the response and
+	// IdleTimeout the wait for the next request, headers included, on a
+	// kept alive connection. Each phase gets the full timeout. Zero means
+	// 30 seconds; ReadHeaderTimeout and IdleTimeout default to
+	// ReadTimeout. A negative value disables the timeout, for instance
+	// WriteTimeout for servers of long-lived streams; single handlers can
+	// extend their deadlines with http.ResponseController instead.
+	ReadHeaderTimeout Duration `json:"read_header_timeout,omitempty"`
+	ReadTimeout       Duration `json:"read_timeout,omitempty"`
+	WriteTimeout      Duration `json:"write_timeout,omitempty"`
+	IdleTimeout       Duration `json:"idle_timeout,omitempty"`
+
+	// MaxBodyBytes limits request bodies; larger ones answer 413. Zero
+	// means no limit.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+
+	// Maintenance answers every request with 503 Service Unavailable
+	Maintenance bool `json:"maintenance,omitempty"`
+
+	// LogLevel drops log output below the level
+	LogLevel LogLevel `json:"log_level,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" in
+// configuration files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LogLevel is the minimum severity that is logged.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelError
+)
+
+var logLevelNames = []string{"debug", "info", "error"}
+
+func (l LogLevel) MarshalText() ([]byte, error) {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return nil, fmt.Errorf("lux: invalid log level %d", l)
+	}
+	return []byte(logLevelNames[l]), nil
+}
+
+func (l *LogLevel) UnmarshalText(b []byte) error {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(string(b), name) {
+			*l = LogLevel(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("lux: unknown log level %q", b)
+}
+
+// defaultTimeout applies to unset timeouts
+const defaultTimeout = 30 * time.Second
+
+// runtimeConfig is an applied Config with its values resolved.
+type runtimeConfig struct {
+	Config
+	trustedProxies []netip.Prefix
+
+	// Resolved timeouts, zero when disabled
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+}
+
+var defaultConfig = mustResolveConfig(Config{})
+
+func mustResolveConfig(cfg Config) *runtimeConfig {
+	rc, err := resolveConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return rc
+}
+
+// resolveConfig validates cfg and fills in defaults.
+func resolveConfig(cfg Config) (*runtimeConfig, error) {
+	rc := &runtimeConfig{Config: cfg}
+	for _, s := range cfg.TrustedProxies {
+		p, err := parsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("lux: trusted proxy %q: %w", s, err)
+		}
+		rc.trustedProxies = append(rc.trustedProxies, p)
+	}
+	if cfg.MaxBodyBytes < 0 {
+		return nil, fmt.Errorf("lux: negative body limit")
+	}
+	rc.readTimeout = orDefault(time.Duration(cfg.ReadTimeout), defaultTimeout)
+	rc.writeTimeout = orDefault(time.Duration(cfg.WriteTimeout), defaultTimeout)
+	rc.readHeaderTimeout = orDefault(time.Duration(cfg.ReadHeaderTimeout), rc.readTimeout)
+	rc.idleTimeout = orDefault(time.Duration(cfg.IdleTimeout), rc.readTimeout)
+	return rc, nil
+}
+
+// parsePrefix parses a CIDR range or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// orDefault resolves a configured timeout: zero takes def and a negative
+// value, disabling the timeout, becomes zero.
+func orDefault(d, def time.Duration) time.Duration {
+	switch {
+	case d == 0:
+		return def
+	case d < 0:
+		return 0
+	}
+	return d
+}
+
+// deadline returns the deadline for a timeout starting now, or the zero
+// time, meaning none, for a disabled timeout.
+func deadline(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// config returns the current configuration snapshot.
+func (e *Engine) config() *runtimeConfig {
+	if rc := e.cfg.Load(); rc != nil {
+		return rc
+	}
+	return defaultConfig
+}
+
+// Config returns a copy of the current configuration.
+func (e *Engine) Config() Config {
+	cfg := e.config().Config
+	cfg.TrustedProxies = append([]string(nil), cfg.TrustedProxies...)
+	return cfg
+}
+
+// ApplyConfig validates cfg and makes it the configuration of all
+// requests that start from now on. It is safe to call while serving.
+func (e *Engine) ApplyConfig(cfg Config) error {
+	rc, err := resolveConfig(cfg)
+	if err != nil {
+		return err
+	}
+	e.cfg.Store(rc)
+	return nil
+}
+
+// UpdateConfig applies a modified copy of the current configuration, for
+// example to enter maintenance mode:
+//
+//	engine.UpdateConfig(func(c *lux.Config) { c.Maintenance = true })
+//
+// Concurrent updates are not merged; the last one wins.
+func (e *Engine) UpdateConfig(update func(*Config)) error {
+	cfg := e.Config()
+	update(&cfg)
+	return e.ApplyConfig(cfg)
+}
+
+// LoadConfigFile reads a Config from a JSON file.
+func LoadConfigFile(path string) (Config, error) {
+	var cfg Config
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("lux: config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// WatchConfigFile applies the JSON configuration file at path, then checks
+// it every interval and applies it again whenever it changes, until ctx
+// ends. An invalid file fails the initial load; later errors are logged
+// and leave the running configuration in place.
+func (e *Engine) WatchConfigFile(ctx context.Context, path string, interval time.Duration) error {
+	modTime, err := e.applyConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			if modTime, err = e.applyConfigFile(path); err != nil {
+				e.logger().Error("config reload failed", "path", path, "error", err)
+				continue
+			}
+			e.logger().Info("config reloaded", "path", path)
+		}
+	}()
+	return nil
+}
+
+// applyConfigFile loads and applies the file at path and returns the
+// modification time it had.
+func (e *Engine) applyConfigFile(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		return info.ModTime(), err
+	}
+	return info.ModTime(), e.ApplyConfig(cfg)
+}
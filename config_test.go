@@ -0,0 +1,134 @@
+package lux
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	engine := NewEngine()
+	called := 0
+	engine.Get("/", func(c *Context) {
+		called++
+		c.WriteResponse("ok")
+	})
+
+	if err := engine.UpdateConfig(func(c *Config) { c.Maintenance = true }); err != nil {
+		t.Fatal(err)
+	}
+	w := engine.TestRequest(http.MethodGet, "/", nil, nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" || w.Body.Len() != 0 {
+		t.Errorf("maintenance: status %d, Retry-After %q, body %q", w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+	if called != 0 {
+		t.Error("handler ran in maintenance mode")
+	}
+
+	if err := engine.UpdateConfig(func(c *Config) { c.Maintenance = false }); err != nil {
+		t.Fatal(err)
+	}
+	if w := engine.TestRequest(http.MethodGet, "/", nil, nil); w.Code != http.StatusOK || called != 1 {
+		t.Errorf("after maintenance: status %d, handler calls %d", w.Code, called)
+	}
+}
+
+// writeConfig replaces the configuration file at path with one that has
+// the given modification time, so that a watcher sees a change even on
+// file systems with coarse timestamps, and never a half written file.
+func writeConfig(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	logger := &testLogger{}
+	engine := NewEngine()
+	engine.Logger = logger
+	engine.Post("/upload", func(c *Context) {
+		if _, err := c.GetRawData(); err != nil {
+			return
+		}
+		c.WriteResponse("ok")
+	})
+	addr := serveLoopback(t, engine, nil)
+
+	path := filepath.Join(t.TempDir(), "lux.json")
+	start := time.Now().Add(-time.Hour)
+	writeConfig(t, path, `{"max_body_bytes": 1024}`, start)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.WatchConfigFile(ctx, path, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func() int {
+		t.Helper()
+		resp, err := http.Post("http://"+addr+"/upload", "text/plain", strings.NewReader(strings.Repeat("x", 100)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := upload(); code != http.StatusOK {
+		t.Fatalf("upload within the initial limit = %d", code)
+	}
+
+	// A reload lowers the limit for the requests that follow
+	writeConfig(t, path, `{"max_body_bytes": 10}`, start.Add(time.Minute))
+	waitFor(t, func() bool { return engine.Config().MaxBodyBytes == 10 })
+	if code := upload(); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload over the reloaded limit = %d, want 413", code)
+	}
+
+	// A malformed file is logged and leaves the running configuration
+	writeConfig(t, path, `{"max_body_bytes": `, start.Add(2*time.Minute))
+	waitFor(t, func() bool { return len(logger.errors()) > 0 })
+	if got := engine.Config().MaxBodyBytes; got != 10 {
+		t.Errorf("MaxBodyBytes = %d after a malformed reload, want 10", got)
+	}
+	if code := upload(); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload after a malformed reload = %d, want 413", code)
+	}
+	if errs := logger.errors(); !strings.Contains(errs[0], "config reload failed") {
+		t.Errorf("logged %q", errs)
+	}
+}
+
+func TestWatchConfigFileRejectsInvalidFile(t *testing.T) {
+	engine := NewEngine()
+	path := filepath.Join(t.TempDir(), "lux.json")
+	writeConfig(t, path, `{"max_body_bytes": -1}`, time.Now())
+	if err := engine.WatchConfigFile(context.Background(), path, time.Hour); err == nil {
+		t.Fatal("WatchConfigFile accepted a negative body limit")
+	}
+	if got := engine.Config().MaxBodyBytes; got != 0 {
+		t.Errorf("MaxBodyBytes = %d after a failed load", got)
+	}
+}
+
+// waitFor polls cond until it holds or a few seconds have passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
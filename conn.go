@@ -0,0 +1,49 @@
+package lux
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+)
+
+// Hijack takes over the client connection, for protocols that continue
+// after HTTP such as raw TCP upgrades and tunnels. Anything written so far,
+// typically a 101 Switching Protocols or 200 response, is flushed first.
+// The returned reader may hold bytes the client already sent. lux neither
+// closes the connection nor reads from it afterwards, and its deadlines
+// are cleared.
+func (c *Context) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return c.Writer.Hijack()
+}
+
+// Conn returns the connection the request arrived on, for instance to
+// inspect its addresses. Reading from or writing to it directly corrupts
+// the HTTP stream; use Hijack to take it over. Conn is nil for requests
+// served through Engine.ServeHTTP.
+func (c *Context) Conn() net.Conn {
+	return c.writermem.conn
+}
+
+// TLS returns the TLS state of the connection the request arrived on, with
+// the negotiated version, cipher suite and any client certificates, or nil
+// for plaintext connections. Request.TLS carries the same state.
+func (c *Context) TLS() *tls.ConnectionState {
+	return c.Request.TLS
+}
+
+// connectionState returns the TLS state of conn, unwrapping connections
+// that embed a *tls.Conn, or nil for plaintext connections.
+func connectionState(conn net.Conn) *tls.ConnectionState {
+	for conn != nil {
+		switch cc := conn.(type) {
+		case *tls.Conn:
+			state := cc.ConnectionState()
+			return &state
+		case interface{ NetConn() net.Conn }:
+			conn = cc.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package lux
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serveLoopback runs engine on a loopback listener and returns its address.
+func serveLoopback(t *testing.T, engine *Engine, wrap func(net.Listener) net.Listener) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if wrap != nil {
+		ln = wrap(ln)
+	}
+	go engine.RunListener(ln)
+	t.Cleanup(func() { engine.Shutdown(context.Background()) })
+	return addr
+}
+
+func TestHijack(t *testing.T) {
+	engine := NewEngine()
+	conns := make(chan net.Conn, 2)
+	engine.Get("/upgrade", func(c *Context) {
+		conns <- c.Conn()
+		c.Writer.Header().Set("Upgrade", "echo")
+		c.Writer.Header().Set("Connection", "Upgrade")
+		c.Writer.WriteHeader(http.StatusSwitchingProtocols)
+		c.Writer.WriteHeaderNow()
+		conn, rw, err := c.Hijack()
+		if err != nil {
+			t.Errorf("Hijack = %v", err)
+			return
+		}
+		if _, _, err := c.Hijack(); err == nil {
+			t.Error("second Hijack succeeded")
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				line, err := rw.ReadString('\n')
+				if err != nil {
+					return
+				}
+				rw.WriteString("echo: " + line)
+				rw.Flush()
+			}
+		}()
+	})
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	own := serveLoopback(t, engine, nil)
+	for _, addr := range []string{own, srv.Listener.Addr().String()} {
+		raw, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer raw.Close()
+		raw.SetDeadline(time.Now().Add(5 * time.Second))
+
+		// Bytes sent along with the request reach the hijacker
+		fmt.Fprintf(raw, "GET /upgrade HTTP/1.1\r\nHost: %s\r\n\r\nearly\n", addr)
+		br := bufio.NewReader(raw)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "echo" {
+			t.Errorf("%s: response = %d, Upgrade %q", addr, resp.StatusCode, resp.Header.Get("Upgrade"))
+		}
+		for _, msg := range []string{"early", "late"} {
+			if msg == "late" {
+				fmt.Fprintf(raw, "%s\n", msg)
+			}
+			if line, err := br.ReadString('\n'); err != nil || line != "echo: "+msg+"\n" {
+				t.Errorf("%s: got %q, %v", addr, line, err)
+			}
+		}
+	}
+
+	// Conn is the accepted connection when lux serves it, nil under
+	// another server
+	if conn := <-conns; conn == nil || conn.LocalAddr().String() != own {
+		t.Errorf("Conn = %v on the engine's own listener", conn)
+	}
+	if conn := <-conns; conn != nil {
+		t.Errorf("Conn = %v through ServeHTTP, want nil", conn)
+	}
+	// Hijacked connections are no longer tracked
+	deadline := time.Now().Add(2 * time.Second)
+	for engine.Stats().Open != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := engine.Stats().Open; n != 0 {
+		t.Errorf("Open = %d after hijacking, want 0", n)
+	}
+}
+
+// testCertificate writes a self-signed certificate for 127.0.0.1 and its
+// key to PEM files and returns their paths and a pool trusting it.
+func testCertificate(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "lux test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	leaf, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(leaf)
+	return certFile, keyFile, pool
+}
+
+func TestRunTLS(t *testing.T) {
+	certFile, keyFile, pool := testCertificate(t)
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine()
+	engine.TLSConfig = &tls.Config{ClientAuth: tls.RequestClientCert}
+	engine.Get("/", func(c *Context) {
+		state := c.TLS()
+		if state == nil {
+			c.WriteResponse("plaintext")
+			return
+		}
+		if state != c.Request.TLS {
+			t.Error("TLS differs from Request.TLS")
+		}
+		peer := ""
+		if len(state.PeerCertificates) > 0 {
+			peer = state.PeerCertificates[0].Subject.CommonName
+		}
+		c.WriteResponse(fmt.Sprintf("%s %s %s", tls.VersionName(state.Version), state.NegotiatedProtocol, peer))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	errc := make(chan error, 1)
+	go func() { errc <- engine.RunTLS(addr, certFile, keyFile) }()
+	defer engine.Shutdown(context.Background())
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientCert},
+		// The engine answers over HTTP/1.1 even to clients preferring h2
+		NextProtos: []string{"h2", "http/1.1"},
+	}}}
+	var resp *http.Response
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		resp, err = client.Get("https://" + addr + "/")
+		if err == nil {
+			break
+		}
+		select {
+		case err := <-errc:
+			t.Fatal(err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := "TLS 1.3 http/1.1 lux test"; string(body) != want {
+		t.Errorf("GET / over TLS = %q, want %q", body, want)
+	}
+
+	// Clients that fail the handshake are dropped
+	raw, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(raw, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", addr)
+	raw.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := http.ReadResponse(bufio.NewReader(raw), nil); err == nil {
+		t.Error("plaintext request to the TLS port was answered over HTTP")
+	}
+	raw.Close()
+
+	if w := engine.TestRequest(http.MethodGet, "/", nil, nil); w.Body.String() != "plaintext" {
+		t.Errorf("TLS on a plaintext request = %q, want nil", w.Body.String())
+	}
+}
+
+// closedWithin reports how long the server took to close conn, failing
+// the test if it does not within limit.
+func closedWithin(t *testing.T, conn net.Conn, limit time.Duration) time.Duration {
+	t.Helper()
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(limit))
+	_, err := io.Copy(io.Discard, conn)
+	if err != nil {
+		t.Fatalf("connection still open after %v: %v", limit, err)
+	}
+	return time.Since(start)
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	engine := NewEngine()
+	engine.Logger = &testLogger{}
+	engine.Get("/", func(c *Context) { c.WriteResponse("ok") })
+	err := engine.ApplyConfig(Config{
+		ReadHeaderTimeout: Duration(100 * time.Millisecond),
+		ReadTimeout:       Duration(10 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveLoopback(t, engine, nil)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The request line and a header, but never the blank line ending them
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n", addr)
+	if d := closedWithin(t, conn, 5*time.Second); d < 50*time.Millisecond {
+		t.Errorf("stalled client disconnected after %v, before ReadHeaderTimeout", d)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	engine := NewEngine()
+	engine.Logger = &testLogger{}
+	engine.Get("/", func(c *Context) {
+		c.Writer.Header().Set("Content-Length", "2")
+		c.WriteResponse("ok")
+	})
+	err := engine.ApplyConfig(Config{
+		ReadHeaderTimeout: Duration(10 * time.Second),
+		IdleTimeout:       Duration(100 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveLoopback(t, engine, nil)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", addr)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.Close {
+		t.Fatal("connection not kept alive")
+	}
+	// The kept alive connection waits IdleTimeout, not ReadHeaderTimeout,
+	// for the next request
+	if d := closedWithin(t, conn, 5*time.Second); d < 50*time.Millisecond {
+		t.Errorf("idle connection closed after %v", d)
+	}
+}
+
+func TestUnreadBodyDrain(t *testing.T) {
+	engine := NewEngine()
+	engine.MaxBodyDrain = 1024
+	engine.Post("/ignore", func(c *Context) {
+		c.Writer.Header().Set("Content-Length", "2")
+		c.WriteResponse("ok")
+	})
+	addr := serveLoopback(t, engine, nil)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+	post := func(size int) *http.Response {
+		t.Helper()
+		fmt.Fprintf(conn, "POST /ignore HTTP/1.1\r\nHost: %s\r\nContent-Length: %d\r\n\r\n%s",
+			addr, size, make([]byte, size))
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	// A small leftover is discarded and the connection serves on
+	for i := 0; i < 2; i++ {
+		if resp := post(100); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d = %d", i, resp.StatusCode)
+		}
+	}
+
+	// A body over MaxBodyDrain is dropped with the connection
+	post(2000)
+	if _, err := br.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after an undrained body = %v, want the connection closed", err)
+	}
+}
+
+func TestShutdownOnDrain(t *testing.T) {
+	engine := NewEngine()
+	progress := make(chan DrainProgress, 64)
+	engine.OnDrain = func(p DrainProgress) {
+		select {
+		case progress <- p:
+		default:
+		}
+	}
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	engine.Get("/slow", func(c *Context) {
+		close(entered)
+		<-release
+		c.WriteResponse("done")
+	})
+	addr := serveLoopback(t, engine, nil)
+
+	resp := make(chan error, 1)
+	go func() {
+		r, err := http.Get("http://" + addr + "/slow")
+		if err == nil {
+			r.Body.Close()
+		}
+		resp <- err
+	}()
+	<-entered
+
+	done := make(chan error, 1)
+	go func() { done <- engine.Shutdown(context.Background()) }()
+	if p := <-progress; p.InFlight != 1 {
+		t.Errorf("progress while a request runs = %+v, want 1 in flight", p)
+	}
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-resp; err != nil {
+		t.Errorf("request during Shutdown: %v", err)
+	}
+	var last DrainProgress
+	for len(progress) > 0 {
+		last = <-progress
+	}
+	if last.InFlight != 0 || last.Open != 0 || last.Elapsed <= 0 {
+		t.Errorf("final progress = %+v, want drained", last)
+	}
+}
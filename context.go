@@ -2,10 +2,14 @@ package lux
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 const abortIndex int8 = math.MaxInt8 >> 1
@@ -15,18 +19,26 @@ type Context struct {
 	Request   *http.Request
 	Writer    ResponseWriter
 
-	handlers     HandlerChain
-	Params       Params
-	index        int8
-	fullPath     string
-	engine       *Engine
-	params       *Params
-	skippedNodes *[]skippedNode
-	mu           sync.RWMutex
+	handlers HandlerChain
+	Params   Params
+	index    int8
+	fullPath string
+	label    string
+	engine   *Engine
+	params   *Params
+	mu       sync.RWMutex
+	done     chan struct{} // signals the end of a worker pool run
 
 	Keys       map[string]any
 	queryCache url.Values
 	formCache  url.Values
+
+	trace  TraceContext
+	traced bool
+
+	principal   *Principal
+	uploadHooks []func(UploadProgress) error
+	sameSite    http.SameSite
 }
 
 func (c *Context) reset() {
@@ -36,10 +48,15 @@ func (c *Context) reset() {
 	c.index = -1
 
 	c.fullPath = ""
+	c.label = ""
 	c.Keys = nil
 	c.queryCache = nil
 	c.formCache = nil
-	c.params = nil
+	c.traced = false
+	c.principal = nil
+	c.uploadHooks = c.uploadHooks[:0]
+	c.sameSite = 0
+	*c.params = (*c.params)[:0]
 }
 
 func (c *Context) Next() {
@@ -67,7 +84,7 @@ func (c *Context) AddParam(key, value string) {
 }
 
 func (c *Context) WriteResponse(s string) {
-	c.writermem.Write([]byte(s))
+	c.Writer.Write([]byte(s))
 }
 
 func (c *Context) WriteNotFound() {
@@ -89,7 +106,21 @@ func (c *Context) Handler() HandlerFunc {
 
 func (c *Context) FullPath() string { return c.fullPath }
 
-func (c *Context) Set(key string, value string) {
+// RouteLabel returns the label of the matched route for use in logs and
+// metrics: the label set with WithLabel, or else the route pattern such as
+// /users/:id, which unlike the request path has a bounded set of values.
+// It is empty if no route matched.
+func (c *Context) RouteLabel() string {
+	if c.label != "" {
+		return c.label
+	}
+	return c.fullPath
+}
+
+// Set stores a value in c.Keys for the rest of the request, so middleware
+// can hand values such as the authenticated user or a database handle to
+// later handlers. It is safe for concurrent use.
+func (c *Context) Set(key string, value any) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.Keys == nil {
@@ -98,6 +129,7 @@ func (c *Context) Set(key string, value string) {
 	c.Keys[key] = value
 }
 
+// Get returns the value stored for key and whether it exists.
 func (c *Context) Get(key string) (value any, exists bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -105,10 +137,62 @@ func (c *Context) Get(key string) (value any, exists bool) {
 	return value, exists
 }
 
+// MustGet returns the value stored for key and panics when there is none,
+// for values that middleware earlier in the chain is known to set.
+func (c *Context) MustGet(key string) any {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic("lux: key " + strconv.Quote(key) + " does not exist")
+}
+
+// GetString returns the value stored for key if it is a string, or "".
+// The other typed getters likewise return the zero value when the key is
+// missing or holds a value of another type.
 func (c *Context) GetString(key string) (s string) {
 	return getTyped[string](c, key)
 }
 
+// GetBool returns the value stored for key if it is a bool.
+func (c *Context) GetBool(key string) bool {
+	return getTyped[bool](c, key)
+}
+
+// GetInt returns the value stored for key if it is an int.
+func (c *Context) GetInt(key string) int {
+	return getTyped[int](c, key)
+}
+
+// GetInt64 returns the value stored for key if it is an int64.
+func (c *Context) GetInt64(key string) int64 {
+	return getTyped[int64](c, key)
+}
+
+// GetFloat64 returns the value stored for key if it is a float64.
+func (c *Context) GetFloat64(key string) float64 {
+	return getTyped[float64](c, key)
+}
+
+// GetTime returns the value stored for key if it is a time.Time.
+func (c *Context) GetTime(key string) time.Time {
+	return getTyped[time.Time](c, key)
+}
+
+// GetDuration returns the value stored for key if it is a time.Duration.
+func (c *Context) GetDuration(key string) time.Duration {
+	return getTyped[time.Duration](c, key)
+}
+
+// GetStringSlice returns the value stored for key if it is a []string.
+func (c *Context) GetStringSlice(key string) []string {
+	return getTyped[[]string](c, key)
+}
+
+// GetStringMap returns the value stored for key if it is a map[string]any.
+func (c *Context) GetStringMap(key string) map[string]any {
+	return getTyped[map[string]any](c, key)
+}
+
 func getTyped[T any](c *Context, key string) (res T) {
 	if val, ok := c.Get(key); ok && val != nil {
 		res, _ = val.(T)
@@ -131,7 +215,9 @@ func (c *Context) initQueryCache() {
 	}
 }
 
-func (c *Context) GetQuery(key string) (string, interface{}) {
+// GetQuery is like Query but also reports whether the key is present in
+// the query string, even with an empty value.
+func (c *Context) GetQuery(key string) (string, bool) {
 	if values, ok := c.GetQueryArray(key); ok {
 		return values[0], ok
 	}
@@ -144,6 +230,91 @@ func (c *Context) GetQueryArray(key string) (values []string, ok bool) {
 	return
 }
 
+// DefaultQuery returns the query value for key when it is present,
+// otherwise defaultValue.
+func (c *Context) DefaultQuery(key, defaultValue string) string {
+	if value, ok := c.GetQuery(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// ErrMissingQuery is returned by the GetQuery getters of typed values when
+// the key is not in the query string.
+var ErrMissingQuery = errors.New("lux: missing query parameter")
+
+// GetQueryInt returns the query value for key as an int. It fails with
+// ErrMissingQuery when the key is absent, or with the strconv error when
+// the value is not an integer.
+func (c *Context) GetQueryInt(key string) (int, error) {
+	return parseQuery(c, key, strconv.Atoi)
+}
+
+// GetQueryInt64 is like GetQueryInt for int64 values.
+func (c *Context) GetQueryInt64(key string) (int64, error) {
+	return parseQuery(c, key, func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) })
+}
+
+// GetQueryBool is like GetQueryInt for the boolean values accepted by
+// strconv.ParseBool, such as 1, t, true, 0, f and false.
+func (c *Context) GetQueryBool(key string) (bool, error) {
+	return parseQuery(c, key, strconv.ParseBool)
+}
+
+// QueryInt returns the query value for key as an int, or defaultValue when
+// it is absent or not an integer:
+//
+//	page := c.QueryInt("page", 1)
+func (c *Context) QueryInt(key string, defaultValue int) int {
+	if n, err := c.GetQueryInt(key); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+// QueryInt64 is like QueryInt for int64 values.
+func (c *Context) QueryInt64(key string, defaultValue int64) int64 {
+	if n, err := c.GetQueryInt64(key); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+// QueryBool is like QueryInt for boolean values, see GetQueryBool.
+func (c *Context) QueryBool(key string, defaultValue bool) bool {
+	if b, err := c.GetQueryBool(key); err == nil {
+		return b
+	}
+	return defaultValue
+}
+
+func parseQuery[T any](c *Context, key string, parse func(string) (T, error)) (T, error) {
+	value, ok := c.GetQuery(key)
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w %q", ErrMissingQuery, key)
+	}
+	v, err := parse(value)
+	if err != nil {
+		return v, fmt.Errorf("lux: query parameter %q: %w", key, err)
+	}
+	return v, nil
+}
+
+// QueryMap returns the query values written as key[name]=value, keyed by
+// name. For ?ids[a]=1&ids[b]=2, QueryMap("ids") returns {"a": "1", "b": "2"}.
+func (c *Context) QueryMap(key string) map[string]string {
+	dict, _ := c.GetQueryMap(key)
+	return dict
+}
+
+// GetQueryMap is like QueryMap but also reports whether at least one value
+// exists for key.
+func (c *Context) GetQueryMap(key string) (map[string]string, bool) {
+	c.initQueryCache()
+	return valuesMap(c.queryCache, key)
+}
+
 // PostForm returns the specified key from a POST urlencoded form or multipart form
 // when it exists, otherwise it returns an empty string `("")`.
 func (c *Context) PostForm(key string) (value string) {
@@ -187,9 +358,9 @@ func (c *Context) initFormCache() {
 	if c.formCache == nil {
 		c.formCache = make(url.Values)
 		req := c.Request
-		if err := req.ParseMultipartForm(c.engine.MaxMultipartMemory); err != nil {
+		if err := c.parseMultipart(); err != nil {
 			if !errors.Is(err, http.ErrNotMultipart) {
-				debugPrint("error on parse multipart form array: %v", err)
+				c.engine.logger().Debug("error on parse multipart form array", "error", err)
 			}
 		}
 		c.formCache = req.PostForm
@@ -203,3 +374,32 @@ func (c *Context) GetPostFormArray(key string) (values []string, ok bool) {
 	values, ok = c.formCache[key]
 	return
 }
+
+// PostFormMap returns the form values written as key[name]=value, keyed by
+// name, like QueryMap.
+func (c *Context) PostFormMap(key string) map[string]string {
+	dict, _ := c.GetPostFormMap(key)
+	return dict
+}
+
+// GetPostFormMap is like PostFormMap but also reports whether at least one
+// value exists for key.
+func (c *Context) GetPostFormMap(key string) (map[string]string, bool) {
+	c.initFormCache()
+	return valuesMap(c.formCache, key)
+}
+
+// valuesMap collects the first values of the keys of the form key[name].
+func valuesMap(values url.Values, key string) (map[string]string, bool) {
+	dict := make(map[string]string)
+	found := false
+	for k, v := range values {
+		name, ok := strings.CutPrefix(k, key+"[")
+		if !ok || len(name) < 2 || !strings.HasSuffix(name, "]") {
+			continue
+		}
+		dict[name[:len(name)-1]] = v[0]
+		found = true
+	}
+	return dict, found
+}
@@ -0,0 +1,195 @@
+package lux
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueryGetters(t *testing.T) {
+	engine := NewEngine()
+	called := false
+	engine.Get("/items", func(c *Context) {
+		called = true
+		if got := c.QueryInt("page", 1); got != 3 {
+			t.Errorf("QueryInt(page) = %d", got)
+		}
+		if got := c.QueryInt("size", 20); got != 20 {
+			t.Errorf("QueryInt(size) = %d, want default", got)
+		}
+		if got := c.QueryInt64("bad", 7); got != 7 {
+			t.Errorf("QueryInt64(bad) = %d, want default", got)
+		}
+		if _, err := c.GetQueryInt("bad"); err == nil {
+			t.Error("GetQueryInt(bad): want error")
+		}
+		if _, err := c.GetQueryInt("size"); !errors.Is(err, ErrMissingQuery) {
+			t.Errorf("GetQueryInt(size) = %v, want ErrMissingQuery", err)
+		}
+		if !c.QueryBool("all", false) {
+			t.Error("QueryBool(all) = false")
+		}
+		if got := c.DefaultQuery("sort", "name"); got != "name" {
+			t.Errorf("DefaultQuery(sort) = %q", got)
+		}
+		if got := c.QueryMap("ids"); !reflect.DeepEqual(got, map[string]string{"a": "1", "b": "2"}) {
+			t.Errorf("QueryMap(ids) = %v", got)
+		}
+	})
+	engine.TestRequest(http.MethodGet, "/items?page=3&bad=x&all=true&ids[a]=1&ids[b]=2&idsx=3", nil, nil)
+	if !called {
+		t.Fatal("handler not called")
+	}
+}
+
+func TestKeysGetters(t *testing.T) {
+	c := &Context{}
+	c.Set("n", 42)
+	c.Set("d", 3*time.Second)
+	c.Set("tags", []string{"a"})
+	if c.GetInt("n") != 42 || c.GetDuration("d") != 3*time.Second || len(c.GetStringSlice("tags")) != 1 {
+		t.Errorf("Keys = %v", c.Keys)
+	}
+	if c.GetString("n") != "" || c.GetInt64("n") != 0 {
+		t.Error("getter of another type: want zero value")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("MustGet(missing): want panic")
+		}
+	}()
+	c.MustGet("missing")
+}
+
+func TestStreamSSEvent(t *testing.T) {
+	engine := NewEngine()
+	engine.Get("/events", func(c *Context) {
+		n := 0
+		c.Stream(func(w io.Writer) bool {
+			n++
+			c.SSEvent("count", map[string]int{"n": n})
+			return n < 2
+		})
+	})
+	w := engine.TestRequest(http.MethodGet, "/events", nil, nil)
+	want := "event: count\ndata: {\"n\":1}\n\nevent: count\ndata: {\"n\":2}\n\n"
+	if w.Body.String() != want || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("GET /events = %q (%s)", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+}
+
+func TestStreamSSEventEncodeError(t *testing.T) {
+	engine := NewEngine()
+	logs := &testLogger{}
+	engine.Logger = logs
+	engine.Get("/events", func(c *Context) {
+		c.SSEvent("bad", make(chan int))
+	})
+	w := engine.TestRequest(http.MethodGet, "/events", nil, nil)
+	if w.Code != http.StatusInternalServerError || w.Body.Len() != 0 {
+		t.Errorf("GET /events = %d %q, want 500", w.Code, w.Body.String())
+	}
+	if len(logs.errors()) != 1 {
+		t.Errorf("logged errors = %q, want one", logs.errors())
+	}
+}
+
+// testLogger records the error messages logged through it.
+type testLogger struct {
+	mu   sync.Mutex
+	errs []string
+}
+
+func (l *testLogger) Debug(msg string, args ...any) {}
+func (l *testLogger) Info(msg string, args ...any)  {}
+
+func (l *testLogger) Error(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs = append(l.errs, msg+formatArgs(args))
+}
+
+func (l *testLogger) errors() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.errs...)
+}
+
+func TestRawDataDoubleRelease(t *testing.T) {
+	engine := NewEngine()
+	var held *RawData
+	engine.Post("/raw", func(c *Context) {
+		d, err := c.GetRawDataPooled()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held == nil {
+			d.Release()
+			d.Release()
+			if d.Bytes() != nil {
+				t.Error("Bytes after Release: want nil")
+			}
+			return
+		}
+		if string(d.Bytes()) != c.Query("want") {
+			t.Errorf("body = %q", d.Bytes())
+		}
+	})
+	engine.TestRequest(http.MethodPost, "/raw", strings.NewReader("first"), nil)
+
+	// The two requests after the double release must not share storage
+	engine.Post("/hold", func(c *Context) {
+		held, _ = c.GetRawDataPooled()
+	})
+	engine.TestRequest(http.MethodPost, "/hold", strings.NewReader("held"), nil)
+	engine.TestRequest(http.MethodPost, "/raw?want=other", strings.NewReader("other"), nil)
+	if string(held.Bytes()) != "held" {
+		t.Errorf("held body = %q, overwritten by a later request", held.Bytes())
+	}
+}
+
+func TestCookies(t *testing.T) {
+	engine := NewEngine()
+	engine.Get("/set", func(c *Context) {
+		c.SetCookie("session", "a b;c", 3600, "", "example.com", true, true)
+		c.SetSameSite(http.SameSiteStrictMode)
+		c.SetCookie("pref", "dark", 0, "/app", "", false, false)
+		c.SetCookie("old", "", -1, "/", "", false, false)
+		// Invalid names are skipped
+		c.SetCookie("bad name", "x", 0, "/", "", false, false)
+	})
+	engine.Get("/get", func(c *Context) {
+		v, err := c.Cookie("session")
+		if err != nil || v != "a b;c" {
+			t.Errorf("Cookie(session) = %q, %v", v, err)
+		}
+		if _, err := c.Cookie("missing"); !errors.Is(err, http.ErrNoCookie) {
+			t.Errorf("Cookie(missing) = %v, want http.ErrNoCookie", err)
+		}
+	})
+
+	w := engine.TestRequest(http.MethodGet, "/set", nil, nil)
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	if len(cookies) != 3 {
+		t.Fatalf("Set-Cookie = %q, want 3 cookies", w.Header().Values("Set-Cookie"))
+	}
+	session, pref, old := cookies[0], cookies[1], cookies[2]
+	if session.Path != "/" || session.Domain != "example.com" || session.MaxAge != 3600 ||
+		!session.Secure || !session.HttpOnly || session.SameSite != 0 {
+		t.Errorf("session cookie = %s", session)
+	}
+	if pref.Path != "/app" || pref.MaxAge != 0 || pref.Secure || pref.SameSite != http.SameSiteStrictMode {
+		t.Errorf("pref cookie = %s", pref)
+	}
+	if old.MaxAge >= 0 {
+		t.Errorf("deleted cookie = %s, want Max-Age=0", old)
+	}
+
+	// The escaped value reads back unchanged
+	engine.TestRequest(http.MethodGet, "/get", nil, http.Header{"Cookie": {"session=" + session.Value}})
+}
@@ -0,0 +1,44 @@
+package lux
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Cookie returns the unescaped value of the named request cookie, or
+// http.ErrNoCookie if there is none.
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// SetSameSite sets the SameSite attribute of the cookies that SetCookie
+// adds for the rest of the request.
+func (c *Context) SetSameSite(mode http.SameSite) {
+	c.sameSite = mode
+}
+
+// SetCookie adds a Set-Cookie header to the response. value is escaped, so
+// Cookie returns it unchanged. A maxAge of zero leaves Max-Age unset and a
+// negative one deletes the cookie. An empty path means "/".
+func (c *Context) SetCookie(name, value string, maxAge int, path, domain string, secure, httpOnly bool) {
+	if path == "" {
+		path = "/"
+	}
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    url.QueryEscape(value),
+		MaxAge:   maxAge,
+		Path:     path,
+		Domain:   domain,
+		SameSite: c.sameSite,
+		Secure:   secure,
+		HttpOnly: httpOnly,
+	}
+	if v := cookie.String(); v != "" {
+		c.Writer.Header().Add("Set-Cookie", v)
+	}
+}
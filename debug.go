@@ -1,7 +1,6 @@
 package lux
 
 import (
-	"fmt"
 	"io"
 	"os"
 )
@@ -18,8 +17,3 @@ var DefaultWriter io.Writer = os.Stdout
 
 // DefaultErrorWriter is the default io.Writer used by Gin to debug errors
 var DefaultErrorWriter io.Writer = os.Stderr
-
-func debugPrint(format string, values ...any) {
-
-	fmt.Fprintf(DefaultWriter, "[LUX-debug] "+format, values...)
-}
@@ -2,24 +2,118 @@ package lux
 
 import (
 	"bufio"
-	"fmt"
+	"crypto/tls"
+	"html/template"
 	"io"
 	"net"
 	"net/http"
-	"os"
+	"net/url"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
+
+	"github.com/edgflow/lux/internal/reuseport"
+	"github.com/edgflow/lux/internal/sockopt"
 )
 
 type Engine struct {
 	RouterGroup
-	pool               sync.Pool
-	trees              methodTrees
+	pool      sync.Pool
+	trees     methodTrees
+	maxParams uint16
+
+	// MaxMultipartMemory is how many bytes of uploaded files MultipartForm
+	// keeps in memory; the rest are stored in temporary files. NewEngine
+	// sets it to 32MB, like net/http.
 	MaxMultipartMemory int64
-	maxParams          uint16
-	maxSections        uint16
+
+	// SocketOptions are applied to every accepted connection
+	SocketOptions SocketOptions
+
+	// MaxRequestBodySize limits request bodies, which handlers read as
+	// they arrive from the connection: a larger Content-Length is answered
+	// with 413 before the handler runs, and reading a chunked body past the
+	// limit fails with *http.MaxBytesError. It applies on top of
+	// Config.MaxBodyBytes, the smaller limit winning. Zero means no limit.
+	MaxRequestBodySize int64
+
+	// MaxBodyDrain is how many bytes of a request body the handler left
+	// unread are discarded so that the connection can serve the next
+	// request; bodies with more left over close the connection instead.
+	// Zero means 256KB and a negative value disables draining.
+	MaxBodyDrain int64
+
+	// ResponseBufferSize is how many bytes of a response body are held
+	// back so that it can be sent with a Content-Length. Larger bodies, and
+	// any body once the handler flushes, are sent with chunked encoding.
+	// Zero means 4KB and a negative value streams every body.
+	ResponseBufferSize int
+
+	// ServerHeader, if set, is sent as the Server header of responses that
+	// don't set one
+	ServerHeader string
+
+	// RedirectTrailingSlash redirects requests that match no route, but
+	// would with a trailing slash added or removed, to the path of the
+	// route: /users/ to /users and /dir to /dir/. GET and HEAD get 301,
+	// other methods 308 so that the client repeats them with their body.
+	// Without it such requests are served by that route, unless
+	// StrictTrailingSlash is set. Wildcard routes take trailing slashes as
+	// part of their parameter.
+	RedirectTrailingSlash bool
+
+	// StrictTrailingSlash answers 404 to requests that match a route only
+	// with a trailing slash added or removed, instead of serving them
+	StrictTrailingSlash bool
+
+	// RemoveExtraSlash matches routes against the cleaned request path,
+	// with repeated slashes collapsed and dot segments resolved, so that
+	// /users//42 and /files/../users/42 reach /users/:id
+	RemoveExtraSlash bool
+
+	// FileOffload, if set, delegates Context.File to a fronting proxy
+	FileOffload *FileOffload
+
+	// TLSConfig is the base TLS configuration of RunTLS
+	TLSConfig *tls.Config
+
+	// Logger receives the engine's internal log output. Defaults to DefaultLogger.
+	Logger Logger
+
+	// ConnState, if set, is called whenever a connection changes state,
+	// as with http.Server.ConnState
+	ConnState func(net.Conn, http.ConnState)
+
+	// OnDrain, if set, is called periodically during Shutdown with the
+	// connections and requests that are still open
+	OnDrain func(DrainProgress)
+
+	noRoute     HandlerChain
+	noMethod    HandlerChain
+	allNoRoute  HandlerChain // noRoute behind the global middleware
+	allNoMethod HandlerChain
+
+	cfg        atomic.Pointer[runtimeConfig]
+	workers    *workerPool
+	lastRoutes []*Node // endpoints added by the latest registration call
+	tracker    connTracker
+	htmlSets   map[string]*HTMLSet
+	htmlReload bool
+	htmlDelims [2]string
+	htmlFuncs  template.FuncMap
 }
 
+// SocketOptions tunes the TCP sockets accepted by the engine. The zero value
+// keeps Go's defaults: keep-alive probes every 15 seconds and TCP_NODELAY set.
+// It is the same type as ws.SocketOptions, so one value can configure both.
+type SocketOptions = sockopt.Options
+
+// defaultMultipartMemory is the MaxMultipartMemory set by NewEngine
+const defaultMultipartMemory = 32 << 20
+
 func NewEngine() *Engine {
 	engine := &Engine{
 		RouterGroup: RouterGroup{
@@ -27,7 +121,8 @@ func NewEngine() *Engine {
 			BasePath: "/",
 			root:     true,
 		},
-		trees: make(methodTrees, 0, 9),
+		trees:              make(methodTrees, 0, 9),
+		MaxMultipartMemory: defaultMultipartMemory,
 	}
 	engine.pool.New = func() any {
 		return engine.allocateContext(engine.maxParams)
@@ -38,8 +133,7 @@ func NewEngine() *Engine {
 
 func (engine *Engine) allocateContext(maxParams uint16) *Context {
 	v := make(Params, 0, maxParams)
-	skippedNodes := make([]skippedNode, 0, engine.maxSections)
-	return &Context{engine: engine, params: &v, skippedNodes: &skippedNodes}
+	return &Context{engine: engine, params: &v, done: make(chan struct{}, 1)}
 }
 
 func (e *Engine) addRoute(method string, path string, handlers []HandlerFunc) {
@@ -52,7 +146,12 @@ func (e *Engine) addRoute(method string, path string, handlers []HandlerFunc) {
 			Root:   root,
 		})
 	}
-	root.addRoute(path, handlers)
+	e.lastRoutes = append(e.lastRoutes, root.addRoute(path, handlers))
+
+	// Contexts preallocate room for the longest parameter list
+	if n := countParams(path); n > e.maxParams {
+		e.maxParams = n
+	}
 }
 
 func (e *Engine) Routes() (routes RoutesInfo) {
@@ -66,11 +165,19 @@ func iterate(path, method string, routes RoutesInfo, root *Node) RoutesInfo {
 	path += root.Path
 	if len(root.Handlers) > 0 {
 		handlerFunc := root.Handlers.Last()
+		middleware := make([]string, 0, len(root.Handlers)-1)
+		for _, h := range root.Handlers[:len(root.Handlers)-1] {
+			middleware = append(middleware, nameOfFunction(h))
+		}
 		routes = append(routes, RouteInfo{
 			Method:      method,
 			Path:        path,
 			Handler:     nameOfFunction(handlerFunc),
 			HandlerFunc: handlerFunc,
+			Group:       root.Group,
+			Middleware:  middleware,
+			Label:       root.Label,
+			Meta:        root.Meta,
 		})
 	}
 	for _, child := range root.Children {
@@ -79,52 +186,304 @@ func iterate(path, method string, routes RoutesInfo, root *Node) RoutesInfo {
 	return routes
 }
 
-func (e *Engine) Run(add string) (err error) {
-	l, err := net.Listen("tcp", add)
+// Run listens on the TCP address addr and serves HTTP connections until
+// Shutdown, when it returns http.ErrServerClosed, or until listening or
+// accepting fails, when it returns that error.
+func (e *Engine) Run(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return e.serve(l)
+}
+
+// RunTLS is like Run but serves HTTPS with the certificate and key in the
+// given PEM files, on top of TLSConfig if set.
+func (e *Engine) RunTLS(addr, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
-		fmt.Println("Faild to bind address", add)
-		os.Exit(1)
+		return err
 	}
+	cfg := &tls.Config{}
+	if e.TLSConfig != nil {
+		cfg = e.TLSConfig.Clone()
+	}
+	cfg.Certificates = append(cfg.Certificates, cert)
+	if len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = []string{"http/1.1"}
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return e.RunListener(tls.NewListener(l, cfg))
+}
+
+// RunListener serves connections accepted from l, such as a socket passed
+// in by systemd or an in-memory listener in tests. Listeners created by
+// tls.NewListener serve HTTPS. It returns http.ErrServerClosed after
+// Shutdown, and otherwise the error that stopped l.
+func (e *Engine) RunListener(l net.Listener) error {
+	return e.serve(l)
+}
+
+// RunReusePort opens n listeners on addr with SO_REUSEPORT and runs one
+// accept loop per listener, so the kernel spreads new connections across
+// them instead of every goroutine contending for one accept queue. n <= 0
+// uses one listener per CPU. It is only supported on Linux and returns the
+// first accept error, once all the accept loops have stopped.
+func (e *Engine) RunReusePort(addr string, n int) error {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := reuseport.Listen(addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	errc := make(chan error, n)
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errc <- e.serve(l)
+		}(l)
+	}
+	err := <-errc
+	for _, l := range listeners {
+		l.Close()
+	}
+	// Wait for the other loops, so nothing is served once this returns
+	for i := 1; i < n; i++ {
+		<-errc
+	}
+	return err
+}
+
+// serve accepts connections on l until it fails and serves each of them on
+// its own goroutine. It returns http.ErrServerClosed after Shutdown.
+func (e *Engine) serve(l net.Listener) error {
+	if !e.trackListener(l, true) {
+		l.Close()
+		return http.ErrServerClosed
+	}
+	defer e.trackListener(l, false)
 
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			fmt.Println("Filed to bind port 4221")
-			os.Exit(1)
+			if e.tracker.shuttingDown.Load() {
+				return http.ErrServerClosed
+			}
+			return err
 		}
 		go e.handleConn(conn)
 	}
 }
 
-// Use in your handleConn function
+// Readers and writers are recycled across requests and connections
+var (
+	bufioReaderPool sync.Pool
+	bufioWriterPool sync.Pool
+)
+
+func newBufioReader(r io.Reader) *bufio.Reader {
+	if v := bufioReaderPool.Get(); v != nil {
+		br := v.(*bufio.Reader)
+		br.Reset(r)
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+func putBufioReader(br *bufio.Reader) {
+	br.Reset(nil)
+	bufioReaderPool.Put(br)
+}
+
+func newBufioWriter(w io.Writer) *bufio.Writer {
+	if v := bufioWriterPool.Get(); v != nil {
+		bw := v.(*bufio.Writer)
+		bw.Reset(w)
+		return bw
+	}
+	return bufio.NewWriter(w)
+}
+
+func putBufioWriter(bw *bufio.Writer) {
+	bw.Reset(nil)
+	bufioWriterPool.Put(bw)
+}
+
+// handleConn serves requests on conn until the client or a response ends
+// the connection. The buffered reader and writer live as long as the
+// connection and go back to their pools afterwards.
 func (e *Engine) handleConn(conn net.Conn) {
-	defer conn.Close()
-	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if !e.SocketOptions.IsZero() {
+		if err := sockopt.Apply(conn, e.SocketOptions); err != nil {
+			e.logger().Debug("error setting socket options", "error", err)
+		}
+	}
 
-	reader := bufio.NewReader(conn)
+	e.setConnState(conn, http.StateNew)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// The handshake normally runs on the first read; doing it up front
+		// makes the state available to every request
+		tlsConn.SetDeadline(deadline(e.config().readHeaderTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			e.logger().Debug("tls handshake error", "remote", conn.RemoteAddr().String(), "error", err)
+			e.setConnState(conn, http.StateClosed)
+			conn.Close()
+			return
+		}
+	}
+	tlsState := connectionState(conn)
+	reader := newBufioReader(conn)
+	writer := newBufioWriter(conn)
 
-	req, err := http.ReadRequest(reader)
-	if err != nil {
-		if err != io.EOF {
-			fmt.Println("error read Request ", err)
+	hijacked := false
+	defer func() {
+		// A hijacked connection and its buffers belong to the handler
+		if hijacked {
+			e.setConnState(conn, http.StateHijacked)
+			return
+		}
+		e.setConnState(conn, http.StateClosed)
+		conn.Close()
+		putBufioReader(reader)
+		putBufioWriter(writer)
+	}()
+
+	for first := true; ; first = false {
+		if !first {
+			e.setConnState(conn, http.StateIdle)
+		}
+		if e.tracker.shuttingDown.Load() {
+			return
+		}
+		cfg := e.config()
+		if first {
+			conn.SetReadDeadline(deadline(cfg.readHeaderTimeout))
+		} else {
+			conn.SetReadDeadline(deadline(cfg.idleTimeout))
+		}
+
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if err != io.EOF && !e.tracker.shuttingDown.Load() {
+				e.logger().Debug("error reading request", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+			return
+		}
+		req.RemoteAddr = conn.RemoteAddr().String()
+		req.TLS = tlsState
+		e.setConnState(conn, http.StateActive)
+		conn.SetReadDeadline(deadline(cfg.readTimeout))
+		conn.SetWriteDeadline(deadline(cfg.writeTimeout))
+
+		ctx := e.pool.Get().(*Context)
+		ctx.writermem.reset(conn, reader, writer)
+		ctx.writermem.prepare(req, e.responseBufferSize(), e.ServerHeader)
+		ctx.Request = req
+		ctx.reset()
+		e.serveRequest(ctx)
+		ctx.removeMultipartFiles(req)
+
+		hijacked = ctx.writermem.hijacked
+		keepAlive := !hijacked && ctx.writermem.finish(req, e.maxBodyDrain())
+		e.pool.Put(ctx)
+		if !keepAlive {
+			return
 		}
-		return
 	}
+}
+
+// ServeHTTP makes the engine an http.Handler, so that it can be mounted
+// in a net/http server, wrapped by standard middleware or driven by
+// httptest. The server then owns the connection: Config timeouts, socket
+// options and connection tracking do not apply, and Context.Conn is nil.
+func (e *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c := e.pool.Get().(*Context)
+	c.writermem.resetHTTP(w)
+	c.Request = req
+	c.reset()
+	e.serveRequest(c)
+	c.removeMultipartFiles(req)
+	if !c.writermem.hijacked {
+		c.writermem.WriteHeaderNow()
+	}
+	c.writermem.ResponseWriter = nil
+	e.pool.Put(c)
+}
 
-	// Create a response writer using the connection
-	writer := NewResponseWriter(conn, req)
+// defaultMaxBodyDrain is the MaxBodyDrain used when it is zero
+const defaultMaxBodyDrain = 256 << 10
 
-	ctx := e.pool.Get().(*Context)
-	ctx.writermem.reset(writer, conn)
-	ctx.Request = req
-	ctx.reset()
-	e.handleHttpRequest(ctx)
-	e.pool.Put(ctx)
+func (e *Engine) maxBodyDrain() int64 {
+	switch {
+	case e.MaxBodyDrain == 0:
+		return defaultMaxBodyDrain
+	case e.MaxBodyDrain < 0:
+		return 0
+	}
+	return e.MaxBodyDrain
+}
+
+// maxBodyBytes returns the smaller of MaxRequestBodySize and the
+// configured MaxBodyBytes, ignoring unset ones.
+func (e *Engine) maxBodyBytes(cfg *runtimeConfig) int64 {
+	max := cfg.MaxBodyBytes
+	if n := e.MaxRequestBodySize; n > 0 && (max == 0 || n < max) {
+		max = n
+	}
+	return max
+}
+
+// defaultResponseBufferSize is the ResponseBufferSize used when it is zero
+const defaultResponseBufferSize = 4 << 10
+
+func (e *Engine) responseBufferSize() int {
+	switch {
+	case e.ResponseBufferSize == 0:
+		return defaultResponseBufferSize
+	case e.ResponseBufferSize < 0:
+		return 0
+	}
+	return e.ResponseBufferSize
 }
+
 func (e *Engine) handleHttpRequest(c *Context) {
+	cfg := e.config()
+	if cfg.Maintenance {
+		c.Writer.Header().Set("Retry-After", "120")
+		c.Writer.Header().Set("Content-Length", "0")
+		c.writermem.WriteHeader(http.StatusServiceUnavailable)
+		c.Abort()
+		return
+	}
+	if max := e.maxBodyBytes(cfg); max > 0 {
+		if c.Request.ContentLength > max {
+			c.Writer.Header().Set("Connection", "close")
+			c.Writer.Header().Set("Content-Length", "0")
+			c.writermem.WriteHeader(http.StatusRequestEntityTooLarge)
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+	}
+
 	httpMehod := c.Request.Method
 	rPath := c.Request.URL.Path
+	if e.RemoveExtraSlash {
+		rPath = cleanPath(rPath)
+	}
 	t := e.trees
 
 	//find root of tree
@@ -132,15 +491,126 @@ func (e *Engine) handleHttpRequest(c *Context) {
 		if t[i].Method != httpMehod {
 			continue
 		}
-		//root:=t[i].Root
-		handler, params := t[i].Find(rPath)
-		if handler != nil {
-			c.handlers = handler
-			c.Params = params
+		route := t[i].Root.getValue(strings.TrimPrefix(rPath, "/"), c.params)
+		if route == nil && (e.RedirectTrailingSlash || !e.StrictTrailingSlash) && httpMehod != http.MethodConnect && rPath != "/" {
+			target := toggleTrailingSlash(rPath)
+			route = t[i].Root.getValue(strings.TrimPrefix(target, "/"), c.params)
+			if route != nil && e.RedirectTrailingSlash {
+				*c.params = (*c.params)[:0]
+				redirectTrailingSlash(c, target)
+				return
+			}
+		}
+		if route != nil {
+			c.handlers = route.Handlers
+			c.fullPath = route.FullPath
+			c.label = route.Label
+			c.Params = *c.params
 			c.Next()
 			return
 		}
 	}
 
-	c.Abort()
+	if allow := e.allowedMethods(rPath, httpMehod, c.params); allow != "" {
+		c.Writer.Header().Set("Allow", allow)
+		serveError(c, http.StatusMethodNotAllowed, e.allNoMethod, "405 method not allowed")
+		return
+	}
+	serveError(c, http.StatusNotFound, e.allNoRoute, "404 page not found")
+}
+
+// allowedMethods lists, for an Allow header, the methods other than method
+// that have a route matching path.
+func (e *Engine) allowedMethods(path, method string, params *Params) string {
+	var allow []string
+	for _, tree := range e.trees {
+		if tree.Method == method {
+			continue
+		}
+		*params = (*params)[:0]
+		if tree.Root.getValue(strings.TrimPrefix(path, "/"), params) != nil {
+			allow = append(allow, tree.Method)
+		}
+	}
+	*params = (*params)[:0]
+	return strings.Join(allow, ", ")
+}
+
+// toggleTrailingSlash removes the trailing slash of p, or adds one.
+func toggleTrailingSlash(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return p[:len(p)-1]
+	}
+	return p + "/"
+}
+
+// redirectTrailingSlash redirects the request to target, keeping the
+// query string.
+func redirectTrailingSlash(c *Context, target string) {
+	// A leading // would make the Location protocol-relative, pointing to
+	// another host
+	target = "/" + strings.TrimLeft(target, "/")
+	u := url.URL{Path: target, RawQuery: c.Request.URL.RawQuery}
+
+	code := http.StatusPermanentRedirect
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	c.Redirect(code, u.RequestURI())
+}
+
+// cleanPath resolves dot segments and collapses repeated slashes in p,
+// keeping a trailing slash.
+func cleanPath(p string) string {
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// serveError runs handlers for a request that matched no route, with code
+// as the response status. If they write nothing, defaultBody is sent.
+func serveError(c *Context, code int, handlers HandlerChain, defaultBody string) {
+	c.handlers = handlers
+	c.writermem.WriteHeader(code)
+	c.Next()
+	if c.writermem.Written() || c.writermem.Status() != code {
+		return
+	}
+	h := c.Writer.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	h.Set("Content-Length", strconv.Itoa(len(defaultBody)))
+	c.Writer.WriteString(defaultBody)
+}
+
+// NoRoute sets the handlers for requests that match no route. They run
+// behind the global middleware with the status already set to 404; if
+// they write nothing a plain "404 page not found" body is sent.
+func (e *Engine) NoRoute(handlers ...HandlerFunc) {
+	e.noRoute = handlers
+	e.rebuildErrorHandlers()
+}
+
+// NoMethod sets the handlers for requests whose path only has routes for
+// other methods. They run like those of NoRoute, with status 405 and the
+// Allow header listing the methods the path supports.
+func (e *Engine) NoMethod(handlers ...HandlerFunc) {
+	e.noMethod = handlers
+	e.rebuildErrorHandlers()
+}
+
+// Use adds global middleware. Unlike group middleware it also applies to
+// the NoRoute and NoMethod handlers.
+func (e *Engine) Use(middleware ...HandlerFunc) IRoutes {
+	e.RouterGroup.Use(middleware...)
+	e.rebuildErrorHandlers()
+	return e
+}
+
+func (e *Engine) rebuildErrorHandlers() {
+	e.allNoRoute = e.combineHandlers(e.noRoute)
+	e.allNoMethod = e.combineHandlers(e.noMethod)
 }
@@ -0,0 +1,530 @@
+package lux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/edgflow/lux/internal/reuseport"
+)
+
+func TestEngineTestRequest(t *testing.T) {
+	engine := NewEngine()
+	engine.Use(func(c *Context) {
+		c.Writer.Header().Set("X-Middleware", "yes")
+		c.Next()
+	})
+	engine.Get("/users/:id", func(c *Context) {
+		body := "user " + c.Param("id")
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		c.WriteResponse(body)
+	})
+	engine.Post("/echo", func(c *Context) {
+		data, _ := io.ReadAll(c.Request.Body)
+		c.Writer.Header().Set("Content-Type", c.Request.Header.Get("Content-Type"))
+		c.Writer.Write(data)
+	})
+
+	w := engine.TestRequest(http.MethodGet, "/users/42", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "user 42" {
+		t.Errorf("GET /users/42 = %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Middleware"); got != "yes" {
+		t.Errorf("middleware header = %q", got)
+	}
+
+	headers := http.Header{"Content-Type": {"text/plain"}}
+	w = engine.TestRequest(http.MethodPost, "/echo", strings.NewReader("ping"), headers)
+	if w.Body.String() != "ping" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("POST /echo = %q (%s)", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+
+	w = engine.TestRequest(http.MethodGet, "/missing", nil, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /missing = %d, want 404", w.Code)
+	}
+}
+
+func TestEngineServeHTTP(t *testing.T) {
+	engine := NewEngine()
+	engine.Get("/users/:id", func(c *Context) {
+		c.Writer.Header().Set("X-User", c.Param("id"))
+		c.Writer.WriteHeader(http.StatusAccepted)
+		c.WriteResponse("ok")
+	})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "ok" || w.Header().Get("X-User") != "7" {
+		t.Errorf("GET /users/7 = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/7", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET" {
+		t.Errorf("POST /users/7 = %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestEngineResponseFraming(t *testing.T) {
+	engine := NewEngine()
+	engine.ServerHeader = "lux"
+	engine.ResponseBufferSize = 16
+	engine.Get("/small", func(c *Context) {
+		c.WriteResponse("hello")
+	})
+	engine.Get("/large", func(c *Context) {
+		c.WriteResponse(strings.Repeat("x", 100))
+	})
+
+	w := engine.TestRequest(http.MethodGet, "/small", nil, nil)
+	if w.Body.String() != "hello" || w.Header().Get("Content-Length") != "5" {
+		t.Errorf("GET /small = %q, Content-Length %q", w.Body.String(), w.Header().Get("Content-Length"))
+	}
+	if w.Header().Get("Date") == "" || w.Header().Get("Server") != "lux" {
+		t.Errorf("GET /small: Date %q, Server %q", w.Header().Get("Date"), w.Header().Get("Server"))
+	}
+
+	w = engine.TestRequest(http.MethodGet, "/large", nil, nil)
+	if w.Body.Len() != 100 || w.Header().Get("Content-Length") != "" {
+		t.Errorf("GET /large = %d bytes, Content-Length %q", w.Body.Len(), w.Header().Get("Content-Length"))
+	}
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	engine := NewEngine()
+	engine.MaxRequestBodySize = 8
+	engine.Post("/upload", func(c *Context) {
+		data, err := io.ReadAll(c.Request.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.Writer.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.WriteResponse(strconv.Itoa(len(data)))
+	})
+
+	w := engine.TestRequest(http.MethodPost, "/upload", strings.NewReader("12345678"), nil)
+	if w.Code != http.StatusOK || w.Body.String() != "8" {
+		t.Errorf("body at the limit = %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodPost, "/upload", strings.NewReader("123456789"), nil)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Content-Length over the limit = %d, want 413", w.Code)
+	}
+	// Without a Content-Length the body is chunked and only fails once read
+	chunked := io.MultiReader(strings.NewReader("12345"), strings.NewReader("6789"))
+	w = engine.TestRequest(http.MethodPost, "/upload", chunked, nil)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked body over the limit = %d, want 413", w.Code)
+	}
+
+	// The configured limit applies too when it is smaller
+	engine.UpdateConfig(func(c *Config) { c.MaxBodyBytes = 4 })
+	w = engine.TestRequest(http.MethodPost, "/upload", strings.NewReader("12345"), nil)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over MaxBodyBytes = %d, want 413", w.Code)
+	}
+}
+
+func TestRouterGroupHandle(t *testing.T) {
+	engine := NewEngine()
+	dav := engine.Group("/dav")
+	dav.Handle("PROPFIND", "/files", func(c *Context) {
+		c.WriteResponse("propfind " + c.Request.Method)
+	})
+
+	w := engine.TestRequest("PROPFIND", "/dav/files", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "propfind PROPFIND" {
+		t.Errorf("PROPFIND /dav/files = %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodGet, "/dav/files", nil, nil)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "PROPFIND" {
+		t.Errorf("GET /dav/files = %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Handle with an invalid method: want panic")
+		}
+	}()
+	engine.Handle("BAD METHOD", "/x", func(c *Context) {})
+}
+
+func TestTrailingSlashAndExtraSlash(t *testing.T) {
+	engine := NewEngine()
+	engine.RedirectTrailingSlash = true
+	engine.RemoveExtraSlash = true
+	engine.Get("/users", func(c *Context) {
+		c.WriteResponse("users")
+	})
+	engine.Get("/users/:id", func(c *Context) {
+		c.WriteResponse("user " + c.Param("id"))
+	})
+	engine.Post("/items", func(c *Context) {})
+	engine.Get("/dir/", func(c *Context) {
+		c.WriteResponse("dir")
+	})
+	engine.StaticFS("/static", fstest.MapFS{"index.html": {Data: []byte("index")}})
+
+	w := engine.TestRequest(http.MethodGet, "/users/?page=2", nil, nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/users?page=2" {
+		t.Errorf("GET /users/ = %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+	w = engine.TestRequest(http.MethodPost, "/items/", nil, nil)
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "/items" {
+		t.Errorf("POST /items/ = %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+	w = engine.TestRequest(http.MethodGet, "/dir?x=1", nil, nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/dir/?x=1" {
+		t.Errorf("GET /dir = %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+	w = engine.TestRequest(http.MethodGet, "/dir/", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "dir" {
+		t.Errorf("GET /dir/ = %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodGet, "/static/", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "index" {
+		t.Errorf("GET /static/ = %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodGet, "//users///42", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "user 42" {
+		t.Errorf("GET //users///42 = %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodGet, "/files/../users/7", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "user 7" {
+		t.Errorf("GET /files/../users/7 = %d %q", w.Code, w.Body.String())
+	}
+
+	engine.RemoveExtraSlash = false
+	w = engine.TestRequest(http.MethodGet, "//users/", nil, nil)
+	if loc := w.Header().Get("Location"); strings.HasPrefix(loc, "//") {
+		t.Errorf("GET //users/: protocol-relative Location %q", loc)
+	}
+
+	// Without the redirect the route is served, unless matching is strict
+	engine.RedirectTrailingSlash = false
+	for p, want := range map[string]string{"/users/": "users", "/dir": "dir"} {
+		if w = engine.TestRequest(http.MethodGet, p, nil, nil); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("GET %s without redirect = %d %q, want %q", p, w.Code, w.Body.String(), want)
+		}
+	}
+	engine.StrictTrailingSlash = true
+	for _, p := range []string{"/users/", "/dir"} {
+		if w = engine.TestRequest(http.MethodGet, p, nil, nil); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s with StrictTrailingSlash = %d, want 404", p, w.Code)
+		}
+	}
+}
+
+// By default a trailing slash makes no difference, as it did before the
+// redirect and strict options existed.
+func TestTrailingSlashTolerated(t *testing.T) {
+	engine := NewEngine()
+	engine.Get("/users", func(c *Context) {
+		c.WriteResponse("users")
+	})
+	engine.Get("/users/:id", func(c *Context) {
+		c.WriteResponse("user " + c.Param("id"))
+	})
+	engine.Post("/items", func(c *Context) {
+		c.WriteResponse("created")
+	})
+	engine.Group("/api").Get("/", func(c *Context) {
+		c.WriteResponse("api")
+	})
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{http.MethodGet, "/users", "users"},
+		{http.MethodGet, "/users/", "users"},
+		{http.MethodGet, "/users/42/", "user 42"},
+		{http.MethodPost, "/items/", "created"},
+		{http.MethodGet, "/api", "api"},
+		{http.MethodGet, "/api/", "api"},
+	}
+	for _, tt := range tests {
+		w := engine.TestRequest(tt.method, tt.path, nil, nil)
+		if w.Code != http.StatusOK || w.Body.String() != tt.body {
+			t.Errorf("%s %s = %d %q, want %q", tt.method, tt.path, w.Code, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRouteLabelAndMeta(t *testing.T) {
+	engine := NewEngine()
+	var label string
+	engine.Get("/users/:id", func(c *Context) {
+		label = c.RouteLabel()
+	}).WithLabel("user")
+	engine.StaticFS("/assets", fstest.MapFS{"app.js": {Data: []byte("js")}}).WithLabel("assets").WithMeta("cache", "long")
+
+	engine.TestRequest(http.MethodGet, "/users/7", nil, nil)
+	if label != "user" {
+		t.Errorf("RouteLabel = %q, want user", label)
+	}
+
+	static := 0
+	for _, r := range engine.Routes() {
+		if !strings.HasPrefix(r.Path, "/assets") {
+			continue
+		}
+		static++
+		if r.Label != "assets" || r.Meta["cache"] != "long" {
+			t.Errorf("%s %s: label %q, meta %v", r.Method, r.Path, r.Label, r.Meta)
+		}
+	}
+	if static != 6 {
+		t.Errorf("StaticFS registered %d routes, want 6", static)
+	}
+}
+
+func TestWorkerPoolShutdown(t *testing.T) {
+	engine := NewEngine()
+	engine.EnableWorkerPool(WorkerPoolOptions{Workers: 2})
+	engine.Get("/", func(c *Context) {
+		c.WriteResponse("ok")
+	})
+	if w := engine.TestRequest(http.MethodGet, "/", nil, nil); w.Body.String() != "ok" {
+		t.Fatalf("GET / = %d %q", w.Code, w.Body.String())
+	}
+
+	if err := engine.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-engine.workers.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("workers still running after Shutdown")
+	}
+	// Handlers mounted on another server keep running, without the pool
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Body.String() != "ok" {
+		t.Errorf("GET / after Shutdown = %d %q", w.Code, w.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("second EnableWorkerPool did not panic")
+		}
+	}()
+	engine.EnableWorkerPool(WorkerPoolOptions{})
+}
+
+func TestRecovery(t *testing.T) {
+	engine := NewEngine()
+	logs := &testLogger{}
+	engine.Logger = logs
+	engine.Use(Recovery())
+	engine.Get("/panic", func(c *Context) {
+		panic("boom")
+	})
+	engine.Get("/partial", func(c *Context) {
+		c.WriteResponse("started")
+		c.Writer.Flush()
+		panic("late boom")
+	})
+	engine.Get("/abort", func(c *Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	w := engine.TestRequest(http.MethodGet, "/panic", nil, nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("GET /panic = %d, want 500", w.Code)
+	}
+	errs := logs.errors()
+	if len(errs) != 1 || !strings.Contains(errs[0], "boom") || !strings.Contains(errs[0], "goroutine") {
+		t.Errorf("logged %q, want the panic with its stack", errs)
+	}
+
+	w = engine.TestRequest(http.MethodGet, "/partial", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "started" {
+		t.Errorf("GET /partial = %d %q, want the started response kept", w.Code, w.Body.String())
+	}
+
+	w = engine.TestRequest(http.MethodGet, "/abort", nil, nil)
+	if w.Code != http.StatusInternalServerError || len(logs.errors()) != 2 {
+		t.Errorf("GET /abort = %d, logged %q", w.Code, logs.errors())
+	}
+}
+
+func TestNoRouteNoMethod(t *testing.T) {
+	engine := NewEngine()
+	engine.Get("/items", func(c *Context) {})
+	engine.Post("/items", func(c *Context) {})
+
+	w := engine.TestRequest(http.MethodGet, "/missing", nil, nil)
+	if w.Code != http.StatusNotFound || w.Body.String() != "404 page not found" {
+		t.Errorf("default 404 = %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodDelete, "/items", nil, nil)
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "405 method not allowed" || w.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("default 405 = %d %q, Allow %q", w.Code, w.Body.String(), w.Header().Get("Allow"))
+	}
+
+	engine.NoRoute(func(c *Context) {
+		c.JSON(http.StatusNotFound, map[string]string{"error": "no route " + c.Request.URL.Path})
+	})
+	engine.NoMethod(func(c *Context) {
+		c.Writer.Header().Set("X-NoMethod", "yes")
+	})
+	// Global middleware added afterwards still applies
+	engine.Use(func(c *Context) {
+		c.Writer.Header().Set("X-Middleware", "yes")
+		c.Next()
+	})
+
+	w = engine.TestRequest(http.MethodGet, "/missing", nil, nil)
+	if w.Code != http.StatusNotFound || w.Body.String() != `{"error":"no route /missing"}` {
+		t.Errorf("NoRoute = %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Middleware") != "yes" {
+		t.Error("global middleware skipped for NoRoute")
+	}
+
+	// Handlers that write nothing get the default body
+	w = engine.TestRequest(http.MethodPut, "/items", nil, nil)
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "405 method not allowed" {
+		t.Errorf("NoMethod = %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-NoMethod") != "yes" || w.Header().Get("X-Middleware") != "yes" || w.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("NoMethod headers = %v", w.Header())
+	}
+
+	// A handler may answer with another status
+	engine.NoRoute(func(c *Context) {
+		c.Redirect(http.StatusFound, "/items")
+	})
+	w = engine.TestRequest(http.MethodGet, "/old", nil, nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/items" {
+		t.Errorf("redirecting NoRoute = %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRunReusePort(t *testing.T) {
+	// Find a free port; the listeners must all bind the same one
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	engine := NewEngine()
+	engine.Get("/", func(c *Context) {
+		c.WriteResponse("ok")
+	})
+	errc := make(chan error, 1)
+	go func() { errc <- engine.RunReusePort(addr, 4) }()
+
+	listeners := func() int {
+		engine.tracker.mu.Lock()
+		defer engine.tracker.mu.Unlock()
+		return len(engine.tracker.listeners)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for listeners() < 4 {
+		select {
+		case err := <-errc:
+			if errors.Is(err, reuseport.ErrUnsupported) {
+				t.Skip(err)
+			}
+			t.Fatal(err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d listeners running, want 4", listeners())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for i := 0; i < 8; i++ {
+		resp, err := client.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Errorf("GET / = %d %q", resp.StatusCode, body)
+		}
+	}
+
+	if err := engine.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("RunReusePort = %v, want http.ErrServerClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunReusePort still running after Shutdown")
+	}
+	if n := listeners(); n != 0 {
+		t.Errorf("%d listeners left after Shutdown", n)
+	}
+}
+
+func requireAdmin(c *Context) {
+	if c.Request.Header.Get("X-Admin") != "yes" {
+		c.Writer.WriteHeader(http.StatusUnauthorized)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func TestIntrospectionHandler(t *testing.T) {
+	engine := NewEngine()
+	engine.ServerHeader = "lux"
+	engine.Get("/users/:id", func(c *Context) {}).WithLabel("user").WithMeta("owner", "accounts")
+	admin := engine.Group("/admin", requireAdmin)
+	admin.Get("/introspect", engine.IntrospectionHandler())
+
+	if w := engine.TestRequest(http.MethodGet, "/admin/introspect", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("without credentials = %d, want 401", w.Code)
+	}
+
+	w := engine.TestRequest(http.MethodGet, "/admin/introspect", nil, http.Header{"X-Admin": {"yes"}})
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("GET /admin/introspect = %d, Cache-Control %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	var out introspection
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := make(map[string]routeJSON)
+	for _, r := range out.Routes {
+		routes[r.Method+" "+r.Path] = r
+	}
+	user, ok := routes["GET /users/:id"]
+	if !ok || user.Label != "user" || user.Meta["owner"] != "accounts" || len(user.Middleware) != 0 {
+		t.Errorf("user route = %+v", user)
+	}
+	self := routes["GET /admin/introspect"]
+	if self.Group != "/admin" || len(self.Middleware) != 1 || !strings.HasSuffix(self.Middleware[0], ".requireAdmin") {
+		t.Errorf("introspection route = %+v", self)
+	}
+
+	if out.Config.ServerHeader != "lux" || out.Config.MaxMultipartMemory != engine.MaxMultipartMemory || out.Config.Logger == "" {
+		t.Errorf("config = %+v", out.Config)
+	}
+	if out.Build.GoVersion != runtime.Version() {
+		t.Errorf("build Go version = %q, want %q", out.Build.GoVersion, runtime.Version())
+	}
+}
@@ -0,0 +1,226 @@
+package lux
+
+import (
+	"bufio"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetETag sets the response's entity tag, quoting tag and marking it weak
+// if asked. Weak tags promise equivalent rather than byte-identical
+// content, which suits responses that vary in formatting only.
+func (c *Context) SetETag(tag string, weak bool) {
+	etag := `"` + strings.ReplaceAll(tag, `"`, "") + `"`
+	if weak {
+		etag = "W/" + etag
+	}
+	c.Writer.Header().Set("ETag", etag)
+}
+
+// IfNoneMatch evaluates the request's conditional headers against the
+// ETag and Last-Modified headers already set on the response. If the
+// client's copy is current it answers 304 Not Modified, aborts and returns
+// true, so that the handler can skip rendering:
+//
+//	c.SetETag(article.Version, false)
+//	if c.IfNoneMatch() {
+//		return
+//	}
+//
+// If-Modified-Since is only consulted when the request has no
+// If-None-Match, and only GET and HEAD requests are answered 304.
+func (c *Context) IfNoneMatch() bool {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	if !notModified(c.Request, c.Writer.Header()) {
+		return false
+	}
+	writeNotModified(c.Writer)
+	c.Abort()
+	return true
+}
+
+// notModified reports whether the conditional headers of req match a
+// response with header h.
+func notModified(req *http.Request, h http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		return etag != "" && etagMatch(inm, etag)
+	}
+	ims := req.Header.Get("If-Modified-Since")
+	lastModified := h.Get("Last-Modified")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+// etagMatch reports whether the If-None-Match list matches etag, with the
+// weak comparison RFC 9110 prescribes for it.
+func etagMatch(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified answers 304, dropping the headers that describe a body.
+func writeNotModified(w ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+	w.WriteHeaderNow()
+}
+
+// ETagOptions tunes the ETag middleware.
+type ETagOptions struct {
+	// Weak marks the computed tags weak
+	Weak bool
+
+	// MaxBody is the largest response that is buffered to be hashed.
+	// Larger responses are streamed without an ETag. Defaults to 1MB.
+	MaxBody int
+}
+
+// ETag returns middleware that tags successful GET and HEAD responses with
+// a hash of their body and answers 304 Not Modified, without the body, to
+// clients that already have it. Responses that set their own ETag are
+// only checked against the request, and streamed or hijacked responses
+// pass through untouched.
+func ETag(opts ...ETagOptions) HandlerFunc {
+	var o ETagOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxBody <= 0 {
+		o.MaxBody = 1 << 20
+	}
+
+	return func(c *Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		ew := &etagWriter{ResponseWriter: c.Writer, max: o.MaxBody}
+		c.Writer = ew
+		defer func() {
+			c.Writer = ew.ResponseWriter
+		}()
+		c.Next()
+		if ew.passthrough {
+			return
+		}
+
+		w := ew.ResponseWriter
+		h := w.Header()
+		if w.Status() == http.StatusOK {
+			if h.Get("ETag") == "" {
+				sum := fnv.New64a()
+				sum.Write(ew.buf)
+				tag := strconv.FormatInt(int64(len(ew.buf)), 16) + "-" + strconv.FormatUint(sum.Sum64(), 16)
+				c.SetETag(tag, o.Weak)
+			}
+			if notModified(c.Request, h) {
+				writeNotModified(w)
+				return
+			}
+		}
+		ew.release()
+	}
+}
+
+// etagWriter holds back the body so that its hash can go in the headers.
+type etagWriter struct {
+	ResponseWriter
+	buf         []byte
+	max         int
+	wrote       bool
+	passthrough bool
+}
+
+func (w *etagWriter) WriteHeaderNow() {
+	w.wrote = true
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *etagWriter) Written() bool {
+	return w.wrote || w.ResponseWriter.Written()
+}
+
+func (w *etagWriter) Write(data []byte) (int, error) {
+	w.wrote = true
+	if !w.passthrough {
+		if len(w.buf)+len(data) <= w.max {
+			w.buf = append(w.buf, data...)
+			return len(data), nil
+		}
+		if err := w.release(); err != nil {
+			return 0, err
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// release gives up on tagging and sends what was held back.
+func (w *etagWriter) release() error {
+	w.passthrough = true
+	if w.wrote {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *etagWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError streams the response, which then goes out without an ETag.
+func (w *etagWriter) FlushError() error {
+	if !w.passthrough {
+		if err := w.release(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !w.passthrough {
+		if err := w.release(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return w.ResponseWriter.Hijack()
+}
+
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,40 @@
+package lux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	engine := NewEngine()
+	engine.Use(ETag())
+	engine.Get("/doc", func(c *Context) {
+		c.WriteResponse("document body")
+	})
+	engine.Get("/versioned", func(c *Context) {
+		c.SetETag("v2", true)
+		if c.IfNoneMatch() {
+			return
+		}
+		c.WriteResponse("version 2")
+	})
+
+	w := engine.TestRequest(http.MethodGet, "/doc", nil, nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Body.String() != "document body" {
+		t.Fatalf("GET /doc = %d %q, ETag %q", w.Code, w.Body.String(), etag)
+	}
+	w = engine.TestRequest(http.MethodGet, "/doc", nil, http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("GET /doc If-None-Match = %d %q, want 304", w.Code, w.Body.String())
+	}
+
+	w = engine.TestRequest(http.MethodGet, "/versioned", nil, http.Header{"If-None-Match": {`"v1", "v2"`}})
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != `W/"v2"` {
+		t.Errorf("GET /versioned = %d, ETag %q, want 304", w.Code, w.Header().Get("ETag"))
+	}
+	w = engine.TestRequest(http.MethodGet, "/versioned", nil, http.Header{"If-None-Match": {`"v1"`}})
+	if w.Code != http.StatusOK || w.Body.String() != "version 2" {
+		t.Errorf("GET /versioned stale = %d %q", w.Code, w.Body.String())
+	}
+}
@@ -23,6 +23,9 @@ func main() {
 		c.WriteResponse("hi")
 	})
 
-	engine.Run("0.0.0.0:4222")
+	if err := engine.Run("0.0.0.0:4222"); err != nil {
+		fmt.Println("Failed to serve:", err)
+		os.Exit(1)
+	}
 
 }
@@ -0,0 +1,135 @@
+package lux
+
+import (
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileOffload makes Context.File hand files to a fronting proxy instead of
+// streaming them: the response carries only a header naming the file, and
+// the proxy sends the file itself, keeping large downloads off the Go
+// process. The proxy must be configured to honour the header, and must
+// never pass it through from untrusted upstreams.
+type FileOffload struct {
+	// Header names the file for the proxy: X-Sendfile for Apache
+	// mod_xsendfile and lighttpd, X-Accel-Redirect for nginx
+	Header string `json:"header"`
+
+	// Root limits offloading to files below it; other files are streamed
+	// as usual. Empty offloads every file.
+	Root string `json:"root"`
+
+	// Prefix replaces Root in the header value. nginx expects the URI of
+	// an internal location rather than a file system path.
+	Prefix string `json:"prefix"`
+}
+
+// XSendfile offloads files below root with the X-Sendfile header, which
+// Apache mod_xsendfile and lighttpd resolve as an absolute file path.
+func XSendfile(root string) *FileOffload {
+	return &FileOffload{Header: "X-Sendfile", Root: root}
+}
+
+// XAccelRedirect offloads files below root with nginx's X-Accel-Redirect
+// header, naming them by the internal location that serves root:
+//
+//	location /protected/ {
+//		internal;
+//		alias /var/www/files/;
+//	}
+//
+// goes with XAccelRedirect("/var/www/files", "/protected/").
+func XAccelRedirect(root, location string) *FileOffload {
+	return &FileOffload{Header: "X-Accel-Redirect", Root: root, Prefix: location}
+}
+
+// target returns the header value for the absolute path name, or false if
+// the file is outside Root.
+func (o *FileOffload) target(name string) (string, bool) {
+	if o.Root == "" {
+		if o.Prefix == "" {
+			return name, true
+		}
+		return strings.TrimSuffix(o.Prefix, "/") + filepath.ToSlash(name), true
+	}
+	root, err := filepath.Abs(o.Root)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if o.Prefix == "" {
+		return name, true
+	}
+	return strings.TrimSuffix(o.Prefix, "/") + "/" + filepath.ToSlash(rel), true
+}
+
+// File writes the named file, with Range and conditional request handling
+// and an ETag derived from its size and modification time.
+// With Engine.FileOffload set, files below its root are left to the fronting
+// proxy instead. Missing files and directories answer 404.
+func (c *Context) File(name string) {
+	if o := c.engine.FileOffload; o != nil {
+		if abs, err := filepath.Abs(name); err == nil {
+			if target, ok := o.target(abs); ok {
+				h := c.Writer.Header()
+				if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+					h.Set("Content-Type", ctype)
+				}
+				h.Set(o.Header, target)
+				h.Set("Content-Length", "0")
+				return
+			}
+		}
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		c.staticError(err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		c.staticError(err)
+		return
+	}
+	if info.IsDir() {
+		c.staticError(os.ErrNotExist)
+		return
+	}
+	serveContent(c, f, info, &StaticOptions{ETag: true})
+}
+
+// FileAttachment writes the named file like File, with a
+// Content-Disposition header that makes browsers download it as filename.
+// filename is reduced to a base name without control characters or
+// quotes; non-ASCII names are sent in the RFC 5987 filename* form as well.
+func (c *Context) FileAttachment(name, filename string) {
+	c.Writer.Header().Set("Content-Disposition", contentDisposition("attachment", filename))
+	c.File(name)
+}
+
+// contentDisposition formats a Content-Disposition header value for a
+// sanitized copy of filename.
+func contentDisposition(disposition, filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f, r == '"':
+			return -1
+		}
+		return r
+	}, path.Base(strings.ReplaceAll(filename, `\`, "/")))
+	if filename == "" || filename == "." || filename == ".." {
+		return disposition
+	}
+	if v := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return disposition
+}
@@ -0,0 +1,237 @@
+package lux
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFileRange(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(name, []byte(strings.Repeat("0123456789", 10)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine()
+	engine.Get("/data", func(c *Context) {
+		c.File(name)
+	})
+
+	tests := []struct {
+		rng, contentRange, body string
+		code                    int
+	}{
+		{"bytes=2-5", "bytes 2-5/100", "2345", http.StatusPartialContent},
+		{"bytes=-3", "bytes 97-99/100", "789", http.StatusPartialContent},
+		{"bytes=200-", "bytes */100", "", http.StatusRequestedRangeNotSatisfiable},
+	}
+	for _, tt := range tests {
+		w := engine.TestRequest(http.MethodGet, "/data", nil, http.Header{"Range": {tt.rng}})
+		if w.Code != tt.code || w.Header().Get("Content-Range") != tt.contentRange {
+			t.Errorf("Range %s = %d %q, want %d %q", tt.rng, w.Code, w.Header().Get("Content-Range"), tt.code, tt.contentRange)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("Range %s: body %q, want %q", tt.rng, w.Body.String(), tt.body)
+		}
+	}
+
+	w := engine.TestRequest(http.MethodGet, "/data", nil, http.Header{"Range": {"bytes=0-1,4-5"}})
+	if w.Code != http.StatusPartialContent || !strings.HasPrefix(w.Header().Get("Content-Type"), "multipart/byteranges") {
+		t.Errorf("multiple ranges = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestFileAttachmentAndDataFromReader(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(name, []byte("a,b\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine()
+	engine.Get("/download", func(c *Context) {
+		c.FileAttachment(name, c.Query("as"))
+	})
+	engine.Get("/reader", func(c *Context) {
+		c.DataFromReader(http.StatusOK, 5, "text/plain", strings.NewReader("hello"), map[string]string{"X-Source": "reader"})
+	})
+
+	tests := map[string]string{
+		`../../etc/pa"ss`: `attachment; filename=pass`,
+		"résumé.csv":      `attachment; filename*=utf-8''r%C3%A9sum%C3%A9.csv`,
+	}
+	for as, want := range tests {
+		w := engine.TestRequest(http.MethodGet, "/download?as="+url.QueryEscape(as), nil, nil)
+		if got := w.Header().Get("Content-Disposition"); got != want || w.Body.String() != "a,b\n" {
+			t.Errorf("FileAttachment(%q): Content-Disposition %q, want %q", as, got, want)
+		}
+	}
+
+	w := engine.TestRequest(http.MethodGet, "/reader", nil, nil)
+	if w.Body.String() != "hello" || w.Header().Get("Content-Length") != "5" || w.Header().Get("X-Source") != "reader" {
+		t.Errorf("DataFromReader = %q %v", w.Body.String(), w.Header())
+	}
+}
+
+func TestDataFromReaderLength(t *testing.T) {
+	engine := NewEngine()
+	engine.Get("/long", func(c *Context) {
+		c.DataFromReader(http.StatusOK, 3, "text/plain", strings.NewReader("hello world"), nil)
+	})
+	engine.Get("/short", func(c *Context) {
+		c.DataFromReader(http.StatusOK, 10, "text/plain", strings.NewReader("abc"), nil)
+	})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go engine.handleConn(server)
+	go io.WriteString(client, "GET /long HTTP/1.1\r\nHost: x\r\n\r\nGET /short HTTP/1.1\r\nHost: x\r\n\r\n")
+
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hel" {
+		t.Errorf("GET /long = %q, want the declared 3 bytes", body)
+	}
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("response after an over-long reader: %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil || !resp.Close {
+		t.Errorf("GET /short: want a truncated body on a closed connection, got err %v, Close %v", err, resp.Close)
+	}
+}
+
+func TestStaticCacheHeaders(t *testing.T) {
+	assets := fstest.MapFS{"a.js": {Data: []byte("aaaa")}, "b.js": {Data: []byte("bbbb")}}
+	fp, err := NewFingerprints("/assets", assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine()
+	engine.StaticFS("/assets", assets, StaticOptions{ETag: true, MaxAge: time.Hour, Immutable: true, Fingerprints: fp})
+
+	a := engine.TestRequest(http.MethodGet, "/assets/a.js", nil, nil)
+	b := engine.TestRequest(http.MethodGet, "/assets/b.js", nil, nil)
+	if a.Header().Get("ETag") == "" || a.Header().Get("ETag") == b.Header().Get("ETag") {
+		t.Errorf("ETags of same-sized files: %q and %q", a.Header().Get("ETag"), b.Header().Get("ETag"))
+	}
+	if cc := a.Header().Get("Cache-Control"); strings.Contains(cc, "immutable") {
+		t.Errorf("plain name Cache-Control = %q, want no immutable", cc)
+	}
+
+	w := engine.TestRequest(http.MethodGet, fp.Path("/assets/a.js"), nil, nil)
+	if cc := w.Header().Get("Cache-Control"); w.Body.String() != "aaaa" || !strings.Contains(cc, "immutable") {
+		t.Errorf("fingerprinted name = %q, Cache-Control %q", w.Body.String(), cc)
+	}
+}
+
+func TestStaticDirectoryRedirect(t *testing.T) {
+	engine := NewEngine()
+	engine.StaticFS("/static", fstest.MapFS{"my dir?#%/index.html": {Data: []byte("index")}})
+
+	w := engine.TestRequest(http.MethodGet, "/static/my%20dir%3F%23%25?x=1", nil, nil)
+	if want := "/static/my%20dir%3F%23%25/?x=1"; w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != want {
+		t.Fatalf("GET directory = %d, Location %q, want %q", w.Code, w.Header().Get("Location"), want)
+	}
+	w = engine.TestRequest(http.MethodGet, w.Header().Get("Location"), nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "index" {
+		t.Errorf("GET redirect target = %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestFileOffload(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	inside := filepath.Join(root, "sub", "report.pdf")
+	outside := filepath.Join(t.TempDir(), "other.txt")
+	for _, name := range []string{inside, outside} {
+		if err := os.WriteFile(name, []byte("file content"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		offload *FileOffload
+		header  string
+		target  string
+	}{
+		{XSendfile(root), "X-Sendfile", inside},
+		{XAccelRedirect(root, "/protected/"), "X-Accel-Redirect", "/protected/sub/report.pdf"},
+	}
+	for _, tt := range tests {
+		engine := NewEngine()
+		engine.FileOffload = tt.offload
+		engine.Get("/inside", func(c *Context) { c.File(inside) })
+		engine.Get("/outside", func(c *Context) { c.File(outside) })
+
+		w := engine.TestRequest(http.MethodGet, "/inside", nil, nil)
+		if w.Code != http.StatusOK || w.Header().Get(tt.header) != tt.target {
+			t.Errorf("%s: status %d, header %q, want %q", tt.header, w.Code, w.Header().Get(tt.header), tt.target)
+		}
+		if w.Body.Len() != 0 || w.Header().Get("Content-Length") != "0" {
+			t.Errorf("%s: body %q, Content-Length %q; want it empty", tt.header, w.Body, w.Header().Get("Content-Length"))
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/pdf" {
+			t.Errorf("%s: Content-Type %q", tt.header, ct)
+		}
+
+		// Files outside the root are streamed as usual
+		w = engine.TestRequest(http.MethodGet, "/outside", nil, nil)
+		if w.Header().Get(tt.header) != "" || w.Body.String() != "file content" {
+			t.Errorf("%s outside the root: header %q, body %q", tt.header, w.Header().Get(tt.header), w.Body)
+		}
+	}
+}
+
+func TestStaticDirectoryListing(t *testing.T) {
+	files := fstest.MapFS{
+		"docs/<img src=x onerror=alert(1)>.txt": {Data: []byte("x")},
+		"docs/a b.txt":                          {Data: []byte("xxx")},
+		"docs/sub/inner.txt":                    {Data: []byte("inner")},
+	}
+
+	engine := NewEngine()
+	engine.StaticFS("/hidden", files)
+	engine.StaticFS("/browse", files, StaticOptions{Browse: true})
+
+	if w := engine.TestRequest(http.MethodGet, "/hidden/docs/", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("listing without Browse = %d %q, want 404", w.Code, w.Body.String())
+	}
+
+	w := engine.TestRequest(http.MethodGet, "/browse/docs/", nil, nil)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("listing = %d (%s)", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`<a href="sub/">sub/</a>`,
+		`<a href="a%20b.txt">a b.txt</a>`,
+		`&lt;img src=x onerror=alert(1)&gt;.txt</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("listing lacks %s:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "<img") {
+		t.Errorf("listing contains an unescaped name:\n%s", body)
+	}
+	// Directories come first, then names in order
+	if i, j, k := strings.Index(body, "sub/"), strings.Index(body, "&lt;img"), strings.Index(body, "a b.txt"); !(i < j && j < k) {
+		t.Errorf("listing order: sub/ at %d, <img at %d, a b.txt at %d", i, j, k)
+	}
+
+	w = engine.TestRequest(http.MethodGet, "/browse/docs/?sort=size&order=desc", nil, nil)
+	if i, j := strings.Index(w.Body.String(), "a b.txt"), strings.Index(w.Body.String(), "&lt;img"); i > j {
+		t.Errorf("size descending: a b.txt at %d, after the smaller file at %d", i, j)
+	}
+}
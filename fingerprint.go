@@ -0,0 +1,100 @@
+package lux
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Fingerprints maps static asset paths to names that embed a hash of the
+// file's content, such as /assets/app.js to /assets/app.3f2a91c0.js. Pages
+// link to the fingerprinted name, which can then be cached forever: a new
+// release changes the name instead of relying on revalidation.
+//
+//	assets := os.DirFS("public")
+//	fp, err := lux.NewFingerprints("/assets", assets)
+//	engine.StaticFS("/assets", assets, lux.StaticOptions{
+//		Fingerprints: fp,
+//		MaxAge:       365 * 24 * time.Hour,
+//		Immutable:    true,
+//	})
+//	engine.SetFuncMap(template.FuncMap{"asset": fp.Path})
+type Fingerprints struct {
+	prefix    string
+	hashed    map[string]string // file name to fingerprinted name
+	originals map[string]string // fingerprinted name to file name
+}
+
+// NewFingerprints hashes every file of fsys, which is mounted at prefix.
+func NewFingerprints(prefix string, fsys fs.FS) (*Fingerprints, error) {
+	f := &Fingerprints{
+		prefix:    path.Clean("/" + prefix),
+		hashed:    make(map[string]string),
+		originals: make(map[string]string),
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		sum, err := hashFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		hashed := fingerprintName(name, sum)
+		f.hashed[name] = hashed
+		f.originals[hashed] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func hashFile(fsys fs.FS, name string) (string, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:4]), nil
+}
+
+// fingerprintName inserts sum before the extension of name.
+func fingerprintName(name, sum string) string {
+	ext := path.Ext(name)
+	if ext == "" || ext == path.Base(name) {
+		return name + "." + sum
+	}
+	return strings.TrimSuffix(name, ext) + "." + sum + ext
+}
+
+// Path returns the fingerprinted URL path for p, a path below the mount
+// prefix. Paths of unknown files are returned unchanged.
+func (f *Fingerprints) Path(p string) string {
+	rel, ok := strings.CutPrefix(path.Clean("/"+p), f.prefix)
+	if !ok {
+		return p
+	}
+	hashed, ok := f.hashed[strings.TrimPrefix(rel, "/")]
+	if !ok {
+		return p
+	}
+	return path.Join(f.prefix, hashed)
+}
+
+// original returns the file a fingerprinted name was derived from, or name
+// itself if it isn't fingerprinted.
+func (f *Fingerprints) original(name string) string {
+	if orig, ok := f.originals[strings.TrimPrefix(name, "/")]; ok {
+		return orig
+	}
+	return name
+}
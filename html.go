@@ -0,0 +1,383 @@
+package lux
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTMLSet is a group of HTML templates parsed from files. Templates are
+// named after the base name of their file. An engine has a default set,
+// configured through its LoadHTML* methods, and any number of named sets
+// returned by Engine.HTMLSet, for example to keep admin pages or email
+// bodies apart from the public site.
+//
+// Without a layout every file is parsed into one template tree, so any file
+// can include any other by name. With a layout each page file is parsed into
+// its own copy of the layout and the partials (files whose name starts with
+// an underscore); rendering a page executes the layout, whose blocks the page
+// overrides with {{define}}:
+//
+//	layout.html: <html><title>{{block "title" .}}lux{{end}}</title>{{block "content" .}}{{end}}</html>
+//	index.html:  {{define "title"}}Home{{end}}{{define "content"}}{{template "_nav.html" .}}…{{end}}
+type HTMLSet struct {
+	mu sync.RWMutex
+
+	fsys     fs.FS    // file system of patterns and files, nil for the OS
+	patterns []string // glob patterns, expanded on every load
+	files    []string // files named explicitly
+	layout   string
+	reload   bool
+	delims   [2]string
+	funcs    template.FuncMap
+
+	root    *template.Template            // every file, or the layout and partials
+	pages   map[string]*template.Template // page name to its copy of the layout
+	modTime map[string]time.Time          // files as of the last load
+}
+
+// load parses the set's files, replacing the previously parsed templates.
+func (s *HTMLSet) load() error {
+	files, err := s.expand()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("lux: no template files match %v", append(s.patterns, s.files...))
+	}
+
+	modTime := make(map[string]time.Time, len(files))
+	sources := make(map[string]string, len(files))
+	for _, file := range files {
+		info, err := s.stat(file)
+		if err != nil {
+			return err
+		}
+		b, err := s.readFile(file)
+		if err != nil {
+			return err
+		}
+		modTime[file] = info.ModTime()
+		sources[file] = string(b)
+	}
+
+	root := template.New("").Delims(s.delims[0], s.delims[1]).Funcs(s.funcs)
+	var pages map[string]*template.Template
+	var pageFiles []string
+	for _, file := range files {
+		name := path.Base(filepath.ToSlash(file))
+		if s.layout != "" && name != s.layout && !strings.HasPrefix(name, "_") {
+			pageFiles = append(pageFiles, file)
+			continue
+		}
+		if _, err := root.New(name).Parse(sources[file]); err != nil {
+			return err
+		}
+	}
+	if s.layout != "" {
+		if root.Lookup(s.layout) == nil {
+			return fmt.Errorf("lux: layout template %q not found", s.layout)
+		}
+		pages = make(map[string]*template.Template, len(pageFiles))
+		for _, file := range pageFiles {
+			t, err := root.Clone()
+			if err != nil {
+				return err
+			}
+			name := path.Base(filepath.ToSlash(file))
+			if _, err := t.New(name).Parse(sources[file]); err != nil {
+				return err
+			}
+			pages[name] = t
+		}
+	}
+
+	s.root, s.pages, s.modTime = root, pages, modTime
+	return nil
+}
+
+// expand returns the set's files in a stable order.
+func (s *HTMLSet) expand() ([]string, error) {
+	files := slices.Clone(s.files)
+	for _, pattern := range s.patterns {
+		matches, err := s.glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+func (s *HTMLSet) glob(pattern string) ([]string, error) {
+	if s.fsys != nil {
+		return fs.Glob(s.fsys, pattern)
+	}
+	return filepath.Glob(pattern)
+}
+
+func (s *HTMLSet) stat(file string) (fs.FileInfo, error) {
+	if s.fsys != nil {
+		return fs.Stat(s.fsys, file)
+	}
+	return os.Stat(file)
+}
+
+func (s *HTMLSet) readFile(file string) ([]byte, error) {
+	if s.fsys != nil {
+		return fs.ReadFile(s.fsys, file)
+	}
+	return os.ReadFile(file)
+}
+
+// stale reports whether a file of the set was modified, added or removed
+// since the last load.
+func (s *HTMLSet) stale() bool {
+	files, err := s.expand()
+	if err != nil || len(files) != len(s.modTime) {
+		return true
+	}
+	for _, file := range files {
+		info, err := s.stat(file)
+		if err != nil {
+			return true
+		}
+		if t, ok := s.modTime[file]; !ok || !t.Equal(info.ModTime()) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the template tree to execute for name and the name of the
+// template to execute in it, reloading changed files first in reload mode.
+func (s *HTMLSet) lookup(name string) (*template.Template, string, error) {
+	if s.reload {
+		s.mu.Lock()
+		if s.root == nil || s.stale() {
+			if err := s.load(); err != nil {
+				s.mu.Unlock()
+				return nil, "", err
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if t, ok := s.pages[name]; ok {
+		return t, s.layout, nil
+	}
+	if s.root == nil || s.root.Lookup(name) == nil {
+		return nil, "", fmt.Errorf("lux: html template %q is undefined", name)
+	}
+	return s.root, name, nil
+}
+
+// render executes the template name with data into buf.
+func (s *HTMLSet) render(buf *bytes.Buffer, name string, data any) error {
+	t, entry, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
+	return t.ExecuteTemplate(buf, entry, data)
+}
+
+// HTMLSet returns the template set registered under name, creating it on
+// first use. The empty name is the default set used by Context.HTML.
+func (e *Engine) HTMLSet(name string) *HTMLSet {
+	if e.htmlSets == nil {
+		e.htmlSets = make(map[string]*HTMLSet)
+	}
+	s := e.htmlSets[name]
+	if s == nil {
+		s = &HTMLSet{reload: e.htmlReload, delims: e.htmlDelims, funcs: maps.Clone(e.htmlFuncs)}
+		e.htmlSets[name] = s
+	}
+	return s
+}
+
+// LoadGlob parses the HTML templates matching pattern. It panics if the
+// templates cannot be parsed.
+func (s *HTMLSet) LoadGlob(pattern string) *HTMLSet {
+	if s.fsys != nil {
+		panic("lux: template set mixes file systems")
+	}
+	s.patterns = append(s.patterns, pattern)
+	s.reloadNow()
+	return s
+}
+
+// LoadFiles parses the given HTML template files. It panics if the
+// templates cannot be parsed.
+func (s *HTMLSet) LoadFiles(files ...string) *HTMLSet {
+	if s.fsys != nil {
+		panic("lux: template set mixes file systems")
+	}
+	s.files = append(s.files, files...)
+	s.reloadNow()
+	return s
+}
+
+// LoadFS parses the HTML templates in fsys matching the patterns, so that
+// templates can ship inside the binary with embed.FS. A set reads all of its
+// files from a single file system, the one passed to the latest LoadFS call,
+// or from the operating system; it panics if the two are mixed or the
+// templates cannot be parsed.
+func (s *HTMLSet) LoadFS(fsys fs.FS, patterns ...string) *HTMLSet {
+	if s.fsys == nil && len(s.patterns)+len(s.files) > 0 {
+		panic("lux: template set mixes file systems")
+	}
+	s.fsys = fsys
+	s.patterns = append(s.patterns, patterns...)
+	s.reloadNow()
+	return s
+}
+
+// SetLayout renders every page into the layout template name, the base
+// name of one of the loaded files. Files whose name starts with an
+// underscore are partials shared by the layout and all pages.
+func (s *HTMLSet) SetLayout(name string) *HTMLSet {
+	s.layout = name
+	s.reloadNow()
+	return s
+}
+
+// SetAutoReload makes the set re-parse its templates whenever one of the
+// files changes, so edits show up without a restart. Every render checks
+// the files, which is meant for development rather than production.
+func (s *HTMLSet) SetAutoReload(enabled bool) *HTMLSet {
+	s.reload = enabled
+	return s
+}
+
+// SetDelims sets the action delimiters used when parsing, for templates
+// that share pages with frontend frameworks using {{ and }}. Empty strings
+// select the defaults.
+func (s *HTMLSet) SetDelims(left, right string) *HTMLSet {
+	s.delims = [2]string{left, right}
+	s.reloadNow()
+	return s
+}
+
+// SetFuncMap adds functions callable from the set's templates.
+func (s *HTMLSet) SetFuncMap(funcs template.FuncMap) *HTMLSet {
+	if s.funcs == nil {
+		s.funcs = make(template.FuncMap, len(funcs))
+	}
+	maps.Copy(s.funcs, funcs)
+	s.reloadNow()
+	return s
+}
+
+// reloadNow re-parses templates that have already been loaded, after the
+// set's configuration changed.
+func (s *HTMLSet) reloadNow() {
+	if len(s.patterns) == 0 && len(s.files) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		panic(err)
+	}
+}
+
+// LoadHTMLGlob parses the HTML templates matching pattern into the default
+// set. It panics if the templates cannot be parsed.
+func (e *Engine) LoadHTMLGlob(pattern string) {
+	e.HTMLSet("").LoadGlob(pattern)
+}
+
+// LoadHTMLFiles parses the given HTML template files into the default set.
+// It panics if the templates cannot be parsed.
+func (e *Engine) LoadHTMLFiles(files ...string) {
+	e.HTMLSet("").LoadFiles(files...)
+}
+
+// LoadHTMLFS parses the HTML templates in fsys matching the patterns into
+// the default set; see HTMLSet.LoadFS.
+func (e *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) {
+	e.HTMLSet("").LoadFS(fsys, patterns...)
+}
+
+// SetHTMLLayout sets the layout of the default set; see HTMLSet.SetLayout.
+func (e *Engine) SetHTMLLayout(name string) {
+	e.HTMLSet("").SetLayout(name)
+}
+
+// SetHTMLAutoReload enables auto-reload for every template set, including
+// sets created later; see HTMLSet.SetAutoReload.
+func (e *Engine) SetHTMLAutoReload(enabled bool) {
+	e.htmlReload = enabled
+	for _, s := range e.htmlSets {
+		s.SetAutoReload(enabled)
+	}
+}
+
+// SetHTMLDelims sets the template action delimiters of every template set,
+// including sets created later; see HTMLSet.SetDelims.
+func (e *Engine) SetHTMLDelims(left, right string) {
+	e.htmlDelims = [2]string{left, right}
+	for _, s := range e.htmlSets {
+		s.SetDelims(left, right)
+	}
+}
+
+// SetFuncMap registers template functions for every template set, including
+// sets created later; see HTMLSet.SetFuncMap.
+func (e *Engine) SetFuncMap(funcs template.FuncMap) {
+	if e.htmlFuncs == nil {
+		e.htmlFuncs = make(template.FuncMap, len(funcs))
+	}
+	maps.Copy(e.htmlFuncs, funcs)
+	for _, s := range e.htmlSets {
+		s.SetFuncMap(funcs)
+	}
+}
+
+// HTML renders the named template of the default set with data and writes
+// it with the given status code. A template error answers 500 instead.
+func (c *Context) HTML(code int, name string, data any) {
+	c.HTMLFromSet("", code, name, data)
+}
+
+// HTMLFromSet is like HTML but renders from the named template set.
+func (c *Context) HTMLFromSet(set string, code int, name string, data any) {
+	s := c.engine.htmlSets[set]
+	if s == nil {
+		c.engine.logger().Error("html render", "set", set, "template", name, "error", "no templates loaded")
+		c.htmlError()
+		return
+	}
+	var buf bytes.Buffer
+	if err := s.render(&buf, name, data); err != nil {
+		c.engine.logger().Error("html render", "set", set, "template", name, "error", err)
+		c.htmlError()
+		return
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(buf.Len()))
+	c.Writer.WriteHeader(code)
+	c.Writer.Write(buf.Bytes())
+}
+
+func (c *Context) htmlError() {
+	c.Writer.Header().Set("Content-Length", "0")
+	c.Writer.WriteHeader(http.StatusInternalServerError)
+	c.Abort()
+}
@@ -0,0 +1,111 @@
+package lux
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHTMLLayoutFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"views/layout.html": {Data: []byte(`<title>{{block "title" .}}lux{{end}}</title>{{block "content" .}}{{end}}`)},
+		"views/_nav.html":   {Data: []byte(`<nav>[[.]]</nav>`)},
+		"views/index.html":  {Data: []byte(`{{define "title"}}Home{{end}}{{define "content"}}{{template "_nav.html" .}}{{shout .}}{{end}}`)},
+		"views/about.html":  {Data: []byte(`{{define "content"}}about{{end}}`)},
+	}
+
+	engine := NewEngine()
+	engine.SetHTMLLayout("layout.html")
+	engine.SetFuncMap(map[string]any{"shout": func(s string) string { return s + "!" }})
+	engine.LoadHTMLFS(fsys, "views/*.html")
+	engine.Get("/:page", func(c *Context) {
+		c.HTML(http.StatusOK, c.Param("page")+".html", "hi")
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/index", http.StatusOK, "<title>Home</title><nav>[[.]]</nav>hi!"},
+		{"/about", http.StatusOK, "<title>lux</title>about"},
+		{"/missing", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		w := engine.TestRequest(http.MethodGet, tt.path, nil, nil)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+func TestHTMLSets(t *testing.T) {
+	engine := NewEngine()
+	logger := &testLogger{}
+	engine.Logger = logger
+	engine.LoadHTMLFS(fstest.MapFS{"index.html": {Data: []byte(`site {{.}}`)}}, "*.html")
+	engine.HTMLSet("admin").LoadFS(fstest.MapFS{
+		"index.html": {Data: []byte(`admin {{template "_row.html" .}}`)},
+		"_row.html":  {Data: []byte(`<td>{{.}}</td>`)},
+	}, "*.html")
+	engine.HTMLSet("email").LoadFS(fstest.MapFS{"index.html": {Data: []byte(`email {{.}}`)}}, "*.html")
+	engine.Get("/:set", func(c *Context) {
+		set := c.Param("set")
+		if set == "default" {
+			set = ""
+		}
+		c.HTMLFromSet(set, http.StatusOK, "index.html", "<b>")
+	})
+
+	// Every set renders its own index.html, escaping the data
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/default", http.StatusOK, "site &lt;b&gt;"},
+		{"/admin", http.StatusOK, "admin <td>&lt;b&gt;</td>"},
+		{"/email", http.StatusOK, "email &lt;b&gt;"},
+		{"/unknown", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		w := engine.TestRequest(http.MethodGet, tt.path, nil, nil)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+	if errs := logger.errors(); len(errs) != 1 {
+		t.Errorf("logged %q, want the unknown set", errs)
+	}
+}
+
+func TestHTMLDelims(t *testing.T) {
+	pages := fstest.MapFS{"page.html": {Data: []byte(`<div id="app">{{ message }}</div>[[.]]`)}}
+
+	engine := NewEngine()
+	engine.SetHTMLDelims("[[", "]]")
+	engine.LoadHTMLFS(pages, "*.html")
+	// Sets created after SetHTMLDelims use the delimiters too
+	engine.HTMLSet("late").LoadFS(pages, "*.html")
+	// and so do sets that change theirs after loading
+	engine.HTMLSet("own").LoadFS(fstest.MapFS{"page.html": {Data: []byte(`{{.}} <%.%>`)}}, "*.html").SetDelims("<%", "%>")
+	engine.Get("/:set", func(c *Context) {
+		set := c.Param("set")
+		if set == "default" {
+			set = ""
+		}
+		c.HTMLFromSet(set, http.StatusOK, "page.html", "hi")
+	})
+
+	tests := map[string]string{
+		"/default": `<div id="app">{{ message }}</div>hi`,
+		"/late":    `<div id="app">{{ message }}</div>hi`,
+		"/own":     `{{.}} hi`,
+	}
+	for path, want := range tests {
+		w := engine.TestRequest(http.MethodGet, path, nil, nil)
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("GET %s = %d %q, want %q", path, w.Code, w.Body.String(), want)
+		}
+	}
+}
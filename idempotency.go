@@ -0,0 +1,282 @@
+package lux
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrIdempotencyInFlight is returned by IdempotencyStore.Begin while another
+// request with the same key is being handled.
+var ErrIdempotencyInFlight = errors.New("lux: idempotent request in flight")
+
+// StoredResponse is a response recorded for replay by the Idempotency
+// middleware.
+type StoredResponse struct {
+	Status      int
+	Header      http.Header
+	Body        []byte
+	Fingerprint string // hash of the request body that produced the response
+}
+
+// IdempotencyStore keeps responses by idempotency key. Implementations
+// backed by a shared database or cache let replicas answer each other's
+// retries; they must make Begin atomic.
+type IdempotencyStore interface {
+	// Begin reserves key for a new request. It returns the stored response
+	// if the key has completed, or ErrIdempotencyInFlight if it is reserved.
+	Begin(key string, ttl time.Duration) (*StoredResponse, error)
+	// Complete stores the response of the request holding the key.
+	Complete(key string, resp *StoredResponse, ttl time.Duration) error
+	// Release drops the reservation of a request that produced no
+	// storable response, so the client can retry.
+	Release(key string) error
+}
+
+// IdempotencyOptions tunes the Idempotency middleware.
+type IdempotencyOptions struct {
+	// Store keeps the responses. Defaults to an in-memory store, which is
+	// only correct for a single instance.
+	Store IdempotencyStore
+
+	// TTL is how long responses are kept. Defaults to 24 hours.
+	TTL time.Duration
+
+	// Header carries the key. Defaults to Idempotency-Key.
+	Header string
+
+	// Required answers 400 to requests without a key
+	Required bool
+
+	// MaxBody is the largest response that is stored. Larger responses
+	// are sent but not recorded, so retries run again. Defaults to 1MB.
+	MaxBody int
+
+	// MaxRequestBody is the largest request body read into memory to
+	// fingerprint the request. Larger bodies answer 413. Defaults to 1MB.
+	MaxRequestBody int64
+}
+
+// Idempotency returns middleware implementing the Idempotency-Key pattern
+// for POST and PATCH requests. The first response for a key is stored and
+// replayed, with an Idempotent-Replayed header, for retries carrying the
+// same key. A retry that arrives while the first request is still running
+// answers 409 Conflict, and reusing a key with a different body answers 422.
+// Server errors are not stored, so that a failed request can be retried.
+// Keys are scoped to the method and path.
+func Idempotency(opts IdempotencyOptions) HandlerFunc {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+	if opts.MaxBody <= 0 {
+		opts.MaxBody = 1 << 20
+	}
+	if opts.MaxRequestBody <= 0 {
+		opts.MaxRequestBody = 1 << 20
+	}
+
+	return func(c *Context) {
+		method := c.Request.Method
+		if method != http.MethodPost && method != http.MethodPatch {
+			c.Next()
+			return
+		}
+		key := c.Request.Header.Get(opts.Header)
+		if key == "" {
+			if opts.Required {
+				abortWithStatus(c, http.StatusBadRequest)
+				return
+			}
+			c.Next()
+			return
+		}
+		key = method + " " + c.Request.URL.Path + " " + key
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, opts.MaxRequestBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortWithStatus(c, http.StatusRequestEntityTooLarge)
+				return
+			}
+			abortWithStatus(c, http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		stored, err := opts.Store.Begin(key, opts.TTL)
+		switch {
+		case errors.Is(err, ErrIdempotencyInFlight):
+			abortWithStatus(c, http.StatusConflict)
+			return
+		case err != nil:
+			c.engine.logger().Error("idempotency store", "route", c.RouteLabel(), "error", err)
+			abortWithStatus(c, http.StatusInternalServerError)
+			return
+		case stored != nil:
+			if stored.Fingerprint != fingerprint {
+				abortWithStatus(c, http.StatusUnprocessableEntity)
+				return
+			}
+			replay(c, stored)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: c.Writer, max: opts.MaxBody}
+		c.Writer = rec
+		completed := false
+		defer func() {
+			c.Writer = rec.ResponseWriter
+			if !completed {
+				opts.Store.Release(key)
+			}
+		}()
+
+		c.Next()
+
+		if rec.Status() >= 500 || rec.overflow || rec.hijacked {
+			return
+		}
+		resp := &StoredResponse{
+			Status:      rec.Status(),
+			Header:      rec.Header().Clone(),
+			Body:        rec.body.Bytes(),
+			Fingerprint: fingerprint,
+		}
+		if err := opts.Store.Complete(key, resp, opts.TTL); err != nil {
+			c.engine.logger().Error("idempotency store", "route", c.RouteLabel(), "error", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// replay writes a stored response.
+func replay(c *Context, r *StoredResponse) {
+	h := c.Writer.Header()
+	for k, v := range r.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("Idempotent-Replayed", "true")
+	h.Set("Content-Length", strconv.Itoa(len(r.Body)))
+	c.Writer.WriteHeader(r.Status)
+	c.Writer.Write(r.Body)
+	c.Abort()
+}
+
+func abortWithStatus(c *Context, code int) {
+	c.Writer.Header().Set("Content-Length", "0")
+	c.Writer.WriteHeader(code)
+	c.Abort()
+}
+
+// recordingWriter copies the response body as it is written.
+type recordingWriter struct {
+	ResponseWriter
+	body     bytes.Buffer
+	max      int
+	overflow bool
+	hijacked bool
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *recordingWriter) record(b []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(b) > w.max {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(b)
+}
+
+func (w *recordingWriter) Hijack() (conn net.Conn, rw *bufio.ReadWriter, err error) {
+	w.hijacked = true
+	return w.ResponseWriter.Hijack()
+}
+
+// memoryIdempotencyStore is the default IdempotencyStore.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	sweep   time.Time
+}
+
+type idempotencyEntry struct {
+	resp    *StoredResponse // nil while in flight
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an IdempotencyStore that keeps responses
+// in process memory.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{entries: make(map[string]*idempotencyEntry)}
+}
+
+func (s *memoryIdempotencyStore) Begin(key string, ttl time.Duration) (*StoredResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// Drop expired entries now and then rather than on every call
+	if now.After(s.sweep) {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.sweep = now.Add(time.Minute)
+	}
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.resp == nil {
+			return nil, ErrIdempotencyInFlight
+		}
+		return e.resp, nil
+	}
+	s.entries[key] = &idempotencyEntry{expires: now.Add(ttl)}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(key string, resp *StoredResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &idempotencyEntry{resp: resp, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.resp == nil {
+		delete(s.entries, key)
+	}
+	return nil
+}
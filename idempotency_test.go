@@ -0,0 +1,36 @@
+package lux
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIdempotency(t *testing.T) {
+	engine := NewEngine()
+	engine.Use(Idempotency(IdempotencyOptions{MaxRequestBody: 16}))
+	calls := 0
+	engine.Post("/orders", func(c *Context) {
+		calls++
+		c.WriteResponse("created")
+	})
+	key := http.Header{"Idempotency-Key": {"k1"}}
+
+	w := engine.TestRequest(http.MethodPost, "/orders", strings.NewReader("item=1"), key)
+	if w.Code != http.StatusOK || w.Body.String() != "created" {
+		t.Fatalf("POST = %d %q", w.Code, w.Body.String())
+	}
+	w = engine.TestRequest(http.MethodPost, "/orders", strings.NewReader("item=1"), key)
+	if w.Header().Get("Idempotent-Replayed") != "true" || calls != 1 {
+		t.Errorf("retry replayed %q after %d calls", w.Header().Get("Idempotent-Replayed"), calls)
+	}
+	w = engine.TestRequest(http.MethodPost, "/orders", strings.NewReader("item=2"), key)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with another body = %d, want 422", w.Code)
+	}
+
+	w = engine.TestRequest(http.MethodPost, "/orders", strings.NewReader(strings.Repeat("x", 17)), http.Header{"Idempotency-Key": {"k2"}})
+	if w.Code != http.StatusRequestEntityTooLarge || calls != 1 {
+		t.Errorf("oversized body = %d after %d calls, want 413", w.Code, calls)
+	}
+}
@@ -0,0 +1,36 @@
+// Package reuseport opens TCP listeners with SO_REUSEPORT so that several
+// sockets can share one address and the kernel balances new connections
+// across them.
+package reuseport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrUnsupported is returned by Listen on platforms without SO_REUSEPORT
+// support.
+var ErrUnsupported = errors.New("reuseport: SO_REUSEPORT is not supported on this platform")
+
+// Listen announces on the local TCP address with SO_REUSEPORT set.
+func Listen(addr string) (net.Listener, error) {
+	if !supported {
+		return nil, ErrUnsupported
+	}
+	lc := net.ListenConfig{Control: control}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// control sets SO_REUSEPORT on the socket before it is bound.
+func control(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = setReusePort(fd)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
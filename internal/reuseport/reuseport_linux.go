@@ -0,0 +1,15 @@
+//go:build linux && (386 || amd64 || arm || arm64 || loong64 || ppc64 || ppc64le || riscv64 || s390x)
+
+package reuseport
+
+import "syscall"
+
+// soReusePort is SO_REUSEPORT from asm-generic/socket.h, which the syscall
+// package does not define.
+const soReusePort = 0xf
+
+const supported = true
+
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+}
@@ -0,0 +1,40 @@
+//go:build linux && (386 || amd64 || arm || arm64 || loong64 || ppc64 || ppc64le || riscv64 || s390x)
+
+package reuseport
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	first, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	raw, err := first.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		v, serr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort)
+	})
+	if err != nil || serr != nil {
+		t.Fatal(err, serr)
+	}
+	if v != 1 {
+		t.Errorf("SO_REUSEPORT = %d, want 1", v)
+	}
+
+	// A second socket can bind the same address
+	second, err := Listen(first.Addr().String())
+	if err != nil {
+		t.Fatalf("second listener on %s: %v", first.Addr(), err)
+	}
+	second.Close()
+}
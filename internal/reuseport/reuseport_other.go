@@ -0,0 +1,9 @@
+//go:build !linux || !(386 || amd64 || arm || arm64 || loong64 || ppc64 || ppc64le || riscv64 || s390x)
+
+package reuseport
+
+const supported = false
+
+func setReusePort(fd uintptr) error {
+	return ErrUnsupported
+}
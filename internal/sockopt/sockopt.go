@@ -0,0 +1,73 @@
+// Package sockopt applies TCP socket options to accepted connections. It is
+// shared by the HTTP engine and the ws server, which both expose Options as
+// their SocketOptions type.
+package sockopt
+
+import (
+	"net"
+	"time"
+)
+
+// Options tunes accepted TCP sockets. The zero value keeps Go's defaults:
+// keep-alive probes every 15 seconds and TCP_NODELAY set.
+type Options struct {
+	// KeepAlive is the TCP keep-alive period. Negative disables keep-alive.
+	KeepAlive time.Duration `json:"keep_alive"`
+
+	// DisableNoDelay clears TCP_NODELAY so small writes are coalesced
+	DisableNoDelay bool `json:"disable_no_delay"`
+
+	// ReadBuffer and WriteBuffer set SO_RCVBUF and SO_SNDBUF in bytes
+	ReadBuffer  int `json:"read_buffer"`
+	WriteBuffer int `json:"write_buffer"`
+}
+
+// IsZero reports whether o leaves the socket untouched.
+func (o Options) IsZero() bool {
+	return o == Options{}
+}
+
+// Apply sets the options on conn. TLS connections are configured through
+// the connection they wrap; connections that are not TCP are left alone.
+func Apply(conn net.Conn, o Options) error {
+	if nc, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = nc.NetConn()
+	}
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case o.KeepAlive > 0:
+		err := tc.SetKeepAliveConfig(net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     o.KeepAlive,
+			Interval: o.KeepAlive,
+		})
+		if err != nil {
+			return err
+		}
+	case o.KeepAlive < 0:
+		if err := tc.SetKeepAlive(false); err != nil {
+			return err
+		}
+	}
+
+	if o.DisableNoDelay {
+		if err := tc.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	if o.ReadBuffer > 0 {
+		if err := tc.SetReadBuffer(o.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if o.WriteBuffer > 0 {
+		if err := tc.SetWriteBuffer(o.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
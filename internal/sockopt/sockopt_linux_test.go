@@ -0,0 +1,103 @@
+package sockopt
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// accepted returns the server side of a loopback TCP connection.
+func accepted(t *testing.T) *net.TCPConn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.(*net.TCPConn)
+}
+
+// getsockopt reads an integer socket option of conn.
+func getsockopt(t *testing.T, conn *net.TCPConn, level, opt int) int {
+	t.Helper()
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		v, serr = syscall.GetsockoptInt(int(fd), level, opt)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	return v
+}
+
+func TestApply(t *testing.T) {
+	conn := accepted(t)
+	err := Apply(conn, Options{
+		KeepAlive:      42 * time.Second,
+		DisableNoDelay: true,
+		ReadBuffer:     64 << 10,
+		WriteBuffer:    64 << 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		level, opt int
+		want       int
+	}{
+		{"SO_KEEPALIVE", syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1},
+		{"TCP_KEEPIDLE", syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, 42},
+		{"TCP_KEEPINTVL", syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, 42},
+		{"TCP_NODELAY", syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 0},
+	}
+	for _, tt := range tests {
+		if got := getsockopt(t, conn, tt.level, tt.opt); got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	// The kernel doubles buffer sizes for its bookkeeping
+	for name, opt := range map[string]int{"SO_RCVBUF": syscall.SO_RCVBUF, "SO_SNDBUF": syscall.SO_SNDBUF} {
+		if got := getsockopt(t, conn, syscall.SOL_SOCKET, opt); got < 64<<10 {
+			t.Errorf("%s = %d, want at least %d", name, got, 64<<10)
+		}
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	conn := accepted(t)
+	if err := Apply(conn, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getsockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); got != 1 {
+		t.Errorf("TCP_NODELAY = %d with zero Options, want Go's default of 1", got)
+	}
+
+	conn = accepted(t)
+	if err := Apply(conn, Options{KeepAlive: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getsockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); got != 0 {
+		t.Errorf("SO_KEEPALIVE = %d with negative KeepAlive, want 0", got)
+	}
+}
@@ -0,0 +1,107 @@
+package lux
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"slices"
+)
+
+// IntrospectionHandler serves the engine's route table, configuration,
+// connection gauges and build information as JSON, for operators and
+// tooling that audit deployments. The output reveals the application's
+// internals, so mount it behind authentication:
+//
+//	admin := engine.Group("/admin", requireAdmin)
+//	admin.Get("/introspect", engine.IntrospectionHandler())
+func (e *Engine) IntrospectionHandler() HandlerFunc {
+	return func(c *Context) {
+		c.Writer.Header().Set("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, e.introspect())
+	}
+}
+
+type introspection struct {
+	Routes      []routeJSON `json:"routes"`
+	Config      configJSON  `json:"config"`
+	Connections ConnStats   `json:"connections"`
+	Build       buildJSON   `json:"build"`
+}
+
+type routeJSON struct {
+	Method     string         `json:"method"`
+	Path       string         `json:"path"`
+	Handler    string         `json:"handler"`
+	Group      string         `json:"group,omitempty"`
+	Middleware []string       `json:"middleware"`
+	Label      string         `json:"label,omitempty"`
+	Meta       map[string]any `json:"meta,omitempty"`
+}
+
+type configJSON struct {
+	MaxMultipartMemory int64              `json:"max_multipart_memory"`
+	MaxBodyDrain       int64              `json:"max_body_drain"`
+	ResponseBufferSize int                `json:"response_buffer_size"`
+	ServerHeader       string             `json:"server_header,omitempty"`
+	SocketOptions      SocketOptions      `json:"socket_options"`
+	WorkerPool         *WorkerPoolOptions `json:"worker_pool,omitempty"`
+	FileOffload        *FileOffload       `json:"file_offload,omitempty"`
+	Logger             string             `json:"logger"`
+	HTMLSets           []string           `json:"html_sets,omitempty"`
+}
+
+type buildJSON struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+func (e *Engine) introspect() introspection {
+	var out introspection
+	for _, r := range e.Routes() {
+		out.Routes = append(out.Routes, routeJSON{
+			Method:     r.Method,
+			Path:       r.Path,
+			Handler:    r.Handler,
+			Group:      r.Group,
+			Middleware: r.Middleware,
+			Label:      r.Label,
+			Meta:       r.Meta,
+		})
+	}
+
+	out.Config = configJSON{
+		MaxMultipartMemory: e.MaxMultipartMemory,
+		MaxBodyDrain:       e.maxBodyDrain(),
+		ResponseBufferSize: e.responseBufferSize(),
+		ServerHeader:       e.ServerHeader,
+		SocketOptions:      e.SocketOptions,
+		FileOffload:        e.FileOffload,
+		Logger:             fmt.Sprintf("%T", e.logger()),
+	}
+	if e.workers != nil {
+		out.Config.WorkerPool = &e.workers.opts
+	}
+	for name := range e.htmlSets {
+		out.Config.HTMLSets = append(out.Config.HTMLSets, name)
+	}
+	slices.Sort(out.Config.HTMLSets)
+
+	out.Connections = e.Stats()
+
+	out.Build.GoVersion = runtime.Version()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		out.Build.Path = info.Main.Path
+		out.Build.Version = info.Main.Version
+		// VCS revision, time and dirty flag, plus build flags
+		for _, s := range info.Settings {
+			if out.Build.Settings == nil {
+				out.Build.Settings = make(map[string]string)
+			}
+			out.Build.Settings[s.Key] = s.Value
+		}
+	}
+	return out
+}
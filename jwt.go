@@ -0,0 +1,269 @@
+package lux
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JWTAuthenticator checks a JSON Web Token sent as a bearer token. HMAC
+// tokens (HS256, HS384, HS512) are verified with Secret; RSA (RS256,
+// RS384, RS512), ECDSA (ES256, ES384) and Ed25519 (EdDSA) tokens with
+// PublicKey. Tokens signed with any other algorithm, or "none", are
+// rejected.
+type JWTAuthenticator struct {
+	Secret    []byte
+	PublicKey crypto.PublicKey
+
+	// Issuer and Audience, if set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+
+	// Leeway tolerates clock skew when checking exp and nbf
+	Leeway time.Duration
+
+	// Realm is announced in the Bearer challenge
+	Realm string
+}
+
+func (a *JWTAuthenticator) Authenticate(c *Context) (*Principal, error) {
+	token, ok := bearerToken(c)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	p := &Principal{Method: "jwt", Claims: claims}
+	p.ID, _ = claims["sub"].(string)
+	switch roles := claims["roles"].(type) {
+	case []any:
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				p.Roles = append(p.Roles, s)
+			}
+		}
+	case string:
+		p.Roles = strings.Fields(roles)
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		p.Roles = append(p.Roles, strings.Fields(scope)...)
+	}
+	return p, nil
+}
+
+func (a *JWTAuthenticator) Challenge() string {
+	if a.Realm == "" {
+		return "Bearer"
+	}
+	return `Bearer realm="` + strings.ReplaceAll(a.Realm, `"`, `\"`) + `"`
+}
+
+// JWTAuth returns middleware requiring a bearer token verified by a. Like
+// Auth, it panics if a has neither a Secret nor a PublicKey.
+func JWTAuth(a *JWTAuthenticator) HandlerFunc {
+	return Auth(a)
+}
+
+// validate reports a configuration that cannot verify any token. An empty
+// Secret, typically read from an unset environment variable, would
+// otherwise sign and verify tokens with the empty key.
+func (a *JWTAuthenticator) validate() error {
+	if a.Secret != nil && len(a.Secret) == 0 {
+		return errors.New("lux: JWTAuthenticator with an empty Secret")
+	}
+	if len(a.Secret) == 0 && a.PublicKey == nil {
+		return errors.New("lux: JWTAuthenticator needs a Secret or a PublicKey")
+	}
+	return nil
+}
+
+// verify checks the token's signature and registered claims and returns
+// its claims.
+func (a *JWTAuthenticator) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("lux: malformed JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("lux: malformed JWT signature")
+	}
+	if err := a.checkSignature(header.Alg, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errors.New("lux: malformed JWT")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.New("lux: malformed JWT")
+	}
+	return nil
+}
+
+var errJWTSignature = errors.New("lux: invalid JWT signature")
+
+// jwtCurves maps each ECDSA algorithm to the one curve it is defined for
+// (RFC 7518 section 3.4).
+var jwtCurves = map[string]string{"ES256": "P-256", "ES384": "P-384"}
+
+func (a *JWTAuthenticator) checkSignature(alg, signed string, sig []byte) error {
+	var h func() hash.Hash
+	var ch crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		h, ch = sha256.New, crypto.SHA256
+	case "384":
+		h, ch = sha512.New384, crypto.SHA384
+	case "512":
+		h, ch = sha512.New, crypto.SHA512
+	}
+
+	switch {
+	case strings.HasPrefix(alg, "HS") && h != nil && len(a.Secret) > 0:
+		mac := hmac.New(h, a.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errJWTSignature
+		}
+		return nil
+
+	case strings.HasPrefix(alg, "RS") && h != nil:
+		key, ok := a.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			break
+		}
+		digest := h()
+		digest.Write([]byte(signed))
+		if rsa.VerifyPKCS1v15(key, ch, digest.Sum(nil), sig) != nil {
+			return errJWTSignature
+		}
+		return nil
+
+	case (alg == "ES256" || alg == "ES384") && h != nil:
+		key, ok := a.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			break
+		}
+		if key.Curve.Params().Name != jwtCurves[alg] {
+			return errJWTSignature
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errJWTSignature
+		}
+		digest := h()
+		digest.Write([]byte(signed))
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest.Sum(nil), r, s) {
+			return errJWTSignature
+		}
+		return nil
+
+	case alg == "EdDSA":
+		key, ok := a.PublicKey.(ed25519.PublicKey)
+		if !ok {
+			break
+		}
+		if !ed25519.Verify(key, []byte(signed), sig) {
+			return errJWTSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("lux: unsupported JWT algorithm %q", alg)
+}
+
+func (a *JWTAuthenticator) checkClaims(claims map[string]any) error {
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok {
+		t, ok := unixTime(exp)
+		if !ok {
+			return errors.New("lux: JWT exp out of range")
+		}
+		if now.After(t.Add(a.Leeway)) {
+			return errors.New("lux: JWT expired")
+		}
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		t, ok := unixTime(nbf)
+		if !ok {
+			return errors.New("lux: JWT nbf out of range")
+		}
+		if now.Add(a.Leeway).Before(t) {
+			return errors.New("lux: JWT not valid yet")
+		}
+	}
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return errors.New("lux: JWT issuer mismatch")
+	}
+	if a.Audience != "" && !hasAudience(claims["aud"], a.Audience) {
+		return errors.New("lux: JWT audience mismatch")
+	}
+	return nil
+}
+
+// maxJWTSeconds bounds NumericDate claims so that they convert to
+// nanoseconds without overflowing, which could turn a far-future time into
+// one in the past.
+const maxJWTSeconds = math.MaxInt64 / float64(time.Second)
+
+// unixTime converts a NumericDate claim, reporting false if it is out of
+// range.
+func unixTime(seconds float64) (time.Time, bool) {
+	if math.IsNaN(seconds) || seconds >= maxJWTSeconds || seconds <= -maxJWTSeconds {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// hasAudience reports whether the aud claim, a string or a list of
+// strings, contains audience.
+func hasAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
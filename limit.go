@@ -0,0 +1,74 @@
+package lux
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ConcurrencyOptions tunes ConcurrencyLimit.
+type ConcurrencyOptions struct {
+	// Wait is how long a request may wait for a free slot. Zero rejects
+	// requests as soon as every slot is taken.
+	Wait time.Duration
+
+	// Status answers rejected requests. Defaults to 503 Service
+	// Unavailable; 429 Too Many Requests suits per-client limits better.
+	Status int
+
+	// RetryAfter, if set, is sent in the Retry-After header of rejections
+	RetryAfter time.Duration
+}
+
+// ConcurrencyLimit returns middleware that lets at most n requests run the
+// rest of the chain at once, for routes backed by scarce resources such as
+// report generation. Each call creates an independent limit, so attach it
+// to the routes that share the resource:
+//
+//	engine.Get("/reports/:id", lux.ConcurrencyLimit(4, lux.ConcurrencyOptions{
+//		Wait: 2 * time.Second,
+//	}), renderReport)
+func ConcurrencyLimit(n int, opts ...ConcurrencyOptions) HandlerFunc {
+	var o ConcurrencyOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Status == 0 {
+		o.Status = http.StatusServiceUnavailable
+	}
+	slots := make(chan struct{}, n)
+
+	return func(c *Context) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			if o.Wait <= 0 || !acquireSlot(c, slots, o.Wait) {
+				h := c.Writer.Header()
+				if o.RetryAfter > 0 {
+					h.Set("Retry-After", strconv.Itoa(int((o.RetryAfter+time.Second-1)/time.Second)))
+				}
+				h.Set("Content-Length", "0")
+				c.Writer.WriteHeader(o.Status)
+				c.Abort()
+				return
+			}
+		}
+		defer func() { <-slots }()
+		c.Next()
+	}
+}
+
+// acquireSlot waits up to wait for a free slot, giving up early if the
+// request is canceled.
+func acquireSlot(c *Context, slots chan struct{}, wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-c.Request.Context().Done():
+		return false
+	}
+}
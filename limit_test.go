@@ -0,0 +1,82 @@
+package lux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	engine := NewEngine()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	engine.Get("/reject", ConcurrencyLimit(1, ConcurrencyOptions{
+		Status:     http.StatusTooManyRequests,
+		RetryAfter: 1500 * time.Millisecond,
+	}), func(c *Context) {
+		entered <- struct{}{}
+		<-release
+	})
+	engine.Get("/queue", ConcurrencyLimit(1, ConcurrencyOptions{Wait: 2 * time.Second}), func(c *Context) {
+		entered <- struct{}{}
+		<-release
+		c.WriteResponse("done")
+	})
+	serve := func(path string) <-chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			done <- w
+		}()
+		return done
+	}
+
+	// A request over the limit is rejected while the slot is taken
+	first := serve("/reject")
+	<-entered
+	w := <-serve("/reject")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("request over the limit = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	release <- struct{}{}
+	<-first
+	second := serve("/reject")
+	<-entered
+	release <- struct{}{}
+	if w := <-second; w.Code != http.StatusOK {
+		t.Errorf("request after the slot was freed = %d", w.Code)
+	}
+
+	// With Wait, it queues until the slot is freed
+	first = serve("/queue")
+	<-entered
+	second = serve("/queue")
+	select {
+	case <-entered:
+		t.Fatal("second request ran while the slot was taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	<-entered
+	release <- struct{}{}
+	for _, done := range []<-chan *httptest.ResponseRecorder{first, second} {
+		if w := <-done; w.Code != http.StatusOK || w.Body.String() != "done" {
+			t.Errorf("queued request = %d %q", w.Code, w.Body.String())
+		}
+	}
+
+	// A request that waits too long is rejected with the default status
+	engine.Get("/short", ConcurrencyLimit(1, ConcurrencyOptions{Wait: 20 * time.Millisecond}), func(c *Context) {
+		entered <- struct{}{}
+		<-release
+	})
+	first = serve("/short")
+	<-entered
+	if w := <-serve("/short"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request waiting past Wait = %d, want 503", w.Code)
+	}
+	release <- struct{}{}
+	<-first
+}
@@ -0,0 +1,132 @@
+package lux
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Logger receives lux's internal log output: accept-loop and request
+// parsing errors, recovered panics and similar events. Messages come with
+// alternating key/value pairs, as in log/slog, so a *slog.Logger can be used
+// directly; adapters are provided for zap and logrus style loggers.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// DefaultLogger is used by engines without a Logger and by code that runs
+// outside an engine. It writes debug and info lines to DefaultWriter and
+// errors to DefaultErrorWriter.
+var DefaultLogger Logger = writerLogger{}
+
+// logger returns the engine's logger, falling back to DefaultLogger.
+// Output below the configured LogLevel is dropped.
+func (e *Engine) logger() Logger {
+	if e == nil {
+		return DefaultLogger
+	}
+	l := e.Logger
+	if l == nil {
+		l = DefaultLogger
+	}
+	if level := e.config().LogLevel; level > LevelDebug {
+		return levelLogger{l, level}
+	}
+	return l
+}
+
+// levelLogger drops messages below its level.
+type levelLogger struct {
+	Logger
+	level LogLevel
+}
+
+func (l levelLogger) Debug(msg string, args ...any) {}
+
+func (l levelLogger) Info(msg string, args ...any) {
+	if l.level <= LevelInfo {
+		l.Logger.Info(msg, args...)
+	}
+}
+
+// writerLogger is the default Logger.
+type writerLogger struct{}
+
+func (writerLogger) Debug(msg string, args ...any) {
+	writeLog(DefaultWriter, "[LUX-debug] ", msg, args)
+}
+
+func (writerLogger) Info(msg string, args ...any) {
+	writeLog(DefaultWriter, "[LUX] ", msg, args)
+}
+
+func (writerLogger) Error(msg string, args ...any) {
+	writeLog(DefaultErrorWriter, "[LUX-error] ", msg, args)
+}
+
+func writeLog(w io.Writer, prefix, msg string, args []any) {
+	fmt.Fprintln(w, prefix+msg+formatArgs(args))
+}
+
+// formatArgs renders key/value pairs as " key=value" for text loggers.
+func formatArgs(args []any) string {
+	var b strings.Builder
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	return b.String()
+}
+
+// NewSlogLogger adapts a *slog.Logger; nil selects slog.Default().
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return l
+}
+
+// ZapSugaredLogger is the subset of *zap.SugaredLogger used by NewZapLogger.
+type ZapSugaredLogger interface {
+	Debugw(msg string, keysAndValues ...any)
+	Infow(msg string, keysAndValues ...any)
+	Errorw(msg string, keysAndValues ...any)
+}
+
+// NewZapLogger adapts a *zap.SugaredLogger, keeping key/value pairs as
+// structured fields.
+func NewZapLogger(l ZapSugaredLogger) Logger {
+	return zapLogger{l}
+}
+
+type zapLogger struct{ l ZapSugaredLogger }
+
+func (z zapLogger) Debug(msg string, args ...any) { z.l.Debugw(msg, args...) }
+func (z zapLogger) Info(msg string, args ...any)  { z.l.Infow(msg, args...) }
+func (z zapLogger) Error(msg string, args ...any) { z.l.Errorw(msg, args...) }
+
+// PrintfLogger is the subset of logrus.FieldLogger (and similar printf-style
+// loggers) used by NewLogrusLogger.
+type PrintfLogger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// NewLogrusLogger adapts a logrus logger or entry. Key/value pairs are
+// appended to the message as key=value.
+func NewLogrusLogger(l PrintfLogger) Logger {
+	return printfLogger{l}
+}
+
+type printfLogger struct{ l PrintfLogger }
+
+func (p printfLogger) Debug(msg string, args ...any) { p.l.Debugf("%s", msg+formatArgs(args)) }
+func (p printfLogger) Info(msg string, args ...any)  { p.l.Infof("%s", msg+formatArgs(args)) }
+func (p printfLogger) Error(msg string, args ...any) { p.l.Errorf("%s", msg+formatArgs(args)) }
@@ -16,6 +16,15 @@ type RouteInfo struct {
 	Path        string
 	Handler     string
 	HandlerFunc HandlerFunc
+
+	// Group is the base path of the group the route was registered on
+	Group string
+	// Middleware names the handlers that run before Handler, in order
+	Middleware []string
+	// Label is the route's log and metrics label, if set with WithLabel
+	Label string
+	// Meta holds the metadata attached with WithMeta
+	Meta map[string]any
 }
 
 type RoutesInfo []RouteInfo
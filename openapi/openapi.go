@@ -0,0 +1,235 @@
+// Package openapi generates an OpenAPI 3 document from a lux route table.
+//
+// Every registered route becomes an operation, with path parameters taken
+// from the route pattern. Routes can be described further with Describe,
+// whose request, query and response types are turned into schemas from
+// their json, form and binding struct tags:
+//
+//	gen := openapi.New(openapi.Info{Title: "Users", Version: "1.0"})
+//	gen.Describe("POST", "/users", openapi.RouteDoc{
+//		Summary:  "Create a user",
+//		Request:  CreateUser{},
+//		Response: User{},
+//		Status:   201,
+//	})
+//	engine.Get("/openapi.json", gen.Handler(engine))
+//	engine.Get("/docs", openapi.SwaggerUI("/openapi.json"))
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/edgflow/lux"
+)
+
+// Version is the OpenAPI version emitted by the generator.
+const Version = "3.0.3"
+
+// Document is the root of an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components *Components         `json:"components,omitempty"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower-case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+// Operation describes a single route.
+type Operation struct {
+	Summary     string              `json:"summary,omitempty"`
+	Description string              `json:"description,omitempty"`
+	OperationID string              `json:"operationId,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body in one content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the reusable schemas referenced from operations.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// RouteDoc describes a route beyond what the route table knows. Request,
+// Query and Response take a value (typically a zero struct) whose type is
+// turned into a schema.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	OperationID string
+
+	// Request is decoded from the JSON request body
+	Request any
+	// Query is a struct whose form tags name the query parameters
+	Query any
+	// Response is encoded as the JSON body of a successful response
+	Response any
+	// Status of a successful response, 200 when zero
+	Status int
+}
+
+// Generator builds OpenAPI documents from route tables.
+type Generator struct {
+	Info Info
+
+	mu   sync.Mutex
+	docs map[string]RouteDoc
+}
+
+// New creates a generator for an API described by info.
+func New(info Info) *Generator {
+	return &Generator{Info: info, docs: make(map[string]RouteDoc)}
+}
+
+// Describe attaches documentation to the route registered for method and
+// path, using the same pattern the route was registered with.
+func (g *Generator) Describe(method, path string, doc RouteDoc) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.docs[method+" "+path] = doc
+}
+
+// Generate builds a document covering every route in routes.
+func (g *Generator) Generate(routes lux.RoutesInfo) *Document {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	schemas := newSchemaSet()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    g.Info,
+		Paths:   make(map[string]PathItem),
+	}
+
+	for _, route := range routes {
+		path, params := convertPath(route.Path)
+		item := doc.Paths[path]
+		if item == nil {
+			item = make(PathItem)
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = g.operation(route, params, schemas)
+	}
+
+	if len(schemas.named) > 0 {
+		doc.Components = &Components{Schemas: schemas.named}
+	}
+	return doc
+}
+
+// operation builds the operation for one route.
+func (g *Generator) operation(route lux.RouteInfo, params []string, schemas *schemaSet) *Operation {
+	rd := g.docs[route.Method+" "+route.Path]
+	op := &Operation{
+		Summary:     rd.Summary,
+		Description: rd.Description,
+		OperationID: rd.OperationID,
+		Tags:        rd.Tags,
+		Responses:   make(map[string]Response),
+	}
+
+	for _, name := range params {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	if rd.Query != nil {
+		op.Parameters = append(op.Parameters, queryParameters(rd.Query, schemas)...)
+	}
+
+	if rd.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  jsonContent(schemas.of(rd.Request)),
+		}
+	}
+
+	status := rd.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	resp := Response{Description: http.StatusText(status)}
+	if rd.Response != nil {
+		resp.Content = jsonContent(schemas.of(rd.Response))
+	}
+	op.Responses[strconv.Itoa(status)] = resp
+	return op
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+// convertPath turns a lux route pattern into an OpenAPI path template and
+// returns the parameter names in order.
+func convertPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, seg := range segments {
+		if len(seg) > 1 && (seg[0] == ':' || seg[0] == '*') {
+			params = append(params, seg[1:])
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// Handler serves the document for the engine's routes as JSON. The document
+// is generated on the first request, once every route has been registered.
+func (g *Generator) Handler(engine *lux.Engine) lux.HandlerFunc {
+	var (
+		once sync.Once
+		body []byte
+	)
+	return func(c *lux.Context) {
+		once.Do(func() {
+			body, _ = json.Marshal(g.Generate(engine.Routes()))
+		})
+		c.Writer.Header().Set("Content-Type", "application/json")
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		c.Writer.Write(body)
+	}
+}
@@ -0,0 +1,121 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/edgflow/lux"
+)
+
+type createUser struct {
+	Name  string `json:"name" binding:"required" description:"display name"`
+	Email string `json:"email,omitempty"`
+}
+
+type user struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Manager *user     `json:"manager"`
+	secret  string
+}
+
+type listQuery struct {
+	Page   int    `form:"page" binding:"required"`
+	Filter string `form:"q"`
+}
+
+func TestGenerate(t *testing.T) {
+	engine := lux.NewEngine()
+	engine.Get("/users", func(c *lux.Context) {})
+	engine.Post("/users", func(c *lux.Context) {})
+	engine.Get("/users/:id", func(c *lux.Context) {})
+	engine.Get("/files/*path", func(c *lux.Context) {})
+
+	gen := New(Info{Title: "Users", Version: "1.0"})
+	gen.Describe(http.MethodGet, "/users", RouteDoc{Query: listQuery{}, Response: []user{}})
+	gen.Describe(http.MethodPost, "/users", RouteDoc{
+		Summary:  "Create a user",
+		Request:  createUser{},
+		Response: user{},
+		Status:   http.StatusCreated,
+	})
+	doc := gen.Generate(engine.Routes())
+
+	if doc.OpenAPI != Version || doc.Info.Title != "Users" {
+		t.Errorf("header = %q %+v", doc.OpenAPI, doc.Info)
+	}
+	for _, path := range []string{"/users", "/users/{id}", "/files/{path}"} {
+		if doc.Paths[path] == nil {
+			t.Errorf("missing path %s in %v", path, doc.Paths)
+		}
+	}
+
+	get := doc.Paths["/users/{id}"]["get"]
+	if len(get.Parameters) != 1 || get.Parameters[0] != (Parameter{Name: "id", In: "path", Required: true, Schema: get.Parameters[0].Schema}) {
+		t.Errorf("path parameters = %+v", get.Parameters)
+	}
+	if _, ok := get.Responses["200"]; !ok {
+		t.Errorf("default response = %v, want 200", get.Responses)
+	}
+
+	list := doc.Paths["/users"]["get"]
+	var names []string
+	for _, p := range list.Parameters {
+		names = append(names, p.Name)
+		if p.In != "query" || p.Required != (p.Name == "page") {
+			t.Errorf("query parameter %+v", p)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"page", "q"}) {
+		t.Errorf("query parameters = %v", names)
+	}
+	if items := list.Responses["200"].Content["application/json"].Schema; items.Type != "array" || items.Items.Ref != "#/components/schemas/user" {
+		t.Errorf("list response schema = %+v", items)
+	}
+
+	create := doc.Paths["/users"]["post"]
+	if create.Summary != "Create a user" || create.RequestBody == nil || !create.RequestBody.Required {
+		t.Fatalf("create operation = %+v", create)
+	}
+	if resp, ok := create.Responses["201"]; !ok || resp.Description != "Created" {
+		t.Errorf("create responses = %v", create.Responses)
+	}
+
+	req := doc.Components.Schemas["createUser"]
+	if req == nil || !reflect.DeepEqual(req.Required, []string{"name"}) || req.Properties["name"].Description != "display name" {
+		t.Errorf("createUser schema = %+v", req)
+	}
+	u := doc.Components.Schemas["user"]
+	if u == nil {
+		t.Fatal("user schema missing")
+	}
+	if len(u.Properties) != 4 || u.Properties["id"].Format != "int64" || u.Properties["created"].Format != "date-time" {
+		t.Errorf("user properties = %+v", u.Properties)
+	}
+	if u.Properties["manager"].Ref != "#/components/schemas/user" {
+		t.Errorf("recursive field = %+v", u.Properties["manager"])
+	}
+}
+
+func TestHandler(t *testing.T) {
+	engine := lux.NewEngine()
+	gen := New(Info{Title: "API", Version: "2"})
+	engine.Get("/openapi.json", gen.Handler(engine))
+	engine.Delete("/items/:id", func(c *lux.Context) {})
+
+	w := engine.TestRequest(http.MethodGet, "/openapi.json", nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /openapi.json = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var doc Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Paths["/items/{id}"]["delete"] == nil || doc.Paths["/openapi.json"]["get"] == nil {
+		t.Errorf("paths = %v", doc.Paths)
+	}
+}
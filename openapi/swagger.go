@@ -0,0 +1,43 @@
+package openapi
+
+import (
+	"html/template"
+	"strconv"
+	"strings"
+
+	"github.com/edgflow/lux"
+)
+
+// SwaggerUIVersion is the swagger-ui release loaded by SwaggerUI.
+var SwaggerUIVersion = "5"
+
+var swaggerPage = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API documentation</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`))
+
+// SwaggerUI serves a Swagger UI page, loaded from the unpkg CDN, that
+// renders the document served at specURL.
+func SwaggerUI(specURL string) lux.HandlerFunc {
+	var b strings.Builder
+	swaggerPage.Execute(&b, struct{ Version, SpecURL string }{SwaggerUIVersion, specURL})
+	page := b.String()
+
+	return func(c *lux.Context) {
+		c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(page)))
+		c.Writer.WriteString(page)
+	}
+}
@@ -39,71 +39,187 @@ const (
 	Wildcard                  // Wildcard parameter (e.g., *filepath)
 )
 
-// Node represents a node in the router tree
+// Node represents a node in the router tree. The tree is a compressed
+// radix trie: a static node holds the longest byte prefix its routes
+// share, such as "users/" for /users/:id and /users/new, and parameter
+// and wildcard nodes hold a single ":name" or "*name".
+//
+// Static, parameter and wildcard routes may overlap, for example
+// /users/new, /users/:id and /users/*rest. A request is matched by the
+// most specific route: static segments win over a parameter, which wins
+// over a wildcard, and a branch that leads nowhere falls back to the next
+// candidate. Routes that could never be told apart are rejected when they
+// are registered: one position cannot hold parameters or wildcards of
+// different names, as in /users/:id and /users/:name/posts.
 type Node struct {
-	Path     string       // Path segment this node represents
+	Path     string       // Path fragment this node represents
 	NodeType NodeType     // Type of the node
 	Handlers HandlerChain // Handlers associated with this endpoint
-	Children []*Node      // Child nodes
+	Children []*Node      // Static children by priority, then parameter and wildcard children
+
+	FullPath string         // Route pattern of an endpoint, e.g. /users/:id
+	Label    string         // Metrics and log label of an endpoint, see WithLabel
+	Group    string         // Base path of the group that registered the endpoint
+	Meta     map[string]any // Metadata attached with WithMeta
+
+	indices  string // first byte of each static child, in Children order
+	priority uint32 // number of endpoints in the subtree
 }
 
-// addRoute adds a new route to the node tree
+// addRoute adds a new route to the node tree and returns its endpoint node
 // Panics if the path is already registered with handlers
-func (n *Node) addRoute(path string, handlers []HandlerFunc) {
-	segments := splitPath(path)
-	current := n
-
-	// Track if we're adding to an existing endpoint
-	pathExists := true
+func (n *Node) addRoute(path string, handlers []HandlerFunc) *Node {
+	endpoint := n.insert(strings.TrimPrefix(path, "/"), path)
+	if len(endpoint.Handlers) > 0 {
+		panic(fmt.Sprintf("Route already exists: %s", path))
+	}
+	endpoint.Handlers = handlers
+	endpoint.FullPath = path
+	return endpoint
+}
 
-	for i, segment := range segments {
-		if segment == "" {
-			continue
+// insert walks path below n, which has already matched everything before
+// it, creating and splitting nodes as needed, and returns the endpoint.
+// ':' and '*' only start a parameter or wildcard right after a '/';
+// elsewhere, as in /a:b, they are literal.
+func (n *Node) insert(path, fullPath string) *Node {
+	n.priority++
+	// path follows the leading '/'
+	segmentStart := true
+	for path != "" {
+		c := path[0]
+		if !segmentStart {
+			c = 0
 		}
-
-		found := false
-		for _, child := range current.Children {
-			if child.Path == segment || (child.NodeType == Parameter && segment[0] == ':') {
-				current = child
-				found = true
-				break
+		switch c {
+		case ':':
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
 			}
-		}
+			if end == 1 {
+				panic(fmt.Sprintf("parameter without a name in route %s", fullPath))
+			}
+			n = n.wildChild(Parameter, path[:end], fullPath)
+			path = path[end:]
+			segmentStart = false
 
-		if !found {
-			pathExists = false // New node means this is a new path
-			nodeType := Static
-			if segment[0] == ':' {
-				nodeType = Parameter
-			} else if segment[0] == '*' {
-				nodeType = Wildcard
+		case '*':
+			if strings.IndexByte(path, '/') >= 0 {
+				panic(fmt.Sprintf("wildcard must be the last segment in route %s", fullPath))
+			}
+			if len(path) == 1 {
+				panic(fmt.Sprintf("wildcard without a name in route %s", fullPath))
 			}
-			newNode := &Node{
-				Path:     segment,
-				NodeType: nodeType,
-				Children: make([]*Node, 0),
+			n = n.wildChild(Wildcard, path, fullPath)
+			path = ""
+
+		default:
+			// The static part runs up to the next parameter or wildcard
+			end := len(path)
+			for i := 1; i < len(path); i++ {
+				if path[i-1] == '/' && (path[i] == ':' || path[i] == '*') {
+					end = i
+					break
+				}
 			}
-			current.Children = append(current.Children, newNode)
-			current = newNode
+			// A split can leave a shorter prefix than path[:end], whose
+			// rest may then start mid-segment
+			n = n.staticChild(path[:end])
+			path = path[len(n.Path):]
+			segmentStart = strings.HasSuffix(n.Path, "/")
 		}
+		n.priority++
+	}
+	return n
+}
 
-		if i == len(segments)-1 {
-			// Check for duplicate routes
-			if len(current.Handlers) > 0 && pathExists {
-				panic(fmt.Sprintf("Route already exists: %s", path))
-			}
-			current.Handlers = handlers
+// staticChild returns the child of n that path starts with, splitting a
+// child that only shares part of its prefix with path, or adding a new
+// child with all of path.
+func (n *Node) staticChild(path string) *Node {
+	i := strings.IndexByte(n.indices, path[0])
+	if i < 0 {
+		child := &Node{Path: path, NodeType: Static}
+		// Static children go before parameter and wildcard children
+		n.Children = append(n.Children, nil)
+		copy(n.Children[len(n.indices)+1:], n.Children[len(n.indices):])
+		n.Children[len(n.indices)] = child
+		n.indices += path[:1]
+		return child
+	}
+
+	child := n.Children[i]
+	common := 0
+	for common < len(path) && common < len(child.Path) && path[common] == child.Path[common] {
+		common++
+	}
+	if common < len(child.Path) {
+		// The child keeps its identity, and with it any endpoint data, as
+		// the suffix below a new node holding the shared prefix
+		prefix := &Node{
+			Path:     child.Path[:common],
+			NodeType: Static,
+			Children: []*Node{child},
+			indices:  child.Path[common : common+1],
+			priority: child.priority,
 		}
+		child.Path = child.Path[common:]
+		n.Children[i] = prefix
+		child = prefix
 	}
+	n.promote(i)
+	return child
+}
 
-	// Special case for root path
-	if len(path) == 1 && path == "/" {
-		// Check for duplicate root handler
-		if len(n.Handlers) > 0 {
-			panic("Root route '/' already registered")
+// wildChild returns the parameter or wildcard child of n named path,
+// adding it if n has none. A node has at most one of each kind, so a
+// different name at the same position panics.
+func (n *Node) wildChild(typ NodeType, path, fullPath string) *Node {
+	for _, child := range n.Children[len(n.indices):] {
+		if child.NodeType != typ {
+			continue
 		}
-		n.Handlers = handlers
+		if child.Path != path {
+			panic(fmt.Sprintf("%q in route %s conflicts with %q in existing route %s",
+				path, fullPath, child.Path, child.anyRoute()))
+		}
+		return child
 	}
+	child := &Node{Path: path, NodeType: typ}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// anyRoute returns the pattern of a route below n, for error messages.
+func (n *Node) anyRoute() string {
+	if n.FullPath != "" {
+		return n.FullPath
+	}
+	for _, child := range n.Children {
+		if r := child.anyRoute(); r != "" {
+			return r
+		}
+	}
+	return ""
+}
+
+// promote moves the static child at i, whose priority is about to grow,
+// ahead of siblings with lower priority, so that lookups try busy
+// branches first.
+func (n *Node) promote(i int) {
+	prio := n.Children[i].priority + 1
+	j := i
+	for j > 0 && n.Children[j-1].priority < prio {
+		j--
+	}
+	if j == i {
+		return
+	}
+	child := n.Children[i]
+	copy(n.Children[j+1:i+1], n.Children[j:i])
+	n.Children[j] = child
+	n.indices = n.indices[:j] + n.indices[i:i+1] + n.indices[j:i] + n.indices[i+1:]
 }
 
 // NodeTree represents a router tree for a specific HTTP method
@@ -137,199 +253,101 @@ func NewNodeTree() *NodeTree {
 // addRoute adds a new route to the tree
 // Panics if the path is already registered with handlers
 func (nt *NodeTree) addRoute(path string, handlers []HandlerFunc) {
-	segments := splitPath(path)
-	current := nt.Root
-
-	// Track if we're adding to an existing endpoint
-	pathExists := true
-
-	for i, segment := range segments {
-		if segment == "" {
-			continue
-		}
-
-		found := false
-		for _, child := range current.Children {
-			if child.Path == segment || (child.NodeType == Parameter && segment[0] == ':') {
-				current = child
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			pathExists = false // New node means this is a new path
-			nodeType := Static
-			if segment[0] == ':' {
-				nodeType = Parameter
-			} else if segment[0] == '*' {
-				nodeType = Wildcard
-			}
-			newNode := &Node{
-				Path:     segment,
-				NodeType: nodeType,
-				Children: make([]*Node, 0),
-			}
-			current.Children = append(current.Children, newNode)
-			current = newNode
-		}
-
-		if i == len(segments)-1 {
-			// Check for duplicate routes
-			if len(current.Handlers) > 0 && pathExists {
-				panic(fmt.Sprintf("Duplicate route detected: %s", path))
-			}
-			current.Handlers = handlers
-		}
-	}
-
-	// Special case for empty path or root path
-	if path == "" || path == "/" {
-		if len(nt.Root.Handlers) > 0 {
-			panic("Root route '/' already registered")
-		}
-		nt.Root.Handlers = handlers
+	if path == "" {
+		path = "/"
 	}
+	nt.Root.addRoute(path, handlers)
 }
 
 // Find locates a handler for the given path and extracts URL parameters
 func (nt *NodeTree) Find(path string) (HandlerChain, Params) {
-	segments := splitPath(path)
 	params := make(Params, 0)
-	skippedNodes := make([]skippedNode, 0, 2) // Create skippedNodes for backtracking
-	handler := nt.findNode(nt.Root, segments, &params, 0, &skippedNodes)
-	return handler, params
-}
-
-// skippedNode represents a potential alternative path during route matching
-type skippedNode struct {
-	node        *Node
-	segmentIdx  int
-	paramsCount int
-}
-
-// findNode recursively searches for a matching node in the tree
-func (nt *NodeTree) findNode(node *Node, segments []string, params *Params, index int, skippedNodes *[]skippedNode) HandlerChain {
-	// End of path, return handlers if any
-	if index >= len(segments) {
-		if len(node.Handlers) > 0 {
-			return node.Handlers
-		}
-
-		// No handler found, try backtracking
-		return nt.tryBacktrack(segments, params, skippedNodes)
+	if n := nt.Root.getValue(strings.TrimPrefix(path, "/"), &params); n != nil {
+		return n.Handlers, params
 	}
+	return nil, params
+}
 
-	segment := segments[index]
-	// Handle empty segment at the end (trailing slash)
-	if segment == "" && index == len(segments)-1 {
-		if len(node.Handlers) > 0 {
-			return node.Handlers
+// getValue returns the endpoint registered for path below n, appending URL
+// parameters to params. path is what remains of the request path after
+// n's fragment. Static children are tried first, then the parameter and
+// finally the wildcard child, backtracking on dead ends. The path is
+// walked in place, so a lookup does not allocate as long as params has
+// enough capacity.
+func (n *Node) getValue(path string, params *Params) *Node {
+walk:
+	for {
+		if path == "" {
+			if len(n.Handlers) > 0 {
+				return n
+			}
+			return nil
 		}
 
-		// No handler found, try backtracking
-		return nt.tryBacktrack(segments, params, skippedNodes)
-	}
+		// Parameters and wildcards only start right after a '/'
+		wild := strings.HasSuffix(n.Path, "/")
 
-	// First try to match static nodes (most common case)
-	for _, child := range node.Children {
-		if child.NodeType == Static && child.Path == segment {
-			// Before going down this path, check if there are parameter nodes
-			// that could be alternative paths
-			for _, paramChild := range node.Children {
-				if paramChild.NodeType == Parameter || paramChild.NodeType == Wildcard {
-					// Save this as a skipped node for potential backtracking
-					*skippedNodes = append(*skippedNodes, skippedNode{
-						node:        paramChild,
-						segmentIdx:  index,
-						paramsCount: len(*params),
-					})
-				}
+		for i := 0; i < len(n.indices); i++ {
+			if n.indices[i] != path[0] {
+				continue
 			}
-
-			if handler := nt.findNode(child, segments, params, index+1, skippedNodes); handler != nil {
-				return handler
+			child := n.Children[i]
+			if len(path) < len(child.Path) || path[:len(child.Path)] != child.Path {
+				break
 			}
-		}
-	}
-
-	// Then try parameter nodes
-	for _, child := range node.Children {
-		if child.NodeType == Parameter {
-			// Save previous params length for backtracking
-			originalParamsLen := len(*params)
-
-			*params = append(*params, Param{
-				Key:   child.Path[1:], // skip the ':' prefix
-				Value: segment,
-			})
-
-			if handler := nt.findNode(child, segments, params, index+1, skippedNodes); handler != nil {
-				return handler
+			// Without parameter or wildcard siblings there is nothing to
+			// fall back on, so the walk goes on in this frame
+			if !wild || len(n.Children) == len(n.indices) {
+				n, path = child, path[len(child.Path):]
+				continue walk
 			}
-
-			// Remove param if no match found with this path
-			*params = (*params)[:originalParamsLen]
+			if found := child.getValue(path[len(child.Path):], params); found != nil {
+				return found
+			}
+			break
 		}
-	}
 
-	// Finally try wildcard nodes (they match rest of the path)
-	for _, child := range node.Children {
-		if child.NodeType == Wildcard {
-			remaining := strings.Join(segments[index:], "/")
-			*params = append(*params, Param{
-				Key:   child.Path[1:], // skip '*' prefix
-				Value: remaining,
-			})
-			return child.Handlers
+		if !wild {
+			return nil
+		}
+		for _, child := range n.Children[len(n.indices):] {
+			switch child.NodeType {
+			case Parameter:
+				end := strings.IndexByte(path, '/')
+				if end < 0 {
+					end = len(path)
+				}
+				if end == 0 {
+					continue
+				}
+				// Drop the param again on a dead end
+				paramsLen := len(*params)
+				*params = append(*params, Param{
+					Key:   child.Path[1:], // skip the ':' prefix
+					Value: path[:end],
+				})
+				if found := child.getValue(path[end:], params); found != nil {
+					return found
+				}
+				*params = (*params)[:paramsLen]
+
+			case Wildcard:
+				// Wildcards match the rest of the path
+				if len(child.Handlers) > 0 {
+					*params = append(*params, Param{
+						Key:   child.Path[1:], // skip '*' prefix
+						Value: path,
+					})
+					return child
+				}
+			}
 		}
-	}
-
-	// No match found, try backtracking
-	return nt.tryBacktrack(segments, params, skippedNodes)
-}
 
-// tryBacktrack attempts to find an alternative path using saved skipped nodes
-func (nt *NodeTree) tryBacktrack(segments []string, params *Params, skippedNodes *[]skippedNode) HandlerChain {
-	// No more skipped nodes to try
-	if len(*skippedNodes) == 0 {
 		return nil
 	}
-
-	// Pop the last skipped node
-	lastIdx := len(*skippedNodes) - 1
-	skipped := (*skippedNodes)[lastIdx]
-	*skippedNodes = (*skippedNodes)[:lastIdx]
-
-	// Reset params to the state when this node was skipped
-	*params = (*params)[:skipped.paramsCount]
-
-	// Try this alternative path
-	if skipped.node.NodeType == Parameter {
-		segment := segments[skipped.segmentIdx]
-		*params = append(*params, Param{
-			Key:   skipped.node.Path[1:], // skip the ':' prefix
-			Value: segment,
-		})
-		return nt.findNode(skipped.node, segments, params, skipped.segmentIdx+1, skippedNodes)
-	} else if skipped.node.NodeType == Wildcard {
-		remaining := strings.Join(segments[skipped.segmentIdx:], "/")
-		*params = append(*params, Param{
-			Key:   skipped.node.Path[1:], // skip '*' prefix
-			Value: remaining,
-		})
-		return skipped.node.Handlers
-	}
-
-	// Continue with static node
-	return nt.findNode(skipped.node, segments, params, skipped.segmentIdx+1, skippedNodes)
 }
 
-// splitPath splits a URL path into segments
-func splitPath(path string) []string {
-	path = strings.TrimPrefix(path, "/")
-	if path == "" {
-		return []string{""}
-	}
-	return strings.Split(path, "/")
+// countParams returns the number of parameters and wildcards in a route path.
+func countParams(path string) uint16 {
+	return uint16(strings.Count(path, "/:") + strings.Count(path, "/*"))
 }
@@ -100,6 +100,9 @@ func TestMultipleDuplicateScenarios(t *testing.T) {
 		{"Different parameter names same position", "/users/:id", "/users/:userId", true}, // Should still panic
 		{"Wildcard duplicate", "/static/*filepath", "/static/*path", true},
 		{"Parameter vs static route", "/users/:id", "/users/profile", false}, // Different routes
+		{"Different parameter names in longer route", "/users/:id", "/users/:name/posts", true},
+		{"Parameter vs wildcard route", "/files/:name", "/files/*path", false},
+		{"Wildcard not last", "/files", "/files/*path/raw", true},
 	}
 
 	for _, tc := range testCases {
@@ -227,3 +230,134 @@ func TestNodeIsolation(t *testing.T) {
 		t.Errorf("POST tree should have 2 handlers, got %d", len(postHandlers))
 	}
 }
+
+func TestSharedPrefixes(t *testing.T) {
+	tree := NewNodeTree()
+	routes := []string{"/user", "/users", "/usage", "/users/new", "/users/:id", "/users/:id/posts", "/u/*rest"}
+	for i, route := range routes {
+		tree.addRoute(route, createHandlers(i+1))
+	}
+
+	testCases := []struct {
+		path     string
+		handlers int
+		params   Params
+	}{
+		{"/user", 1, Params{}},
+		{"/users", 2, Params{}},
+		{"/usage", 3, Params{}},
+		{"/users/new", 4, Params{}},
+		{"/users/newer", 5, Params{{Key: "id", Value: "newer"}}},
+		{"/users/7/posts", 6, Params{{Key: "id", Value: "7"}}},
+		{"/u/a/b", 7, Params{{Key: "rest", Value: "a/b"}}},
+		{"/us", 0, Params{}},
+		{"/users/7/comments", 0, Params{}},
+	}
+	for _, tc := range testCases {
+		handlers, params := tree.Find(tc.path)
+		if len(handlers) != tc.handlers || !reflect.DeepEqual(params, tc.params) {
+			t.Errorf("%s: got %d handlers, params %+v; want %d, %+v", tc.path, len(handlers), params, tc.handlers, tc.params)
+		}
+	}
+}
+
+// A split of a static node must not turn a ':' or '*' in the middle of a
+// segment into a parameter or wildcard.
+func TestLiteralColonAndStarMidSegment(t *testing.T) {
+	tree := NewNodeTree()
+	routes := []string{"/ab", "/a:c", "/a*d", "/files/v1:list", "/files/:name"}
+	for i, route := range routes {
+		tree.addRoute(route, createHandlers(i+1))
+	}
+
+	testCases := []struct {
+		path     string
+		handlers int
+		params   Params
+	}{
+		{"/ab", 1, Params{}},
+		{"/a:c", 2, Params{}},
+		{"/a*d", 3, Params{}},
+		{"/axyz", 0, Params{}},
+		{"/a:other", 0, Params{}},
+		{"/files/v1:list", 4, Params{}},
+		{"/files/v1", 5, Params{{Key: "name", Value: "v1"}}},
+		{"/files/v1:other", 5, Params{{Key: "name", Value: "v1:other"}}},
+	}
+	for _, tc := range testCases {
+		handlers, params := tree.Find(tc.path)
+		if len(handlers) != tc.handlers || !reflect.DeepEqual(params, tc.params) {
+			t.Errorf("%s: got %d handlers, params %+v; want %d, %+v", tc.path, len(handlers), params, tc.handlers, tc.params)
+		}
+	}
+}
+
+func benchmarkLookup(b *testing.B, path string) {
+	e := NewEngine()
+	e.Get("/", createHandlers(1)...)
+	e.Get("/users", createHandlers(1)...)
+	e.Get("/users/profile/settings", createHandlers(1)...)
+	e.Get("/users/:id", createHandlers(1)...)
+	e.Get("/users/:id/posts/:postId", createHandlers(1)...)
+	e.Get("/static/*filepath", createHandlers(1)...)
+
+	c := e.allocateContext(e.maxParams)
+	root := e.trees.get("GET")
+	path = path[1:]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		*c.params = (*c.params)[:0]
+		if root.getValue(path, c.params) == nil {
+			b.Fatalf("no route for %s", path)
+		}
+	}
+}
+
+func BenchmarkLookupStatic(b *testing.B) {
+	benchmarkLookup(b, "/users/profile/settings")
+}
+
+func BenchmarkLookupParam(b *testing.B) {
+	benchmarkLookup(b, "/users/42/posts/7")
+}
+
+func BenchmarkLookupWildcard(b *testing.B) {
+	benchmarkLookup(b, "/static/css/site.css")
+}
+
+// BenchmarkLookupManyRoutes resolves paths in a table of routes that share
+// long prefixes, where the radix tree saves comparing whole segments.
+func BenchmarkLookupManyRoutes(b *testing.B) {
+	e := NewEngine()
+	for _, r := range []string{
+		"/repos/:owner/:repo", "/repos/:owner/:repo/issues", "/repos/:owner/:repo/issues/:number",
+		"/repos/:owner/:repo/issues/:number/comments", "/repos/:owner/:repo/pulls",
+		"/repos/:owner/:repo/pulls/:number", "/repos/:owner/:repo/pulls/:number/commits",
+		"/repos/:owner/:repo/releases", "/repos/:owner/:repo/releases/latest",
+		"/repos/:owner/:repo/contributors", "/repos/:owner/:repo/contents/*path",
+		"/user", "/user/repos", "/user/orgs", "/user/keys", "/user/followers", "/user/following",
+		"/users/:user", "/users/:user/repos", "/users/:user/orgs", "/users/:user/gists",
+		"/orgs/:org", "/orgs/:org/repos", "/orgs/:org/members", "/orgs/:org/teams",
+		"/gists", "/gists/public", "/gists/starred", "/gists/:id", "/gists/:id/star",
+		"/notifications", "/notifications/threads/:id", "/search/repositories", "/search/users",
+	} {
+		e.Get(r, createHandlers(1)...)
+	}
+	paths := []string{
+		"user/following", "gists/starred", "search/users",
+		"repos/edgflow/lux/issues/12/comments", "repos/edgflow/lux/contents/docs/index.md",
+	}
+
+	c := e.allocateContext(e.maxParams)
+	root := e.trees.get("GET")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		*c.params = (*c.params)[:0]
+		if root.getValue(paths[i%len(paths)], c.params) == nil {
+			b.Fatalf("no route for %s", paths[i%len(paths)])
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package lux
+
+import (
+	"net/http"
+	"time"
+)
+
+// Poll holds a long-polling request open until source delivers a value,
+// which is passed to render, or until wait expires, which answers 204 No
+// Content. A closed source answers 204 as well. If the client disconnects
+// or the request context ends first, the request is aborted without a
+// response. Poll reports whether render was called.
+//
+// Poll is a function rather than a Context method because methods cannot
+// have type parameters:
+//
+//	engine.Get("/messages", func(c *lux.Context) {
+//		lux.Poll(c, 30*time.Second, inbox, func(m Message) {
+//			c.WriteResponse(m.Text)
+//		})
+//	})
+func Poll[T any](c *Context, wait time.Duration, source <-chan T, render func(T)) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	// The connection's deadlines assume a prompt response
+	if conn := c.writermem.conn; conn != nil && c.engine.config().writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(wait + c.engine.config().writeTimeout))
+	}
+	gone, stop := c.writermem.watchClose(c.engine.config().readTimeout)
+	defer stop()
+
+	select {
+	case v, ok := <-source:
+		if !ok {
+			break
+		}
+		stop()
+		render(v)
+		return true
+	case <-timer.C:
+	case <-gone:
+		c.Abort()
+		return false
+	case <-c.Request.Context().Done():
+		c.Abort()
+		return false
+	}
+
+	c.Writer.Header().Set("Content-Length", "0")
+	c.Writer.WriteHeader(http.StatusNoContent)
+	return false
+}
+
+// watchClose returns a channel that is closed if the client closes the
+// connection while the handler is still running. The connection is watched
+// with a Peek on its buffered reader, which consumes nothing, so a
+// pipelined request or unread body simply ends the watch. stop ends the
+// watch and must be called before the reader is used again; it may be
+// called more than once.
+func (w *responseWriter) watchClose(readTimeout time.Duration) (gone <-chan struct{}, stop func()) {
+	closed := make(chan struct{})
+	if w.conn == nil || w.hijackReader == nil || w.hijackReader.Buffered() > 0 {
+		return closed, func() {}
+	}
+
+	w.conn.SetReadDeadline(time.Time{})
+	done := make(chan struct{})
+	interrupted := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := w.hijackReader.Peek(1)
+		select {
+		case <-interrupted:
+		default:
+			if err != nil {
+				close(closed)
+			}
+		}
+	}()
+
+	stopped := false
+	return closed, func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		close(interrupted)
+		// Wake the Peek with a deadline in the past, then restore one for
+		// the rest of the request
+		w.conn.SetReadDeadline(time.Now())
+		<-done
+		w.conn.SetReadDeadline(deadline(readTimeout))
+	}
+}
@@ -0,0 +1,74 @@
+package lux
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	engine := NewEngine()
+	source := make(chan string, 1)
+	rendered := make(chan bool, 1)
+	engine.Get("/poll", func(c *Context) {
+		rendered <- Poll(c, 50*time.Millisecond, source, func(s string) {
+			c.Writer.Header().Set("Content-Length", "5")
+			c.WriteResponse(s)
+		})
+	})
+
+	// A value that is ready is rendered without waiting
+	source <- "hello"
+	start := time.Now()
+	w := engine.TestRequest(http.MethodGet, "/poll", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" || !<-rendered {
+		t.Errorf("value: %d %q", w.Code, w.Body.String())
+	}
+	if d := time.Since(start); d >= 50*time.Millisecond {
+		t.Errorf("value took %v, the full wait", d)
+	}
+
+	// Without a value the request ends with 204 once the wait expires
+	start = time.Now()
+	w = engine.TestRequest(http.MethodGet, "/poll", nil, nil)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 || <-rendered {
+		t.Errorf("timeout: %d %q", w.Code, w.Body.String())
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("timeout answered after %v, before the wait expired", d)
+	}
+
+	// A closed source answers 204 as well
+	close(source)
+	w = engine.TestRequest(http.MethodGet, "/poll", nil, nil)
+	if w.Code != http.StatusNoContent || <-rendered {
+		t.Errorf("closed source: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestPollClientGone(t *testing.T) {
+	engine := NewEngine()
+	result := make(chan bool, 1)
+	engine.Get("/poll", func(c *Context) {
+		result <- Poll(c, 10*time.Second, make(chan int), func(int) {})
+	})
+	addr := serveLoopback(t, engine, nil)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("GET /poll HTTP/1.1\r\nHost: " + addr + "\r\n\r\n"))
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case rendered := <-result:
+		if rendered {
+			t.Error("Poll reported a render for a client that left")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Poll still waiting after the client disconnected")
+	}
+}
@@ -0,0 +1,76 @@
+package lux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProxyOptions tunes Context.Proxy.
+type ProxyOptions struct {
+	// Transport performs the upstream request. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// StripPrefix is removed from the request path before it is joined
+	// with the target's path
+	StripPrefix string
+
+	// PreserveHost forwards the client's Host header instead of the target's
+	PreserveHost bool
+
+	// FlushInterval is how often the response is flushed while streaming.
+	// Event streams are always flushed immediately; negative flushes after
+	// every write.
+	FlushInterval time.Duration
+
+	// ModifyResponse, if set, may alter the upstream response before it is
+	// copied to the client
+	ModifyResponse func(*http.Response) error
+}
+
+// Proxy forwards the current request to target and copies the upstream
+// response back to the client, streaming bodies in both directions. The
+// target's scheme, host and path prefix replace those of the request, and
+// X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto are set from the
+// incoming request. The request's trace context is propagated with the
+// traceparent and tracestate headers. WebSocket and other protocol upgrades
+// are passed through by hijacking the client connection. Upstream failures
+// answer 502.
+func (c *Context) Proxy(target *url.URL, opts ...ProxyOptions) {
+	var o ProxyOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if o.StripPrefix != "" {
+				pr.Out.URL.Path = strings.TrimPrefix(pr.Out.URL.Path, o.StripPrefix)
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			c.Trace().Inject(pr.Out.Header)
+			if o.PreserveHost {
+				pr.Out.Host = pr.In.Host
+			}
+		},
+		Transport:      o.Transport,
+		FlushInterval:  o.FlushInterval,
+		ModifyResponse: o.ModifyResponse,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			c.engine.logger().Error("proxy error", "route", c.RouteLabel(), "target", target.String(), "error", err)
+			w.Header().Set("Content-Length", "0")
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	// A cancelable context keeps ReverseProxy from falling back to
+	// CloseNotify, which would consume bytes from the client connection
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	rp.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+}
@@ -0,0 +1,69 @@
+package lux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	var upstream *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+		w.Header().Set("X-Backend", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("from backend"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL + "/v1")
+
+	engine := NewEngine()
+	logs := &testLogger{}
+	engine.Logger = logs
+	engine.Any("/api/*path", func(c *Context) {
+		c.Proxy(target, ProxyOptions{StripPrefix: "/api", PreserveHost: c.Query("host") != ""})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api/users/42?page=2", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated || w.Body.String() != "from backend" || w.Header().Get("X-Backend") != "yes" {
+		t.Fatalf("proxied response = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	if upstream.URL.Path != "/v1/users/42" || upstream.URL.RawQuery != "page=2" {
+		t.Errorf("upstream request = %s", upstream.URL)
+	}
+	if upstream.Host != target.Host {
+		t.Errorf("upstream Host = %q, want %q", upstream.Host, target.Host)
+	}
+	// The client's own X-Forwarded-For is not trusted and gets replaced
+	if got := upstream.Header.Get("X-Forwarded-For"); got != "192.0.2.1" {
+		t.Errorf("X-Forwarded-For = %q", got)
+	}
+	if got := upstream.Header.Get("X-Forwarded-Host"); got != "example.com" {
+		t.Errorf("X-Forwarded-Host = %q", got)
+	}
+	if got := upstream.Header.Get("X-Forwarded-Proto"); got != "http" {
+		t.Errorf("X-Forwarded-Proto = %q", got)
+	}
+
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/api/x?host=1", nil))
+	if upstream.Host != "example.com" {
+		t.Errorf("PreserveHost: upstream Host = %q", upstream.Host)
+	}
+
+	// With the upstream gone the client gets 502 and the error is logged
+	backend.Close()
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("upstream down = %d, want 502", w.Code)
+	}
+	if len(logs.errors()) != 1 {
+		t.Errorf("logged errors = %q, want one", logs.errors())
+	}
+}
@@ -0,0 +1,78 @@
+package lux
+
+import (
+	"io"
+	"sync"
+)
+
+// maxPooledRawData caps the capacity of body buffers kept for reuse so that
+// one huge upload does not pin memory for the lifetime of the process.
+const maxPooledRawData = 64 << 10
+
+var rawDataPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+// RawData is a request body read into pooled storage by GetRawDataPooled.
+type RawData struct {
+	buf *[]byte
+}
+
+// Bytes returns the body. It must not be used after Release.
+func (d *RawData) Bytes() []byte {
+	if d.buf == nil {
+		return nil
+	}
+	return *d.buf
+}
+
+// Release hands the storage back to the pool for the next request.
+// Calling it more than once has no effect.
+func (d *RawData) Release() {
+	bp := d.buf
+	if bp == nil {
+		return
+	}
+	d.buf = nil
+	if cap(*bp) > maxPooledRawData {
+		return
+	}
+	*bp = (*bp)[:0]
+	rawDataPool.Put(bp)
+}
+
+// GetRawData returns the request body as a freshly allocated slice.
+func (c *Context) GetRawData() ([]byte, error) {
+	return io.ReadAll(c.Request.Body)
+}
+
+// GetRawDataPooled reads the request body into a pooled buffer. Callers on
+// hot paths release it once done to avoid allocating a body buffer per
+// request; those that don't simply leave it to the garbage collector.
+func (c *Context) GetRawDataPooled() (*RawData, error) {
+	bp := rawDataPool.Get().(*[]byte)
+	d := &RawData{buf: bp}
+	b := *bp
+	if n := c.Request.ContentLength; n > int64(cap(b)) && n <= maxPooledRawData {
+		b = make([]byte, 0, n)
+	}
+
+	for {
+		if len(b) == cap(b) {
+			b = append(b, 0)[:len(b)]
+		}
+		n, err := c.Request.Body.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		*bp = b
+		if err == io.EOF {
+			return d, nil
+		}
+		if err != nil {
+			d.Release()
+			return nil, err
+		}
+	}
+}
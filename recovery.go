@@ -0,0 +1,43 @@
+package lux
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// Recovery returns middleware that recovers from panics in the rest of the
+// chain. The panic and its stack are logged through the engine's Logger
+// and the request is answered 500, unless the response was already
+// started. The connection is closed afterwards, as the handler may have
+// left the request or the response half done. Panics with
+// http.ErrAbortHandler only close the connection.
+//
+// Engines don't recover by default, so register it first:
+//
+//	engine.Use(lux.Recovery())
+func Recovery() HandlerFunc {
+	return func(c *Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec != http.ErrAbortHandler {
+				c.engine.logger().Error("panic recovered",
+					"method", c.Request.Method,
+					"path", c.Request.URL.Path,
+					"route", c.RouteLabel(),
+					"error", rec,
+					"stack", string(debug.Stack()))
+			}
+			h := c.Writer.Header()
+			h.Set("Connection", "close")
+			if !c.Writer.Written() {
+				h.Set("Content-Length", "0")
+				c.Writer.WriteHeader(http.StatusInternalServerError)
+			}
+			c.Abort()
+		}()
+		c.Next()
+	}
+}
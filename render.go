@@ -0,0 +1,81 @@
+package lux
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// JSON serializes obj as JSON and writes it with the given status code. If
+// obj cannot be serialized the request is answered 500 instead.
+func (c *Context) JSON(code int, obj any) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		c.engine.logger().Error("json render", "route", c.RouteLabel(), "error", err)
+		c.Writer.Header().Set("Content-Length", "0")
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		c.Abort()
+		return
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	c.Writer.WriteHeader(code)
+	c.Writer.Write(body)
+}
+
+// DataFromReader writes the body read from r with the given status code
+// and content type, plus any extra headers. A contentLength of -1 marks
+// the length as unknown, in which case the body is sent chunked; otherwise
+// exactly contentLength bytes are sent and the rest of r is left unread.
+// Errors reading r end the response early, close the connection and are
+// logged.
+func (c *Context) DataFromReader(code int, contentLength int64, contentType string, r io.Reader, extraHeaders map[string]string) {
+	h := c.Writer.Header()
+	for k, v := range extraHeaders {
+		h.Set(k, v)
+	}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	if contentLength >= 0 {
+		h.Set("Content-Length", strconv.FormatInt(contentLength, 10))
+	}
+	c.Writer.WriteHeader(code)
+	c.Writer.WriteHeaderNow()
+	var err error
+	if contentLength < 0 {
+		_, err = io.Copy(c.Writer, r)
+	} else {
+		var n int64
+		n, err = io.CopyN(c.Writer, r, contentLength)
+		if n == contentLength {
+			err = nil
+		} else if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		c.engine.logger().Error("data from reader", "route", c.RouteLabel(), "error", err)
+		// The body is incomplete, so the connection can't be reused
+		h.Set("Connection", "close")
+		c.Abort()
+	}
+}
+
+// Redirect answers with a redirect to location, which may be relative to
+// the request path. code must be a 3xx status or 201 Created; anything
+// else panics, as it is a programming error.
+func (c *Context) Redirect(code int, location string) {
+	if (code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect) && code != http.StatusCreated {
+		panic(fmt.Sprintf("lux: cannot redirect with status code %d", code))
+	}
+	h := c.Writer.Header()
+	h.Set("Location", location)
+	h.Set("Content-Length", "0")
+	c.Writer.WriteHeader(code)
+	c.Writer.WriteHeaderNow()
+}
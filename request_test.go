@@ -0,0 +1,81 @@
+package lux
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadRequest(t *testing.T) {
+	raw := "POST /upload?x=1 HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"x-forwarded-for: 10.0.0.1\r\n" +
+		"X-Forwarded-For: 10.0.0.2\r\n" +
+		"Content-Length: 5\r\n\r\n" +
+		"hello" +
+		"GET /next HTTP/1.0\r\n\r\n"
+	b := bufio.NewReader(strings.NewReader(raw))
+
+	req, err := ReadRequest(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "POST" || req.URL.Path != "/upload" || req.Host != "example.com" {
+		t.Errorf("request = %s %s (host %q)", req.Method, req.URL, req.Host)
+	}
+	if got := req.Header.Values("X-Forwarded-For"); len(got) != 2 || got[1] != "10.0.0.2" {
+		t.Errorf("X-Forwarded-For = %q, want both values", got)
+	}
+	if req.Header.Get("Host") != "" {
+		t.Error("Host header kept in Header")
+	}
+	// The body is left in b until it is read
+	if body, _ := io.ReadAll(req.Body); string(body) != "hello" {
+		t.Errorf("body = %q", body)
+	}
+
+	req, err = ReadRequest(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/next" || req.ProtoMinor != 0 || !req.Close {
+		t.Errorf("second request = %s HTTP/1.%d, Close %v", req.URL, req.ProtoMinor, req.Close)
+	}
+}
+
+func TestRequestParseMultipartForm(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "report")
+	part, _ := mw.CreateFormFile("b", "b.txt")
+	part.Write([]byte("second"))
+	part, _ = mw.CreateFormFile("a", "a.txt")
+	part.Write([]byte(strings.Repeat("x", 64)))
+	mw.Close()
+
+	raw := "POST /upload HTTP/1.1\r\nHost: example.com\r\n" +
+		"Content-Type: " + mw.FormDataContentType() + "\r\n" +
+		"Content-Length: " + strconv.Itoa(body.Len()) + "\r\n\r\n" + body.String()
+	req, err := ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.ParseMultipartForm(16); err != nil {
+		t.Fatal(err)
+	}
+	defer req.RemoveMultipartFiles()
+
+	if req.PostForm.Get("title") != "report" {
+		t.Errorf("PostForm = %v", req.PostForm)
+	}
+	if req.FileHeader == nil || req.FileHeader.Filename != "a.txt" || req.FileHeader.Size != 64 {
+		t.Errorf("FileHeader = %+v, want a.txt", req.FileHeader)
+	}
+	if len(req.MultipartForm.File) != 2 {
+		t.Errorf("MultipartForm has %d file fields, want 2", len(req.MultipartForm.File))
+	}
+}
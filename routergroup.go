@@ -1,8 +1,10 @@
 package lux
 
 import (
+	"fmt"
 	"net/http"
 	"path"
+	"strings"
 )
 
 var (
@@ -32,6 +34,9 @@ type IRoutes interface {
 	OPTIONS(string, ...HandlerFunc) IRoutes
 	HEAD(string, ...HandlerFunc) IRoutes
 	Match([]string, string, ...HandlerFunc) IRoutes
+	Handle(string, string, ...HandlerFunc) IRoutes
+	WithLabel(string) IRoutes
+	WithMeta(string, any) IRoutes
 }
 type IRouter interface {
 	IRoutes
@@ -44,10 +49,7 @@ func (r *RouterGroup) Use(handlerFunc ...HandlerFunc) IRoutes {
 }
 
 func (r *RouterGroup) Any(relPath string, handlers ...HandlerFunc) IRoutes {
-	for _, method := range anyMethods {
-		r.handle(method, relPath, handlers)
-	}
-	return r.returnObj()
+	return r.handleMethods(anyMethods, relPath, handlers)
 }
 
 func (r *RouterGroup) Get(relativePath string, handlers ...HandlerFunc) IRoutes {
@@ -84,10 +86,31 @@ func (group *RouterGroup) HEAD(relativePath string, handlers ...HandlerFunc) IRo
 // Match registers a route that matches the specified methods that you declared.
 func (group *RouterGroup) Match(methods []string, relativePath string, handlers ...HandlerFunc) IRoutes {
 	for _, method := range methods {
-		group.handle(method, relativePath, handlers)
+		validateMethod(method)
 	}
+	return group.handleMethods(methods, relativePath, handlers)
+}
+
+// Handle registers a route for any request method, including extension
+// methods such as WebDAV's PROPFIND and MKCOL that have no shortcut.
+// Method names are case-sensitive; one that is not a valid HTTP token
+// panics, as it is a programming error.
+func (r *RouterGroup) Handle(httpMethod, relativePath string, handlers ...HandlerFunc) IRoutes {
+	validateMethod(httpMethod)
+	return r.handle(httpMethod, relativePath, handlers)
+}
 
-	return group.returnObj()
+// validateMethod panics unless method is a token as defined by RFC 9110.
+func validateMethod(method string) {
+	valid := method != ""
+	for i := 0; i < len(method) && valid; i++ {
+		c := method[i]
+		valid = 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+	}
+	if !valid {
+		panic(fmt.Sprintf("lux: invalid HTTP method %q", method))
+	}
 }
 
 func (r *RouterGroup) Group(relativePath string, handlers ...HandlerFunc) *RouterGroup {
@@ -117,9 +140,30 @@ func (r *RouterGroup) calculateAbseloutPath(path string) string {
 }
 
 func (r *RouterGroup) handle(httpMethod string, relPath string, handlers []HandlerFunc) IRoutes {
+	return r.handleMethods([]string{httpMethod}, relPath, handlers)
+}
+
+func (r *RouterGroup) handleMethods(methods []string, relPath string, handlers []HandlerFunc) IRoutes {
 	abseloutPaht := r.calculateAbseloutPath(relPath)
 	handlers = r.combineHandlers(handlers)
-	r.engine.addRoute(httpMethod, abseloutPaht, handlers)
+	r.engine.lastRoutes = r.engine.lastRoutes[:0]
+	for _, method := range methods {
+		r.engine.addRoute(method, abseloutPaht, handlers)
+	}
+	for _, n := range r.engine.lastRoutes {
+		n.Group = r.BasePath
+	}
+	return r.returnObj()
+}
+
+// WithLabel sets the label that logs and metrics use for the routes added
+// by the preceding call, in place of the route pattern:
+//
+//	engine.Get("/files/*path", serveFile).WithLabel("files")
+func (r *RouterGroup) WithLabel(label string) IRoutes {
+	for _, n := range r.engine.lastRoutes {
+		n.Label = label
+	}
 	return r.returnObj()
 }
 
@@ -127,7 +171,27 @@ func joinsPath(absolutePath string, relativePath string) string {
 	if absolutePath == "" {
 		return relativePath
 	}
-	return path.Join(absolutePath, relativePath)
+	// Join drops the trailing slash, which is part of the route
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
+
+// WithMeta attaches metadata to the routes added by the preceding call.
+// It is reported by Engine.Routes, so that tooling can audit routes, for
+// example for a missing auth requirement:
+//
+//	admin.Delete("/users/:id", deleteUser).WithMeta("auth", "admin")
+func (r *RouterGroup) WithMeta(key string, value any) IRoutes {
+	for _, n := range r.engine.lastRoutes {
+		if n.Meta == nil {
+			n.Meta = make(map[string]any)
+		}
+		n.Meta[key] = value
+	}
+	return r.returnObj()
 }
 
 var _ IRouter = (*RouterGroup)(nil)
@@ -0,0 +1,167 @@
+package lux
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats is a snapshot of the engine's connections.
+type ConnStats struct {
+	Open     int64 `json:"open"`      // accepted connections not yet closed or hijacked
+	Idle     int64 `json:"idle"`      // open connections waiting for their next request
+	InFlight int64 `json:"in_flight"` // requests being handled
+}
+
+// DrainProgress reports how far a Shutdown has got.
+type DrainProgress struct {
+	ConnStats
+	Elapsed time.Duration
+}
+
+// connTracker follows the connections and listeners of an engine.
+type connTracker struct {
+	mu        sync.Mutex
+	conns     map[net.Conn]*connState
+	listeners map[net.Listener]struct{}
+
+	shuttingDown atomic.Bool
+	open         atomic.Int64
+	idle         atomic.Int64
+	inFlight     atomic.Int64
+}
+
+type connState struct {
+	state http.ConnState
+	since time.Time
+}
+
+// Stats returns the current connection gauges.
+func (e *Engine) Stats() ConnStats {
+	return ConnStats{
+		Open:     e.tracker.open.Load(),
+		Idle:     e.tracker.idle.Load(),
+		InFlight: e.tracker.inFlight.Load(),
+	}
+}
+
+// setConnState records a connection's move to state and reports it to the
+// ConnState hook.
+func (e *Engine) setConnState(conn net.Conn, state http.ConnState) {
+	t := &e.tracker
+	t.mu.Lock()
+	cs := t.conns[conn]
+	switch {
+	case cs == nil && state == http.StateNew:
+		if t.conns == nil {
+			t.conns = make(map[net.Conn]*connState)
+		}
+		cs = &connState{}
+		t.conns[conn] = cs
+		t.open.Add(1)
+	case cs == nil:
+		t.mu.Unlock()
+		return
+	}
+	if cs.state == http.StateIdle {
+		t.idle.Add(-1)
+	}
+	switch state {
+	case http.StateIdle:
+		t.idle.Add(1)
+	case http.StateActive:
+		t.inFlight.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		delete(t.conns, conn)
+		t.open.Add(-1)
+	}
+	if cs.state == http.StateActive {
+		t.inFlight.Add(-1)
+	}
+	cs.state, cs.since = state, time.Now()
+	t.mu.Unlock()
+
+	if e.ConnState != nil {
+		e.ConnState(conn, state)
+	}
+}
+
+// trackListener registers l so that Shutdown can close it. It reports
+// false if the engine is already shutting down.
+func (e *Engine) trackListener(l net.Listener, add bool) bool {
+	t := &e.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !add {
+		delete(t.listeners, l)
+		return true
+	}
+	if t.shuttingDown.Load() {
+		return false
+	}
+	if t.listeners == nil {
+		t.listeners = make(map[net.Listener]struct{})
+	}
+	t.listeners[l] = struct{}{}
+	return true
+}
+
+// closeIdleConns closes connections waiting for a request, and new ones
+// that never sent one, and reports whether no connections are left.
+func (e *Engine) closeIdleConns() bool {
+	t := &e.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	quiescent := true
+	for conn, cs := range t.conns {
+		// A new connection may have a request on the way, so give it a
+		// few seconds as net/http does
+		if cs.state == http.StateIdle || (cs.state == http.StateNew && time.Since(cs.since) > 5*time.Second) {
+			conn.Close()
+		}
+		quiescent = false
+	}
+	return quiescent
+}
+
+// shutdownPollInterval is how often Shutdown checks for, and reports,
+// connections that are still open
+const shutdownPollInterval = 100 * time.Millisecond
+
+// Shutdown stops the engine gracefully: it closes the listeners, so Run
+// returns, then closes idle connections and waits for active ones to finish
+// their current request. Progress is reported to OnDrain while waiting. If
+// ctx ends first, Shutdown returns its error and leaves the remaining
+// connections open. Once drained, the worker pool is stopped. Hijacked connections, such as WebSockets, are not
+// tracked and must be closed by their handlers.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	t := &e.tracker
+	t.mu.Lock()
+	t.shuttingDown.Store(true)
+	for l := range t.listeners {
+		l.Close()
+	}
+	t.mu.Unlock()
+
+	start := time.Now()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		quiescent := e.closeIdleConns()
+		if e.OnDrain != nil {
+			e.OnDrain(DrainProgress{ConnStats: e.Stats(), Elapsed: time.Since(start)})
+		}
+		if quiescent {
+			e.stopWorkers()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package sse
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/edgflow/lux"
+)
+
+// Options tunes a Broker.
+type Options struct {
+	// History is the number of recent events kept per topic for replay to
+	// reconnecting clients. Zero disables replay.
+	History int
+
+	// Heartbeat is how often idle streams receive a comment, which keeps
+	// proxies from closing them and detects clients that went away.
+	// Defaults to 15 seconds.
+	Heartbeat time.Duration
+
+	// Retry, if set, tells clients how long to wait before reconnecting
+	Retry time.Duration
+
+	// Buffer is the number of events queued per client. A client that
+	// falls further behind is disconnected and catches up through replay
+	// when it reconnects. Defaults to 32.
+	Buffer int
+}
+
+// Broker keeps a registry of connected clients per topic and delivers
+// published events to them. Event IDs are assigned by the broker from a
+// single sequence, so a Last-Event-ID is meaningful across topics.
+type Broker struct {
+	opts Options
+
+	mu      sync.Mutex
+	lastID  uint64
+	topics  map[string]*topic
+	closed  bool
+	closing chan struct{}
+}
+
+type topic struct {
+	clients map[*client]struct{}
+	history []Event // oldest first, at most Options.History
+}
+
+type client struct {
+	events  chan Event
+	dropped bool
+}
+
+// NewBroker creates a broker.
+func NewBroker(opts Options) *Broker {
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = 15 * time.Second
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 32
+	}
+	return &Broker{
+		opts:    opts,
+		topics:  make(map[string]*topic),
+		closing: make(chan struct{}),
+	}
+}
+
+// Publish assigns the next ID to ev, records it in the topic's history
+// and queues it for every client subscribed to the topic. It returns the
+// event as sent.
+func (b *Broker) Publish(name string, ev Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	ev.ID = strconv.FormatUint(b.lastID, 10)
+
+	t := b.topic(name)
+	if b.opts.History > 0 {
+		if len(t.history) == b.opts.History {
+			t.history = append(t.history[:0], t.history[1:]...)
+		}
+		t.history = append(t.history, ev)
+	}
+	for c := range t.clients {
+		select {
+		case c.events <- ev:
+		default:
+			// Too slow; the client replays what it missed on reconnect
+			b.drop(c)
+		}
+	}
+	if len(t.clients) == 0 && len(t.history) == 0 {
+		delete(b.topics, name)
+	}
+	return ev
+}
+
+// Clients returns the number of clients subscribed to a topic.
+func (b *Broker) Clients(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[name]; ok {
+		return len(t.clients)
+	}
+	return 0
+}
+
+// Close ends every stream. Serve returns immediately afterwards.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.closing)
+	}
+}
+
+// topic returns the named topic, creating it. b.mu must be held.
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{clients: make(map[*client]struct{})}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// subscribe registers a client for the topics and returns it along with
+// the events after lastID that it has not seen, in ID order.
+func (b *Broker) subscribe(topics []string, lastID string) (*client, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := &client{events: make(chan Event, b.opts.Buffer)}
+	var missed []Event
+	after, err := strconv.ParseUint(lastID, 10, 64)
+	for _, name := range topics {
+		t := b.topic(name)
+		t.clients[c] = struct{}{}
+		if lastID == "" || err != nil {
+			continue
+		}
+		for _, ev := range t.history {
+			if id, _ := strconv.ParseUint(ev.ID, 10, 64); id > after {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	if len(topics) > 1 {
+		slices.SortFunc(missed, func(a, b Event) int {
+			x, _ := strconv.ParseUint(a.ID, 10, 64)
+			y, _ := strconv.ParseUint(b.ID, 10, 64)
+			return cmp.Compare(x, y)
+		})
+	}
+	return c, missed
+}
+
+// drop removes c from every topic and closes its queue. b.mu must be held.
+func (b *Broker) drop(c *client) {
+	for name, t := range b.topics {
+		if _, ok := t.clients[c]; !ok {
+			continue
+		}
+		delete(t.clients, c)
+		if len(t.clients) == 0 && len(t.history) == 0 {
+			delete(b.topics, name)
+		}
+	}
+	if !c.dropped {
+		c.dropped = true
+		close(c.events)
+	}
+}
+
+func (b *Broker) unsubscribe(c *client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(c)
+}
+
+// Serve streams the events of the given topics to the client until it
+// disconnects or the broker is closed, first replaying the events it missed
+// according to its Last-Event-ID header.
+func (b *Broker) Serve(c *lux.Context, topics ...string) {
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	// Streams outlive the connection's default write deadline
+	rc := http.NewResponseController(c.Writer)
+	rc.SetWriteDeadline(time.Time{})
+
+	sub, missed := b.subscribe(topics, c.Request.Header.Get("Last-Event-ID"))
+	defer b.unsubscribe(sub)
+
+	if b.opts.Retry > 0 {
+		Event{Retry: b.opts.Retry}.Encode(c.Writer)
+	}
+	for _, ev := range missed {
+		if ev.Encode(c.Writer) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(b.opts.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.events:
+			if !ok || ev.Encode(c.Writer) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if Comment(c.Writer, "ping") != nil {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		case <-b.closing:
+			return
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edgflow/lux"
+)
+
+// stream connects to the broker's /events/:topic route and returns a reader
+// of the event stream, which is closed at the end of the test.
+func stream(t *testing.T, b *Broker, topic, lastID string) (*bufio.Reader, context.CancelFunc) {
+	t.Helper()
+	engine := lux.NewEngine()
+	engine.Get("/events/:topic", func(c *lux.Context) {
+		b.Serve(c, strings.Split(c.Param("topic"), ",")...)
+	})
+	srv := httptest.NewServer(engine)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events/"+topic, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	return bufio.NewReader(resp.Body), cancel
+}
+
+// readEvent reads the lines of the next event, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v (read %q)", err, lines)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if len(lines) > 0 {
+				return lines
+			}
+		case !strings.HasPrefix(line, ":"):
+			lines = append(lines, line)
+		}
+	}
+}
+
+// waitClients waits until topic has n clients.
+func waitClients(t *testing.T, b *Broker, topic string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Clients(topic) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Clients(%q) = %d, want %d", topic, b.Clients(topic), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBrokerPublish(t *testing.T) {
+	b := NewBroker(Options{})
+	defer b.Close()
+	r, _ := stream(t, b, "news", "")
+	waitClients(t, b, "news", 1)
+
+	b.Publish("sports", Event{Data: "not subscribed"})
+	b.Publish("news", Event{Event: "headline", Data: "line one\nline two"})
+
+	got := strings.Join(readEvent(t, r), "|")
+	if want := "id: 2|event: headline|data: line one|data: line two"; got != want {
+		t.Errorf("event = %q, want %q", got, want)
+	}
+}
+
+func TestBrokerReplay(t *testing.T) {
+	b := NewBroker(Options{History: 2})
+	defer b.Close()
+	b.Publish("a", Event{Data: "1"})
+	b.Publish("b", Event{Data: "2"})
+	b.Publish("a", Event{Data: "3"})
+	b.Publish("a", Event{Data: "4"})
+
+	// Event 1 fell out of the history of a; the rest arrive in ID order
+	r, _ := stream(t, b, "a,b", "0")
+	for _, want := range []string{"id: 2|data: 2", "id: 3|data: 3", "id: 4|data: 4"} {
+		if got := strings.Join(readEvent(t, r), "|"); got != want {
+			t.Errorf("replayed %q, want %q", got, want)
+		}
+	}
+}
+
+func TestBrokerEvictsSlowClients(t *testing.T) {
+	b := NewBroker(Options{Buffer: 1})
+	defer b.Close()
+	slow, _ := b.subscribe([]string{"t"}, "")
+
+	b.Publish("t", Event{Data: "queued"})
+	b.Publish("t", Event{Data: "overflow"})
+
+	if n := b.Clients("t"); n != 0 {
+		t.Errorf("Clients = %d after overflow, want 0", n)
+	}
+	if ev, ok := <-slow.events; !ok || ev.Data != "queued" {
+		t.Errorf("first event = %+v, %v", ev, ok)
+	}
+	if _, ok := <-slow.events; ok {
+		t.Error("queue of an evicted client still open")
+	}
+	// Unsubscribing an evicted client is harmless
+	b.unsubscribe(slow)
+}
+
+func TestBrokerUnsubscribeOnDisconnect(t *testing.T) {
+	b := NewBroker(Options{})
+	defer b.Close()
+	_, cancel := stream(t, b, "room", "")
+	waitClients(t, b, "room", 1)
+
+	cancel()
+	waitClients(t, b, "room", 0)
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker(Options{})
+	r, _ := stream(t, b, "room", "")
+	waitClients(t, b, "room", 1)
+
+	b.Close()
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("stream still open after Close")
+	}
+	waitClients(t, b, "room", 0)
+}
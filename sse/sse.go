@@ -0,0 +1,67 @@
+// Package sse implements Server-Sent Events for lux: an Event encoder and
+// a Broker that fans published events out to subscribers by topic.
+//
+// Browsers reconnect to an event stream on their own and send the ID of
+// the last event they saw in the Last-Event-ID header; the Broker keeps a
+// per-topic history and replays whatever the client missed:
+//
+//	broker := sse.NewBroker(sse.Options{History: 100})
+//	engine.Get("/events/:room", func(c *lux.Context) {
+//		broker.Serve(c, c.Param("room"))
+//	})
+//	broker.Publish("lobby", sse.Event{Event: "message", Data: "hello"})
+package sse
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a single server-sent event.
+type Event struct {
+	ID    string
+	Event string // event type, "message" when empty
+	Data  string // may span several lines; events without data are not dispatched
+	Retry time.Duration
+}
+
+// Encode writes e in the text/event-stream format.
+func (e Event) Encode(w io.Writer) error {
+	var b strings.Builder
+	if e.ID != "" {
+		writeField(&b, "id", e.ID)
+	}
+	if e.Event != "" {
+		writeField(&b, "event", e.Event)
+	}
+	if e.Retry > 0 {
+		writeField(&b, "retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	// Clients only dispatch events that carry data
+	if e.Data != "" {
+		for _, line := range strings.Split(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\n") {
+			writeField(&b, "data", line)
+		}
+	}
+	b.WriteByte('\n')
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeField writes one field line. Line breaks are not allowed in the
+// single-line fields and are dropped.
+func writeField(b *strings.Builder, name, value string) {
+	b.WriteString(name)
+	b.WriteString(": ")
+	b.WriteString(strings.NewReplacer("\r", "", "\n", "").Replace(value))
+	b.WriteByte('\n')
+}
+
+// Comment writes a comment line, which clients ignore. Comments keep idle
+// connections from being closed by proxies.
+func Comment(w io.Writer, text string) error {
+	_, err := io.WriteString(w, ": "+text+"\n\n")
+	return err
+}
@@ -0,0 +1,317 @@
+package lux
+
+import (
+	"cmp"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StaticOptions tunes Static and StaticFS.
+type StaticOptions struct {
+	// Browse lists the contents of directories without an index.html.
+	// Listings are off by default so that a mount does not reveal more
+	// files than the pages link to.
+	Browse bool
+
+	// ListingTemplate renders directory listings from a DirListing. The
+	// default is a plain HTML table.
+	ListingTemplate *template.Template
+
+	// MaxAge sets Cache-Control max-age on files; zero sends no
+	// Cache-Control header
+	MaxAge time.Duration
+
+	// Immutable adds the immutable directive to Cache-Control, telling
+	// browsers not to revalidate until MaxAge expires. Meant for
+	// fingerprinted assets, whose URL changes with their content: with
+	// Fingerprints set, it is only sent for fingerprinted names.
+	Immutable bool
+
+	// ETag sends an entity tag derived from the file's size and
+	// modification time, so clients can revalidate with If-None-Match.
+	// Files without a modification time, such as those of an embed.FS,
+	// are tagged with a hash of their content instead.
+	ETag bool
+
+	// NoLastModified omits the Last-Modified header and ignores
+	// If-Modified-Since
+	NoLastModified bool
+
+	// Fingerprints resolves fingerprinted names such as app.3f2a91c0.js
+	// to the files they were derived from
+	Fingerprints *Fingerprints
+}
+
+// DirListing is the data a directory listing template is executed with.
+type DirListing struct {
+	Path    string // request path of the directory, with a trailing slash
+	Entries []DirEntry
+	Sort    string // "name", "size" or "mtime"
+	Desc    bool
+}
+
+// DirEntry is one file or subdirectory of a DirListing.
+type DirEntry struct {
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// Static serves the files below the directory root under relativePath.
+func (r *RouterGroup) Static(relativePath, root string, opts ...StaticOptions) IRoutes {
+	return r.StaticFS(relativePath, os.DirFS(root), opts...)
+}
+
+// StaticFS serves the files of fsys, for example an embed.FS, under
+// relativePath. A directory is answered with its index.html, or with a
+// listing when StaticOptions.Browse is set.
+func (r *RouterGroup) StaticFS(relativePath string, fsys fs.FS, opts ...StaticOptions) IRoutes {
+	var o StaticOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.ListingTemplate == nil {
+		o.ListingTemplate = defaultListingTemplate
+	}
+
+	// Names that are not fingerprinted may change content under the same URL
+	mutable := o
+	mutable.Immutable = false
+	handler := func(c *Context) {
+		name := c.Param("filepath")
+		opts := &o
+		if o.Fingerprints != nil {
+			orig := o.Fingerprints.original(name)
+			if orig == name {
+				opts = &mutable
+			}
+			name = orig
+		}
+		serveStatic(c, fsys, name, opts)
+	}
+	// Routes match exactly, so the root directory is registered with and
+	// without its trailing slash. All routes are kept for WithLabel and
+	// WithMeta, not just the last registration's.
+	dir := strings.TrimSuffix(relativePath, "/")
+	patterns := []string{dir + "/", dir + "/*filepath"}
+	if dir != "" {
+		patterns = append(patterns, dir)
+	}
+	var routes []*Node
+	for _, p := range patterns {
+		r.handleMethods([]string{http.MethodGet, http.MethodHead}, p, []HandlerFunc{handler})
+		routes = append(routes, r.engine.lastRoutes...)
+	}
+	r.engine.lastRoutes = routes
+	return r.returnObj()
+}
+
+// serveStatic answers the request for name, a slash-separated path below
+// the root of fsys.
+func serveStatic(c *Context, fsys fs.FS, name string, o *StaticOptions) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		c.staticError(err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		c.staticError(err)
+		return
+	}
+
+	if info.IsDir() {
+		// Relative links in the index and the listing need the slash
+		reqPath := c.Request.URL.Path
+		if !strings.HasSuffix(reqPath, "/") {
+			// The path is escaped so that names with %, ? or # keep their
+			// meaning, and starts with a single slash so that the Location
+			// can't point to another host
+			u := url.URL{Path: "/" + strings.TrimLeft(reqPath, "/") + "/", RawQuery: c.Request.URL.RawQuery}
+			c.Redirect(http.StatusMovedPermanently, u.String())
+			return
+		}
+		if index, err := fsys.Open(path.Join(name, "index.html")); err == nil {
+			defer index.Close()
+			if indexInfo, err := index.Stat(); err == nil && !indexInfo.IsDir() {
+				serveContent(c, index, indexInfo, o)
+				return
+			}
+		}
+		if !o.Browse {
+			c.staticError(fs.ErrNotExist)
+			return
+		}
+		serveListing(c, fsys, name, o)
+		return
+	}
+	serveContent(c, f, info, o)
+}
+
+// serveContent writes the file with the cache headers of o and with Range,
+// conditional request and content type handling from net/http.
+func serveContent(c *Context, f fs.File, info fs.FileInfo, o *StaticOptions) {
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		// Files without Seek are read into memory
+		b, err := io.ReadAll(f)
+		if err != nil {
+			c.staticError(err)
+			return
+		}
+		rs = strings.NewReader(string(b))
+	}
+
+	var etag string
+	if o.ETag {
+		version := strconv.FormatInt(info.ModTime().UnixNano(), 16)
+		if info.ModTime().IsZero() {
+			// Every file of an embed.FS has the zero time, so size and
+			// time alone would give same-sized files the same tag
+			sum := fnv.New64a()
+			if _, err := io.Copy(sum, rs); err != nil {
+				c.staticError(err)
+				return
+			}
+			if _, err := rs.Seek(0, io.SeekStart); err != nil {
+				c.staticError(err)
+				return
+			}
+			version = strconv.FormatUint(sum.Sum64(), 16)
+		}
+		etag = `"` + strconv.FormatInt(info.Size(), 16) + "-" + version + `"`
+	}
+
+	h := c.Writer.Header()
+	if o.MaxAge > 0 {
+		cc := "public, max-age=" + strconv.FormatInt(int64(o.MaxAge/time.Second), 10)
+		if o.Immutable {
+			cc += ", immutable"
+		}
+		h.Set("Cache-Control", cc)
+	}
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	modTime := info.ModTime()
+	if o.NoLastModified {
+		modTime = time.Time{}
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name(), modTime, rs)
+}
+
+// serveListing renders the listing of the directory name.
+func serveListing(c *Context, fsys fs.FS, name string, o *StaticOptions) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		c.staticError(err)
+		return
+	}
+
+	listing := DirListing{
+		Path: c.Request.URL.Path,
+		Sort: c.Query("sort"),
+		Desc: c.Query("order") == "desc",
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		listing.Entries = append(listing.Entries, DirEntry{
+			Name:    entry.Name(),
+			IsDir:   entry.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	listing.sort()
+
+	var buf strings.Builder
+	if err := o.ListingTemplate.Execute(&buf, listing); err != nil {
+		c.engine.logger().Error("directory listing", "path", listing.Path, "error", err)
+		c.staticError(err)
+		return
+	}
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, strings.NewReader(buf.String()))
+}
+
+// sort orders the entries by the requested column, directories first.
+func (l *DirListing) sort() {
+	if l.Sort != "size" && l.Sort != "mtime" {
+		l.Sort = "name"
+	}
+	slices.SortStableFunc(l.Entries, func(a, b DirEntry) int {
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		var n int
+		switch l.Sort {
+		case "size":
+			n = cmp.Compare(a.Size, b.Size)
+		case "mtime":
+			n = a.ModTime.Compare(b.ModTime)
+		}
+		if n == 0 {
+			n = strings.Compare(a.Name, b.Name)
+		}
+		if l.Desc {
+			n = -n
+		}
+		return n
+	})
+}
+
+// staticError answers 404 for missing files and 500 otherwise.
+func (c *Context) staticError(err error) {
+	code := http.StatusInternalServerError
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		code = http.StatusNotFound
+	}
+	c.Writer.Header().Set("Content-Length", "0")
+	c.Writer.WriteHeader(code)
+	c.Abort()
+}
+
+var defaultListingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"escape": url.PathEscape,
+	"order": func(l DirListing, column string) string {
+		if l.Sort == column && !l.Desc {
+			return "desc"
+		}
+		return "asc"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th><a href="?sort=name&amp;order={{order . "name"}}">Name</a></th><th><a href="?sort=size&amp;order={{order . "size"}}">Size</a></th><th><a href="?sort=mtime&amp;order={{order . "mtime"}}">Modified</a></th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{escape .Name}}{{if .IsDir}}/{{end}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
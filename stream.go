@@ -0,0 +1,101 @@
+package lux
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SSEvent writes one server-sent event in the text/event-stream format,
+// setting the stream's headers on the first event. Strings and byte slices
+// are sent as they are, spread over several data lines if they contain
+// line breaks; other values are encoded as JSON. An empty name sends a
+// plain "message" event. A value that cannot be encoded is logged and the
+// event dropped; if nothing was written yet the request is answered 500.
+//
+// Events are buffered like any other write; send them from a Stream step
+// or call Writer.Flush to deliver them right away. The sse package adds
+// event IDs, replay and fan-out on top of this.
+func (c *Context) SSEvent(name string, data any) {
+	var payload string
+	switch v := data.(type) {
+	case string:
+		payload = v
+	case []byte:
+		payload = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			c.engine.logger().Error("sse render", "route", c.RouteLabel(), "error", err)
+			if !c.Writer.Written() {
+				c.Writer.Header().Set("Content-Length", "0")
+				c.Writer.WriteHeader(http.StatusInternalServerError)
+			}
+			c.Abort()
+			return
+		}
+		payload = string(b)
+	}
+
+	h := c.Writer.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no")
+	}
+
+	var b strings.Builder
+	if name != "" {
+		b.WriteString("event: ")
+		b.WriteString(strings.NewReplacer("\r", "", "\n", "").Replace(name))
+		b.WriteByte('\n')
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(payload, "\r\n", "\n"), "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	c.Writer.WriteString(b.String())
+}
+
+// Stream calls step repeatedly, flushing what it wrote to the client after
+// each call, until step returns false or the client goes away. It reports
+// whether the client disconnected before step was done:
+//
+//	engine.Get("/ticks", func(c *lux.Context) {
+//		c.Stream(func(w io.Writer) bool {
+//			c.SSEvent("tick", time.Now())
+//			time.Sleep(time.Second)
+//			return true
+//		})
+//	})
+//
+// The connection's write deadline is lifted for the duration of the
+// stream, since it was set for a prompt response.
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	rc := http.NewResponseController(c.Writer)
+	rc.SetWriteDeadline(time.Time{})
+
+	gone, stop := c.writermem.watchClose(c.engine.config().readTimeout)
+	defer stop()
+
+	for {
+		select {
+		case <-gone:
+			return true
+		case <-c.Request.Context().Done():
+			return true
+		default:
+		}
+		keepOpen := step(c.Writer)
+		if rc.Flush() != nil {
+			return true
+		}
+		if !keepOpen {
+			return false
+		}
+	}
+}
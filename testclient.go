@@ -0,0 +1,49 @@
+package lux
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+)
+
+// TestRequest runs a request through routing and middleware without opening
+// a socket and returns the recorded response. The engine serves one end of
+// an in-memory pipe exactly as it would a client connection, so handlers
+// observe the same request parsing and response writing as in production.
+// headers may be nil. TestRequest panics if the exchange fails, for example
+// when a handler hijacks the connection.
+func (e *Engine) TestRequest(method, path string, body io.Reader, headers http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	for k, vs := range headers {
+		req.Header[k] = vs
+	}
+	req.Close = true
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go e.handleConn(server)
+
+	// The engine may answer before it has read the whole body, so the
+	// request is written concurrently with reading the response
+	go func() {
+		req.Write(client)
+	}()
+
+	resp, err := http.ReadResponse(bufio.NewReader(client), req)
+	if err != nil {
+		panic("lux: TestRequest: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	rec := httptest.NewRecorder()
+	for k, vs := range resp.Header {
+		rec.Header()[k] = vs
+	}
+	rec.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(rec, resp.Body); err != nil {
+		panic("lux: TestRequest: " + err.Error())
+	}
+	return rec
+}
@@ -0,0 +1,147 @@
+package lux
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context headers (https://www.w3.org/TR/trace-context/)
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// TraceContext identifies the span a request is handled in.
+type TraceContext struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte // span of the caller, zero when the trace starts here
+	Flags    byte    // trace flags, 0x01 means sampled
+	State    string  // vendor-specific tracestate, passed through unchanged
+}
+
+// ParseTraceParent parses a traceparent header value. The span ID of the
+// header becomes SpanID of the result.
+func ParseTraceParent(s string) (TraceContext, bool) {
+	var tc TraceContext
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return tc, false
+	}
+	version, ok := decodeHex(s[:2])
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(s) != 55) {
+		return tc, false
+	}
+	if len(s) > 55 && s[55] != '-' {
+		return tc, false
+	}
+	traceID, ok1 := decodeHex(s[3:35])
+	spanID, ok2 := decodeHex(s[36:52])
+	flags, ok3 := decodeHex(s[53:55])
+	if !ok1 || !ok2 || !ok3 {
+		return tc, false
+	}
+	copy(tc.TraceID[:], traceID)
+	copy(tc.SpanID[:], spanID)
+	tc.Flags = flags[0]
+	if tc.TraceID == [16]byte{} || tc.SpanID == [8]byte{} {
+		return tc, false
+	}
+	return tc, true
+}
+
+// decodeHex decodes lower-case hex, which is all traceparent allows.
+func decodeHex(s string) ([]byte, bool) {
+	if strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// NewTraceContext starts a new, sampled trace.
+func NewTraceContext() TraceContext {
+	tc := TraceContext{Flags: 0x01}
+	for tc.TraceID == [16]byte{} {
+		binary.BigEndian.PutUint64(tc.TraceID[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(tc.TraceID[8:], rand.Uint64())
+	}
+	tc.SpanID = newSpanID()
+	return tc
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	for id == [8]byte{} {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
+
+// ChildOf returns a trace context for a new span whose parent is tc.
+func (tc TraceContext) ChildOf() TraceContext {
+	child := tc
+	child.ParentID = tc.SpanID
+	child.SpanID = newSpanID()
+	return child
+}
+
+// TraceParent formats the traceparent header announcing tc's span.
+func (tc TraceContext) TraceParent() string {
+	var b strings.Builder
+	b.Grow(55)
+	b.WriteString("00-")
+	b.WriteString(hex.EncodeToString(tc.TraceID[:]))
+	b.WriteByte('-')
+	b.WriteString(hex.EncodeToString(tc.SpanID[:]))
+	b.WriteByte('-')
+	b.WriteString(hex.EncodeToString([]byte{tc.Flags}))
+	return b.String()
+}
+
+// Inject sets the traceparent and tracestate headers on h so that the
+// receiver continues the trace as a child of tc's span.
+func (tc TraceContext) Inject(h http.Header) {
+	h.Set(HeaderTraceParent, tc.TraceParent())
+	if tc.State != "" {
+		h.Set(HeaderTraceState, tc.State)
+	} else {
+		h.Del(HeaderTraceState)
+	}
+}
+
+// Trace returns the trace context of the request. An incoming traceparent
+// header is continued with a new span for this server; otherwise a new
+// trace is started. The result is computed once per request.
+func (c *Context) Trace() TraceContext {
+	if !c.traced {
+		if parent, ok := ParseTraceParent(c.Request.Header.Get(HeaderTraceParent)); ok {
+			parent.State = c.Request.Header.Get(HeaderTraceState)
+			c.trace = parent.ChildOf()
+		} else {
+			c.trace = NewTraceContext()
+		}
+		c.traced = true
+	}
+	return c.trace
+}
+
+// TraceID returns the hex-encoded trace ID of the request.
+func (c *Context) TraceID() string {
+	tc := c.Trace()
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// SpanID returns the hex-encoded ID of the span handling the request.
+func (c *Context) SpanID() string {
+	tc := c.Trace()
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// InjectTrace propagates the request's trace onto an outbound request.
+func (c *Context) InjectTrace(req *http.Request) {
+	c.Trace().Inject(req.Header)
+}
@@ -0,0 +1,112 @@
+package lux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	sampleTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	sampleSpanID  = "00f067aa0ba902b7"
+	sampleParent  = "00-" + sampleTraceID + "-" + sampleSpanID + "-01"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{sampleParent, true},
+		{"00-" + sampleTraceID + "-" + sampleSpanID + "-00", true},
+		// Later versions may append fields
+		{"01-" + sampleTraceID + "-" + sampleSpanID + "-01-more", true},
+		{"00-" + sampleTraceID + "-" + sampleSpanID + "-01-more", false},
+		{"01-" + sampleTraceID + "-" + sampleSpanID + "-01more", false},
+		{"ff-" + sampleTraceID + "-" + sampleSpanID + "-01", false},
+		{"00-" + strings.ToUpper(sampleTraceID) + "-" + sampleSpanID + "-01", false},
+		{"00-00000000000000000000000000000000-" + sampleSpanID + "-01", false},
+		{"00-" + sampleTraceID + "-0000000000000000-01", false},
+		{"00-" + sampleTraceID + "-" + sampleSpanID + "-0x", false},
+		{"00-" + sampleTraceID + "_" + sampleSpanID + "-01", false},
+		{sampleParent[:54], false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		tc, ok := ParseTraceParent(tt.in)
+		if ok != tt.ok {
+			t.Errorf("ParseTraceParent(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+			continue
+		}
+		if ok && tc.TraceParent()[3:52] != sampleTraceID+"-"+sampleSpanID {
+			t.Errorf("ParseTraceParent(%q) = %s", tt.in, tc.TraceParent())
+		}
+	}
+}
+
+func TestContextTrace(t *testing.T) {
+	var traceID, spanID string
+	var outbound *http.Request
+	engine := NewEngine()
+	engine.Get("/", func(c *Context) {
+		traceID, spanID = c.TraceID(), c.SpanID()
+		if c.SpanID() != spanID {
+			t.Error("SpanID changed within a request")
+		}
+		outbound, _ = http.NewRequest(http.MethodGet, "http://backend/", nil)
+		c.InjectTrace(outbound)
+	})
+
+	// An incoming trace is continued in a new span
+	engine.TestRequest(http.MethodGet, "/", nil, http.Header{
+		"Traceparent": {sampleParent},
+		"Tracestate":  {"vendor=value"},
+	})
+	if traceID != sampleTraceID || spanID == sampleSpanID || len(spanID) != 16 {
+		t.Errorf("TraceID = %q, SpanID = %q", traceID, spanID)
+	}
+	if got, want := outbound.Header.Get("traceparent"), "00-"+sampleTraceID+"-"+spanID+"-01"; got != want {
+		t.Errorf("outbound traceparent = %q, want %q", got, want)
+	}
+	if got := outbound.Header.Get("tracestate"); got != "vendor=value" {
+		t.Errorf("outbound tracestate = %q", got)
+	}
+
+	// Otherwise a new sampled trace starts, and a malformed header is
+	// ignored
+	for _, header := range []http.Header{nil, {"Traceparent": {"garbage"}, "Tracestate": {"vendor=value"}}} {
+		engine.TestRequest(http.MethodGet, "/", nil, header)
+		if len(traceID) != 32 || traceID == sampleTraceID {
+			t.Errorf("new TraceID = %q", traceID)
+		}
+		tc, ok := ParseTraceParent(outbound.Header.Get("traceparent"))
+		if !ok || tc.Flags != 0x01 || outbound.Header.Get("tracestate") != "" {
+			t.Errorf("outbound headers of a new trace = %v", outbound.Header)
+		}
+	}
+}
+
+func TestProxyPropagatesTrace(t *testing.T) {
+	var upstream http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	var spanID string
+	engine := NewEngine()
+	engine.Get("/api", func(c *Context) {
+		spanID = c.SpanID()
+		c.Proxy(target, ProxyOptions{})
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.Header.Set("traceparent", sampleParent)
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got, want := upstream.Get("traceparent"), "00-"+sampleTraceID+"-"+spanID+"-01"; got != want {
+		t.Errorf("upstream traceparent = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,329 @@
+package lux
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrUploadTooLarge is returned while parsing a multipart body once a file
+// exceeds the quota set with MaxUploadSize.
+var ErrUploadTooLarge = errors.New("lux: uploaded file too large")
+
+// UploadProgress reports how much of a multipart request body has been
+// received.
+type UploadProgress struct {
+	Field    string // form field of the current part
+	Filename string // file name of the current part, empty for plain values
+	Part     int64  // bytes of the current part received so far
+	Total    int64  // bytes of all parts received so far
+	Done     bool   // the current part is complete
+}
+
+// OnUploadProgress registers fn to be called as the multipart body of the
+// request is parsed, after every chunk read from a part and once more when
+// the part is complete. An error returned by fn aborts parsing; it is then
+// returned by MultipartForm and FormFile. Hooks must be registered before
+// the form is first accessed.
+func (c *Context) OnUploadProgress(fn func(UploadProgress) error) {
+	c.uploadHooks = append(c.uploadHooks, fn)
+}
+
+// MultipartForm parses the multipart body of the request, keeping up to
+// Engine.MaxMultipartMemory bytes of files in memory and the rest in
+// temporary files. The temporary files are removed once the handler chain
+// returns; use SaveUploadedFile to keep an upload.
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if err := c.parseMultipart(); err != nil {
+		return nil, err
+	}
+	return c.Request.MultipartForm, nil
+}
+
+// FormFile returns the first file uploaded in the multipart form field name.
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if files := form.File[name]; len(files) > 0 {
+		return files[0], nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// SaveUploadedFile writes the content of an uploaded file to dst, creating
+// the parent directories as needed. dst is a path on the server and must
+// not be derived from fh.Filename without sanitizing it.
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// MaxUploadSize returns middleware that limits each file of a multipart
+// upload to limit bytes. Parsing stops as soon as a file goes over, rather
+// than after the whole body was received, and the request is answered 413
+// Request Entity Too Large unless the handler has responded already.
+func MaxUploadSize(limit int64) HandlerFunc {
+	return func(c *Context) {
+		exceeded := false
+		c.OnUploadProgress(func(p UploadProgress) error {
+			if p.Filename != "" && p.Part > limit {
+				exceeded = true
+				return ErrUploadTooLarge
+			}
+			return nil
+		})
+		c.Next()
+		if exceeded && !c.Writer.Written() {
+			c.Writer.Header().Set("Content-Length", "0")
+			c.Writer.Header().Set("Connection", "close")
+			c.Writer.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}
+}
+
+// removeMultipartFiles deletes the temporary files of the multipart form
+// parsed for the request, which handlers may have replaced by a copy of
+// req, once the handler chain is done with them.
+func (c *Context) removeMultipartFiles(req *http.Request) {
+	if form := c.Request.MultipartForm; form != nil {
+		form.RemoveAll()
+	}
+	if form := req.MultipartForm; form != nil && req != c.Request {
+		form.RemoveAll()
+	}
+}
+
+// parseMultipart parses the multipart body into Request.MultipartForm,
+// Request.PostForm and Request.Form.
+func (c *Context) parseMultipart() error {
+	req := c.Request
+	if req.MultipartForm != nil {
+		return nil
+	}
+	if len(c.uploadHooks) == 0 {
+		return req.ParseMultipartForm(c.engine.MaxMultipartMemory)
+	}
+
+	if req.PostForm == nil {
+		if err := req.ParseForm(); err != nil {
+			return err
+		}
+	}
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	// The parts are copied, reporting progress, into a pipe from which
+	// multipart.Reader.ReadForm builds the form with its usual handling of
+	// memory limits and temporary files.
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(c.copyParts(mr, mw))
+	}()
+	form, err := multipart.NewReader(pr, mw.Boundary()).ReadForm(c.engine.MaxMultipartMemory)
+	pr.CloseWithError(err)
+	<-done
+	if err != nil {
+		return err
+	}
+
+	for k, v := range form.Value {
+		req.Form[k] = append(req.Form[k], v...)
+		req.PostForm[k] = append(req.PostForm[k], v...)
+	}
+	req.MultipartForm = form
+	return nil
+}
+
+// copyParts copies every part of mr to mw, calling the upload hooks as the
+// data goes through.
+func (c *Context) copyParts(mr *multipart.Reader, mw *multipart.Writer) error {
+	var total int64
+	buf := make([]byte, 32<<10)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return mw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		w, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+
+		p := UploadProgress{Field: part.FormName(), Filename: part.FileName()}
+		for {
+			n, rerr := part.Read(buf)
+			if n > 0 {
+				p.Part += int64(n)
+				total += int64(n)
+				p.Total = total
+				if err := c.reportUpload(p); err != nil {
+					return err
+				}
+				if _, err := w.Write(buf[:n]); err != nil {
+					return err
+				}
+			}
+			if rerr == io.EOF {
+				break
+			}
+			if rerr != nil {
+				return rerr
+			}
+		}
+		p.Done = true
+		if err := c.reportUpload(p); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Context) reportUpload(p UploadProgress) error {
+	for _, fn := range c.uploadHooks {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UploadRule constrains the files uploaded in one form field.
+type UploadRule struct {
+	// MaxSize limits each file to this many bytes; larger uploads are
+	// answered 413 Request Entity Too Large. Zero means no limit.
+	MaxSize int64
+
+	// Extensions lists the allowed file name extensions, such as ".png".
+	// They are compared case-insensitively. Empty allows any.
+	Extensions []string
+
+	// Types lists the allowed media types, such as "image/png" or
+	// "image/*". The type is sniffed from the first bytes of the content,
+	// not taken from the client. Empty allows any.
+	Types []string
+}
+
+// ValidateUploads returns middleware that checks the files of multipart
+// requests against rules, keyed by form field, before the handler runs.
+// The rule under "*" applies to fields without one of their own. Files
+// that break a rule are answered 413 when too large and 415 Unsupported
+// Media Type when of the wrong kind; malformed bodies are answered 400.
+//
+//	engine.Post("/avatar", lux.ValidateUploads(map[string]lux.UploadRule{
+//		"image": {MaxSize: 2 << 20, Types: []string{"image/png", "image/jpeg"}},
+//	}), saveAvatar)
+func ValidateUploads(rules map[string]UploadRule) HandlerFunc {
+	return func(c *Context) {
+		c.OnUploadProgress(func(p UploadProgress) error {
+			if rule, ok := uploadRule(rules, p.Field); ok && p.Filename != "" && rule.MaxSize > 0 && p.Part > rule.MaxSize {
+				return ErrUploadTooLarge
+			}
+			return nil
+		})
+
+		form, err := c.MultipartForm()
+		switch {
+		case errors.Is(err, http.ErrNotMultipart):
+			c.Next()
+			return
+		case errors.Is(err, ErrUploadTooLarge):
+			c.Writer.Header().Set("Connection", "close")
+			abortWithStatus(c, http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			abortWithStatus(c, http.StatusBadRequest)
+			return
+		}
+
+		for field, files := range form.File {
+			rule, ok := uploadRule(rules, field)
+			if !ok {
+				continue
+			}
+			for _, fh := range files {
+				if code := rule.check(fh); code != 0 {
+					c.engine.logger().Debug("upload rejected", "route", c.RouteLabel(), "field", field, "file", fh.Filename, "status", code)
+					abortWithStatus(c, code)
+					return
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+func uploadRule(rules map[string]UploadRule, field string) (UploadRule, bool) {
+	if rule, ok := rules[field]; ok {
+		return rule, true
+	}
+	rule, ok := rules["*"]
+	return rule, ok
+}
+
+// check returns the status answering a file that breaks the rule, or 0.
+func (r UploadRule) check(fh *multipart.FileHeader) int {
+	if r.MaxSize > 0 && fh.Size > r.MaxSize {
+		return http.StatusRequestEntityTooLarge
+	}
+	if len(r.Extensions) > 0 {
+		ext := filepath.Ext(fh.Filename)
+		if !slices.ContainsFunc(r.Extensions, func(e string) bool { return strings.EqualFold(e, ext) }) {
+			return http.StatusUnsupportedMediaType
+		}
+	}
+	if len(r.Types) > 0 {
+		f, err := fh.Open()
+		if err != nil {
+			return http.StatusBadRequest
+		}
+		defer f.Close()
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+		if !slices.ContainsFunc(r.Types, func(t string) bool { return matchMediaType(t, mediaType) }) {
+			return http.StatusUnsupportedMediaType
+		}
+	}
+	return 0
+}
+
+// matchMediaType reports whether mediaType matches pattern, which may end
+// in a "/*" wildcard.
+func matchMediaType(pattern, mediaType string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		major, _, _ := strings.Cut(mediaType, "/")
+		return strings.EqualFold(prefix, major)
+	}
+	return strings.EqualFold(pattern, mediaType)
+}
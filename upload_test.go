@@ -0,0 +1,192 @@
+package lux
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultipartTempFilesRemoved(t *testing.T) {
+	engine := NewEngine()
+	engine.MaxMultipartMemory = 16
+	var tempName string
+	engine.Post("/upload", func(c *Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		if osFile, ok := f.(*os.File); ok {
+			tempName = osFile.Name()
+		}
+	})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "big.txt")
+	part.Write([]byte(strings.Repeat("x", 4096)))
+	mw.Close()
+	engine.TestRequest(http.MethodPost, "/upload", &body, http.Header{"Content-Type": {mw.FormDataContentType()}})
+
+	if tempName == "" {
+		t.Fatal("upload was not stored in a temporary file")
+	}
+	if _, err := os.Stat(tempName); !os.IsNotExist(err) {
+		t.Errorf("temporary file %s still exists after the request: %v", tempName, err)
+	}
+}
+
+func TestMultipartDefaultMemory(t *testing.T) {
+	engine := NewEngine()
+	inMemory := false
+	engine.Post("/upload", func(c *Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		_, onDisk := f.(*os.File)
+		inMemory = !onDisk
+	})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "small.txt")
+	part.Write([]byte("hello"))
+	mw.Close()
+	engine.TestRequest(http.MethodPost, "/upload", &body, http.Header{"Content-Type": {mw.FormDataContentType()}})
+
+	if !inMemory {
+		t.Error("small upload was written to a temporary file")
+	}
+}
+
+func TestSaveUploadedFile(t *testing.T) {
+	engine := NewEngine()
+	engine.MaxMultipartMemory = 16
+	dir := t.TempDir()
+	// Uploads over MaxMultipartMemory go to the temporary directory
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	spilled := false
+	engine.Post("/upload", func(c *Context) {
+		form, err := c.MultipartForm()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if got := form.Value["title"]; len(got) != 1 || got[0] != "photos" {
+			t.Errorf("title = %q", got)
+		}
+		if entries, _ := os.ReadDir(tmp); len(entries) > 0 {
+			spilled = true
+		}
+		for _, fh := range form.File["files"] {
+			if err := c.SaveUploadedFile(fh, filepath.Join(dir, "nested", fh.Filename)); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	files := map[string]string{
+		"one.txt": strings.Repeat("1", 100),
+		"two.txt": strings.Repeat("2", 200),
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "photos")
+	for name, content := range files {
+		part, _ := mw.CreateFormFile("files", name)
+		part.Write([]byte(content))
+	}
+	mw.Close()
+	w := engine.TestRequest(http.MethodPost, "/upload", &body, http.Header{"Content-Type": {mw.FormDataContentType()}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /upload = %d", w.Code)
+	}
+
+	for name, content := range files {
+		saved, err := os.ReadFile(filepath.Join(dir, "nested", name))
+		if err != nil || string(saved) != content {
+			t.Errorf("saved %s = %d bytes, %v", name, len(saved), err)
+		}
+	}
+	if !spilled {
+		t.Fatal("uploads were not stored in temporary files")
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("temporary files left after the request: %v", entries)
+	}
+}
+
+func TestValidateUploads(t *testing.T) {
+	engine := NewEngine()
+	ran := false
+	engine.Post("/upload", ValidateUploads(map[string]UploadRule{
+		"image": {MaxSize: 1024, Types: []string{"image/*"}},
+		"doc":   {Extensions: []string{".pdf"}},
+		"*":     {MaxSize: 16},
+	}), func(c *Context) {
+		ran = true
+	})
+
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32)
+	tests := []struct {
+		name     string
+		field    string
+		filename string
+		content  string
+		want     int
+	}{
+		{"allowed type", "image", "a.png", png, http.StatusOK},
+		{"sniffed type", "image", "a.png", "plain text, not an image", http.StatusUnsupportedMediaType},
+		{"too large while parsing", "image", "a.png", png + strings.Repeat("x", 4096), http.StatusRequestEntityTooLarge},
+		{"allowed extension", "doc", "report.PDF", "%PDF-1.4", http.StatusOK},
+		{"wrong extension", "doc", "report.exe", "%PDF-1.4", http.StatusUnsupportedMediaType},
+		{"fallback rule", "other", "a.txt", "small", http.StatusOK},
+		{"fallback rule too large", "other", "a.txt", strings.Repeat("x", 17), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			part, _ := mw.CreateFormFile(tt.field, tt.filename)
+			part.Write([]byte(tt.content))
+			mw.Close()
+
+			ran = false
+			w := engine.TestRequest(http.MethodPost, "/upload", &body, http.Header{"Content-Type": {mw.FormDataContentType()}})
+			if w.Code != tt.want || ran != (tt.want == http.StatusOK) {
+				t.Errorf("status = %d, handler ran %v, want %d", w.Code, ran, tt.want)
+			}
+		})
+	}
+
+	ran = false
+	w := engine.TestRequest(http.MethodPost, "/upload", strings.NewReader(`{"a":1}`), http.Header{"Content-Type": {"application/json"}})
+	if w.Code != http.StatusOK || !ran {
+		t.Errorf("non-multipart request = %d, handler ran %v", w.Code, ran)
+	}
+
+	ran = false
+	w = engine.TestRequest(http.MethodPost, "/upload", strings.NewReader("not a multipart body"), http.Header{"Content-Type": {"multipart/form-data; boundary=x"}})
+	if w.Code != http.StatusBadRequest || ran {
+		t.Errorf("malformed body = %d, handler ran %v", w.Code, ran)
+	}
+}
@@ -0,0 +1,171 @@
+package lux
+
+import (
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy decides what happens to a request when every worker is busy
+// and the worker pool's queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue, up to QueueTimeout.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject answers 503 Service Unavailable and closes the connection.
+	OverflowReject
+	// OverflowInline runs the handlers on the connection's goroutine.
+	OverflowInline
+)
+
+// WorkerPoolOptions configures the bounded worker pool, see EnableWorkerPool.
+type WorkerPoolOptions struct {
+	// Workers is the number of goroutines running handler chains.
+	// Defaults to runtime.NumCPU().
+	Workers int `json:"workers"`
+	// QueueSize is the number of requests waiting for a worker.
+	// Defaults to Workers.
+	QueueSize int `json:"queue_size"`
+	// Policy applies when the queue is full.
+	Policy OverflowPolicy `json:"policy"`
+	// QueueTimeout bounds the wait under OverflowBlock, after which the
+	// request is rejected. Zero waits indefinitely.
+	QueueTimeout time.Duration `json:"queue_timeout"`
+}
+
+// workerPool runs handler chains on a fixed set of goroutines.
+type workerPool struct {
+	jobs    chan *Context
+	policy  OverflowPolicy
+	timeout time.Duration
+	opts    WorkerPoolOptions // as resolved, for introspection
+
+	quit     chan struct{} // closed by stop
+	stopped  chan struct{} // closed once every worker has returned
+	stopOnce sync.Once
+}
+
+// EnableWorkerPool runs handler chains on a bounded pool of workers instead
+// of on each connection's goroutine, capping the number of requests in
+// flight under connection floods. It must be called once, before the engine
+// starts serving. The workers stop when Shutdown completes; requests served
+// after that run on their connection's goroutine.
+func (e *Engine) EnableWorkerPool(opts WorkerPoolOptions) {
+	if e.workers != nil {
+		panic("lux: EnableWorkerPool called twice")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = opts.Workers
+	}
+
+	p := &workerPool{
+		jobs:    make(chan *Context, opts.QueueSize),
+		policy:  opts.Policy,
+		timeout: opts.QueueTimeout,
+		opts:    opts,
+		quit:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case c := <-p.jobs:
+					e.handleHttpRequest(c)
+					c.done <- struct{}{}
+				case <-p.quit:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(p.stopped)
+	}()
+	e.workers = p
+}
+
+// stopWorkers stops the worker pool, if any, once the engine has drained.
+func (e *Engine) stopWorkers() {
+	if p := e.workers; p != nil {
+		p.stopOnce.Do(func() { close(p.quit) })
+	}
+}
+
+// serveRequest runs the handler chain for c, through the worker pool when
+// one is enabled.
+func (e *Engine) serveRequest(c *Context) {
+	p := e.workers
+	if p == nil {
+		e.handleHttpRequest(c)
+		return
+	}
+	if !p.submit(c) {
+		if p.policy == OverflowInline || p.isStopped() {
+			e.handleHttpRequest(c)
+			return
+		}
+		c.writermem.Header().Set("Connection", "close")
+		c.writermem.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case <-c.done:
+	case <-p.stopped:
+		// The workers may have quit before taking c
+		select {
+		case <-c.done:
+		default:
+			e.handleHttpRequest(c)
+		}
+	}
+}
+
+// isStopped reports whether stop was called.
+func (p *workerPool) isStopped() bool {
+	select {
+	case <-p.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// submit queues c for a worker and reports whether it was accepted.
+func (p *workerPool) submit(c *Context) bool {
+	if p.isStopped() {
+		return false
+	}
+	select {
+	case p.jobs <- c:
+		return true
+	default:
+	}
+	if p.policy != OverflowBlock {
+		return false
+	}
+
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p.jobs <- c:
+		return true
+	case <-timeout:
+		return false
+	case <-p.quit:
+		return false
+	}
+}
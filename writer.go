@@ -3,8 +3,11 @@ package lux
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 const (
@@ -34,25 +37,123 @@ type responseWriter struct {
 	conn         net.Conn
 	header       http.Header
 	headerSent   bool
+	hijacked     bool
 	writer       *bufio.Writer
 	hijackReader *bufio.Reader
+
+	// The header block is held back along with up to bufferSize bytes of
+	// body, so that a response completed within that size can be sent
+	// with a Content-Length and anything longer with chunked encoding.
+	body        []byte
+	bufferSize  int
+	server      string
+	chunked     bool
+	canChunk    bool // the client speaks HTTP/1.1
+	discardBody bool // HEAD request
 }
 
+// framing selects how commit delimits the body that follows the headers.
+type framing int
+
+const (
+	frameLength  framing = iota // the whole body is buffered
+	frameChunked                // more is to come, chunked if possible
+	frameNone                   // the connection is hijacked
+)
+
 var _ ResponseWriter = (*responseWriter)(nil)
 
 func (w *responseWriter) Unwrap() http.ResponseWriter {
 	return w.ResponseWriter
 }
 
-func (w *responseWriter) reset(writer http.ResponseWriter, conn net.Conn) {
-	w.ResponseWriter = writer
+// reset prepares the writer for the next request on conn, reusing the
+// connection's buffered reader and writer.
+func (w *responseWriter) reset(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer) {
+	w.ResponseWriter = nil
 	w.size = noWritten
 	w.status = defaultStatus
-	w.hijackReader = bufio.NewReader(conn)
-	w.writer = bufio.NewWriter(conn)
+	w.conn = conn
+	w.headerSent = false
+	w.hijacked = false
+	w.hijackReader = reader
+	w.writer = writer
+	w.body = w.body[:0]
+	w.chunked = false
+	clear(w.header)
+}
+
+// prepare adapts the writer to req, the request it answers. bufferSize
+// and server are the engine's ResponseBufferSize and ServerHeader.
+func (w *responseWriter) prepare(req *http.Request, bufferSize int, server string) {
+	w.bufferSize = bufferSize
+	w.server = server
+	w.canChunk = req.ProtoAtLeast(1, 1)
+	w.discardBody = req.Method == http.MethodHead
+}
+
+// resetHTTP prepares the writer for a request served through
+// Engine.ServeHTTP, where the response goes to rw instead of a connection.
+func (w *responseWriter) resetHTTP(rw http.ResponseWriter) {
+	w.ResponseWriter = rw
+	w.size = noWritten
+	w.status = defaultStatus
+	w.conn = nil
+	w.headerSent = false
+	w.hijacked = false
+	w.hijackReader = nil
+	w.writer = nil
+}
+
+// finish completes the response once the handler chain has returned and
+// reports whether the connection can be kept alive for another request.
+// Up to maxDrain bytes of unread request body are discarded to get there.
+func (w *responseWriter) finish(req *http.Request, maxDrain int64) bool {
+	w.WriteHeaderNow()
+	if !w.headerSent {
+		if w.commit(frameLength) != nil {
+			return false
+		}
+	}
+	if w.chunked && !w.discardBody {
+		w.writer.WriteString("0\r\n\r\n")
+	}
+	if err := w.writer.Flush(); err != nil {
+		return false
+	}
+
+	if req.Close || w.header.Get("Connection") == "close" {
+		return false
+	}
+	// Without a length the client reads the body until the connection closes
+	if bodyAllowed(w.status) && !w.discardBody && !w.chunked && w.header.Get("Content-Length") == "" {
+		return false
+	}
+	// The next request can only be read once this one's body is consumed.
+	// Leftovers the handler didn't read are discarded, up to maxDrain
+	// bytes; a larger rest is cheaper to drop along with the connection.
+	if req.ContentLength > maxDrain {
+		return false
+	}
+	n, err := io.CopyN(io.Discard, req.Body, maxDrain+1)
+	return n <= maxDrain && err == io.EOF
+}
+
+// bodyAllowed reports whether a response with the given status may carry a body.
+func bodyAllowed(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
 }
 
 func (w *responseWriter) Header() http.Header {
+	if w.ResponseWriter != nil {
+		return w.ResponseWriter.Header()
+	}
 	if w.header == nil {
 		w.header = make(http.Header)
 	}
@@ -72,10 +173,54 @@ func (w *responseWriter) WriteHeader(code int) {
 func (w *responseWriter) WriteHeaderNow() {
 	if !w.Written() {
 		w.size = 0
-		if !w.headerSent {
-			w.writeHeaders()
+		if w.ResponseWriter != nil {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+	}
+}
+
+// commit sends the header block followed by the buffered body. The
+// Content-Length or Transfer-Encoding header is added according to f,
+// unless the handler set its own.
+func (w *responseWriter) commit(f framing) error {
+	h := w.Header()
+	if _, ok := h["Date"]; !ok {
+		h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	if _, ok := h["Server"]; !ok && w.server != "" {
+		h.Set("Server", w.server)
+	}
+	if bodyAllowed(w.status) && h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" {
+		switch {
+		case f == frameLength:
+			h.Set("Content-Length", strconv.Itoa(len(w.body)))
+		case f == frameChunked && w.canChunk:
+			h.Set("Transfer-Encoding", "chunked")
+			w.chunked = true
 		}
 	}
+	w.writeHeaders()
+
+	body := w.body
+	w.body = w.body[:0]
+	_, err := w.writeBody(body)
+	return err
+}
+
+// writeBody writes p after the header block, as a chunk if the response
+// is chunked.
+func (w *responseWriter) writeBody(p []byte) (int, error) {
+	if w.discardBody || len(p) == 0 {
+		return len(p), nil
+	}
+	if !w.chunked {
+		return w.writer.Write(p)
+	}
+	w.writer.WriteString(strconv.FormatInt(int64(len(p)), 16))
+	w.writer.WriteString("\r\n")
+	w.writer.Write(p)
+	_, err := w.writer.WriteString("\r\n")
+	return len(p), err
 }
 
 func (w *responseWriter) writeHeaders() {
@@ -91,49 +236,131 @@ func (w *responseWriter) writeHeaders() {
 		}
 	}
 
-	// Add Content-Length if not present but we know the size
-	if w.header.Get("Content-Length") == "" && w.header.Get("Transfer-Encoding") == "" {
-		w.writer.WriteString("\r\n")
-	}
-
-	w.writer.Flush()
+	// End of the header block
+	w.writer.WriteString("\r\n")
 	w.headerSent = true
 }
 
+// Write buffers data until the response outgrows the engine's
+// ResponseBufferSize; it reaches the client when the connection's buffer
+// fills, on Flush, or once the handler returns.
 func (w *responseWriter) Write(data []byte) (n int, err error) {
 	w.WriteHeaderNow()
-	n, err = w.writer.Write(data)
-	w.writer.Flush()
+	if w.ResponseWriter != nil {
+		n, err = w.ResponseWriter.Write(data)
+		w.size += n
+		return
+	}
+	if !w.headerSent {
+		if len(w.body)+len(data) <= w.bufferSize {
+			w.body = append(w.body, data...)
+			w.size += len(data)
+			return len(data), nil
+		}
+		if err = w.commit(frameChunked); err != nil {
+			return 0, err
+		}
+	}
+	n, err = w.writeBody(data)
 	w.size += n
 	return
 }
 
 func (w *responseWriter) WriteString(s string) (n int, err error) {
-	w.WriteHeaderNow()
-	n, err = w.writer.WriteString(s)
-	w.writer.Flush()
-	w.size += n
-	return
+	if w.ResponseWriter != nil {
+		w.WriteHeaderNow()
+		n, err = io.WriteString(w.ResponseWriter, s)
+		w.size += n
+		return
+	}
+	if !w.headerSent && len(w.body)+len(s) <= w.bufferSize {
+		w.WriteHeaderNow()
+		w.body = append(w.body, s...)
+		w.size += len(s)
+		return len(s), nil
+	}
+	return w.Write([]byte(s))
 }
 
 func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	if w.size < 0 {
-		w.size = 0
+	if w.hijacked {
+		return nil, nil, fmt.Errorf("connection has already been hijacked")
+	}
+	if w.ResponseWriter != nil {
+		conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+		if err == nil {
+			w.hijacked = true
+			if w.size < 0 {
+				w.size = 0
+			}
+		}
+		return conn, rw, err
+	}
+	// Whatever was written so far, such as a 101 response, goes out first
+	if w.Written() && !w.headerSent {
+		if err := w.commit(frameNone); err != nil {
+			return nil, nil, err
+		}
 	}
 	if w.headerSent {
-		return nil, nil, fmt.Errorf("cannot hijack connection after headers have been written")
+		if err := w.writer.Flush(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if w.size < 0 {
+		w.size = 0
 	}
 
+	// The connection's deadlines were set for a request, not a protocol
+	w.conn.SetDeadline(time.Time{})
+	w.hijacked = true
 	rw := bufio.NewReadWriter(w.hijackReader, w.writer)
 	return w.conn, rw, nil
 }
 
 func (w *responseWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError is like Flush but reports write errors, which lets
+// http.ResponseController notice a client that went away.
+func (w *responseWriter) FlushError() error {
 	w.WriteHeaderNow()
-	w.writer.Flush()
+	if w.ResponseWriter != nil {
+		return http.NewResponseController(w.ResponseWriter).Flush()
+	}
+	if !w.headerSent {
+		if err := w.commit(frameChunked); err != nil {
+			return err
+		}
+	}
+	return w.writer.Flush()
+}
+
+// SetReadDeadline and SetWriteDeadline support http.ResponseController,
+// for handlers such as long-lived streams that outlast the connection's
+// default 30 second deadlines. A zero time removes the deadline.
+func (w *responseWriter) SetReadDeadline(t time.Time) error {
+	if w.ResponseWriter != nil {
+		return http.NewResponseController(w.ResponseWriter).SetReadDeadline(t)
+	}
+	return w.conn.SetReadDeadline(t)
+}
+
+func (w *responseWriter) SetWriteDeadline(t time.Time) error {
+	if w.ResponseWriter != nil {
+		return http.NewResponseController(w.ResponseWriter).SetWriteDeadline(t)
+	}
+	return w.conn.SetWriteDeadline(t)
 }
 
 func (w *responseWriter) CloseNotify() <-chan bool {
+	if w.ResponseWriter != nil {
+		if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+			return cn.CloseNotify()
+		}
+		return make(chan bool)
+	}
 	// Implement a simple close notifier
 	notify := make(chan bool, 1)
 
@@ -164,6 +391,9 @@ func (w *responseWriter) Written() bool {
 }
 
 func (w *responseWriter) Pusher() http.Pusher {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher
+	}
 	// Raw connections don't support HTTP/2 Push
 	return nil
 }
@@ -181,6 +411,9 @@ func NewResponseWriter(conn net.Conn, req *http.Request) ResponseWriter {
 		writer:       writer,
 		hijackReader: hijackReader,
 	}
+	if req != nil {
+		w.prepare(req, defaultResponseBufferSize, "")
+	}
 
 	// ResponseWriter is normally nil since we're creating this ourselves
 	// and not wrapping an existing ResponseWriter
@@ -0,0 +1,181 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Close status codes defined in RFC 6455, section 7.4.1, and the IANA
+// WebSocket Close Code Number Registry.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+	CloseServiceRestart          = 1012
+	CloseTryAgainLater           = 1013
+	CloseBadGateway              = 1014
+	CloseTLSHandshake            = 1015
+)
+
+// CloseError is returned by ReadMessage when the connection is closed,
+// either by a close frame from the peer or by a protocol failure.
+type CloseError struct {
+	// Code is the close status code.
+	Code uint16
+	// Text is the close reason sent by the peer, or a description of the
+	// protocol violation that failed the connection.
+	Text string
+	// Local is set when the connection failed itself after a protocol
+	// violation by the peer, sending it Code, rather than receiving a
+	// close frame.
+	Local bool
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("ws: close %d", e.Code)
+	}
+	return fmt.Sprintf("ws: close %d: %s", e.Code, e.Text)
+}
+
+// IsCloseError reports whether err is a *CloseError with one of the given
+// codes. With no codes it matches any CloseError.
+func IsCloseError(err error, codes ...uint16) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	if len(codes) == 0 {
+		return true
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUnexpectedCloseError reports whether err is a *CloseError whose code is
+// not one of the expected codes.
+func IsUnexpectedCloseError(err error, expected ...uint16) bool {
+	return IsCloseError(err) && !IsCloseError(err, expected...)
+}
+
+// parseClosePayload decodes the status code and reason of a close frame.
+func parseClosePayload(payload []byte) *CloseError {
+	if len(payload) < 2 {
+		return &CloseError{Code: CloseNoStatusReceived}
+	}
+	return &CloseError{
+		Code: uint16(payload[0])<<8 | uint16(payload[1]),
+		Text: string(payload[2:]),
+	}
+}
+
+// ErrCloseTimeout is returned by CloseHandshake when the peer does not
+// answer the close frame in time.
+var ErrCloseTimeout = errors.New("ws: timed out waiting for close reply")
+
+// CloseHandshake performs the closing handshake of RFC 6455 section 7: it
+// sends a close frame with code and reason, waits up to timeout for the
+// peer's close frame, and only then closes the underlying connection, so
+// data the peer sent before its reply is not lost. Data frames arriving in
+// the meantime are delivered to a concurrent reader, if there is one, and
+// discarded otherwise.
+func (c *Conn) CloseHandshake(code uint16, reason string, timeout time.Duration) error {
+	c.stopQueue()
+	c.stopKeepAlive()
+	c.writeMu.Lock()
+	var err error
+	if !c.closeSent {
+		err = c.writeFrame(true, 0, OpClose, closePayload(code, reason))
+	}
+	c.writeMu.Unlock()
+	if err != nil {
+		c.conn.Close()
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-c.closeRecv:
+	default:
+		if c.readMu.TryLock() {
+			// Nobody is reading, so the reply is read here, within the
+			// timeout rather than the idle timeout
+			idle := c.idleTimeout
+			c.idleTimeout = 0
+			c.conn.SetReadDeadline(time.Now().Add(timeout))
+			for {
+				f, err := c.readFrame()
+				if err != nil {
+					break
+				}
+				f.Release()
+			}
+			c.idleTimeout = idle
+			c.readMu.Unlock()
+		}
+		select {
+		case <-c.closeRecv:
+		case <-timer.C:
+			err = ErrCloseTimeout
+		}
+	}
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// receiveClose answers the peer's close frame with the same status code,
+// unless a close frame was sent already, and wakes up CloseHandshake. It
+// runs on the reading goroutine.
+func (c *Conn) receiveClose(code uint16) {
+	c.writeMu.Lock()
+	if !c.closeSent {
+		var payload []byte
+		if validCloseCode(code) {
+			payload = closePayload(code, "")
+		}
+		c.writeFrame(true, 0, OpClose, payload)
+	}
+	c.writeMu.Unlock()
+
+	select {
+	case <-c.closeRecv:
+	default:
+		close(c.closeRecv)
+	}
+}
+
+// closePayload encodes the payload of a close frame.
+func closePayload(code uint16, reason string) []byte {
+	payload := make([]byte, 2+len(reason))
+	payload[0] = byte(code >> 8)
+	payload[1] = byte(code)
+	copy(payload[2:], reason)
+	return payload
+}
+
+// readError maps a transport error to a CloseError when the peer vanished
+// without a closing handshake.
+func readError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		return &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// Codec converts application values to and from message payloads, for use
+// with WriteValue and ReadValue.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+
+	// OpCode is the message type of encoded values, OpText or OpBinary.
+	OpCode() OpCode
+}
+
+// JSONCodec encodes values as JSON text messages.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) OpCode() OpCode                     { return OpText }
+
+// ErrUnexpectedMessageType is returned by ReadValue and ReadJSON when
+// SetStrictCodec is on and a message of the other data type arrives.
+var ErrUnexpectedMessageType = errors.New("ws: unexpected message type for codec")
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{"json": JSONCodec}
+)
+
+// RegisterCodec makes a codec available under name, typically the
+// subprotocol it implements, so that handlers can pick it with
+//
+//	if codec, ok := ws.LookupCodec(conn.Subprotocol()); ok {
+//		conn.SetCodec(codec)
+//	}
+//
+// JSONCodec is registered as "json".
+func RegisterCodec(name string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[name] = c
+}
+
+// LookupCodec returns the codec registered under name.
+func LookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// SetCodec sets the codec used by WriteValue and ReadValue. The default is
+// JSONCodec.
+func (c *Conn) SetCodec(codec Codec) {
+	c.codec = codec
+}
+
+// SetStrictCodec makes ReadValue and ReadJSON fail with
+// ErrUnexpectedMessageType on data messages whose type does not match the
+// codec, such as binary messages read as JSON, instead of decoding them.
+func (c *Conn) SetStrictCodec(strict bool) {
+	c.strictCodec = strict
+}
+
+// WriteValue encodes v with the connection's codec and sends it as one
+// message.
+func (c *Conn) WriteValue(v any) error {
+	return c.writeValue(c.valueCodec(), v)
+}
+
+// ReadValue reads the next data message and decodes it into v with the
+// connection's codec. Ping and pong messages are skipped.
+func (c *Conn) ReadValue(v any) error {
+	return c.readValue(c.valueCodec(), v)
+}
+
+// WriteJSON sends v as a JSON text message.
+func (c *Conn) WriteJSON(v any) error {
+	return c.writeValue(JSONCodec, v)
+}
+
+// ReadJSON reads the next data message and decodes it into v as JSON.
+// Ping and pong messages are skipped.
+func (c *Conn) ReadJSON(v any) error {
+	return c.readValue(JSONCodec, v)
+}
+
+func (c *Conn) valueCodec() Codec {
+	if c.codec == nil {
+		return JSONCodec
+	}
+	return c.codec
+}
+
+func (c *Conn) writeValue(codec Codec, v any) error {
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(codec.OpCode(), data)
+}
+
+func (c *Conn) readValue(codec Codec, v any) error {
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if msg.OpCode >= OpClose {
+			msg.Release()
+			continue
+		}
+		defer msg.Release()
+		if c.strictCodec && msg.OpCode != codec.OpCode() {
+			return ErrUnexpectedMessageType
+		}
+		return codec.Unmarshal(msg.Payload, v)
+	}
+}
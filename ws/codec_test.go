@@ -0,0 +1,55 @@
+package ws
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	server, client := connPair(t)
+	type point struct {
+		X, Y int
+	}
+
+	go func() {
+		// Pongs between messages are skipped by ReadJSON
+		server.Pong([]byte("beat"))
+		server.WriteJSON(point{1, 2})
+	}()
+	var p point
+	if err := client.ReadJSON(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p != (point{1, 2}) {
+		t.Errorf("ReadJSON = %+v", p)
+	}
+
+	// JSON goes out as a text message
+	go server.WriteJSON(map[string]string{"k": "v"})
+	expectText(t, client, `{"k":"v"}`)
+
+	// Values that cannot be encoded are not sent
+	if err := server.WriteJSON(make(chan int)); err == nil {
+		t.Error("WriteJSON of a channel succeeded")
+	}
+	go server.WriteText("{broken")
+	if err := client.ReadJSON(&p); err == nil {
+		t.Error("ReadJSON of invalid JSON succeeded")
+	}
+}
+
+func TestReadJSONStrict(t *testing.T) {
+	server, client := connPair(t)
+	var v []int
+
+	go server.WriteBinary([]byte("[1]"))
+	if err := client.ReadJSON(&v); err != nil || len(v) != 1 {
+		t.Errorf("lenient ReadJSON of binary = %v, %v", v, err)
+	}
+
+	client.SetStrictCodec(true)
+	go server.WriteBinary([]byte("[2]"))
+	if err := client.ReadJSON(&v); !errors.Is(err, ErrUnexpectedMessageType) {
+		t.Errorf("strict ReadJSON of binary = %v, want ErrUnexpectedMessageType", err)
+	}
+}
@@ -0,0 +1,79 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/edgflow/lux"
+)
+
+// UpgradeContext upgrades the request of a lux route handler to a WebSocket
+// connection, so WebSocket endpoints can share the router, middleware and
+// port of the HTTP API:
+//
+//	engine.Get("/chat", func(c *lux.Context) {
+//		conn, err := ws.UpgradeContext(c)
+//		if err != nil {
+//			return
+//		}
+//		defer conn.Close()
+//		...
+//	})
+//
+// The request is checked and the connection hijacked from lux. Headers set
+// on c.Writer, such as cookies, are sent with the 101 response. A request
+// that is not a valid WebSocket handshake is answered with the status of
+// the returned *HandshakeError and the chain is aborted, and so is one from
+// a page on another site, see SameOrigin.
+func UpgradeContext(c *lux.Context) (*Conn, error) {
+	return upgradeContext(c, upgradeOptions{})
+}
+
+// UpgradeContext upgrades the request of a lux route handler like the
+// package-level UpgradeContext, negotiating the server's extensions and
+// subprotocols, running its CheckOrigin and CheckRequest hooks and applying
+// its per-connection settings. The connection
+// is returned to the caller rather than passed to s.Handler.
+func (s *Server) UpgradeContext(c *lux.Context) (*Conn, error) {
+	conn, err := upgradeContext(c, s.upgradeOptions())
+	if err != nil {
+		return nil, err
+	}
+	s.configure(conn)
+	return conn, nil
+}
+
+func upgradeContext(c *lux.Context, opts upgradeOptions) (*Conn, error) {
+	herr := checkUpgradeRequest(c.Request)
+	if herr == nil {
+		herr = opts.check(c.Request)
+	}
+	if herr != nil {
+		if herr.StatusCode == http.StatusUpgradeRequired {
+			c.Writer.Header().Set("Sec-WebSocket-Version", "13")
+		}
+		c.Writer.Header().Set("Content-Length", "0")
+		c.Writer.WriteHeader(herr.StatusCode)
+		c.Abort()
+		return nil, herr
+	}
+	if c.Writer.Written() {
+		return nil, errors.New("ws: response already written")
+	}
+
+	header := c.Writer.Header().Clone()
+	for _, k := range []string{"Upgrade", "Connection", "Content-Length", "Content-Type", "Sec-Websocket-Accept", "Sec-Websocket-Protocol", "Sec-Websocket-Extensions"} {
+		header.Del(k)
+	}
+
+	conn, rw, err := c.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	wsConn, err := accept(conn, rw.Reader, c.Request, header, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return wsConn, nil
+}
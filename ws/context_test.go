@@ -0,0 +1,125 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/edgflow/lux"
+)
+
+// serveEngine runs engine on a loopback listener and returns its ws:// URL.
+func serveEngine(t *testing.T, engine *lux.Engine) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go engine.RunListener(ln)
+	t.Cleanup(func() { engine.Shutdown(context.Background()) })
+	return "ws://" + ln.Addr().String()
+}
+
+func TestUpgradeContext(t *testing.T) {
+	engine := lux.NewEngine()
+	engine.Use(func(c *lux.Context) {
+		c.Writer.Header().Set("X-Middleware", "yes")
+		c.Next()
+	})
+	// Set when the chain goes on after a rejected handshake
+	var afterRejected atomic.Bool
+	engine.Get("/echo", func(c *lux.Context) {
+		conn, err := UpgradeContext(c)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(msg.OpCode, msg.Payload)
+	}, func(c *lux.Context) {
+		if c.Request.Header.Get("Sec-WebSocket-Version") == "8" {
+			afterRejected.Store(true)
+		}
+	})
+	base := serveEngine(t, engine)
+
+	u, _ := url.Parse(base + "/echo")
+	conn, resp, err := dialHandshake(context.Background(), u, &DialOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if resp.Header.Get("X-Middleware") != "yes" {
+		t.Errorf("101 response headers = %v, want those set by middleware", resp.Header)
+	}
+	if err := conn.WriteText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	expectText(t, conn, "hello")
+
+	// Requests that are not a valid handshake are answered by the route
+	// and end the chain
+	req, _ := http.NewRequest(http.MethodGet, "http"+strings.TrimPrefix(base, "ws")+"/echo", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusUpgradeRequired || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Errorf("version 8 handshake = %d, Sec-WebSocket-Version %q", r.StatusCode, r.Header.Get("Sec-WebSocket-Version"))
+	}
+	if afterRejected.Load() {
+		t.Error("chain not aborted after a failed upgrade")
+	}
+
+	// Pages on other sites are refused by default
+	_, err = DialWithOptions(base+"/echo", DialOptions{Origin: "https://evil.example"})
+	if herr, ok := err.(*HandshakeError); !ok || herr.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin dial = %v, want 403", err)
+	}
+}
+
+func TestServerUpgradeContext(t *testing.T) {
+	s := &Server{Subprotocols: []string{"chat"}, ReadLimit: 4}
+	engine := lux.NewEngine()
+	engine.Get("/ws", func(c *lux.Context) {
+		conn, err := s.UpgradeContext(c)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if conn.Subprotocol() != "chat" {
+			t.Errorf("server Subprotocol = %q", conn.Subprotocol())
+		}
+		// The server's read limit applies
+		if _, err := conn.ReadMessage(); !errors.Is(err, ErrMessageTooBig) {
+			t.Errorf("oversized message = %v, want ErrMessageTooBig", err)
+		}
+	})
+	base := serveEngine(t, engine)
+
+	conn, err := DialWithOptions(base+"/ws", DialOptions{Subprotocols: []string{"chat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != "chat" {
+		t.Errorf("client Subprotocol = %q", conn.Subprotocol())
+	}
+	conn.WriteText("too long")
+	if _, err := conn.ReadMessage(); !IsCloseError(err, CloseMessageTooBig) {
+		t.Errorf("client read = %v, want close 1009", err)
+	}
+}
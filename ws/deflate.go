@@ -0,0 +1,287 @@
+package ws
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// deflateTail is the empty stored block that ends every compressed message
+// on the wire (RFC 7692 section 7.2.1); it is stripped by the sender and
+// restored by the receiver. The final empty block lets the decompressor
+// report a clean EOF.
+const (
+	deflateTail  = "\x00\x00\xff\xff"
+	deflateFinal = "\x01\x00\x00\xff\xff"
+)
+
+// deflateWindow is the LZ77 window used by compress/flate, which does not
+// support smaller windows.
+const deflateWindow = 1 << 15
+
+// rsv1 marks the first frame of a compressed message.
+const rsv1 = 0x40
+
+// PerMessageDeflate is the permessage-deflate extension (RFC 7692). Add it to
+// Server.Extensions or DialOptions.Extensions to compress data messages.
+type PerMessageDeflate struct {
+	// ServerNoContextTakeover makes the server reset its compressor after
+	// every message, trading ratio for memory on the server side
+	ServerNoContextTakeover bool
+
+	// ClientNoContextTakeover does the same for the client's compressor
+	ClientNoContextTakeover bool
+
+	// Level is the flate compression level, from flate.HuffmanOnly to
+	// flate.BestCompression. Zero selects flate.DefaultCompression. It can
+	// be changed per connection with Conn.SetCompressionLevel.
+	Level int
+
+	// Threshold is the payload size below which messages are sent
+	// uncompressed, since tiny messages often grow when deflated
+	Threshold int
+}
+
+// Name implements Extension.
+func (p *PerMessageDeflate) Name() string {
+	return "permessage-deflate"
+}
+
+// Offer implements Extension.
+func (p *PerMessageDeflate) Offer() ExtensionParams {
+	params := ExtensionParams{"client_max_window_bits": ""}
+	if p.ServerNoContextTakeover {
+		params["server_no_context_takeover"] = ""
+	}
+	if p.ClientNoContextTakeover {
+		params["client_no_context_takeover"] = ""
+	}
+	return params
+}
+
+// Accept implements Extension.
+func (p *PerMessageDeflate) Accept(params ExtensionParams, server bool) (ExtensionParams, NegotiatedExtension, error) {
+	for k, v := range params {
+		switch k {
+		case "server_no_context_takeover", "client_no_context_takeover":
+		case "server_max_window_bits":
+			// Only a server limited to a smaller window is a problem, and
+			// only for the server's own compressor
+			if server && v != "" && v != "15" {
+				return nil, nil, nil
+			}
+		case "client_max_window_bits":
+			if !server && v != "" && v != "15" {
+				return nil, nil, fmt.Errorf("ws: permessage-deflate window of %s bits is not supported", v)
+			}
+		default:
+			if server {
+				return nil, nil, nil
+			}
+			return nil, nil, fmt.Errorf("ws: unknown permessage-deflate parameter %q", k)
+		}
+	}
+
+	serverNoCtx := params.Has("server_no_context_takeover")
+	clientNoCtx := params.Has("client_no_context_takeover")
+
+	if err := checkDeflateLevel(p.Level); err != nil {
+		return nil, nil, err
+	}
+	d := &deflateExt{level: p.Level, threshold: p.Threshold, enabled: true}
+	if d.level == 0 {
+		d.level = flate.DefaultCompression
+	}
+
+	if !server {
+		d.writeNoCtx = clientNoCtx || p.ClientNoContextTakeover
+		d.readNoCtx = serverNoCtx
+		return nil, d, nil
+	}
+
+	serverNoCtx = serverNoCtx || p.ServerNoContextTakeover
+	clientNoCtx = clientNoCtx || p.ClientNoContextTakeover
+	d.writeNoCtx = serverNoCtx
+	d.readNoCtx = clientNoCtx
+
+	resp := ExtensionParams{}
+	if serverNoCtx {
+		resp["server_no_context_takeover"] = ""
+	}
+	if clientNoCtx {
+		resp["client_no_context_takeover"] = ""
+	}
+	return resp, d, nil
+}
+
+// checkDeflateLevel reports an error unless level is a valid flate level
+// or zero.
+func checkDeflateLevel(level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("ws: invalid compression level %d", level)
+	}
+	return nil
+}
+
+// SetCompressionLevel changes the flate level used for the messages the
+// connection sends from now on. It fails unless permessage-deflate was
+// negotiated.
+func (c *Conn) SetCompressionLevel(level int) error {
+	if err := checkDeflateLevel(level); err != nil {
+		return err
+	}
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	d := c.deflate()
+	if d == nil {
+		return errDeflateNotNegotiated
+	}
+	if d.level != level {
+		// A fresh compressor starts without history, which the peer's
+		// decompressor handles like any other message
+		d.level = level
+		d.fw = nil
+	}
+	return nil
+}
+
+// EnableWriteCompression turns compression of outgoing messages on or off,
+// for example to skip payloads that are already compressed. It has no
+// effect unless permessage-deflate was negotiated.
+func (c *Conn) EnableWriteCompression(enable bool) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if d := c.deflate(); d != nil {
+		d.enabled = enable
+	}
+}
+
+var errDeflateNotNegotiated = errors.New("ws: permessage-deflate not negotiated")
+
+// deflate returns the connection's permessage-deflate state, or nil.
+func (c *Conn) deflate() *deflateExt {
+	for _, ext := range c.extensions {
+		if d, ok := ext.(*deflateExt); ok {
+			return d
+		}
+	}
+	return nil
+}
+
+// deflateExt is permessage-deflate negotiated on one connection. Writes are
+// serialised by the connection's write lock and reads happen on a single
+// goroutine, so the compressor and decompressor need no locking of their own.
+type deflateExt struct {
+	level      int
+	threshold  int
+	enabled    bool // compress outgoing messages, see EnableWriteCompression
+	writeNoCtx bool
+	readNoCtx  bool
+
+	fw  *flate.Writer
+	out bytes.Buffer
+
+	fr   io.ReadCloser
+	dict []byte // trailing window of decompressed output for context takeover
+}
+
+func (d *deflateExt) RSV() byte {
+	return rsv1
+}
+
+func (d *deflateExt) WrapWriter(w io.WriteCloser, rsv *byte) io.WriteCloser {
+	return &deflateWriter{d: d, w: w, rsv: rsv}
+}
+
+func (d *deflateExt) WrapReader(r io.Reader, rsv byte) io.Reader {
+	if rsv&rsv1 == 0 {
+		return r
+	}
+	src := io.MultiReader(r, strings.NewReader(deflateTail+deflateFinal))
+	var dict []byte
+	if !d.readNoCtx {
+		dict = d.dict
+	}
+	if d.fr == nil {
+		d.fr = flate.NewReaderDict(src, dict)
+	} else {
+		d.fr.(flate.Resetter).Reset(src, dict)
+	}
+	return &deflateReader{d: d}
+}
+
+// compress deflates p and returns the message body without its tail. The
+// result is only valid until the next call.
+func (d *deflateExt) compress(p []byte) ([]byte, error) {
+	d.out.Reset()
+	if d.fw == nil {
+		fw, err := flate.NewWriter(&d.out, d.level)
+		if err != nil {
+			return nil, err
+		}
+		d.fw = fw
+	} else if d.writeNoCtx {
+		d.fw.Reset(&d.out)
+	}
+
+	if _, err := d.fw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := d.fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(d.out.Bytes(), []byte(deflateTail)), nil
+}
+
+// deflateWriter collects a message and compresses it on Close, unless it is
+// below the threshold.
+type deflateWriter struct {
+	d   *deflateExt
+	w   io.WriteCloser
+	rsv *byte
+	buf []byte
+}
+
+func (w *deflateWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *deflateWriter) Close() error {
+	payload := w.buf
+	if w.d.enabled && len(w.buf) >= w.d.threshold {
+		compressed, err := w.d.compress(w.buf)
+		if err != nil {
+			return err
+		}
+		payload = compressed
+		*w.rsv |= rsv1
+	}
+	if _, err := w.w.Write(payload); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
+
+// deflateReader decompresses one message and records the output window
+// when context takeover is in effect.
+type deflateReader struct {
+	d *deflateExt
+}
+
+func (r *deflateReader) Read(p []byte) (int, error) {
+	n, err := r.d.fr.Read(p)
+	if n > 0 && !r.d.readNoCtx {
+		r.d.dict = append(r.d.dict, p[:n]...)
+		if over := len(r.d.dict) - deflateWindow; over > 0 {
+			r.d.dict = append(r.d.dict[:0], r.d.dict[over:]...)
+		}
+	}
+	return n, err
+}
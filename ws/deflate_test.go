@@ -0,0 +1,312 @@
+package ws
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// deflatePair returns both ends of a loopback connection that negotiated
+// permessage-deflate with the given server and client configuration.
+func deflatePair(t *testing.T, server, client *PerMessageDeflate) (*Conn, *Conn) {
+	t.Helper()
+	accepted := make(chan *Conn, 1)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	s := &Server{
+		Extensions: []Extension{server},
+		Handler: func(c *Conn) {
+			accepted <- c
+			<-done
+		},
+	}
+	url := serveLoopback(t, s)
+
+	cc, err := DialWithOptions(url, DialOptions{Extensions: []Extension{client}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.conn.Close() })
+	sc := <-accepted
+	if sc.deflate() == nil || cc.deflate() == nil {
+		t.Fatal("permessage-deflate not negotiated")
+	}
+	return sc, cc
+}
+
+func TestDeflateOffer(t *testing.T) {
+	tests := []struct {
+		ext  PerMessageDeflate
+		want ExtensionParams
+	}{
+		{PerMessageDeflate{}, ExtensionParams{"client_max_window_bits": ""}},
+		{PerMessageDeflate{ServerNoContextTakeover: true, ClientNoContextTakeover: true}, ExtensionParams{
+			"client_max_window_bits":     "",
+			"server_no_context_takeover": "",
+			"client_no_context_takeover": "",
+		}},
+	}
+	for _, tt := range tests {
+		if got := tt.ext.Offer(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Offer() of %+v = %v, want %v", tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestDeflateAcceptServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		ext        PerMessageDeflate
+		offer      ExtensionParams
+		declined   bool
+		resp       ExtensionParams
+		writeNoCtx bool
+		readNoCtx  bool
+	}{
+		{name: "plain offer", offer: ExtensionParams{}, resp: ExtensionParams{}},
+		{name: "client window bits", offer: ExtensionParams{"client_max_window_bits": "10"}, resp: ExtensionParams{}},
+		{name: "server window of 15 bits", offer: ExtensionParams{"server_max_window_bits": "15"}, resp: ExtensionParams{}},
+		{name: "smaller server window", offer: ExtensionParams{"server_max_window_bits": "10"}, declined: true},
+		{name: "unknown parameter", offer: ExtensionParams{"x_custom": ""}, declined: true},
+		{
+			name:       "server no context takeover requested",
+			offer:      ExtensionParams{"server_no_context_takeover": ""},
+			resp:       ExtensionParams{"server_no_context_takeover": ""},
+			writeNoCtx: true,
+		},
+		{
+			name:      "client no context takeover requested",
+			offer:     ExtensionParams{"client_no_context_takeover": ""},
+			resp:      ExtensionParams{"client_no_context_takeover": ""},
+			readNoCtx: true,
+		},
+		{
+			name:       "no context takeover configured",
+			ext:        PerMessageDeflate{ServerNoContextTakeover: true, ClientNoContextTakeover: true},
+			offer:      ExtensionParams{},
+			resp:       ExtensionParams{"server_no_context_takeover": "", "client_no_context_takeover": ""},
+			writeNoCtx: true,
+			readNoCtx:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, neg, err := tt.ext.Accept(tt.offer, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.declined {
+				if neg != nil {
+					t.Fatalf("offer %v accepted with %v, want declined", tt.offer, resp)
+				}
+				return
+			}
+			d, ok := neg.(*deflateExt)
+			if !ok {
+				t.Fatalf("offer %v declined", tt.offer)
+			}
+			if !reflect.DeepEqual(resp, tt.resp) {
+				t.Errorf("response = %v, want %v", resp, tt.resp)
+			}
+			if d.writeNoCtx != tt.writeNoCtx || d.readNoCtx != tt.readNoCtx {
+				t.Errorf("writeNoCtx, readNoCtx = %v, %v, want %v, %v", d.writeNoCtx, d.readNoCtx, tt.writeNoCtx, tt.readNoCtx)
+			}
+		})
+	}
+}
+
+func TestDeflateAcceptClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		ext        PerMessageDeflate
+		resp       ExtensionParams
+		fails      bool
+		writeNoCtx bool
+		readNoCtx  bool
+	}{
+		{name: "plain response", resp: ExtensionParams{}},
+		{name: "client window of 15 bits", resp: ExtensionParams{"client_max_window_bits": "15"}},
+		{name: "smaller client window", resp: ExtensionParams{"client_max_window_bits": "10"}, fails: true},
+		{name: "unknown parameter", resp: ExtensionParams{"x_custom": ""}, fails: true},
+		{name: "server no context takeover", resp: ExtensionParams{"server_no_context_takeover": ""}, readNoCtx: true},
+		{name: "client no context takeover", resp: ExtensionParams{"client_no_context_takeover": ""}, writeNoCtx: true},
+		{name: "client no context takeover configured", ext: PerMessageDeflate{ClientNoContextTakeover: true}, resp: ExtensionParams{}, writeNoCtx: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, neg, err := tt.ext.Accept(tt.resp, false)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("response %v accepted, want an error", tt.resp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := neg.(*deflateExt)
+			if d.writeNoCtx != tt.writeNoCtx || d.readNoCtx != tt.readNoCtx {
+				t.Errorf("writeNoCtx, readNoCtx = %v, %v, want %v, %v", d.writeNoCtx, d.readNoCtx, tt.writeNoCtx, tt.readNoCtx)
+			}
+		})
+	}
+}
+
+func TestDeflateContextTakeover(t *testing.T) {
+	msg := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog. ", 20))
+	for _, noCtx := range []bool{false, true} {
+		d := &deflateExt{level: 6, writeNoCtx: noCtx}
+		first, err := d.compress(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		firstLen := len(first)
+		second, err := d.compress(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// With context takeover the repeated message is a back reference
+		// into the previous one
+		if shrunk := len(second) < firstLen/2; shrunk == noCtx {
+			t.Errorf("noCtx=%v: second message is %d bytes, first %d", noCtx, len(second), firstLen)
+		}
+	}
+}
+
+func TestDeflateRoundtrip(t *testing.T) {
+	configs := map[string]PerMessageDeflate{
+		"context takeover":    {},
+		"no context takeover": {ServerNoContextTakeover: true, ClientNoContextTakeover: true},
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			serverCfg, clientCfg := cfg, cfg
+			server, client := deflatePair(t, &serverCfg, &clientCfg)
+
+			// Repeated messages exercise the shared window on both sides
+			msgs := []string{
+				strings.Repeat("hello websocket ", 100),
+				strings.Repeat("hello websocket ", 100),
+				"short",
+				strings.Repeat("0123456789", 5000),
+			}
+			for _, m := range msgs {
+				if err := client.WriteText(m); err != nil {
+					t.Fatal(err)
+				}
+				expectText(t, server, m)
+				if err := server.WriteText(m); err != nil {
+					t.Fatal(err)
+				}
+				expectText(t, client, m)
+			}
+		})
+	}
+}
+
+func TestDeflateReadLimit(t *testing.T) {
+	server, client := deflatePair(t, &PerMessageDeflate{}, &PerMessageDeflate{})
+	server.SetReadLimit(4 << 10)
+
+	// A megabyte of zeros deflates to about a kilobyte on the wire, within
+	// the limit, but must not be inflated past it
+	bomb := make([]byte, 1<<20)
+	if err := client.WriteMessage(OpBinary, bomb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.ReadMessage(); !errors.Is(err, ErrMessageTooBig) {
+		t.Fatalf("ReadMessage = %v, want ErrMessageTooBig", err)
+	}
+}
+
+func TestDeflateReadLimitAllowsSmallMessages(t *testing.T) {
+	server, client := deflatePair(t, &PerMessageDeflate{}, &PerMessageDeflate{})
+	server.SetReadLimit(4 << 10)
+	msg := bytes.Repeat([]byte("a"), 4<<10)
+	if err := client.WriteMessage(OpBinary, msg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := server.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Payload, msg) {
+		t.Fatalf("got %d bytes, want %d", len(got.Payload), len(msg))
+	}
+}
+
+// readWireFrame reads the next frame of a compressed message as sent.
+func readWireFrame(t *testing.T, c *Conn) *Frame {
+	t.Helper()
+	f, err := c.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Fin {
+		t.Fatal("message was fragmented")
+	}
+	return f
+}
+
+func TestDeflateThreshold(t *testing.T) {
+	// Without context takeover every frame can be inflated on its own
+	server, client := deflatePair(t, &PerMessageDeflate{Threshold: 64, ServerNoContextTakeover: true}, &PerMessageDeflate{})
+
+	if err := server.WriteText("short"); err != nil {
+		t.Fatal(err)
+	}
+	f := readWireFrame(t, client)
+	if f.RSV&rsv1 != 0 || string(f.Payload) != "short" {
+		t.Errorf("message below the threshold: RSV %#x, payload %q; want it sent as is", f.RSV, f.Payload)
+	}
+
+	long := strings.Repeat("compress me ", 10)
+	if err := server.WriteText(long); err != nil {
+		t.Fatal(err)
+	}
+	f = readWireFrame(t, client)
+	if f.RSV&rsv1 == 0 || len(f.Payload) >= len(long) {
+		t.Errorf("message above the threshold: RSV %#x, %d bytes; want it compressed", f.RSV, len(f.Payload))
+	}
+	got, err := client.decodeMessage(f.Payload, f.RSV)
+	if err != nil || string(got) != long {
+		t.Errorf("decoded %q, %v; want %q", got, err, long)
+	}
+}
+
+func TestSetCompressionLevel(t *testing.T) {
+	server, client := deflatePair(t, &PerMessageDeflate{ServerNoContextTakeover: true}, &PerMessageDeflate{})
+	msg := strings.Repeat("abcdefgh", 512)
+
+	sizes := map[int]int{}
+	for _, level := range []int{flate.BestCompression, flate.HuffmanOnly} {
+		if err := server.SetCompressionLevel(level); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.WriteText(msg); err != nil {
+			t.Fatal(err)
+		}
+		f := readWireFrame(t, client)
+		sizes[level] = len(f.Payload)
+		got, err := client.decodeMessage(f.Payload, f.RSV)
+		if err != nil || string(got) != msg {
+			t.Fatalf("level %d: decoded %d bytes, %v", level, len(got), err)
+		}
+	}
+	// Huffman coding alone cannot use the repetition that LZ77 finds
+	if sizes[flate.HuffmanOnly] <= 4*sizes[flate.BestCompression] {
+		t.Errorf("HuffmanOnly sent %d bytes, BestCompression %d; the level change had no effect",
+			sizes[flate.HuffmanOnly], sizes[flate.BestCompression])
+	}
+
+	if err := server.SetCompressionLevel(42); err == nil {
+		t.Error("SetCompressionLevel(42) succeeded")
+	}
+	plain, _ := connPair(t)
+	if err := plain.SetCompressionLevel(flate.BestSpeed); !errors.Is(err, errDeflateNotNegotiated) {
+		t.Errorf("SetCompressionLevel without permessage-deflate = %v", err)
+	}
+}
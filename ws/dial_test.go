@@ -0,0 +1,189 @@
+package ws
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and a
+// pool that trusts it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// serveTLSLoopback runs s behind TLS on a loopback listener and returns its
+// wss:// URL and a pool that trusts its certificate.
+func serveTLSLoopback(t *testing.T, s *Server) (string, *x509.CertPool) {
+	t.Helper()
+	cert, pool := testCertificate(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}}))
+	t.Cleanup(func() { s.Close() })
+	return "wss://" + ln.Addr().String() + "/", pool
+}
+
+// silentListener accepts connections and never answers them.
+func silentListener(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		ln.Close()
+		<-done
+	})
+	go func() {
+		defer close(done)
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, c)
+		}
+	}()
+	return "ws://" + ln.Addr().String() + "/"
+}
+
+// dialAsync runs DialContext and returns a channel with its error.
+func dialAsync(ctx context.Context, url string, opts *DialOptions) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		conn, err := DialContext(ctx, url, opts)
+		if conn != nil {
+			conn.Close()
+		}
+		errc <- err
+	}()
+	return errc
+}
+
+func waitDial(t *testing.T, errc <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("DialContext still blocked")
+		return nil
+	}
+}
+
+func TestDialContextCancelDuringDial(t *testing.T) {
+	connecting := make(chan struct{})
+	dialer := &net.Dialer{
+		// Hold the connection attempt until the dial is cancelled
+		ControlContext: func(ctx context.Context, network, address string, c syscall.RawConn) error {
+			close(connecting)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := dialAsync(ctx, silentListener(t), &DialOptions{Dialer: dialer})
+	<-connecting
+	cancel()
+	if err := waitDial(t, errc); !errors.Is(err, context.Canceled) {
+		t.Errorf("DialContext = %v, want context.Canceled", err)
+	}
+}
+
+func TestDialContextCancelDuringHandshake(t *testing.T) {
+	url := silentListener(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := dialAsync(ctx, url, nil)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := waitDial(t, errc); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled DialContext = %v, want context.Canceled", err)
+	}
+
+	errc = dialAsync(context.Background(), url, &DialOptions{HandshakeTimeout: 50 * time.Millisecond})
+	if err := waitDial(t, errc); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DialContext past HandshakeTimeout = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestDialContextCancelAfterHandshake(t *testing.T) {
+	s := &Server{Handler: func(c *Conn) {
+		msg, err := c.ReadMessage()
+		if err == nil {
+			c.WriteMessage(msg.OpCode, msg.Payload)
+		}
+	}}
+	url := serveLoopback(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := DialContext(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cancel()
+	if err := conn.WriteText("still open"); err != nil {
+		t.Fatal(err)
+	}
+	expectText(t, conn, "still open")
+}
+
+func TestDialTLSConfig(t *testing.T) {
+	s := &Server{Handler: func(c *Conn) { c.WriteText(c.Request().Host) }}
+	url, pool := serveTLSLoopback(t, s)
+
+	// The system roots don't trust the test certificate
+	if _, err := DialWithOptions(url, DialOptions{HandshakeTimeout: 2 * time.Second}); err == nil {
+		t.Error("dial without the test roots succeeded")
+	}
+
+	conn, err := DialWithOptions(url, DialOptions{TLSConfig: &tls.Config{RootCAs: pool}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !conn.IsTLS() {
+		t.Error("IsTLS = false on a wss connection")
+	}
+	expectText(t, conn, url[len("wss://"):len(url)-1])
+}
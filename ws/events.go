@@ -0,0 +1,47 @@
+package ws
+
+import "errors"
+
+// serveEvents is the connection handler of servers configured with the
+// On* callbacks instead of a Handler. It owns the read loop: pings are
+// answered, pongs consumed, data messages passed to OnMessage and the end
+// of the connection reported to OnError and OnClose.
+func (s *Server) serveEvents(c *Conn) {
+	defer c.Close()
+	if c.pongHandler.Load() == nil {
+		c.SetPongHandler(func([]byte) error { return nil })
+	}
+	if s.OnOpen != nil {
+		s.OnOpen(c)
+	}
+
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			// A close frame from the peer or a vanished peer ends the
+			// connection; anything else, including a protocol failure that
+			// sent the peer a close code, is an error first
+			var ce *CloseError
+			received := errors.As(err, &ce) && !ce.Local
+			if !received && s.OnError != nil {
+				s.OnError(c, err)
+			}
+			if s.OnClose != nil {
+				code, reason := uint16(CloseAbnormalClosure), ""
+				switch {
+				case received:
+					code, reason = ce.Code, ce.Text
+				case ce != nil:
+					code = ce.Code
+				case errors.Is(err, ErrMessageTooBig):
+					code = CloseMessageTooBig
+				}
+				s.OnClose(c, code, reason)
+			}
+			return
+		}
+		if s.OnMessage != nil {
+			s.OnMessage(c, msg)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServeEventsCloseStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		send    func(client *Conn, raw net.Conn)
+		code    uint16
+		reason  string
+		onError bool
+	}{
+		{"peer close", func(c *Conn, _ net.Conn) { c.CloseWithCode(CloseGoingAway, "bye") }, CloseGoingAway, "bye", false},
+		{"oversized message", func(c *Conn, _ net.Conn) { c.WriteMessage(OpBinary, make([]byte, 16)) }, CloseMessageTooBig, "", true},
+		{"invalid UTF-8", func(c *Conn, _ net.Conn) { c.WriteMessage(OpText, []byte{0xff}) }, CloseInvalidFramePayloadData, "", true},
+		{"reserved opcode", func(c *Conn, _ net.Conn) { c.WriteMessage(OpCode(0x3), nil) }, CloseProtocolError, "", true},
+		{"dropped connection", func(_ *Conn, raw net.Conn) { raw.Close() }, CloseAbnormalClosure, "EOF", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer b.Close()
+			server, client := NewConn(a, true), NewConn(b, false)
+			server.SetReadLimit(8)
+
+			var gotErr error
+			type status struct {
+				code   uint16
+				reason string
+			}
+			closed := make(chan status, 1)
+			s := &Server{
+				OnError: func(c *Conn, err error) { gotErr = err },
+				OnClose: func(c *Conn, code uint16, reason string) { closed <- status{code, reason} },
+			}
+			go s.serveEvents(server)
+			// Drain the server's close frame, which net.Pipe would block on
+			go func() {
+				for {
+					if _, err := client.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+
+			tt.send(client, b)
+			select {
+			case got := <-closed:
+				if got.code != tt.code || got.reason != tt.reason {
+					t.Errorf("OnClose(%d, %q), want (%d, %q)", got.code, got.reason, tt.code, tt.reason)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("OnClose not called")
+			}
+			if (gotErr != nil) != tt.onError {
+				t.Errorf("OnError(%v), want called %v", gotErr, tt.onError)
+			}
+		})
+	}
+}
@@ -48,7 +48,11 @@ func handleWebSocket(conn *websocket.Conn) {
 	for {
 		msg, err := conn.ReadMessage()
 		if err != nil {
-			fmt.Println("Error reading message:", err)
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				fmt.Println("Client closed the connection")
+			} else {
+				fmt.Println("Error reading message:", err)
+			}
 			return
 		}
 
@@ -86,20 +90,6 @@ func handleWebSocket(conn *websocket.Conn) {
 				return
 			}
 
-		case websocket.OpPing:
-			fmt.Println("Received ping")
-
-			// Respond with pong
-			err = conn.Pong(msg.Payload)
-			if err != nil {
-				fmt.Println("Error sending pong:", err)
-				return
-			}
-
-		case websocket.OpClose:
-			fmt.Println("Received close frame")
-			return
-
 		default:
 			fmt.Printf("Received message with opcode: %d\n", msg.OpCode)
 		}
@@ -181,5 +171,5 @@ func runClient() {
 
 	// Close with a status code and reason
 	fmt.Println("Closing connection")
-	conn.CloseWithCode(1000, "Normal closure")
+	conn.CloseWithCode(websocket.CloseNormalClosure, "Normal closure")
 }
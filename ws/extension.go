@@ -0,0 +1,240 @@
+package ws
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Extension is a WebSocket protocol extension (RFC 6455 section 9) that is
+// negotiated through the Sec-WebSocket-Extensions header. Extensions are
+// configured on a Server or passed to DialWithOptions; every successful
+// negotiation yields a NegotiatedExtension bound to a single connection.
+type Extension interface {
+	// Name returns the extension token, e.g. "permessage-deflate".
+	Name() string
+
+	// Offer returns the parameters a client sends when offering the extension.
+	Offer() ExtensionParams
+
+	// Accept negotiates the extension. On the server params hold the client's
+	// offer and the returned params are sent back in the response; on the
+	// client params hold the server's response and the returned params are
+	// ignored. A server declines an offer by returning a nil
+	// NegotiatedExtension or an error; on the client either fails the dial.
+	Accept(params ExtensionParams, server bool) (ExtensionParams, NegotiatedExtension, error)
+}
+
+// NegotiatedExtension transforms the payload of data messages on one
+// connection. Extensions run in negotiation order on outgoing messages and
+// in reverse order on incoming ones.
+type NegotiatedExtension interface {
+	// RSV returns the reserved frame bits (0x40, 0x20, 0x10) the extension
+	// may set. Two extensions on the same connection cannot share a bit.
+	RSV() byte
+
+	// WrapWriter returns a writer that encodes one outgoing message into w.
+	// The writer may set bits in *rsv, which are applied to the first frame
+	// of the message. Closing the returned writer must close w.
+	WrapWriter(w io.WriteCloser, rsv *byte) io.WriteCloser
+
+	// WrapReader returns a reader that decodes one incoming message read
+	// from r. rsv holds the reserved bits of the message's first frame.
+	WrapReader(r io.Reader, rsv byte) io.Reader
+}
+
+// ExtensionParams holds the parameters of one Sec-WebSocket-Extensions
+// element. Parameters without a value map to the empty string.
+type ExtensionParams map[string]string
+
+// Has reports whether the parameter is present.
+func (p ExtensionParams) Has(name string) bool {
+	_, ok := p[name]
+	return ok
+}
+
+// extensionElement is one comma separated element of a
+// Sec-WebSocket-Extensions header.
+type extensionElement struct {
+	name   string
+	params ExtensionParams
+}
+
+// String formats the element for use in a header, with parameters sorted so
+// the output is deterministic.
+func (e extensionElement) String() string {
+	keys := make([]string, 0, len(e.params))
+	for k := range e.params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(e.name)
+	for _, k := range keys {
+		b.WriteString("; ")
+		b.WriteString(k)
+		if v := e.params[k]; v != "" {
+			b.WriteString("=")
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
+
+// parseExtensions parses every Sec-WebSocket-Extensions header in h.
+func parseExtensions(h http.Header) []extensionElement {
+	var elems []extensionElement
+	for _, line := range h.Values("Sec-WebSocket-Extensions") {
+		for _, elem := range strings.Split(line, ",") {
+			parts := strings.Split(elem, ";")
+			name := strings.TrimSpace(parts[0])
+			if name == "" {
+				continue
+			}
+			params := ExtensionParams{}
+			for _, p := range parts[1:] {
+				k, v, _ := strings.Cut(p, "=")
+				k = strings.TrimSpace(k)
+				if k == "" {
+					continue
+				}
+				params[k] = strings.Trim(strings.TrimSpace(v), `"`)
+			}
+			elems = append(elems, extensionElement{name: name, params: params})
+		}
+	}
+	return elems
+}
+
+// offerExtensions formats the client's Sec-WebSocket-Extensions header.
+func offerExtensions(exts []Extension) string {
+	offers := make([]string, len(exts))
+	for i, ext := range exts {
+		offers[i] = extensionElement{name: ext.Name(), params: ext.Offer()}.String()
+	}
+	return strings.Join(offers, ", ")
+}
+
+// acceptExtensions runs the server side of the negotiation. Offers are
+// considered in the client's order and each configured extension is used at
+// most once. It returns the negotiated extensions and the response header
+// value.
+func acceptExtensions(offers []extensionElement, exts []Extension) ([]NegotiatedExtension, string) {
+	var (
+		negotiated []NegotiatedExtension
+		accepted   []string
+		used       = make([]bool, len(exts))
+		rsv        byte
+	)
+	for _, offer := range offers {
+		for i, ext := range exts {
+			if used[i] || ext.Name() != offer.name {
+				continue
+			}
+			params, n, err := ext.Accept(offer.params, true)
+			if err != nil || n == nil || n.RSV()&rsv != 0 {
+				continue
+			}
+			used[i] = true
+			rsv |= n.RSV()
+			negotiated = append(negotiated, n)
+			accepted = append(accepted, extensionElement{name: offer.name, params: params}.String())
+			break
+		}
+	}
+	return negotiated, strings.Join(accepted, ", ")
+}
+
+// confirmExtensions runs the client side of the negotiation against the
+// extensions listed in the server's response.
+func confirmExtensions(resp []extensionElement, exts []Extension) ([]NegotiatedExtension, error) {
+	var (
+		negotiated []NegotiatedExtension
+		used       = make([]bool, len(exts))
+		rsv        byte
+	)
+	for _, elem := range resp {
+		idx := -1
+		for i, ext := range exts {
+			if !used[i] && ext.Name() == elem.name {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("ws: server accepted extension %q that was not offered", elem.name)
+		}
+		_, n, err := exts[idx].Accept(elem.params, false)
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			return nil, fmt.Errorf("ws: extension %q rejected the server's parameters", elem.name)
+		}
+		if n.RSV()&rsv != 0 {
+			return nil, fmt.Errorf("ws: extension %q reuses reserved bits", elem.name)
+		}
+		used[idx] = true
+		rsv |= n.RSV()
+		negotiated = append(negotiated, n)
+	}
+	return negotiated, nil
+}
+
+// setExtensions installs the negotiated extensions on the connection.
+func (c *Conn) setExtensions(exts []NegotiatedExtension) {
+	c.extensions = exts
+	c.extRSV = 0
+	for _, ext := range exts {
+		c.extRSV |= ext.RSV()
+	}
+}
+
+// nopWriteCloser terminates the writer chain built by encodeMessage.
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// encodeMessage runs an outgoing data message through the negotiated
+// extensions and returns the encoded payload and the reserved bits for its
+// first frame.
+func (c *Conn) encodeMessage(payload []byte) ([]byte, byte, error) {
+	var (
+		buf bytes.Buffer
+		rsv byte
+		w   io.WriteCloser = nopWriteCloser{&buf}
+	)
+	for i := len(c.extensions) - 1; i >= 0; i-- {
+		w = c.extensions[i].WrapWriter(w, &rsv)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return nil, 0, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), rsv, nil
+}
+
+// decodeMessage runs an incoming data message through the negotiated
+// extensions in reverse order. The input payload is released. Output beyond
+// the read limit is not decoded and yields ErrMessageTooBig.
+func (c *Conn) decodeMessage(payload []byte, rsv byte) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(payload)
+	for i := len(c.extensions) - 1; i >= 0; i-- {
+		r = c.extensions[i].WrapReader(r, rsv)
+	}
+	if c.readLimit > 0 {
+		r = io.LimitReader(r, c.readLimit+1)
+	}
+	out, err := io.ReadAll(r)
+	putBuffer(payload)
+	if err == nil && c.readLimit > 0 && int64(len(out)) > c.readLimit {
+		return nil, ErrMessageTooBig
+	}
+	return out, err
+}
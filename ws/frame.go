@@ -0,0 +1,196 @@
+package ws
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Frame is a single WebSocket frame as delivered by ReadFrame.
+type Frame struct {
+	// OpCode is the frame opcode; fragments after the first one carry
+	// OpContinuation.
+	OpCode OpCode
+	// Fin is set on the final frame of a message.
+	Fin bool
+	// RSV holds the reserved bits of the frame. Payloads of messages encoded
+	// by a negotiated extension are returned as received.
+	RSV byte
+	// Payload is the unmasked frame payload, backed by a pooled buffer.
+	Payload []byte
+}
+
+// Release returns the frame payload to the buffer pool. Calling it is
+// optional; after Release the Payload must no longer be used.
+func (f *Frame) Release() {
+	if f.Payload != nil {
+		putBuffer(f.Payload)
+		f.Payload = nil
+	}
+}
+
+// ReadFrame reads the next frame without reassembling fragmented messages,
+// so data can be relayed as it arrives with constant memory. Ping and pong
+// frames are returned as they interleave with data fragments; a close frame
+// is reported as a *CloseError. ReadFrame and ReadMessage must not be mixed
+// in the middle of a fragmented message.
+func (c *Conn) ReadFrame() (*Frame, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	return c.readFrame()
+}
+
+// readFrame reads and validates one frame from the connection.
+func (c *Conn) readFrame() (*Frame, error) {
+	if c.idleTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	}
+
+	// Read frame header
+	header := c.readHdr[:2]
+	_, err := io.ReadFull(c.conn, header)
+	if err != nil {
+		return nil, readError(err)
+	}
+	c.touch()
+
+	// Parse basic frame information
+	fin := (header[0] & 0x80) != 0
+	rsv := header[0] & 0x70
+	opcode := OpCode(header[0] & 0x0F)
+	masked := (header[1] & 0x80) != 0
+	payloadLen := int(header[1] & 0x7F)
+
+	// Read the extended payload length and the masking key in one go
+	rest := 0
+	switch payloadLen {
+	case 126:
+		rest = 2
+	case 127:
+		rest = 8
+	}
+	var maskingKey []byte
+	if masked {
+		maskingKey = c.readHdr[2+rest : 6+rest]
+		rest += 4
+	}
+	if rest > 0 {
+		if _, err := io.ReadFull(c.conn, c.readHdr[2:2+rest]); err != nil {
+			return nil, readError(err)
+		}
+	}
+
+	// Handle extended payload length
+	if payloadLen == 126 {
+		payloadLen = int(binary.BigEndian.Uint16(c.readHdr[2:4]))
+	} else if payloadLen == 127 {
+		extLen := c.readHdr[2:10]
+
+		// First bit must be 0 (unsigned)
+		if extLen[0]&0x80 != 0 {
+			return nil, fmt.Errorf("invalid payload length: most significant bit must be 0")
+		}
+
+		// Check if the length fits in an int
+		payloadLen64 := binary.BigEndian.Uint64(extLen)
+		if payloadLen64 > uint64(^uint(0)>>1) {
+			return nil, fmt.Errorf("payload too large for this implementation")
+		}
+
+		payloadLen = int(payloadLen64)
+	}
+
+	if c.readLimit > 0 && int64(payloadLen) > c.readLimit {
+		return nil, c.tooBig()
+	}
+	if c.maxFrameSize > 0 && payloadLen > c.maxFrameSize {
+		return nil, c.fail(CloseMessageTooBig, fmt.Errorf("ws: frame of %d bytes exceeds limit of %d", payloadLen, c.maxFrameSize))
+	}
+
+	// Clients mask their frames and servers must not, RFC 6455 section 5.1
+	if c.server && !masked {
+		return nil, c.fail(CloseProtocolError, fmt.Errorf("ws: client frames must be masked"))
+	}
+	if !c.server && masked {
+		return nil, c.fail(CloseProtocolError, fmt.Errorf("ws: server frames must not be masked"))
+	}
+
+	if err := c.checkFrame(fin, rsv, opcode, payloadLen); err != nil {
+		return nil, c.fail(CloseProtocolError, err)
+	}
+
+	// Track the message the data frame belongs to
+	switch {
+	case opcode == OpContinuation:
+		c.fragmenting = !fin
+	case opcode < OpClose:
+		c.fragmentOpCode = opcode
+		c.fragmentRSV = rsv
+		c.fragmenting = !fin
+	}
+
+	// Read payload
+	payload := getBuffer(payloadLen)
+	_, err = io.ReadFull(c.conn, payload)
+	if err != nil {
+		putBuffer(payload)
+		return nil, readError(err)
+	}
+
+	// Unmask the payload if necessary
+	if masked {
+		maskBytes(maskingKey, payload)
+	}
+
+	if opcode == OpPong {
+		c.lastPong.Store(time.Now().UnixNano())
+	}
+
+	// A close frame ends the message stream
+	if opcode == OpClose {
+		if err := checkClosePayload(payload); err != nil {
+			putBuffer(payload)
+			return nil, c.fail(CloseProtocolError, err)
+		}
+		closeErr := parseClosePayload(payload)
+		putBuffer(payload)
+		c.receiveClose(closeErr.Code)
+		return nil, closeErr
+	}
+
+	return &Frame{OpCode: opcode, Fin: fin, RSV: rsv, Payload: payload}, nil
+}
+
+// maskBytes applies the masking key to b in place. Masking and unmasking
+// are the same operation.
+func maskBytes(key []byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// encodeHeader encodes an unmasked frame header into buf and returns its length.
+// buf must have room for the largest header (maxHeaderSize bytes).
+func encodeHeader(buf []byte, fin bool, rsv byte, opcode OpCode, payloadLen int) int {
+	// First byte: FIN bit, RSV1-3, opcode
+	buf[0] = rsv&0x70 | byte(opcode)
+	if fin {
+		buf[0] |= 0x80
+	}
+
+	// Second byte: No mask bit (0), and payload length
+	switch {
+	case payloadLen < 126:
+		buf[1] = byte(payloadLen)
+		return 2
+	case payloadLen < 65536:
+		buf[1] = 126
+		binary.BigEndian.PutUint16(buf[2:], uint16(payloadLen))
+		return 4
+	default:
+		buf[1] = 127
+		binary.BigEndian.PutUint64(buf[2:], uint64(payloadLen))
+		return 10
+	}
+}
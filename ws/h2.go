@@ -0,0 +1,236 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// WebSocket over HTTP/2 (RFC 8441) bootstraps a connection with an extended
+// CONNECT request carrying the :protocol pseudo-header. The resulting HTTP/2
+// stream carries regular WebSocket frames in both directions.
+//
+// Go's HTTP/2 implementation only advertises and accepts extended CONNECT
+// when the process is started with GODEBUG=http2xconnect=1.
+
+// ServeHTTP bootstraps a WebSocket connection from an HTTP/2 extended CONNECT
+// request and runs the server's handler on it. It lets a Server be mounted in
+// a standard net/http server that speaks HTTP/2.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Method != http.MethodConnect || r.Header.Get(":protocol") != "websocket" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket over HTTP/2 requires an extended CONNECT request", http.StatusUpgradeRequired)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return
+	}
+	if err := s.upgradeOptions().check(r); err != nil {
+		http.Error(w, err.Reason, err.StatusCode)
+		return
+	}
+	if !s.reserve() {
+		http.Error(w, "too many connections", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		s.release(nil)
+		return
+	}
+
+	stream := newH2Stream(r.Body, w, rc.Flush, r.RemoteAddr)
+	stream.setReadDeadline = rc.SetReadDeadline
+	stream.setWriteDeadline = rc.SetWriteDeadline
+
+	wsConn := newConn(stream, true)
+	wsConn.req = r
+	s.configure(wsConn)
+
+	if !s.activate(wsConn) {
+		wsConn.CloseWithCode(CloseGoingAway, "server shutting down")
+		return
+	}
+	defer s.release(wsConn)
+	defer wsConn.Close()
+	s.handler()(wsConn)
+}
+
+// ListenAndServeHTTP2 serves WebSocket over HTTP/2 on s.Addr using TLS.
+// The process must run with GODEBUG=http2xconnect=1.
+func (s *Server) ListenAndServeHTTP2(certFile, keyFile string) error {
+	srv := &http.Server{
+		Addr:      s.Addr,
+		Handler:   s,
+		TLSConfig: s.TLSConfig,
+	}
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP2(true)
+	return srv.ListenAndServeTLS(certFile, keyFile)
+}
+
+// The default transports speak HTTP/2 over TLS for wss:// and cleartext
+// HTTP/2 with prior knowledge for ws://. net/http's Transport cannot be used
+// here because it rejects the :protocol pseudo-header.
+var (
+	defaultH2Transport  = &http2.Transport{}
+	defaultH2CTransport = &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+)
+
+// H2Dialer opens WebSocket connections over HTTP/2 extended CONNECT.
+type H2Dialer struct {
+	// Transport performs the CONNECT request. It must speak HTTP/2 and accept
+	// the :protocol pseudo-header; when nil a golang.org/x/net/http2 transport
+	// is used (cleartext prior knowledge for ws://).
+	Transport http.RoundTripper
+
+	// Header holds extra headers sent with the CONNECT request.
+	Header http.Header
+}
+
+// DialContext connects to a ws:// or wss:// URL over HTTP/2. The server's
+// response is returned alongside the connection for inspection.
+func (d *H2Dialer) DialContext(ctx context.Context, rawURL string) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, nil, fmt.Errorf("ws: unsupported scheme %q", u.Scheme)
+	}
+
+	rt := d.Transport
+	if rt == nil {
+		rt = defaultH2Transport
+		if u.Scheme == "http" {
+			rt = defaultH2CTransport
+		}
+	}
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodConnect, u.String(), pr)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, vs := range d.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set(":protocol", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		pw.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		pw.Close()
+		return nil, resp, fmt.Errorf("ws: extended CONNECT failed with status %s", resp.Status)
+	}
+
+	stream := newH2Stream(resp.Body, pw, nil, u.Host)
+	stream.closeWrite = pw.Close
+	return newConn(stream, false), resp, nil
+}
+
+// h2Stream adapts an HTTP/2 request/response body pair to net.Conn.
+type h2Stream struct {
+	r     io.ReadCloser
+	w     io.Writer
+	flush func() error
+
+	closeWrite       func() error
+	setReadDeadline  func(time.Time) error
+	setWriteDeadline func(time.Time) error
+
+	remote    h2Addr
+	closeOnce sync.Once
+}
+
+func newH2Stream(r io.ReadCloser, w io.Writer, flush func() error, remote string) *h2Stream {
+	return &h2Stream{
+		r:      r,
+		w:      w,
+		flush:  flush,
+		remote: h2Addr(remote),
+	}
+}
+
+func (s *h2Stream) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *h2Stream) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err == nil && s.flush != nil {
+		err = s.flush()
+	}
+	return n, err
+}
+
+func (s *h2Stream) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		if s.closeWrite != nil {
+			err = s.closeWrite()
+		}
+		if rerr := s.r.Close(); err == nil {
+			err = rerr
+		}
+	})
+	return err
+}
+
+func (s *h2Stream) LocalAddr() net.Addr  { return h2Addr("") }
+func (s *h2Stream) RemoteAddr() net.Addr { return s.remote }
+
+// Deadlines are only available on server-side streams, where the
+// http.ResponseController can apply them. On client streams they are no-ops.
+func (s *h2Stream) SetDeadline(t time.Time) error {
+	return errors.Join(s.SetReadDeadline(t), s.SetWriteDeadline(t))
+}
+
+func (s *h2Stream) SetReadDeadline(t time.Time) error {
+	if s.setReadDeadline == nil {
+		return nil
+	}
+	return s.setReadDeadline(t)
+}
+
+func (s *h2Stream) SetWriteDeadline(t time.Time) error {
+	if s.setWriteDeadline == nil {
+		return nil
+	}
+	return s.setWriteDeadline(t)
+}
+
+// h2Addr is the net.Addr of an HTTP/2 stream endpoint.
+type h2Addr string
+
+func (a h2Addr) Network() string { return "h2" }
+func (a h2Addr) String() string  { return string(a) }
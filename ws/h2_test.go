@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Extended CONNECT is only enabled when GODEBUG carries http2xconnect=1 at
+// startup, so the test reruns itself in a child process with it set.
+func TestH2RoundTrip(t *testing.T) {
+	if !strings.Contains(os.Getenv("GODEBUG"), "http2xconnect=1") {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestH2RoundTrip$", "-test.v")
+		cmd.Env = append(os.Environ(), "GODEBUG="+os.Getenv("GODEBUG")+",http2xconnect=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+
+	released := make(chan struct{})
+	s := &Server{Handler: func(c *Conn) {
+		defer close(released)
+		if c.Request().Header.Get(":protocol") != "websocket" {
+			t.Errorf(":protocol = %q", c.Request().Header.Get(":protocol"))
+		}
+		msg, err := c.ReadMessage()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		c.WriteMessage(msg.OpCode, msg.Payload)
+		// Returning closes the connection from the server side
+	}}
+
+	srv := httptest.NewUnstartedServer(s)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var d H2Dialer
+	client, resp, err := d.DialContext(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("response proto = %s, want HTTP/2", resp.Proto)
+	}
+	defer client.Close()
+
+	if err := client.WriteText("ping"); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.OpCode != OpText || string(msg.Payload) != "ping" {
+		t.Errorf("echo = %d %q", msg.OpCode, msg.Payload)
+	}
+
+	// Client streams have no deadlines, so the read is bounded here
+	closed := make(chan error, 1)
+	go func() {
+		_, err := client.ReadMessage()
+		closed <- err
+	}()
+	select {
+	case err := <-closed:
+		if !IsCloseError(err, CloseNoStatusReceived) {
+			t.Errorf("read after the handler returned = %v, want a close frame", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection not closed after the handler returned")
+	}
+	<-released
+}
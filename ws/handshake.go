@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HandshakeRequest is a client's opening handshake as seen by the server's
+// hooks, before the connection is upgraded. The same request is returned by
+// Conn.Request afterwards.
+type HandshakeRequest struct {
+	*http.Request
+}
+
+// Origin returns the Origin header sent by the client, empty for most
+// non-browser clients.
+func (r *HandshakeRequest) Origin() string {
+	return r.Header.Get("Origin")
+}
+
+// SameOrigin reports whether r has no Origin header or one whose host
+// matches the Host of the request. It is the default Server.CheckOrigin,
+// keeping other sites' pages from connecting on behalf of their visitors.
+func SameOrigin(r *HandshakeRequest) bool {
+	origin := r.Origin()
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// AllowAnyOrigin accepts every Origin. Set it as Server.CheckOrigin only
+// for servers that do not rely on cookies or other ambient credentials, or
+// that authenticate clients in CheckRequest.
+func AllowAnyOrigin(*HandshakeRequest) bool {
+	return true
+}
+
+// check runs the server's handshake hooks on a valid upgrade request.
+func (o upgradeOptions) check(req *http.Request) *HandshakeError {
+	r := &HandshakeRequest{req}
+	checkOrigin := o.checkOrigin
+	if checkOrigin == nil {
+		checkOrigin = SameOrigin
+	}
+	if !checkOrigin(r) {
+		return &HandshakeError{StatusCode: http.StatusForbidden, Reason: "origin not allowed"}
+	}
+	if o.checkRequest == nil {
+		return nil
+	}
+	err := o.checkRequest(r)
+	if err == nil {
+		return nil
+	}
+	var herr *HandshakeError
+	if errors.As(err, &herr) {
+		return herr
+	}
+	return &HandshakeError{StatusCode: http.StatusForbidden, Reason: err.Error()}
+}
@@ -0,0 +1,173 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+)
+
+// HubOptions configures a Hub.
+type HubOptions struct {
+	// Queue configures the send queue of every registered connection. Its
+	// policy decides what happens to slow consumers: the drop policies
+	// skip messages they cannot take in time and BackpressureClose
+	// disconnects them. With BackpressureBlock a broadcast queues the
+	// message for every connection at once and returns when the slowest
+	// one has taken it, so it is best combined with a SendTimeout.
+	Queue QueueOptions
+
+	// OpCode is the opcode of broadcast messages. Defaults to OpText.
+	OpCode OpCode
+}
+
+// Hub keeps track of a set of connections and the rooms they joined, and
+// fans messages out to them. Messages are delivered through each
+// connection's send queue, so a slow consumer does not hold up the others.
+//
+//	hub := ws.NewHub(ws.HubOptions{Queue: ws.QueueOptions{Policy: ws.BackpressureClose}})
+//	server := ws.NewServer(":8080", func(c *ws.Conn) {
+//		hub.Join("lobby", c)
+//		defer hub.Unregister(c)
+//		for {
+//			msg, err := c.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			hub.BroadcastRoom("lobby", msg.Payload)
+//		}
+//	})
+type Hub struct {
+	opts HubOptions
+
+	mu    sync.RWMutex
+	conns map[*Conn]struct{}
+	rooms map[string]map[*Conn]struct{}
+}
+
+// NewHub returns an empty hub.
+func NewHub(opts HubOptions) *Hub {
+	if opts.OpCode == OpContinuation {
+		opts.OpCode = OpText
+	}
+	return &Hub{
+		opts:  opts,
+		conns: make(map[*Conn]struct{}),
+		rooms: make(map[string]map[*Conn]struct{}),
+	}
+}
+
+// Register adds c to the hub and enables its send queue. Registering a
+// connection twice has no effect.
+func (h *Hub) Register(c *Conn) {
+	c.EnableSendQueue(h.opts.Queue)
+	h.mu.Lock()
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+}
+
+// Unregister removes c from the hub and from every room it joined. The
+// connection itself is left open.
+func (h *Hub) Unregister(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, c)
+	for name, room := range h.rooms {
+		delete(room, c)
+		if len(room) == 0 {
+			delete(h.rooms, name)
+		}
+	}
+}
+
+// Join adds c to room, registering it with the hub first if needed.
+func (h *Hub) Join(room string, c *Conn) {
+	h.Register(c)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	members := h.rooms[room]
+	if members == nil {
+		members = make(map[*Conn]struct{})
+		h.rooms[room] = members
+	}
+	members[c] = struct{}{}
+}
+
+// Leave removes c from room. It stays registered with the hub.
+func (h *Hub) Leave(room string, c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if members := h.rooms[room]; members != nil {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// Len returns the number of registered connections.
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// RoomLen returns the number of connections in room.
+func (h *Hub) RoomLen(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
+
+// Broadcast queues msg for every registered connection. The payload is
+// shared, not copied, and must not be modified afterwards. Connections
+// whose queue has shut down are unregistered.
+func (h *Hub) Broadcast(msg []byte) {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+	h.send(conns, msg)
+}
+
+// BroadcastRoom queues msg for every connection in room, like Broadcast.
+func (h *Hub) BroadcastRoom(room string, msg []byte) {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+	h.send(conns, msg)
+}
+
+func (h *Hub) send(conns []*Conn, msg []byte) {
+	if h.opts.Queue.Policy != BackpressureBlock {
+		for _, c := range conns {
+			h.deliver(c, msg)
+		}
+		return
+	}
+	// Blocking sends run side by side, so that a stalled connection delays
+	// the broadcast without holding up delivery to the others
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.deliver(c, msg)
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver queues msg for c, unregistering it if it can no longer take
+// messages.
+func (h *Hub) deliver(c *Conn, msg []byte) {
+	err := c.Send(h.opts.OpCode, msg)
+	if err == nil || errors.Is(err, ErrQueueFull) && h.opts.Queue.Policy != BackpressureClose {
+		// A dropped message leaves the consumer connected
+		return
+	}
+	h.Unregister(c)
+}
@@ -0,0 +1,187 @@
+package ws
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// connPair returns a server connection and the client at the other end of
+// an in-memory pipe. Writes block until the client reads, so a client that
+// doesn't read stalls its server side.
+func connPair(t *testing.T) (server, client *Conn) {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return NewConn(a, true), NewConn(b, false)
+}
+
+// expectText reads the next message from c and checks that it is want.
+func expectText(t *testing.T, c *Conn, want string) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	msg, err := c.ReadMessage()
+	if err != nil {
+		t.Fatalf("waiting for %q: %v", want, err)
+	}
+	if msg.OpCode != OpText || string(msg.Payload) != want {
+		t.Fatalf("got %d %q, want %q", msg.OpCode, msg.Payload, want)
+	}
+}
+
+func TestHubBroadcastRooms(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	var clients []*Conn
+	for i := 0; i < 3; i++ {
+		server, client := connPair(t)
+		hub.Register(server)
+		if i < 2 {
+			hub.Join("room", server)
+		}
+		clients = append(clients, client)
+	}
+	if hub.Len() != 3 || hub.RoomLen("room") != 2 {
+		t.Fatalf("Len = %d, RoomLen = %d", hub.Len(), hub.RoomLen("room"))
+	}
+
+	hub.Broadcast([]byte("all"))
+	hub.BroadcastRoom("room", []byte("room"))
+	hub.Broadcast([]byte("next"))
+	for i, c := range clients {
+		expectText(t, c, "all")
+		if i < 2 {
+			expectText(t, c, "room")
+		}
+		expectText(t, c, "next")
+	}
+}
+
+func TestHubUnregister(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	a, _ := connPair(t)
+	b, clientB := connPair(t)
+	hub.Join("room", a)
+	hub.Join("room", b)
+
+	hub.Unregister(b)
+	if hub.Len() != 1 || hub.RoomLen("room") != 1 {
+		t.Errorf("after Unregister: Len = %d, RoomLen = %d", hub.Len(), hub.RoomLen("room"))
+	}
+	hub.Leave("room", a)
+	if hub.Len() != 1 || hub.RoomLen("room") != 0 {
+		t.Errorf("after Leave: Len = %d, RoomLen = %d", hub.Len(), hub.RoomLen("room"))
+	}
+
+	// Connections closed without unregistering are dropped on the next
+	// broadcast
+	hub.Join("room", b)
+	go clientB.ReadMessage()
+	b.Close()
+	hub.BroadcastRoom("room", []byte("x"))
+	if hub.Len() != 1 || hub.RoomLen("room") != 0 {
+		t.Errorf("after closing a member: Len = %d, RoomLen = %d", hub.Len(), hub.RoomLen("room"))
+	}
+}
+
+// stalledHub registers a connection whose client never reads and one that
+// does, with a queue of one message.
+func stalledHub(t *testing.T, opts QueueOptions) (hub *Hub, fast *Conn) {
+	t.Helper()
+	opts.Size = 1
+	hub = NewHub(HubOptions{Queue: opts})
+	stalled, _ := connPair(t)
+	server, fast := connPair(t)
+	hub.Register(stalled)
+	hub.Register(server)
+	return hub, fast
+}
+
+func TestHubBackpressureDrop(t *testing.T) {
+	for _, policy := range []BackpressurePolicy{BackpressureDropNewest, BackpressureDropOldest} {
+		hub, fast := stalledHub(t, QueueOptions{Policy: policy})
+		for _, msg := range []string{"1", "2", "3", "4"} {
+			hub.Broadcast([]byte(msg))
+			expectText(t, fast, msg)
+		}
+		if hub.Len() != 2 {
+			t.Errorf("policy %d: Len = %d, want the stalled connection kept", policy, hub.Len())
+		}
+	}
+}
+
+func TestHubBackpressureClose(t *testing.T) {
+	hub, fast := stalledHub(t, QueueOptions{Policy: BackpressureClose})
+	for _, msg := range []string{"1", "2", "3"} {
+		hub.Broadcast([]byte(msg))
+		expectText(t, fast, msg)
+	}
+	if hub.Len() != 1 {
+		t.Errorf("Len = %d, want the stalled connection unregistered", hub.Len())
+	}
+}
+
+// The close frame of BackpressureClose is sent by the writer goroutine
+// after the message it is writing, not in the middle of it.
+func TestBackpressureCloseWaitsForWriter(t *testing.T) {
+	server, client := connPair(t)
+	server.EnableSendQueue(QueueOptions{Size: 1, Policy: BackpressureClose})
+
+	// The writer takes 1 and blocks on the pipe, 2 fills the queue
+	if err := server.SendText("1"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for server.QueueLen() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("writer never took the first message")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := server.SendText("2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SendText("3"); err != ErrQueueFull {
+		t.Fatalf("Send on a full queue = %v, want ErrQueueFull", err)
+	}
+	if err := server.SendText("4"); err != ErrQueueFull {
+		t.Errorf("Send after the overflow = %v, want ErrQueueFull", err)
+	}
+
+	expectText(t, client, "1")
+	if _, err := client.ReadMessage(); !IsCloseError(err, ClosePolicyViolation) {
+		t.Errorf("ReadMessage = %v, want close 1008", err)
+	}
+}
+
+// With BackpressureBlock a stalled connection holds up the broadcast, but
+// not delivery to the other connections.
+func TestHubBackpressureBlock(t *testing.T) {
+	hub, fast := stalledHub(t, QueueOptions{SendTimeout: 500 * time.Millisecond})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The stalled writer takes 1, its queue 2; 3 waits for SendTimeout
+		for _, msg := range []string{"1", "2", "3"} {
+			hub.Broadcast([]byte(msg))
+		}
+	}()
+	for _, msg := range []string{"1", "2", "3"} {
+		expectText(t, fast, msg)
+	}
+	select {
+	case <-done:
+		t.Error("broadcast returned before the stalled connection timed out")
+	default:
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("broadcast still blocked after SendTimeout")
+	}
+	if hub.Len() != 2 {
+		t.Errorf("Len = %d, want the stalled connection kept", hub.Len())
+	}
+}
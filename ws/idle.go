@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"sync"
+	"time"
+)
+
+// SetIdleTimeout makes reads fail when the peer sends no frame for d.
+// The deadline is pushed forward every time a frame arrives, so it bounds
+// the silence between frames rather than the lifetime of a read.
+// A zero duration disables the timeout.
+func (c *Conn) SetIdleTimeout(d time.Duration) {
+	c.idleTimeout = d
+	if d == 0 {
+		c.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// LastActivity returns the time the last frame (including pongs) was read
+// from the peer, or the time the connection was established.
+func (c *Conn) LastActivity() time.Time {
+	return time.Unix(0, c.lastActivity.Load())
+}
+
+// touch records that the peer just produced a frame.
+func (c *Conn) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// LivenessMonitor closes connections that have not produced a frame within
+// a configured window. Connections quiet for half the window are pinged, so
+// a live peer that merely has nothing to say answers with a pong and stays
+// open; pongs are only seen while some goroutine reads from the
+// connection. It catches half-open TCP connections whose handlers are not
+// currently blocked in a read.
+type LivenessMonitor struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	conns map[*Conn]struct{}
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// NewLivenessMonitor starts a monitor that checks its connections every
+// half window, pings the ones idle for half of it and closes the ones idle
+// for longer than window.
+func NewLivenessMonitor(window time.Duration) *LivenessMonitor {
+	m := &LivenessMonitor{
+		window: window,
+		conns:  make(map[*Conn]struct{}),
+		stop:   make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// Add starts watching c.
+func (m *LivenessMonitor) Add(c *Conn) {
+	m.mu.Lock()
+	m.conns[c] = struct{}{}
+	m.mu.Unlock()
+}
+
+// Remove stops watching c.
+func (m *LivenessMonitor) Remove(c *Conn) {
+	m.mu.Lock()
+	delete(m.conns, c)
+	m.mu.Unlock()
+}
+
+// Stop terminates the monitor. Watched connections are left open.
+func (m *LivenessMonitor) Stop() {
+	m.once.Do(func() { close(m.stop) })
+}
+
+func (m *LivenessMonitor) run() {
+	ticker := time.NewTicker(m.window / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			dead, quiet := m.check(now)
+			for _, c := range dead {
+				c.CloseWithCode(CloseGoingAway, "idle timeout")
+			}
+			for _, c := range quiet {
+				// A slow peer must not hold up the other connections
+				go c.Ping(nil)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// check removes and returns the connections idle for longer than the
+// window, and returns the ones idle for half of it, which are due a ping.
+func (m *LivenessMonitor) check(now time.Time) (dead, quiet []*Conn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for c := range m.conns {
+		switch idle := now.Sub(c.LastActivity()); {
+		case idle > m.window:
+			dead = append(dead, c)
+			delete(m.conns, c)
+		case idle >= m.window/2:
+			quiet = append(quiet, c)
+		}
+	}
+	return dead, quiet
+}
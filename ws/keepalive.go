@@ -0,0 +1,122 @@
+package ws
+
+import "time"
+
+// SetPingHandler sets the function called by ReadMessage for each ping
+// frame, with the frame's application data. An error returned by h is
+// returned by ReadMessage. A nil h restores DefaultPingHandler, which
+// answers every ping. It may be called while another goroutine reads.
+func (c *Conn) SetPingHandler(h func(appData []byte) error) {
+	if h == nil {
+		c.pingHandler.Store(nil)
+		return
+	}
+	c.pingHandler.Store(&h)
+}
+
+// SetPongHandler sets the function called by ReadMessage for each pong
+// frame, like SetPingHandler does for pings. Without a handler, pongs are
+// returned to the caller as messages. Pongs still count for the keep-alive
+// when a handler is set.
+func (c *Conn) SetPongHandler(h func(appData []byte) error) {
+	if h == nil {
+		c.pongHandler.Store(nil)
+		return
+	}
+	c.pongHandler.Store(&h)
+}
+
+// controlHandler returns the handler for ping or pong frames, or nil if
+// they are returned to the caller.
+func (c *Conn) controlHandler(opcode OpCode) func(appData []byte) error {
+	if opcode == OpPong {
+		if h := c.pongHandler.Load(); h != nil {
+			return *h
+		}
+		return nil
+	}
+	if h := c.pingHandler.Load(); h != nil {
+		return *h
+	}
+	return c.answerPing
+}
+
+// DefaultPingHandler returns the ping handler connections start with. It
+// answers each ping with a pong carrying the same application data, as RFC
+// 6455 section 5.5.2 requires, and suits handlers that observe pings and
+// then delegate to it.
+func (c *Conn) DefaultPingHandler() func(appData []byte) error {
+	return c.answerPing
+}
+
+func (c *Conn) answerPing(appData []byte) error {
+	err := c.Pong(appData)
+	if err != nil && c.sentClose() {
+		// A ping racing the closing handshake needs no answer
+		return nil
+	}
+	return err
+}
+
+// SetKeepAlive pings the peer every interval from a background goroutine
+// and closes the connection when no pong arrives within timeout of a ping,
+// so dead peers and half-open TCP connections are detected without a timer
+// in the application. Pongs are only seen while some goroutine reads from
+// the connection. A zero timeout sends pings without checking the replies,
+// and a zero interval stops the keep-alive, as closing the connection does.
+func (c *Conn) SetKeepAlive(interval, timeout time.Duration) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.keepAliveStop != nil {
+		close(c.keepAliveStop)
+		c.keepAliveStop = nil
+	}
+	if interval <= 0 {
+		return
+	}
+	c.keepAliveStop = make(chan struct{})
+	go c.keepAlive(interval, timeout, c.keepAliveStop)
+}
+
+// stopKeepAlive ends the keep-alive goroutine, if any.
+func (c *Conn) stopKeepAlive() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.keepAliveStop != nil {
+		close(c.keepAliveStop)
+		c.keepAliveStop = nil
+	}
+}
+
+func (c *Conn) keepAlive(interval, timeout time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		sent := time.Now()
+		if err := c.Ping(nil); err != nil {
+			return
+		}
+		if timeout <= 0 {
+			continue
+		}
+
+		timer := time.NewTimer(timeout)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		if c.lastPong.Load() < sent.UnixNano() {
+			// The peer is gone, so there is no point in a close frame
+			c.conn.Close()
+			return
+		}
+	}
+}
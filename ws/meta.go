@@ -0,0 +1,50 @@
+package ws
+
+import "sync/atomic"
+
+// lastConnID is the source of connection IDs handed out by Upgrade.
+var lastConnID atomic.Uint64
+
+func nextConnID() uint64 {
+	return lastConnID.Add(1)
+}
+
+// ID returns the process-unique identifier assigned to the connection when
+// it was upgraded or dialed.
+func (c *Conn) ID() uint64 {
+	return c.id
+}
+
+// Set stores a value on the connection under key. It is safe to call from
+// multiple goroutines.
+func (c *Conn) Set(key string, value any) {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	if c.meta == nil {
+		c.meta = make(map[string]any)
+	}
+	c.meta[key] = value
+}
+
+// Get returns the value stored under key, and whether it exists.
+func (c *Conn) Get(key string) (value any, exists bool) {
+	c.metaMu.RLock()
+	defer c.metaMu.RUnlock()
+	value, exists = c.meta[key]
+	return
+}
+
+// GetString returns the value stored under key as a string, or "" if it is
+// missing or of a different type.
+func (c *Conn) GetString(key string) string {
+	v, _ := c.Get(key)
+	s, _ := v.(string)
+	return s
+}
+
+// Delete removes key from the connection's metadata.
+func (c *Conn) Delete(key string) {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	delete(c.meta, key)
+}
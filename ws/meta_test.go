@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConnMetadata(t *testing.T) {
+	c, _ := connPair(t)
+	if _, ok := c.Get("user"); ok {
+		t.Fatal("Get on a fresh connection found a value")
+	}
+
+	c.Set("user", "ada")
+	c.Set("count", 3)
+	if v, ok := c.Get("user"); !ok || v != "ada" {
+		t.Errorf(`Get("user") = %v, %v`, v, ok)
+	}
+	if s := c.GetString("user"); s != "ada" {
+		t.Errorf(`GetString("user") = %q`, s)
+	}
+	if s := c.GetString("count"); s != "" {
+		t.Errorf(`GetString of an int = %q, want ""`, s)
+	}
+
+	c.Set("user", "grace")
+	if s := c.GetString("user"); s != "grace" {
+		t.Errorf("overwritten value = %q", s)
+	}
+	c.Delete("user")
+	if _, ok := c.Get("user"); ok {
+		t.Error("value still present after Delete")
+	}
+	c.Delete("missing")
+
+	other, _ := connPair(t)
+	if c.ID() == 0 || c.ID() == other.ID() {
+		t.Errorf("IDs %d and %d, want distinct non-zero", c.ID(), other.ID())
+	}
+}
+
+func TestConnMetadataConcurrent(t *testing.T) {
+	c, _ := connPair(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := "k" + strconv.Itoa(i)
+			for j := 0; j < 200; j++ {
+				c.Set(key, j)
+				c.Get(key)
+				c.GetString("shared")
+				c.Set("shared", key)
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+			c.Set(key, "done")
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		if s := c.GetString("k" + strconv.Itoa(i)); s != "done" {
+			t.Errorf("k%d = %q, want done", i, s)
+		}
+	}
+}
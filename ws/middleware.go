@@ -0,0 +1,58 @@
+package ws
+
+// Handler serves an established WebSocket connection.
+type Handler func(*Conn)
+
+// Middleware wraps a Handler with cross-cutting behaviour such as
+// authentication, logging, panic recovery or metrics. It runs once the
+// opening handshake has completed; a middleware that does not call next
+// ends the connection, and may close it with a status code such as
+// ClosePolicyViolation first. To refuse a client before the upgrade, with
+// an HTTP status, use Server.CheckRequest.
+type Middleware func(next Handler) Handler
+
+// Chain composes middleware around h. The first middleware is the outermost,
+// matching the order in which HTTP middleware runs in lux.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Use appends middleware to the server's connection handler chain.
+func (s *Server) Use(middleware ...Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// handler returns the connection handler wrapped in the registered middleware.
+func (s *Server) handler() Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.Handler
+	if h == nil {
+		h = s.serveEvents
+	}
+	return Chain(h, s.middleware...)
+}
+
+// Recover returns middleware that recovers from panics in the handler,
+// reports them to onPanic (if non-nil) and closes the connection with
+// status 1011 (internal error).
+func Recover(onPanic func(c *Conn, recovered any)) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Conn) {
+			defer func() {
+				if r := recover(); r != nil {
+					if onPanic != nil {
+						onPanic(c, r)
+					}
+					c.CloseWithCode(CloseInternalServerErr, "internal error")
+				}
+			}()
+			next(c)
+		}
+	}
+}
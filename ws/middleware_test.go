@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recorder collects the steps of a middleware chain in order.
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) add(step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.steps...)
+}
+
+func (r *recorder) middleware(name string) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Conn) {
+			r.add(name + " before")
+			next(c)
+			r.add(name + " after")
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	rec := &recorder{}
+	h := Chain(func(c *Conn) { rec.add("handler") }, rec.middleware("outer"), rec.middleware("inner"))
+	h(nil)
+	want := []string{"outer before", "inner before", "handler", "inner after", "outer after"}
+	if got := rec.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("steps = %q, want %q", got, want)
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	rec := &recorder{}
+	done := make(chan struct{})
+	s := &Server{Handler: func(c *Conn) {
+		rec.add("handler")
+		c.WriteText("hello")
+	}}
+	// Middleware added by later Use calls runs inside earlier ones
+	s.Use(func(next Handler) Handler {
+		return func(c *Conn) {
+			next(c)
+			close(done)
+		}
+	})
+	s.Use(rec.middleware("first"))
+	s.Use(rec.middleware("second"))
+	url := serveLoopback(t, s)
+
+	client, err := Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	expectText(t, client, "hello")
+	<-done
+	want := []string{"first before", "second before", "handler", "second after", "first after"}
+	if got := rec.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("steps = %q, want %q", got, want)
+	}
+}
+
+func TestMiddlewareRejects(t *testing.T) {
+	called := make(chan struct{}, 1)
+	s := &Server{Handler: func(c *Conn) { called <- struct{}{} }}
+	s.Use(func(next Handler) Handler {
+		return func(c *Conn) {
+			if c.Request().URL.Query().Get("token") != "secret" {
+				c.CloseWithCode(ClosePolicyViolation, "unauthorized")
+				return
+			}
+			next(c)
+		}
+	})
+	url := serveLoopback(t, s)
+
+	client, err := Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.ReadMessage(); !IsCloseError(err, ClosePolicyViolation) {
+		t.Errorf("ReadMessage = %v, want close 1008", err)
+	}
+	select {
+	case <-called:
+		t.Error("handler ran for a rejected connection")
+	default:
+	}
+
+	authorized, err := Dial(url + "?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized.Close()
+	<-called
+}
+
+func TestCheckRequestRejectsBeforeUpgrade(t *testing.T) {
+	rec := &recorder{}
+	s := &Server{
+		Handler: func(c *Conn) { rec.add("handler") },
+		CheckRequest: func(r *HandshakeRequest) error {
+			return &HandshakeError{StatusCode: http.StatusUnauthorized, Reason: "no token"}
+		},
+	}
+	s.Use(rec.middleware("auth"))
+	url := serveLoopback(t, s)
+
+	_, err := Dial(url)
+	var herr *HandshakeError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Dial = %v, want a 401 handshake error", err)
+	}
+	if steps := rec.get(); len(steps) != 0 {
+		t.Errorf("rejected handshake ran %q", steps)
+	}
+}
@@ -0,0 +1,286 @@
+package ws
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+// ErrPollUnsupported reports that a connection does not expose a file
+// descriptor, such as TLS or HTTP/2 stream connections, or that the
+// platform has no readiness facility. Poller.Add reads such connections
+// with a goroutine instead.
+var ErrPollUnsupported = errors.New("ws: connection does not support event-driven polling")
+
+// ErrPollerClosed is returned by Poller.Add after Close, and passed to
+// onClose for the connections Close shuts down.
+var ErrPollerClosed = errors.New("ws: poller closed")
+
+// netpoller is the platform readiness notification facility (epoll, kqueue).
+// Registrations are one-shot: after an fd is reported ready it must be
+// re-armed before it is reported again.
+type netpoller interface {
+	add(fd int) error
+	rearm(fd int) error
+	remove(fd int) error
+	// wait blocks until at least one fd is ready or a short timeout expires
+	// and calls ready for each ready fd.
+	wait(ready func(fd int)) error
+	close() error
+}
+
+// Poller runs an event-driven read loop for many connections. Instead of a
+// goroutine blocked in ReadMessage per connection, idle connections are
+// parked in the operating system's readiness facility (epoll on Linux,
+// kqueue on BSD and macOS) and a fixed pool of workers reads and dispatches
+// messages as data arrives. On other platforms, and for connections without
+// a file descriptor, it falls back to one reading goroutine per connection.
+//
+// A worker reads a whole message once its connection becomes readable, so a
+// peer that trickles a message in slowly keeps that worker busy; combine the
+// poller with SetIdleTimeout to bound this.
+type Poller struct {
+	onMessage func(*Conn, *Message)
+	onClose   func(*Conn, error)
+
+	np   netpoller
+	jobs chan *Conn
+	done chan struct{}
+
+	mu     sync.Mutex
+	byFD   map[int]*Conn
+	fds    map[*Conn]int
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewPoller starts a poller with the given number of workers (defaulting to
+// GOMAXPROCS). onMessage is called from a worker for every message read;
+// onClose is called once when the poller closes a connection, because
+// reading from it failed or the poller was closed. Connections taken back
+// with Remove are not reported.
+func NewPoller(workers int, onMessage func(*Conn, *Message), onClose func(*Conn, error)) *Poller {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &Poller{
+		onMessage: onMessage,
+		onClose:   onClose,
+		jobs:      make(chan *Conn, workers*16),
+		done:      make(chan struct{}),
+		byFD:      make(map[int]*Conn),
+		fds:       make(map[*Conn]int),
+	}
+	if np, err := newNetpoller(); err == nil {
+		p.np = np
+		p.wg.Add(1)
+		go p.loop()
+		for i := 0; i < workers; i++ {
+			p.wg.Add(1)
+			go p.worker()
+		}
+	}
+	return p
+}
+
+// Add hands c over to the poller. The caller must not read from c afterwards.
+// A connection without a file descriptor, such as a TLS connection, is read
+// by a goroutine of its own.
+func (p *Poller) Add(c *Conn) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPollerClosed
+	}
+	fd := -1
+	if p.np != nil {
+		var err error
+		if fd, err = connFD(c.conn); err != nil && !errors.Is(err, ErrPollUnsupported) {
+			p.mu.Unlock()
+			return err
+		}
+	}
+	p.fds[c] = fd
+	if fd >= 0 {
+		p.byFD[fd] = c
+	}
+	p.mu.Unlock()
+
+	if fd < 0 {
+		go p.readLoop(c)
+		return nil
+	}
+
+	if err := p.np.add(fd); err != nil {
+		p.forget(c)
+		return err
+	}
+	return nil
+}
+
+// Remove stops polling c without closing it. A connection read by a
+// goroutine of its own is only released once the message being read has
+// arrived, which is still passed to onMessage; until then the caller must
+// not read from c.
+func (p *Poller) Remove(c *Conn) {
+	if fd, ok := p.forget(c); ok && fd >= 0 {
+		p.np.remove(fd)
+	}
+}
+
+// Len returns the number of connections registered with the poller.
+func (p *Poller) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.fds)
+}
+
+// Close stops the poller and closes the connections still registered,
+// which are reported to onClose with ErrPollerClosed. It waits for the
+// workers to finish the messages they are dispatching.
+func (p *Poller) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	conns := make([]*Conn, 0, len(p.fds))
+	for c := range p.fds {
+		conns = append(conns, c)
+	}
+	p.mu.Unlock()
+
+	close(p.done)
+	// Closing the connections also unblocks workers stuck reading a
+	// message that trickles in
+	for _, c := range conns {
+		p.drop(c, ErrPollerClosed)
+	}
+	p.wg.Wait()
+	if p.np == nil {
+		return nil
+	}
+	return p.np.close()
+}
+
+// loop waits for readiness events and queues the ready connections.
+func (p *Poller) loop() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+
+		err := p.np.wait(func(fd int) {
+			p.mu.Lock()
+			c, ok := p.byFD[fd]
+			p.mu.Unlock()
+			if ok {
+				select {
+				case p.jobs <- c:
+				case <-p.done:
+				}
+			}
+		})
+		if err != nil && !errors.Is(err, syscall.EINTR) {
+			return
+		}
+	}
+}
+
+// worker reads one message from each ready connection and re-arms it.
+func (p *Poller) worker() {
+	defer p.wg.Done()
+	for {
+		var c *Conn
+		select {
+		case c = <-p.jobs:
+		case <-p.done:
+			return
+		}
+
+		msg, err := c.ReadMessage()
+		if err != nil {
+			p.drop(c, err)
+			continue
+		}
+		p.onMessage(c, msg)
+
+		p.mu.Lock()
+		fd, ok := p.fds[c]
+		p.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if err := p.np.rearm(fd); err != nil {
+			p.drop(c, err)
+		}
+	}
+}
+
+// readLoop reads c when it cannot be polled, until it fails or is removed.
+func (p *Poller) readLoop(c *Conn) {
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			p.drop(c, err)
+			return
+		}
+		p.onMessage(c, msg)
+
+		p.mu.Lock()
+		_, ok := p.fds[c]
+		p.mu.Unlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// drop unregisters a failed connection, closes it and reports the error.
+func (p *Poller) drop(c *Conn, err error) {
+	fd, ok := p.forget(c)
+	if !ok {
+		return
+	}
+	if fd >= 0 {
+		p.np.remove(fd)
+	}
+	c.conn.Close()
+	if p.onClose != nil {
+		p.onClose(c, err)
+	}
+}
+
+func (p *Poller) forget(c *Conn) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fd, ok := p.fds[c]
+	if ok {
+		delete(p.fds, c)
+		delete(p.byFD, fd)
+	}
+	return fd, ok
+}
+
+// connFD extracts the file descriptor of a raw network connection.
+func connFD(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return -1, ErrPollUnsupported
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	fd := -1
+	if err := raw.Control(func(s uintptr) { fd = int(s) }); err != nil {
+		return -1, err
+	}
+	return fd, nil
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+package ws
+
+import "syscall"
+
+// epoll implements netpoller on Linux.
+type epoll struct {
+	fd     int
+	events []syscall.EpollEvent
+}
+
+func newNetpoller() (netpoller, error) {
+	fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return &epoll{fd: fd, events: make([]syscall.EpollEvent, 128)}, nil
+}
+
+const epollReadOneShot = syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT
+
+func (e *epoll) add(fd int) error {
+	ev := syscall.EpollEvent{Events: epollReadOneShot, Fd: int32(fd)}
+	return syscall.EpollCtl(e.fd, syscall.EPOLL_CTL_ADD, fd, &ev)
+}
+
+func (e *epoll) rearm(fd int) error {
+	ev := syscall.EpollEvent{Events: epollReadOneShot, Fd: int32(fd)}
+	return syscall.EpollCtl(e.fd, syscall.EPOLL_CTL_MOD, fd, &ev)
+}
+
+func (e *epoll) remove(fd int) error {
+	return syscall.EpollCtl(e.fd, syscall.EPOLL_CTL_DEL, fd, nil)
+}
+
+func (e *epoll) wait(ready func(fd int)) error {
+	n, err := syscall.EpollWait(e.fd, e.events, 100)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		ready(int(e.events[i].Fd))
+	}
+	return nil
+}
+
+func (e *epoll) close() error {
+	return syscall.Close(e.fd)
+}
@@ -0,0 +1,59 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package ws
+
+import "syscall"
+
+// kqueue implements netpoller on BSD systems and macOS.
+type kqueue struct {
+	fd      int
+	events  []syscall.Kevent_t
+	timeout syscall.Timespec
+}
+
+func newNetpoller() (netpoller, error) {
+	fd, err := syscall.Kqueue()
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(fd)
+	return &kqueue{
+		fd:      fd,
+		events:  make([]syscall.Kevent_t, 128),
+		timeout: syscall.NsecToTimespec(100 * 1e6),
+	}, nil
+}
+
+func (k *kqueue) ctl(fd, flags int) error {
+	var ev [1]syscall.Kevent_t
+	syscall.SetKevent(&ev[0], fd, syscall.EVFILT_READ, flags)
+	_, err := syscall.Kevent(k.fd, ev[:], nil, nil)
+	return err
+}
+
+func (k *kqueue) add(fd int) error {
+	return k.ctl(fd, syscall.EV_ADD|syscall.EV_ONESHOT)
+}
+
+func (k *kqueue) rearm(fd int) error {
+	return k.ctl(fd, syscall.EV_ADD|syscall.EV_ONESHOT)
+}
+
+func (k *kqueue) remove(fd int) error {
+	return k.ctl(fd, syscall.EV_DELETE)
+}
+
+func (k *kqueue) wait(ready func(fd int)) error {
+	n, err := syscall.Kevent(k.fd, nil, k.events, &k.timeout)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		ready(int(k.events[i].Ident))
+	}
+	return nil
+}
+
+func (k *kqueue) close() error {
+	return syscall.Close(k.fd)
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package ws
+
+// newNetpoller reports that no readiness facility is available, making the
+// Poller fall back to one reading goroutine per connection.
+func newNetpoller() (netpoller, error) {
+	return nil, ErrPollUnsupported
+}
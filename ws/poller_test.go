@@ -0,0 +1,138 @@
+package ws
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// tcpPair returns a server connection and the raw client socket at the
+// other end of a loopback TCP connection.
+func tcpPair(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return NewConn(server, true), client
+}
+
+// maskedText encodes a client text frame with a zero masking key, which
+// leaves the payload as is.
+func maskedText(payload string) []byte {
+	return append([]byte{0x80 | byte(OpText), 0x80 | byte(len(payload)), 0, 0, 0, 0}, payload...)
+}
+
+// recvPoller returns a poller that passes the payloads of the messages it
+// reads to got and the errors of the connections it closes to closed.
+func recvPoller(t *testing.T) (p *Poller, got chan string, closed chan error) {
+	t.Helper()
+	got = make(chan string, 16)
+	closed = make(chan error, 16)
+	p = NewPoller(2, func(c *Conn, msg *Message) {
+		got <- string(msg.Payload)
+	}, func(c *Conn, err error) {
+		closed <- err
+	})
+	t.Cleanup(func() { p.Close() })
+	return p, got, closed
+}
+
+func expectDelivered(t *testing.T, got chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case s := <-got:
+			if s != w {
+				t.Fatalf("got %q, want %q", s, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+func TestPollerDeliversFramesOfOneWrite(t *testing.T) {
+	p, got, _ := recvPoller(t)
+	server, client := tcpPair(t)
+	if err := p.Add(server); err != nil {
+		t.Fatal(err)
+	}
+	if p.np != nil {
+		p.mu.Lock()
+		fd := p.fds[server]
+		p.mu.Unlock()
+		if fd < 0 {
+			t.Fatal("TCP connection is read by a goroutine, not the netpoller")
+		}
+	}
+
+	// The later frames are already buffered in the socket when the first
+	// is read, so the worker must re-arm rather than wait for new data
+	var batch []byte
+	for _, s := range []string{"one", "two", "three"} {
+		batch = append(batch, maskedText(s)...)
+	}
+	if _, err := client.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	expectDelivered(t, got, "one", "two", "three")
+
+	client.Write(maskedText("four"))
+	expectDelivered(t, got, "four")
+}
+
+func TestPollerRemove(t *testing.T) {
+	p, got, _ := recvPoller(t)
+	server, client := tcpPair(t)
+	if err := p.Add(server); err != nil {
+		t.Fatal(err)
+	}
+	client.Write(maskedText("polled"))
+	expectDelivered(t, got, "polled")
+
+	p.Remove(server)
+	if p.Len() != 0 {
+		t.Fatalf("Len = %d after Remove", p.Len())
+	}
+	client.Write(maskedText("mine"))
+	expectText(t, server, "mine")
+	select {
+	case s := <-got:
+		t.Fatalf("poller delivered %q after Remove", s)
+	default:
+	}
+}
+
+func TestPollerFallsBackWithoutFD(t *testing.T) {
+	p, got, closed := recvPoller(t)
+	server, client := connPair(t)
+	if err := p.Add(server); err != nil {
+		t.Fatalf("Add of a pipe connection: %v", err)
+	}
+	client.WriteText("piped")
+	expectDelivered(t, got, "piped")
+
+	client.conn.Close()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("onClose not called after the peer went away")
+	}
+	if p.Len() != 0 {
+		t.Fatalf("Len = %d after the connection failed", p.Len())
+	}
+}
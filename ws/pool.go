@@ -0,0 +1,68 @@
+package ws
+
+import "sync"
+
+// maxPooledBufferSize caps the capacity of buffers kept in the pool so that a
+// single huge message does not pin memory for the lifetime of the process.
+const maxPooledBufferSize = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+// getBuffer returns a buffer of length n, reusing pooled storage when possible.
+func getBuffer(n int) []byte {
+	if n > maxPooledBufferSize {
+		return make([]byte, n)
+	}
+	bp := bufferPool.Get().(*[]byte)
+	if cap(*bp) < n {
+		bufferPool.Put(bp)
+		return make([]byte, n)
+	}
+	return (*bp)[:n]
+}
+
+// putBuffer hands a buffer back to the pool. Oversized buffers are dropped.
+func putBuffer(b []byte) {
+	if cap(b) == 0 || cap(b) > maxPooledBufferSize {
+		return
+	}
+	b = b[:0]
+	bufferPool.Put(&b)
+}
+
+// getScratch returns a pooled buffer of length n by pointer. Handing it
+// back with putScratch does not allocate, unlike putBuffer, which suits
+// buffers that never leave the function using them.
+func getScratch(n int) *[]byte {
+	bp := bufferPool.Get().(*[]byte)
+	if cap(*bp) < n {
+		*bp = make([]byte, n)
+	}
+	*bp = (*bp)[:n]
+	return bp
+}
+
+// putScratch hands a buffer from getScratch back to the pool.
+func putScratch(bp *[]byte) {
+	if cap(*bp) > maxPooledBufferSize {
+		return
+	}
+	*bp = (*bp)[:0]
+	bufferPool.Put(bp)
+}
+
+// appendBuffer appends src to dst. When dst has to grow, its old storage is
+// handed back to the pool.
+func appendBuffer(dst, src []byte) []byte {
+	if len(dst)+len(src) <= cap(dst) {
+		return append(dst, src...)
+	}
+	grown := append(dst[:len(dst):len(dst)], src...)
+	putBuffer(dst)
+	return grown
+}
@@ -0,0 +1,96 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// proxyFor returns the proxy to reach u through, or nil to connect
+// directly. The proxy function sees the URL with ws and wss mapped to http
+// and https, so http.ProxyFromEnvironment picks HTTP_PROXY or HTTPS_PROXY.
+func proxyFor(u *url.URL, opts *DialOptions) (*url.URL, error) {
+	proxy := opts.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	target := *u
+	target.Scheme = "http"
+	if u.Scheme == "wss" {
+		target.Scheme = "https"
+	}
+	proxyURL, err := proxy(&http.Request{Method: http.MethodGet, URL: &target, Header: opts.Header, Host: u.Host})
+	if err != nil || proxyURL == nil {
+		return nil, err
+	}
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+		return nil, fmt.Errorf("ws: unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	return proxyURL, nil
+}
+
+// hostPort returns the address of u, adding the default port of its scheme.
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "wss" || u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// proxyTLS starts TLS to an https proxy.
+func proxyTLS(ctx context.Context, conn net.Conn, proxyURL *url.URL, opts *DialOptions) (net.Conn, error) {
+	cfg := &tls.Config{}
+	if opts.TLSConfig != nil {
+		cfg = opts.TLSConfig.Clone()
+	}
+	cfg.ServerName = proxyURL.Hostname()
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// proxyConnect opens a tunnel to addr through the proxy conn is connected
+// to.
+func proxyConnect(conn net.Conn, addr string, proxyURL *url.URL) (net.Conn, error) {
+	request := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if auth := proxyAuthorization(proxyURL); auth != "" {
+		request += "Proxy-Authorization: " + auth + "\r\n"
+	}
+	if _, err := conn.Write([]byte(request + "\r\n")); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ws: proxy refused CONNECT: %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		conn = &bufferedConn{Conn: conn, r: br}
+	}
+	return conn, nil
+}
+
+// proxyAuthorization returns the Proxy-Authorization value for the
+// credentials in proxyURL, if any.
+func proxyAuthorization(proxyURL *url.URL) string {
+	if proxyURL.User == nil {
+		return ""
+	}
+	password, _ := proxyURL.User.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username()+":"+password))
+}
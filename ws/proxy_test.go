@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// startProxy runs a forwarding HTTP proxy that tunnels CONNECT requests and
+// relays absolute-form requests. Every request it receives is sent on the
+// returned channel.
+func startProxy(t *testing.T) (*url.URL, <-chan *http.Request) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	reqs := make(chan *http.Request, 4)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go proxyConn(c, reqs)
+		}
+	}()
+	return &url.URL{Scheme: "http", User: url.UserPassword("user", "secret"), Host: ln.Addr().String()}, reqs
+}
+
+func proxyConn(c net.Conn, reqs chan<- *http.Request) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return
+	}
+	reqs <- req
+	addr := req.Host
+	if req.Method != http.MethodConnect {
+		addr = req.URL.Host
+	}
+	upstream, err := net.Dial("tcp", addr)
+	if err != nil {
+		io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer upstream.Close()
+	if req.Method == http.MethodConnect {
+		io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+	} else if err := req.Write(upstream); err != nil {
+		return
+	}
+	go io.Copy(upstream, br)
+	io.Copy(c, upstream)
+}
+
+func TestDialProxyConnect(t *testing.T) {
+	s := &Server{Handler: func(c *Conn) { c.WriteText("through the tunnel") }}
+	target, pool := serveTLSLoopback(t, s)
+	proxyURL, reqs := startProxy(t)
+
+	conn, err := DialWithOptions(target, DialOptions{
+		Proxy:     http.ProxyURL(proxyURL),
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expectText(t, conn, "through the tunnel")
+
+	req := <-reqs
+	u, _ := url.Parse(target)
+	if req.Method != http.MethodConnect || req.Host != u.Host {
+		t.Errorf("proxy got %s %s, want CONNECT %s", req.Method, req.Host, u.Host)
+	}
+	if auth := req.Header.Get("Proxy-Authorization"); auth != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("Proxy-Authorization = %q", auth)
+	}
+}
+
+func TestDialProxyAbsoluteForm(t *testing.T) {
+	s := &Server{Handler: func(c *Conn) { c.WriteText(c.Request().URL.Path) }}
+	target := serveLoopback(t, s) + "chat"
+	proxyURL, reqs := startProxy(t)
+
+	conn, err := DialWithOptions(target, DialOptions{Proxy: http.ProxyURL(proxyURL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expectText(t, conn, "/chat")
+
+	req := <-reqs
+	want := "http" + target[len("ws"):]
+	if req.Method != http.MethodGet || req.RequestURI != want {
+		t.Errorf("proxy got %s %s, want GET %s", req.Method, req.RequestURI, want)
+	}
+	if req.Header.Get("Proxy-Authorization") == "" {
+		t.Error("Proxy-Authorization missing from the absolute-form request")
+	}
+}
+
+func TestDialProxyRefused(t *testing.T) {
+	proxyURL, _ := startProxy(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	_, err := DialWithOptions("wss://"+addr+"/", DialOptions{Proxy: http.ProxyURL(proxyURL)})
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("dial through a proxy that cannot reach the server = %v, want the 502", err)
+	}
+
+	// Only http and https proxies are supported
+	socks := func(*http.Request) (*url.URL, error) { return url.Parse("socks5://127.0.0.1:1080") }
+	if _, err := DialWithOptions("ws://"+addr+"/", DialOptions{Proxy: socks}); err == nil {
+		t.Error("dial through a socks5 proxy succeeded")
+	}
+}
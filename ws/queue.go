@@ -0,0 +1,248 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// BackpressurePolicy decides what Send does when a connection's outbound
+// queue is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock waits for room in the queue, up to SendTimeout.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest discards the oldest queued message to make room.
+	BackpressureDropOldest
+	// BackpressureDropNewest discards the message being sent.
+	BackpressureDropNewest
+	// BackpressureClose closes the connection with status 1008 (policy
+	// violation). The writer goroutine sends the close frame once the write
+	// in progress is done, so set WriteTimeout to bound how long a stalled
+	// peer can hold it up.
+	BackpressureClose
+)
+
+const defaultQueueSize = 64
+
+var (
+	// ErrQueueFull is returned by Send when a message could not be queued.
+	ErrQueueFull = errors.New("ws: outbound queue full")
+	// ErrQueueDisabled is returned by Send when EnableSendQueue was not called.
+	ErrQueueDisabled = errors.New("ws: send queue not enabled")
+	// ErrQueueClosed is returned by Send after the queue has been shut down.
+	ErrQueueClosed = errors.New("ws: send queue closed")
+)
+
+// QueueOptions configures the outbound queue of a connection.
+type QueueOptions struct {
+	// Size is the number of messages the queue can hold. Defaults to 64.
+	Size int
+	// Policy is applied when the queue is full.
+	Policy BackpressurePolicy
+	// SendTimeout bounds how long BackpressureBlock waits. Zero waits forever.
+	SendTimeout time.Duration
+	// WriteTimeout bounds each write of a queued message to the peer. A
+	// peer that does not keep up fails the write, which shuts the queue
+	// down and closes the connection. Zero waits forever.
+	WriteTimeout time.Duration
+}
+
+type outbound struct {
+	opcode  OpCode
+	payload []byte
+}
+
+// sendQueue decouples producers from the socket: a single goroutine drains
+// the channel and performs the actual writes.
+type sendQueue struct {
+	opts QueueOptions
+	ch   chan outbound
+	done chan struct{}
+	full chan struct{} // closed when BackpressureClose overflows
+
+	once     sync.Once
+	fullOnce sync.Once
+	mu       sync.Mutex
+	err      error
+}
+
+// EnableSendQueue starts a writer goroutine for the connection. Afterwards
+// Send can be used to queue messages without blocking on a slow peer.
+// Calling it more than once has no effect.
+func (c *Conn) EnableSendQueue(opts QueueOptions) {
+	if opts.Size <= 0 {
+		opts.Size = defaultQueueSize
+	}
+	q := &sendQueue{
+		opts: opts,
+		ch:   make(chan outbound, opts.Size),
+		done: make(chan struct{}),
+		full: make(chan struct{}),
+	}
+	if !c.queue.CompareAndSwap(nil, q) {
+		return
+	}
+	go c.writeLoop(q)
+}
+
+// Send queues a message for asynchronous delivery. The payload is not copied
+// and must not be modified after Send returns.
+func (c *Conn) Send(opcode OpCode, payload []byte) error {
+	q := c.queue.Load()
+	if q == nil {
+		return ErrQueueDisabled
+	}
+	if err := q.failure(); err != nil {
+		return err
+	}
+
+	m := outbound{opcode: opcode, payload: payload}
+	select {
+	case q.ch <- m:
+		return nil
+	case <-q.done:
+		return ErrQueueClosed
+	default:
+	}
+
+	switch q.opts.Policy {
+	case BackpressureDropNewest:
+		return ErrQueueFull
+	case BackpressureDropOldest:
+		for {
+			select {
+			case q.ch <- m:
+				return nil
+			case <-q.done:
+				return ErrQueueClosed
+			default:
+			}
+			select {
+			case <-q.ch:
+			default:
+			}
+		}
+	case BackpressureClose:
+		q.overflow()
+		return ErrQueueFull
+	default:
+		var timeout <-chan time.Time
+		if q.opts.SendTimeout > 0 {
+			t := time.NewTimer(q.opts.SendTimeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case q.ch <- m:
+			return nil
+		case <-q.done:
+			return ErrQueueClosed
+		case <-timeout:
+			return ErrQueueFull
+		}
+	}
+}
+
+// SendText queues a text message, see Send.
+func (c *Conn) SendText(message string) error {
+	return c.Send(OpText, []byte(message))
+}
+
+// SendBinary queues a binary message, see Send.
+func (c *Conn) SendBinary(data []byte) error {
+	return c.Send(OpBinary, data)
+}
+
+// QueueLen reports the number of messages waiting in the outbound queue.
+func (c *Conn) QueueLen() int {
+	q := c.queue.Load()
+	if q == nil {
+		return 0
+	}
+	return len(q.ch)
+}
+
+// writeLoop drains the queue until it is stopped or a write fails.
+func (c *Conn) writeLoop(q *sendQueue) {
+	for {
+		// An overflow takes precedence over the messages still queued
+		select {
+		case <-q.full:
+			c.closeOverflowed(q)
+			return
+		default:
+		}
+		select {
+		case <-q.full:
+			c.closeOverflowed(q)
+			return
+		case m := <-q.ch:
+			if err := c.writeQueued(m, q.opts.WriteTimeout); err != nil {
+				q.stop(err)
+				if q.opts.WriteTimeout > 0 {
+					// A timed-out frame may be cut short, so the stream
+					// cannot be continued
+					c.conn.Close()
+				}
+				return
+			}
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// closeOverflowed shuts the queue down and closes the connection with
+// status 1008. It runs on the writer goroutine, so the close frame follows
+// the message in flight instead of cutting it short.
+func (c *Conn) closeOverflowed(q *sendQueue) {
+	q.stop(ErrQueueFull)
+	c.stopKeepAlive()
+	c.writeQueued(outbound{opcode: OpClose, payload: closePayload(ClosePolicyViolation, "send queue full")}, q.opts.WriteTimeout)
+	c.conn.Close()
+}
+
+// writeQueued writes a queued message. The timeout applies to this write
+// only, so it neither cuts short nor outlives the writes of other goroutines.
+func (c *Conn) writeQueued(m outbound, timeout time.Duration) error {
+	if m.opcode < OpClose {
+		c.msgMu.Lock()
+		defer c.msgMu.Unlock()
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(timeout))
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	return c.writeMessage(m.opcode, m.payload)
+}
+
+// stop shuts the queue down, recording the reason for later Send calls.
+func (q *sendQueue) stop(err error) {
+	q.once.Do(func() {
+		q.mu.Lock()
+		q.err = err
+		q.mu.Unlock()
+		close(q.done)
+	})
+}
+
+// overflow records that the queue ran full under BackpressureClose and
+// asks the writer goroutine to close the connection.
+func (q *sendQueue) overflow() {
+	q.mu.Lock()
+	if q.err == nil {
+		q.err = ErrQueueFull
+	}
+	q.mu.Unlock()
+	q.fullOnce.Do(func() { close(q.full) })
+}
+
+func (q *sendQueue) failure() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
@@ -0,0 +1,367 @@
+package ws
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ConnState describes the state of a ReconnectingConn.
+type ConnState int
+
+const (
+	StateConnecting ConnState = iota
+	StateConnected
+	StateDisconnected
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+var (
+	// ErrNotConnected is returned by writes while the connection is down.
+	ErrNotConnected = errors.New("ws: not connected")
+	// ErrReconnectClosed is returned once a ReconnectingConn has been
+	// closed, has given up after MaxAttempts or was closed normally by the
+	// server.
+	ErrReconnectClosed = errors.New("ws: reconnecting connection closed")
+)
+
+// ReconnectOptions configures a ReconnectingConn.
+type ReconnectOptions struct {
+	// MinBackoff is the delay before the first retry. Defaults to 500ms.
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between retries. Defaults to 30s.
+	MaxBackoff time.Duration
+	// Factor multiplies the delay after every failed attempt. Defaults to 2.
+	Factor float64
+	// Jitter randomizes each delay by up to this fraction (0 to 1). Defaults to 0.2.
+	Jitter float64
+	// MaxAttempts stops reconnecting after this many consecutive failures.
+	// Zero retries forever.
+	MaxAttempts int
+	// ReconnectOnNormalClose keeps reconnecting after the server closes the
+	// connection with CloseNormalClosure. By default such a close is taken
+	// as the server being done with the client, and the ReconnectingConn
+	// closes too.
+	ReconnectOnNormalClose bool
+
+	// DialOptions are used for every dial, so headers, cookies and
+	// subprotocols are replayed on each reconnect.
+	DialOptions DialOptions
+	// Dial opens the underlying connection. Defaults to DialWithOptions
+	// with DialOptions.
+	Dial func(url string) (*Conn, error)
+
+	// BufferSize is the number of messages WriteMessage holds while the
+	// connection is down. They are sent in order after the next successful
+	// connect, following OnConnect. Writes beyond it fail with
+	// ErrQueueFull. Zero makes writes fail with ErrNotConnected instead.
+	BufferSize int
+	// OnConnect runs after every successful dial, before the connection is
+	// handed to readers and writers. Use it to replay hello or subscription
+	// messages. Returning an error drops the connection and retries.
+	OnConnect func(*Conn) error
+	// OnStateChange is notified of every state transition. err carries the
+	// reason for disconnections, and for closes that were not requested
+	// with Close.
+	OnStateChange func(state ConnState, err error)
+}
+
+// ReconnectingConn is a client connection that transparently re-dials the
+// server with exponential backoff and jitter whenever the connection fails,
+// until the server closes it normally.
+type ReconnectingConn struct {
+	url  string
+	opts ReconnectOptions
+
+	mu      sync.Mutex
+	conn    *Conn
+	state   ConnState
+	pending []outbound // writes held while disconnected
+
+	msgs   chan *Message
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewReconnectingConn starts connecting to url in the background and keeps
+// the connection alive until Close is called.
+func NewReconnectingConn(url string, opts ReconnectOptions) *ReconnectingConn {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.Factor < 1 {
+		opts.Factor = 2
+	}
+	if opts.Jitter <= 0 || opts.Jitter > 1 {
+		opts.Jitter = 0.2
+	}
+	if opts.Dial == nil {
+		dialOpts := opts.DialOptions
+		opts.Dial = func(url string) (*Conn, error) {
+			return DialWithOptions(url, dialOpts)
+		}
+	}
+	rc := &ReconnectingConn{
+		url:    url,
+		opts:   opts,
+		msgs:   make(chan *Message),
+		closed: make(chan struct{}),
+	}
+	go rc.run()
+	return rc
+}
+
+// State returns the current connection state.
+func (rc *ReconnectingConn) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+// ReadMessage returns the next message, waiting across reconnects.
+func (rc *ReconnectingConn) ReadMessage() (*Message, error) {
+	select {
+	case msg := <-rc.msgs:
+		return msg, nil
+	case <-rc.closed:
+		return nil, ErrReconnectClosed
+	}
+}
+
+// WriteMessage writes to the current connection. While a reconnect is in
+// progress the message is buffered, up to BufferSize, or the write fails
+// with ErrNotConnected.
+func (rc *ReconnectingConn) WriteMessage(opcode OpCode, payload []byte) error {
+	rc.mu.Lock()
+	conn, state := rc.conn, rc.state
+	if state == StateClosed {
+		rc.mu.Unlock()
+		return ErrReconnectClosed
+	}
+	if conn == nil {
+		defer rc.mu.Unlock()
+		if rc.opts.BufferSize == 0 {
+			return ErrNotConnected
+		}
+		if len(rc.pending) >= rc.opts.BufferSize {
+			return ErrQueueFull
+		}
+		rc.pending = append(rc.pending, outbound{opcode: opcode, payload: slices.Clone(payload)})
+		return nil
+	}
+	rc.mu.Unlock()
+	return conn.WriteMessage(opcode, payload)
+}
+
+// WriteText writes a text message to the current connection.
+func (rc *ReconnectingConn) WriteText(message string) error {
+	return rc.WriteMessage(OpText, []byte(message))
+}
+
+// WriteBinary writes a binary message to the current connection.
+func (rc *ReconnectingConn) WriteBinary(data []byte) error {
+	return rc.WriteMessage(OpBinary, data)
+}
+
+// Close stops reconnecting and closes the current connection.
+func (rc *ReconnectingConn) Close() error {
+	return rc.shutdown(nil)
+}
+
+// shutdown closes rc, reporting reason with the StateClosed transition.
+func (rc *ReconnectingConn) shutdown(reason error) error {
+	var err error
+	rc.once.Do(func() {
+		close(rc.closed)
+		rc.mu.Lock()
+		conn := rc.conn
+		rc.conn = nil
+		rc.mu.Unlock()
+		if conn != nil {
+			err = conn.Close()
+		}
+		rc.setState(StateClosed, reason)
+	})
+	return err
+}
+
+// run owns the dial/read cycle until the connection is closed.
+func (rc *ReconnectingConn) run() {
+	failures := 0
+	for {
+		rc.setState(StateConnecting, nil)
+		conn, err := rc.connect()
+		if err != nil {
+			failures++
+			rc.setState(StateDisconnected, err)
+			if rc.opts.MaxAttempts > 0 && failures >= rc.opts.MaxAttempts {
+				rc.shutdown(err)
+				return
+			}
+			if !rc.sleep(rc.backoff(failures)) {
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		err = rc.flush(conn)
+		if errors.Is(err, ErrReconnectClosed) {
+			conn.Close()
+			return
+		}
+		if err == nil {
+			rc.setState(StateConnected, nil)
+			err = rc.pump(conn)
+		}
+
+		rc.mu.Lock()
+		rc.conn = nil
+		rc.mu.Unlock()
+		conn.Close()
+		if rc.isClosed() {
+			return
+		}
+		if IsCloseError(err, CloseNormalClosure) && !rc.opts.ReconnectOnNormalClose {
+			rc.shutdown(err)
+			return
+		}
+		rc.setState(StateDisconnected, err)
+		if !rc.sleep(rc.backoff(1)) {
+			return
+		}
+	}
+}
+
+// connect dials and runs the OnConnect hook.
+func (rc *ReconnectingConn) connect() (*Conn, error) {
+	conn, err := rc.opts.Dial(rc.url)
+	if err != nil {
+		return nil, err
+	}
+	if rc.opts.OnConnect != nil {
+		if err := rc.opts.OnConnect(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// flush sends the writes buffered while disconnected, then makes conn the
+// current connection. Writes made meanwhile are buffered behind the ones
+// being sent, which happens without holding rc.mu so that a slow server
+// does not block WriteMessage and State. Messages that could not be sent
+// stay buffered for the next connection.
+func (rc *ReconnectingConn) flush(conn *Conn) error {
+	for {
+		rc.mu.Lock()
+		if rc.isClosed() {
+			rc.mu.Unlock()
+			return ErrReconnectClosed
+		}
+		pending := rc.pending
+		rc.pending = nil
+		if len(pending) == 0 {
+			rc.conn = conn
+			rc.mu.Unlock()
+			return nil
+		}
+		rc.mu.Unlock()
+
+		for i, m := range pending {
+			if err := conn.WriteMessage(m.opcode, m.payload); err != nil {
+				rc.mu.Lock()
+				rc.pending = append(pending[i:], rc.pending...)
+				rc.mu.Unlock()
+				return err
+			}
+		}
+	}
+}
+
+// pump forwards data messages from conn to readers until the connection
+// fails. Pings are answered by the connection's ping handler, and pongs
+// are not passed on.
+func (rc *ReconnectingConn) pump(conn *Conn) error {
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if msg.OpCode == OpPong {
+			continue
+		}
+		select {
+		case rc.msgs <- msg:
+		case <-rc.closed:
+			return ErrReconnectClosed
+		}
+	}
+}
+
+// backoff returns the jittered delay before the given retry attempt.
+func (rc *ReconnectingConn) backoff(attempt int) time.Duration {
+	d := float64(rc.opts.MinBackoff)
+	for i := 1; i < attempt && d < float64(rc.opts.MaxBackoff); i++ {
+		d *= rc.opts.Factor
+	}
+	if d > float64(rc.opts.MaxBackoff) {
+		d = float64(rc.opts.MaxBackoff)
+	}
+	d += d * rc.opts.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(d)
+}
+
+// sleep waits for d, returning false if the connection was closed meanwhile.
+func (rc *ReconnectingConn) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-rc.closed:
+		return false
+	}
+}
+
+func (rc *ReconnectingConn) setState(state ConnState, err error) {
+	rc.mu.Lock()
+	if rc.state == StateClosed {
+		rc.mu.Unlock()
+		return
+	}
+	rc.state = state
+	rc.mu.Unlock()
+	if rc.opts.OnStateChange != nil {
+		rc.opts.OnStateChange(state, err)
+	}
+}
+
+func (rc *ReconnectingConn) isClosed() bool {
+	select {
+	case <-rc.closed:
+		return true
+	default:
+		return false
+	}
+}
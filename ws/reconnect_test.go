@@ -0,0 +1,238 @@
+package ws
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stateRecorder collects the transitions reported to OnStateChange.
+type stateRecorder chan ConnState
+
+func (r stateRecorder) record(state ConnState, err error) { r <- state }
+
+func (r stateRecorder) expect(t *testing.T, want ...ConnState) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-r:
+			if got != w {
+				t.Fatalf("state = %v, want %v", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no transition to %v", w)
+		}
+	}
+}
+
+func readString(t *testing.T, rc *ReconnectingConn) string {
+	t.Helper()
+	msg, err := rc.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(msg.Payload)
+}
+
+func TestReconnectingConnReconnects(t *testing.T) {
+	var dials atomic.Int32
+	s := &Server{Handler: func(c *Conn) {
+		n := dials.Add(1)
+		// OnConnect runs on every connection
+		if msg, err := c.ReadMessage(); err != nil || string(msg.Payload) != "hello" {
+			t.Errorf("first message = %v, %v, want hello", msg, err)
+			return
+		}
+		if n == 1 {
+			c.WriteText("first")
+			c.CloseWithCode(CloseGoingAway, "restarting")
+			return
+		}
+		c.WriteText("second")
+		c.ReadMessage()
+	}}
+	url := serveLoopback(t, s)
+
+	states := make(stateRecorder, 16)
+	rc := NewReconnectingConn(url, ReconnectOptions{
+		MinBackoff:    10 * time.Millisecond,
+		OnConnect:     func(c *Conn) error { return c.WriteText("hello") },
+		OnStateChange: states.record,
+	})
+	defer rc.Close()
+
+	if got := readString(t, rc); got != "first" {
+		t.Errorf("got %q, want first", got)
+	}
+	if got := readString(t, rc); got != "second" {
+		t.Errorf("got %q, want second", got)
+	}
+	states.expect(t, StateConnecting, StateConnected, StateDisconnected, StateConnecting, StateConnected)
+
+	rc.Close()
+	states.expect(t, StateClosed)
+	if _, err := rc.ReadMessage(); !errors.Is(err, ErrReconnectClosed) {
+		t.Errorf("ReadMessage after Close = %v", err)
+	}
+}
+
+func TestReconnectingConnNormalClose(t *testing.T) {
+	for _, reconnect := range []bool{false, true} {
+		var dials atomic.Int32
+		s := &Server{Handler: func(c *Conn) {
+			dials.Add(1)
+			c.CloseWithCode(CloseNormalClosure, "bye")
+		}}
+		url := serveLoopback(t, s)
+
+		var reason atomic.Value
+		rc := NewReconnectingConn(url, ReconnectOptions{
+			MinBackoff:             10 * time.Millisecond,
+			ReconnectOnNormalClose: reconnect,
+			OnStateChange: func(state ConnState, err error) {
+				if state == StateClosed && err != nil {
+					reason.Store(err)
+				}
+			},
+		})
+
+		if !reconnect {
+			if _, err := rc.ReadMessage(); !errors.Is(err, ErrReconnectClosed) {
+				t.Errorf("ReadMessage = %v, want ErrReconnectClosed", err)
+			}
+			err, _ := reason.Load().(error)
+			if !IsCloseError(err, CloseNormalClosure) {
+				t.Errorf("close reason = %v, want close 1000", err)
+			}
+			if n := dials.Load(); n != 1 {
+				t.Errorf("dialed %d times after a normal closure, want 1", n)
+			}
+			continue
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for dials.Load() < 3 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if n := dials.Load(); n < 3 {
+			t.Errorf("dialed %d times with ReconnectOnNormalClose, want reconnects", n)
+		}
+		if rc.State() == StateClosed {
+			t.Error("closed with ReconnectOnNormalClose")
+		}
+		rc.Close()
+	}
+}
+
+func TestReconnectingConnMaxAttempts(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	url := "ws://" + ln.Addr().String() + "/"
+	ln.Close()
+
+	closed := make(chan error, 1)
+	rc := NewReconnectingConn(url, ReconnectOptions{
+		MinBackoff:  time.Millisecond,
+		MaxAttempts: 3,
+		OnStateChange: func(state ConnState, err error) {
+			if state == StateClosed {
+				closed <- err
+			}
+		},
+	})
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Error("gave up without a reason")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("still reconnecting after MaxAttempts")
+	}
+	if err := rc.WriteText("x"); !errors.Is(err, ErrReconnectClosed) {
+		t.Errorf("WriteText = %v, want ErrReconnectClosed", err)
+	}
+}
+
+func TestReconnectingConnBuffer(t *testing.T) {
+	received := make(chan string, 4)
+	s := &Server{Handler: func(c *Conn) {
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(msg.Payload)
+		}
+	}}
+	url := serveLoopback(t, s)
+
+	release := make(chan struct{})
+	rc := NewReconnectingConn(url, ReconnectOptions{
+		BufferSize: 2,
+		Dial: func(url string) (*Conn, error) {
+			<-release
+			return Dial(url)
+		},
+	})
+	defer rc.Close()
+
+	// Writes are held while connecting, up to BufferSize
+	rc.WriteText("a")
+	rc.WriteText("b")
+	if err := rc.WriteText("c"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("write beyond BufferSize = %v, want ErrQueueFull", err)
+	}
+	close(release)
+	for _, want := range []string{"a", "b"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("server got %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("buffered %q not sent after connecting", want)
+		}
+	}
+
+	unbuffered := NewReconnectingConn(url, ReconnectOptions{
+		Dial: func(string) (*Conn, error) { return nil, errors.New("down") },
+	})
+	defer unbuffered.Close()
+	if err := unbuffered.WriteText("x"); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("write without a buffer = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestReconnectingConnReplaysDialOptions(t *testing.T) {
+	type handshake struct{ token, protocol string }
+	seen := make(chan handshake, 2)
+	var dials atomic.Int32
+	s := &Server{Subprotocols: []string{"v1"}, Handler: func(c *Conn) {
+		seen <- handshake{c.Request().Header.Get("X-Token"), c.Subprotocol()}
+		if dials.Add(1) == 1 {
+			c.CloseWithCode(CloseGoingAway, "restarting")
+			return
+		}
+		c.ReadMessage()
+	}}
+	url := serveLoopback(t, s)
+
+	states := make(stateRecorder, 16)
+	rc := NewReconnectingConn(url, ReconnectOptions{
+		MinBackoff: 10 * time.Millisecond,
+		DialOptions: DialOptions{
+			Header:       http.Header{"X-Token": {"secret"}},
+			Subprotocols: []string{"v1"},
+		},
+		OnStateChange: states.record,
+	})
+	defer rc.Close()
+	states.expect(t, StateConnecting, StateConnected, StateDisconnected, StateConnecting, StateConnected)
+
+	for i := 0; i < 2; i++ {
+		if h := <-seen; h != (handshake{"secret", "v1"}) {
+			t.Errorf("handshake %d = %+v, want the dial options replayed", i+1, h)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package ws
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/edgflow/lux/internal/sockopt"
+)
+
+const defaultHandshakeTimeout = 10 * time.Second
+
+// rejectTimeout bounds the 503 answer to connections over MaxConns
+const rejectTimeout = 2 * time.Second
+
+// ErrServerClosed is returned by the Serve methods after a call to Close.
+var ErrServerClosed = errors.New("ws: server closed")
+
+// Server represents a WebSocket server
+type Server struct {
+	Addr string
+
+	// Handler serves each accepted connection, which is closed when it
+	// returns
+	Handler Handler
+
+	TLSConfig *tls.Config // Added TLS config
+
+	// Strict has no effect; every connection is validated fully.
+	//
+	// Deprecated: see Conn.SetStrict.
+	Strict bool
+
+	// MaxConns limits the number of simultaneously open connections.
+	// Connections beyond the limit are refused with 503. Zero means no limit.
+	MaxConns int
+
+	// HandshakeTimeout bounds how long a client may take to complete the
+	// opening handshake. Defaults to 10 seconds; a negative value disables it.
+	HandshakeTimeout time.Duration
+
+	// IdleTimeout closes connections that send no frame (data, ping or pong)
+	// for this long. Zero disables idle detection.
+	IdleTimeout time.Duration
+
+	// MaxFrameSize is applied to every accepted connection, see Conn.SetMaxFrameSize
+	MaxFrameSize int
+
+	// ReadLimit is applied to every accepted connection, see
+	// Conn.SetReadLimit. Defaults to DefaultReadLimit; a negative value
+	// means no limit.
+	ReadLimit int64
+
+	// PingInterval and PongTimeout enable keep-alive pings on every
+	// accepted connection, see Conn.SetKeepAlive
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+
+	// Extensions are negotiated with clients that offer them, in the
+	// client's order of preference
+	Extensions []Extension
+
+	// Subprotocols lists the subprotocols the server speaks. The first one
+	// requested by the client is selected, see Conn.Subprotocol. A client
+	// requesting none of them is served without a subprotocol.
+	Subprotocols []string
+
+	// CheckOrigin decides whether to accept a handshake given its Origin
+	// header; rejected clients get 403. Defaults to SameOrigin; set
+	// AllowAnyOrigin to let pages on other sites connect.
+	CheckOrigin func(r *HandshakeRequest) bool
+
+	// CheckRequest runs after CheckOrigin and can reject the handshake,
+	// for instance to authenticate the client from its headers or query.
+	// Returning a *HandshakeError rejects it with that status code; any
+	// other error rejects it with 403.
+	CheckRequest func(r *HandshakeRequest) error
+
+	// SocketOptions are applied to every accepted connection. Connections
+	// whose options cannot be set are closed before the handshake.
+	SocketOptions SocketOptions
+
+	// OnOpen, OnMessage, OnClose and OnError serve connections when Handler
+	// is nil, with the server owning the read loop: pings are answered,
+	// pongs consumed and the closing handshake completed. OnMessage is
+	// called for every data message, one at a time per connection.
+	// OnClose is called once a connection ends, with the close code and
+	// reason received from the peer, the code sent to the peer when the
+	// server failed the connection, such as 1009 for an oversized message
+	// or 1002 for a protocol error, or 1006 (abnormal closure) when it went
+	// away without a close frame. OnError precedes it for failures other
+	// than a closed connection, such as an idle timeout or those that made
+	// the server send a close code. Any callback may be nil.
+	OnOpen    func(c *Conn)
+	OnMessage func(c *Conn, msg *Message)
+	OnClose   func(c *Conn, code uint16, reason string)
+	OnError   func(c *Conn, err error)
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*Conn]struct{}
+	pending   int // accepted sockets still in the handshake
+	closed    bool
+	monitor   *LivenessMonitor
+
+	middleware []Middleware
+}
+
+// SocketOptions tunes the TCP sockets accepted by the server. The zero value
+// keeps Go's defaults: keep-alive probes every 15 seconds and TCP_NODELAY set.
+// It is the same type as lux.SocketOptions.
+type SocketOptions = sockopt.Options
+
+// NewServer creates a new WebSocket server
+func NewServer(addr string, handler func(*Conn)) *Server {
+	return &Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+}
+
+// NewTLSServer creates a new WebSocket server with TLS support
+func NewTLSServer(addr string, handler func(*Conn), tlsConfig *tls.Config) *Server {
+	return &Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+}
+
+// ListenAndServe starts the WebSocket server
+func (s *Server) ListenAndServe() error {
+	var listener net.Listener
+	var err error
+
+	if s.TLSConfig != nil {
+		// Create TLS listener if TLS config is provided
+		listener, err = tls.Listen("tcp", s.Addr, s.TLSConfig)
+	} else {
+		// Create regular TCP listener
+		listener, err = net.Listen("tcp", s.Addr)
+	}
+
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// ListenAndServeTLS starts the WebSocket server with TLS
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	// Keep the rest of the configured TLS setup (ALPN, client auth, SNI)
+	tlsConfig := &tls.Config{}
+	if s.TLSConfig != nil {
+		tlsConfig = s.TLSConfig.Clone()
+	}
+	tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+
+	listener, err := tls.Listen("tcp", s.Addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on l and runs the handler for each of them.
+// Accept errors that clear up by themselves, such as running out of file
+// descriptors, are retried with exponential backoff; any other error stops
+// the loop and is returned.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+	defer l.Close()
+
+	var tempDelay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			if retryableAcceptError(err) {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if tempDelay > time.Second {
+					tempDelay = time.Second
+				}
+				time.Sleep(tempDelay)
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+
+		if !s.reserve() {
+			go rejectOverloaded(conn)
+			continue
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+// retryableAcceptError reports whether Accept failed for a reason that
+// doesn't concern the listener itself: exhausted file descriptors or
+// buffers, or a connection reset before it could be accepted.
+func retryableAcceptError(err error) bool {
+	for _, errno := range []syscall.Errno{
+		syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM,
+		syscall.ECONNABORTED, syscall.ECONNRESET, syscall.EINTR,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectOverloaded answers 503 to a connection over the server's limit. It
+// runs apart from the accept loop, as on TLS listeners the write performs
+// the handshake, and a short deadline keeps slow clients from holding it.
+func rejectOverloaded(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(rejectTimeout))
+	conn.Write([]byte("HTTP/1.1 503 Service Unavailable\r\nConnection: close\r\nContent-Length: 0\r\n\r\n"))
+	conn.Close()
+}
+
+// handleConnection handles the WebSocket handshake and passes the connection to the handler
+func (s *Server) handleConnection(conn net.Conn) {
+	if !s.SocketOptions.IsZero() {
+		// The options only fail to apply on a socket that is already
+		// broken, which would not survive the handshake either
+		if err := sockopt.Apply(conn, s.SocketOptions); err != nil {
+			s.release(nil)
+			conn.Close()
+			return
+		}
+	}
+
+	timeout := s.HandshakeTimeout
+	if timeout == 0 {
+		timeout = defaultHandshakeTimeout
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	// Complete the TLS handshake up front so failures such as a missing
+	// client certificate are not mistaken for a bad upgrade request
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			s.release(nil)
+			conn.Close()
+			return
+		}
+	}
+
+	wsConn, err := upgrade(conn, s.upgradeOptions())
+	if err != nil {
+		s.release(nil)
+		conn.Close()
+		return
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Time{})
+	}
+	s.configure(wsConn)
+
+	if !s.activate(wsConn) {
+		wsConn.CloseWithCode(CloseGoingAway, "server shutting down")
+		return
+	}
+	defer s.release(wsConn)
+	defer wsConn.Close()
+	s.handler()(wsConn)
+}
+
+// upgradeOptions returns what the server negotiates and checks in the
+// opening handshake.
+func (s *Server) upgradeOptions() upgradeOptions {
+	return upgradeOptions{
+		extensions:   s.Extensions,
+		subprotocols: s.Subprotocols,
+		checkOrigin:  s.CheckOrigin,
+		checkRequest: s.CheckRequest,
+	}
+}
+
+// configure applies the server's per-connection settings to c.
+func (s *Server) configure(c *Conn) {
+	c.SetMaxFrameSize(s.MaxFrameSize)
+	switch {
+	case s.ReadLimit > 0:
+		c.SetReadLimit(s.ReadLimit)
+	case s.ReadLimit < 0:
+		c.SetReadLimit(0)
+	}
+	if s.PingInterval > 0 {
+		c.SetKeepAlive(s.PingInterval, s.PongTimeout)
+	}
+}
+
+// ConnCount returns the number of open connections, including those still
+// in the opening handshake.
+func (s *Server) ConnCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns) + s.pending
+}
+
+// Conns returns a snapshot of the currently open connections.
+func (s *Server) Conns() []*Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// Close stops all listeners and closes every tracked connection.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.monitor != nil {
+		s.monitor.Stop()
+	}
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.CloseWithCode(CloseGoingAway, "server shutting down")
+	}
+	return err
+}
+
+// reserve claims a connection slot, honouring MaxConns.
+func (s *Server) reserve() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxConns > 0 && len(s.conns)+s.pending >= s.MaxConns {
+		return false
+	}
+	s.pending++
+	return true
+}
+
+// activate moves a reserved slot into the registry once the handshake is
+// done. It frees the slot and returns false if the server was closed in the
+// meantime, as Close has already gone through the registry.
+func (s *Server) activate(c *Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending--
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*Conn]struct{})
+	}
+	s.conns[c] = struct{}{}
+
+	if s.IdleTimeout > 0 {
+		c.SetIdleTimeout(s.IdleTimeout)
+		if s.monitor == nil {
+			s.monitor = NewLivenessMonitor(s.IdleTimeout)
+		}
+		s.monitor.Add(c)
+	}
+	return true
+}
+
+// release frees the slot held by c, or a pending slot when c is nil.
+func (s *Server) release(c *Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c == nil {
+		s.pending--
+		return
+	}
+	delete(s.conns, c)
+	if s.monitor != nil {
+		s.monitor.Remove(c)
+	}
+}
+
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.closed {
+			return false
+		}
+		if s.listeners == nil {
+			s.listeners = make(map[net.Listener]struct{})
+		}
+		s.listeners[l] = struct{}{}
+	} else {
+		delete(s.listeners, l)
+	}
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// serveLoopback runs s on a loopback listener and returns its ws:// URL.
+func serveLoopback(t *testing.T, s *Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return "ws://" + ln.Addr().String() + "/"
+}
+
+func TestServerCloseDuringHandshake(t *testing.T) {
+	called := make(chan struct{}, 1)
+	s := &Server{Handler: func(c *Conn) { called <- struct{}{} }}
+	url := serveLoopback(t, s)
+
+	raw, err := net.Dial("tcp", url[len("ws://"):len(url)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	raw.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Close the server while the connection waits for its handshake
+	for s.ConnCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Close()
+
+	fmt.Fprintf(raw, "GET / HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", raw.RemoteAddr())
+	br := bufio.NewReader(raw)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d", resp.StatusCode)
+	}
+
+	client := NewConn(&bufferedConn{Conn: raw, r: br}, false)
+	if _, err := client.ReadMessage(); !IsCloseError(err, CloseGoingAway) {
+		t.Errorf("ReadMessage = %v, want close 1001", err)
+	}
+	select {
+	case <-called:
+		t.Error("handler ran on a connection accepted after Close")
+	default:
+	}
+	if n := s.ConnCount(); n != 0 {
+		t.Errorf("ConnCount = %d, want 0", n)
+	}
+}
+
+func TestRetryableAcceptError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "accept", Err: os.NewSyscallError("accept", syscall.EMFILE)}, true},
+		{&net.OpError{Op: "accept", Err: os.NewSyscallError("accept", syscall.ECONNABORTED)}, true},
+		{&net.OpError{Op: "accept", Err: os.NewSyscallError("accept", syscall.EBADF)}, false},
+		{net.ErrClosed, false},
+	}
+	for _, tt := range tests {
+		if got := retryableAcceptError(tt.err); got != tt.want {
+			t.Errorf("retryableAcceptError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
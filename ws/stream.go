@@ -0,0 +1,303 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// streamFrameSize is the frame size of messages written with NextWriter on
+// connections without a max frame size.
+const streamFrameSize = 4096
+
+var errStaleReader = errors.New("ws: message reader used after the next one was requested")
+
+// NextWriter returns a writer for a new data message of type opcode, so
+// large messages can be sent without holding them in memory: the data is
+// sent in frames of the connection's max frame size, or 4 KB, as it is
+// written, and Close sends the final frame. Control frames, such as pings,
+// may go out between the fragments, but other data messages, including
+// those of the send queue, wait until the writer is closed. The writer must
+// therefore always be closed, and the goroutine holding it must not write
+// other data messages meanwhile.
+//
+// When an extension such as permessage-deflate was negotiated, the message
+// is encoded as a whole and sent on Close.
+func (c *Conn) NextWriter(opcode OpCode) (io.WriteCloser, error) {
+	if opcode != OpText && opcode != OpBinary {
+		return nil, fmt.Errorf("ws: NextWriter needs a data opcode, not %#x", byte(opcode))
+	}
+	c.msgMu.Lock()
+	c.writeMu.Lock()
+	closed, size := c.closeSent, c.maxFrameSize
+	c.writeMu.Unlock()
+	if closed {
+		c.msgMu.Unlock()
+		return nil, fmt.Errorf("connection closed")
+	}
+	if size <= 0 {
+		size = streamFrameSize
+	}
+	return &messageWriter{
+		c:      c,
+		opcode: opcode,
+		size:   size,
+		buf:    getBuffer(size)[:0],
+		encode: len(c.extensions) > 0,
+	}, nil
+}
+
+// messageWriter writes one message, a frame at a time.
+type messageWriter struct {
+	c      *Conn
+	opcode OpCode // opcode of the next frame, OpContinuation after the first
+	size   int
+	buf    []byte
+	encode bool // hold the whole message for the extensions
+	closed bool
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("ws: write to closed message writer")
+	}
+	if w.encode {
+		w.buf = append(w.buf, p...)
+		return len(p), nil
+	}
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == w.size {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):w.size], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// flush sends the buffered data as one frame.
+func (w *messageWriter) flush(fin bool) error {
+	c := w.c
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return fmt.Errorf("connection closed")
+	}
+	if err := c.writeFrame(fin, 0, w.opcode, w.buf); err != nil {
+		return err
+	}
+	w.opcode = OpContinuation
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close sends the final frame of the message and lets other data messages
+// through.
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.c.msgMu.Unlock()
+	defer putBuffer(w.buf)
+	if w.encode {
+		c := w.c
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		return c.writeMessage(w.opcode, w.buf)
+	}
+	return w.flush(true)
+}
+
+// NextReader waits for the next message and returns its type and a reader
+// for its payload. The payload is read from the connection frame by frame
+// as the reader is drained, so large messages need not fit in memory; the
+// read limit, UTF-8 validation of text and the negotiated extensions apply
+// as with ReadMessage.
+//
+// Ping and pong frames are passed to their handlers. Pongs without a
+// handler are returned like messages by NextReader, and dropped when they
+// arrive in the middle of a message. Calling NextReader again discards what is left
+// of the previous message, and the previous reader must not be used
+// anymore. NextReader and ReadMessage must not be mixed in the middle of a
+// message.
+func (c *Conn) NextReader() (OpCode, io.Reader, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	c.readSeq++
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case f.OpCode >= OpClose:
+			handler := c.controlHandler(f.OpCode)
+			if handler == nil {
+				return f.OpCode, &frameStream{c: c, seq: c.readSeq, cur: f, rest: f.Payload, fin: true}, nil
+			}
+			err := handler(f.Payload)
+			f.Release()
+			if err != nil {
+				return 0, nil, err
+			}
+			continue
+		case f.OpCode == OpContinuation:
+			// The rest of a message whose reader was abandoned
+			f.Release()
+			continue
+		}
+
+		frames := &frameStream{c: c, seq: c.readSeq, cur: f, rest: f.Payload, fin: f.Fin}
+		s := &messageReader{c: c, frames: frames, r: frames, text: f.OpCode == OpText}
+		for i := len(c.extensions) - 1; i >= 0; i-- {
+			s.r = c.extensions[i].WrapReader(s.r, f.RSV)
+		}
+		return f.OpCode, s, nil
+	}
+}
+
+// frameStream reads the payload of the frames of one message.
+type frameStream struct {
+	c    *Conn
+	seq  uint64 // NextReader call the stream belongs to
+	cur  *Frame
+	rest []byte
+	fin  bool
+	err  error // error reading from the connection
+}
+
+func (s *frameStream) Read(p []byte) (int, error) {
+	for len(s.rest) == 0 {
+		if s.cur != nil {
+			s.cur.Release()
+			s.cur = nil
+		}
+		if s.fin {
+			return 0, io.EOF
+		}
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.cur, s.err = s.next()
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.rest, s.fin = s.cur.Payload, s.cur.Fin
+	}
+	n := copy(p, s.rest)
+	s.rest = s.rest[n:]
+	return n, nil
+}
+
+// next reads the next fragment of the message, handing control frames to
+// their handlers.
+func (s *frameStream) next() (*Frame, error) {
+	c := s.c
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if c.readSeq != s.seq {
+		return nil, errStaleReader
+	}
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if f.OpCode == OpContinuation {
+			return f, nil
+		}
+		var herr error
+		if handler := c.controlHandler(f.OpCode); handler != nil {
+			herr = handler(f.Payload)
+		}
+		f.Release()
+		if herr != nil {
+			return nil, herr
+		}
+	}
+}
+
+// messageReader enforces the read limit and UTF-8 validity on a message
+// read through NextReader, after the extensions have decoded it.
+type messageReader struct {
+	c      *Conn
+	frames *frameStream
+	r      io.Reader
+	text   bool
+	n      int64
+	utf8   utf8Validator
+	err    error
+}
+
+func (m *messageReader) Read(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	n, err := m.r.Read(p)
+	m.n += int64(n)
+	switch {
+	case m.c.readLimit > 0 && m.n > m.c.readLimit:
+		m.err = m.c.tooBig()
+		return 0, m.err
+	case err != nil && err != io.EOF && m.frames.err == nil:
+		// The extensions failed to decode the payload
+		m.err = m.c.fail(CloseInvalidFramePayloadData, err)
+		return 0, m.err
+	case m.text && !m.utf8.valid(p[:n], err == io.EOF):
+		m.err = m.c.fail(CloseInvalidFramePayloadData, errInvalidUTF8)
+		return 0, m.err
+	}
+	if err != nil {
+		m.err = err
+	}
+	return n, err
+}
+
+// utf8Validator checks text that arrives in pieces, which may split
+// multi-byte characters.
+type utf8Validator struct {
+	partial [utf8.UTFMax]byte
+	n       int
+}
+
+// valid reports whether p, following the pieces seen before, is valid
+// UTF-8. final marks the last piece.
+func (v *utf8Validator) valid(p []byte, final bool) bool {
+	if v.n > 0 {
+		// Complete the character split off the previous piece
+		for len(p) > 0 && !utf8.FullRune(v.partial[:v.n]) {
+			v.partial[v.n] = p[0]
+			v.n++
+			p = p[1:]
+		}
+		if !utf8.FullRune(v.partial[:v.n]) {
+			return !final
+		}
+		if !utf8.Valid(v.partial[:v.n]) {
+			return false
+		}
+		v.n = 0
+	}
+
+	cut := len(p)
+	for i := len(p) - 1; i >= 0 && i > len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	if !utf8.Valid(p[:cut]) {
+		return false
+	}
+	v.n = copy(v.partial[:], p[cut:])
+	return !final || v.n == 0
+}
@@ -0,0 +1,154 @@
+package ws
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNextWriter(t *testing.T) {
+	server, client := connPair(t)
+	server.SetMaxFrameSize(4)
+
+	errc := make(chan error, 1)
+	go func() {
+		w, err := server.NextWriter(OpText)
+		if err != nil {
+			errc <- err
+			return
+		}
+		io.WriteString(w, "hello, ")
+		io.WriteString(w, "world")
+		errc <- w.Close()
+	}()
+
+	// The message goes out in frames of the max frame size
+	want := []struct {
+		opcode OpCode
+		fin    bool
+		data   string
+	}{
+		{OpText, false, "hell"},
+		{OpContinuation, false, "o, w"},
+		{OpContinuation, true, "orld"},
+	}
+	for _, w := range want {
+		f, err := client.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.OpCode != w.opcode || f.Fin != w.fin || string(f.Payload) != w.data {
+			t.Errorf("frame = %d fin=%v %q, want %d fin=%v %q", f.OpCode, f.Fin, f.Payload, w.opcode, w.fin, w.data)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+}
+
+func TestNextWriterReassembled(t *testing.T) {
+	server, client := connPair(t)
+	payload := make([]byte, 3*streamFrameSize+10)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w, _ := server.NextWriter(OpBinary)
+		w.Write(payload)
+		w.Close()
+		// Closing twice is harmless, writing afterwards is not
+		w.Close()
+		if _, err := w.Write([]byte("x")); err == nil {
+			t.Error("Write after Close succeeded")
+		}
+	}()
+	msg, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.OpCode != OpBinary || string(msg.Payload) != string(payload) {
+		t.Errorf("got %d with %d bytes, want the %d byte binary message", msg.OpCode, len(msg.Payload), len(payload))
+	}
+	<-done
+}
+
+func TestNextWriterErrors(t *testing.T) {
+	server, client := connPair(t)
+	go client.ReadMessage()
+	if _, err := server.NextWriter(OpPing); err == nil {
+		t.Error("NextWriter(OpPing) succeeded")
+	}
+	server.Close()
+	if _, err := server.NextWriter(OpText); err == nil {
+		t.Error("NextWriter on a closed connection succeeded")
+	}
+}
+
+// Data messages written while a NextWriter message is open wait for it,
+// while control frames may go out between its fragments.
+func TestNextWriterNotInterleaved(t *testing.T) {
+	server, client := connPair(t)
+	server.SetMaxFrameSize(4)
+
+	started := make(chan struct{})
+	done := make(chan error, 2)
+	go func() {
+		w, err := server.NextWriter(OpText)
+		if err != nil {
+			done <- err
+			return
+		}
+		io.WriteString(w, "aaaabbbb") // sends "aaaa"
+		close(started)
+		go func() { done <- server.WriteText("end") }()
+		go func() { done <- server.Ping([]byte("p")) }()
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "cccc")
+		done <- w.Close()
+	}()
+
+	type frame struct {
+		opcode OpCode
+		fin    bool
+		data   string
+	}
+	var frames []frame
+	for len(frames) == 0 || frames[len(frames)-1].data != "end" {
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		f, err := client.ReadFrame()
+		if err != nil {
+			t.Fatalf("after %v: %v", frames, err)
+		}
+		frames = append(frames, frame{f.OpCode, f.Fin, string(f.Payload)})
+		if len(frames) == 1 {
+			<-started
+		}
+	}
+
+	var data []frame
+	for _, f := range frames {
+		if f.opcode != OpPing {
+			data = append(data, f)
+		}
+	}
+	want := []frame{
+		{OpText, false, "aaaa"},
+		{OpContinuation, false, "bbbb"},
+		{OpContinuation, true, "cccc"},
+		{OpText, true, "end"},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("data frames = %v, want %v", data, want)
+	}
+	if len(frames) != len(want)+1 {
+		t.Errorf("frames = %v, want the ping among them", frames)
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+var errInvalidUTF8 = errors.New("ws: invalid UTF-8 in text message")
+
+// SetStrict used to toggle checks that are now always made: a connection
+// fails when the peer sets reserved bits, uses an unknown opcode, sends an
+// oversized or fragmented control frame, starts a data message before
+// finishing the previous one, sends invalid UTF-8 in a text message or a
+// close frame with an invalid status code or reason, or masks its frames
+// in the wrong direction.
+//
+// Deprecated: every connection is validated fully; SetStrict has no effect.
+func (c *Conn) SetStrict(strict bool) {}
+
+// checkFrame validates a frame header against the rules of RFC 6455
+// section 5 that every endpoint must enforce.
+func (c *Conn) checkFrame(fin bool, rsv byte, opcode OpCode, payloadLen int) error {
+	if rsv&^c.extRSV != 0 {
+		return fmt.Errorf("ws: reserved bits set without a negotiated extension")
+	}
+
+	switch opcode {
+	case OpContinuation, OpText, OpBinary:
+	case OpClose, OpPing, OpPong:
+		if payloadLen > 125 {
+			return fmt.Errorf("ws: control frame payload exceeds 125 bytes")
+		}
+		if !fin {
+			return fmt.Errorf("ws: control frames cannot be fragmented")
+		}
+	default:
+		return fmt.Errorf("ws: unknown opcode %#x", byte(opcode))
+	}
+
+	if opcode == OpContinuation && !c.fragmenting {
+		return fmt.Errorf("ws: continuation frame without a fragmented message in progress")
+	}
+	if (opcode == OpText || opcode == OpBinary) && c.fragmenting {
+		return fmt.Errorf("ws: new data frame while a fragmented message is in progress")
+	}
+	return nil
+}
+
+// checkClosePayload validates the status code and reason of a close frame.
+func checkClosePayload(payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	if len(payload) == 1 {
+		return fmt.Errorf("ws: close frame payload of one byte")
+	}
+	code := uint16(payload[0])<<8 | uint16(payload[1])
+	if !validCloseCode(code) {
+		return fmt.Errorf("ws: invalid close code %d", code)
+	}
+	if !utf8.Valid(payload[2:]) {
+		return fmt.Errorf("ws: invalid UTF-8 in close reason")
+	}
+	return nil
+}
+
+// validCloseCode reports whether code may appear in a close frame on the wire.
+func validCloseCode(code uint16) bool {
+	switch {
+	case code >= CloseNormalClosure && code <= CloseUnsupportedData,
+		code >= CloseInvalidFramePayloadData && code <= CloseBadGateway:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// fail sends a close frame with the given code, tears down the connection
+// and returns a CloseError describing err.
+func (c *Conn) fail(code uint16, err error) error {
+	c.CloseWithCode(code, "")
+	return &CloseError{Code: code, Text: err.Error(), Local: true}
+}
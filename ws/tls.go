@@ -0,0 +1,80 @@
+package ws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// TLSOptions describes the TLS setup of a server created by
+// NewTLSServerWithOptions.
+type TLSOptions struct {
+	// Config is the base configuration. It is cloned, never modified.
+	Config *tls.Config
+
+	// Certificates maps server names to certificates, selected by the SNI
+	// name the client sends. A key of the form "*.example.com" matches a
+	// single leftmost label; the "" key is used when nothing else matches.
+	Certificates map[string]*tls.Certificate
+
+	// NextProtos lists the ALPN protocols offered, in order of preference.
+	NextProtos []string
+
+	// ClientAuth and ClientCAs control client certificate verification
+	ClientAuth tls.ClientAuthType
+	ClientCAs  *x509.CertPool
+}
+
+// NewTLSServerWithOptions creates a WebSocket server with per-SNI
+// certificate selection, ALPN and optional client certificates. Handlers see
+// the negotiated parameters through Conn.TLSConnectionState.
+func NewTLSServerWithOptions(addr string, handler func(*Conn), opts TLSOptions) *Server {
+	return NewTLSServer(addr, handler, opts.build())
+}
+
+// build assembles the tls.Config described by the options.
+func (o TLSOptions) build() *tls.Config {
+	cfg := &tls.Config{}
+	if o.Config != nil {
+		cfg = o.Config.Clone()
+	}
+	if len(o.NextProtos) > 0 {
+		cfg.NextProtos = o.NextProtos
+	}
+	if o.ClientAuth != tls.NoClientCert {
+		cfg.ClientAuth = o.ClientAuth
+	}
+	if o.ClientCAs != nil {
+		cfg.ClientCAs = o.ClientCAs
+	}
+	if len(o.Certificates) > 0 {
+		certs := o.Certificates
+		fallback := cfg.GetCertificate
+		cfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert := selectCertificate(certs, hello.ServerName); cert != nil {
+				return cert, nil
+			}
+			if fallback != nil {
+				return fallback(hello)
+			}
+			return nil, fmt.Errorf("ws: no certificate for server name %q", hello.ServerName)
+		}
+	}
+	return cfg
+}
+
+// selectCertificate picks the certificate for name: an exact match first,
+// then a wildcard for the parent domain, then the "" default.
+func selectCertificate(certs map[string]*tls.Certificate, name string) *tls.Certificate {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if cert, ok := certs[name]; ok {
+		return cert
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := certs["*"+name[i:]]; ok {
+			return cert
+		}
+	}
+	return certs[""]
+}
@@ -1,15 +1,27 @@
 package ws
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/sha1"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/http/httpguts"
 )
 
 const WebSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
@@ -26,228 +38,675 @@ const (
 	OpPong         OpCode = 0xA
 )
 
+// maxHeaderSize is the largest possible frame header: 2 bytes of flags and
+// length, an 8-byte extended length and a 4-byte masking key.
+const maxHeaderSize = 14
+
+// coalesceFrameSize is the largest payload copied behind its header so the
+// frame goes out in one write; larger payloads are written with writev.
+const coalesceFrameSize = 4 << 10
+
 // Message represents a WebSocket message
 type Message struct {
 	OpCode  OpCode
 	Payload []byte
 }
 
+// Release returns the message payload to the buffer pool. Calling it is
+// optional; after Release the Payload must no longer be used.
+func (m *Message) Release() {
+	if m.Payload != nil {
+		putBuffer(m.Payload)
+		m.Payload = nil
+	}
+}
+
 // Conn represents a WebSocket connection
 type Conn struct {
 	conn      net.Conn
 	writeMu   sync.Mutex
 	closeSent bool
+	// msgMu is held while a data message is written, across all its
+	// frames, so that one streamed by NextWriter is not interleaved with
+	// other data frames. It is taken before writeMu; control frames only
+	// need writeMu and may go out between fragments.
+	msgMu sync.Mutex
+
+	// readMu is held by readers, so CloseHandshake can tell whether it
+	// must read the peer's close reply itself
+	readMu sync.Mutex
+	// closeRecv is closed once the peer's close frame has been read
+	closeRecv chan struct{}
+	// readSeq counts NextReader calls, so stale readers can be detected
+	readSeq uint64
+
+	// server is true for connections accepted by Upgrade, false for Dial.
+	// Clients mask the frames they send; servers require masked frames.
+	server bool
+	// maxFrameSize bounds frame payloads in both directions, see SetMaxFrameSize
+	maxFrameSize int
+	// readLimit bounds incoming messages, see SetReadLimit
+	readLimit int64
+
+	// The opening handshake request, nil on the client side
+	req *http.Request
+
+	// Identity and user metadata, see Set and Get
+	id     uint64
+	metaMu sync.RWMutex
+	meta   map[string]any
+
+	// Liveness tracking, see SetIdleTimeout and LivenessMonitor
+	idleTimeout  time.Duration
+	lastActivity atomic.Int64
+
+	// Control frame handling, see SetPingHandler and SetKeepAlive. The
+	// handlers may be swapped while another goroutine reads.
+	pingHandler   atomic.Pointer[func(appData []byte) error]
+	pongHandler   atomic.Pointer[func(appData []byte) error]
+	lastPong      atomic.Int64
+	keepAliveStop chan struct{}
+
+	// Optional outbound queue, see EnableSendQueue. It is not guarded by
+	// writeMu, so Send does not wait for a write to a slow peer.
+	queue atomic.Pointer[sendQueue]
+
+	// Extensions negotiated in the opening handshake and the reserved bits
+	// they may use
+	extensions []NegotiatedExtension
+	extRSV     byte
+
+	// Subprotocol agreed on in the opening handshake
+	subprotocol string
+
+	// Message encoding, see SetCodec and SetStrictCodec
+	codec       Codec
+	strictCodec bool
 
 	// For handling fragmented messages
 	fragmentBuffer []byte
 	fragmentOpCode OpCode
+	fragmentRSV    byte
+	fragmenting    bool
+
+	// Scratch space for frame headers, reused across frames.
+	// Reads and writes use separate arrays since they may run concurrently.
+	readHdr  [maxHeaderSize]byte
+	writeHdr [maxHeaderSize]byte
+	// writeVec backs writeBufs, so writev needs no allocation per frame
+	writeVec  [2][]byte
+	writeBufs net.Buffers
+}
+
+// NewConn wraps an established network connection on which the opening
+// handshake has already completed. server selects the endpoint role: a
+// client masks the frames it sends and a server fails the connection on
+// unmasked frames.
+func NewConn(conn net.Conn, server bool) *Conn {
+	return newConn(conn, server)
+}
+
+// newConn wraps an established connection. server selects the endpoint role.
+func newConn(conn net.Conn, server bool) *Conn {
+	c := &Conn{conn: conn, server: server, id: nextConnID(), closeRecv: make(chan struct{}), readLimit: DefaultReadLimit}
+	c.touch()
+	return c
+}
+
+// Upgrade upgrades a TCP connection to a WebSocket connection. Handshakes
+// from pages on other sites are refused, see SameOrigin; a Server with a
+// CheckOrigin hook can allow them.
+func Upgrade(conn net.Conn) (*Conn, error) {
+	return upgrade(conn, upgradeOptions{})
+}
+
+// UpgradeWithExtensions upgrades a TCP connection like Upgrade, negotiating
+// the given extensions, such as PerMessageDeflate, with the client.
+func UpgradeWithExtensions(conn net.Conn, exts ...Extension) (*Conn, error) {
+	return upgrade(conn, upgradeOptions{extensions: exts})
+}
+
+// upgradeOptions holds what the server negotiates in the opening handshake.
+type upgradeOptions struct {
+	extensions   []Extension
+	subprotocols []string
+	checkOrigin  func(*HandshakeRequest) bool
+	checkRequest func(*HandshakeRequest) error
 }
 
-// Server represents a WebSocket server
-type Server struct {
-	Addr      string
-	Handler   func(*Conn)
-	TLSConfig *tls.Config // Added TLS config
+// upgrade performs the server side of the opening handshake. A malformed
+// or non-WebSocket request is answered with an HTTP error before the
+// *HandshakeError is returned; the caller closes conn.
+func upgrade(conn net.Conn, opts upgradeOptions) (*Conn, error) {
+	// Parse the HTTP request, which may span several TCP reads
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		herr := &HandshakeError{StatusCode: http.StatusBadRequest, Reason: "malformed request: " + err.Error()}
+		rejectHandshake(conn, herr)
+		return nil, herr
+	}
+	req.RemoteAddr = conn.RemoteAddr().String()
+
+	if err := checkUpgradeRequest(req); err != nil {
+		rejectHandshake(conn, err)
+		return nil, err
+	}
+	if err := opts.check(req); err != nil {
+		rejectHandshake(conn, err)
+		return nil, err
+	}
+	return accept(conn, br, req, nil, opts)
 }
 
-// NewServer creates a new WebSocket server
-func NewServer(addr string, handler func(*Conn)) *Server {
-	return &Server{
-		Addr:    addr,
-		Handler: handler,
+// rejectHandshake answers a failed opening handshake with err's status.
+func rejectHandshake(conn net.Conn, err *HandshakeError) {
+	response := fmt.Sprintf("HTTP/1.1 %d %s\r\n", err.StatusCode, http.StatusText(err.StatusCode))
+	if err.StatusCode == http.StatusUpgradeRequired {
+		response += "Sec-WebSocket-Version: 13\r\n"
 	}
+	response += "Connection: close\r\nContent-Length: 0\r\n\r\n"
+	conn.Write([]byte(response))
 }
 
-// NewTLSServer creates a new WebSocket server with TLS support
-func NewTLSServer(addr string, handler func(*Conn), tlsConfig *tls.Config) *Server {
-	return &Server{
-		Addr:      addr,
-		Handler:   handler,
-		TLSConfig: tlsConfig,
+// checkUpgradeRequest validates a client's opening handshake, RFC 6455
+// section 4.2.1.
+func checkUpgradeRequest(req *http.Request) *HandshakeError {
+	var status int
+	var reason string
+	switch {
+	case req.Method != http.MethodGet:
+		status, reason = http.StatusMethodNotAllowed, "method "+req.Method+" is not GET"
+	case !headerContainsToken(req.Header, "Upgrade", "websocket"):
+		status, reason = http.StatusBadRequest, "not a WebSocket upgrade request"
+	case !headerContainsToken(req.Header, "Connection", "upgrade"):
+		status, reason = http.StatusBadRequest, "missing Connection: Upgrade header"
+	case req.Header.Get("Sec-WebSocket-Version") != "13":
+		status, reason = http.StatusUpgradeRequired, "unsupported Sec-WebSocket-Version"
+	case !validKey(req.Header.Get("Sec-WebSocket-Key")):
+		status, reason = http.StatusBadRequest, "missing or invalid Sec-WebSocket-Key header"
+	default:
+		return nil
 	}
+	return &HandshakeError{StatusCode: status, Reason: reason}
 }
 
-// ListenAndServe starts the WebSocket server
-func (s *Server) ListenAndServe() error {
-	var listener net.Listener
-	var err error
+// validKey reports whether key is the base64 encoding of 16 bytes.
+func validKey(key string) bool {
+	b, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(b) == 16
+}
 
-	if s.TLSConfig != nil {
-		// Create TLS listener if TLS config is provided
-		listener, err = tls.Listen("tcp", s.Addr, s.TLSConfig)
-	} else {
-		// Create regular TCP listener
-		listener, err = net.Listen("tcp", s.Addr)
+// accept completes the server side of the opening handshake for req, which
+// was read from conn through br. header holds extra response headers.
+func accept(conn net.Conn, br *bufio.Reader, req *http.Request, header http.Header, opts upgradeOptions) (*Conn, error) {
+	acceptKey := generateAcceptKey(req.Header.Get("Sec-WebSocket-Key"))
+
+	var negotiated []NegotiatedExtension
+	var extHeader string
+	if len(opts.extensions) > 0 {
+		negotiated, extHeader = acceptExtensions(parseExtensions(req.Header), opts.extensions)
+	}
+	protocol := selectSubprotocol(req.Header, opts.subprotocols)
+
+	// Send the WebSocket handshake response
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey + "\r\n"
+	if protocol != "" {
+		response += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	if extHeader != "" {
+		response += "Sec-WebSocket-Extensions: " + extHeader + "\r\n"
+	}
+	for k, vs := range header {
+		for _, v := range vs {
+			response += k + ": " + v + "\r\n"
+		}
+	}
+	response += "\r\n"
+
+	if _, err := conn.Write([]byte(response)); err != nil {
+		return nil, err
+	}
+
+	// A client may pipeline its first frames behind the request
+	if br.Buffered() > 0 {
+		conn = &bufferedConn{Conn: conn, r: br}
 	}
 
+	wsConn := newConn(conn, true)
+	wsConn.req = req
+	wsConn.subprotocol = protocol
+	wsConn.setExtensions(negotiated)
+	return wsConn, nil
+}
+
+// DialOptions configures a client connection opened by DialWithOptions.
+type DialOptions struct {
+	// Extensions are offered to the server in order of preference
+	Extensions []Extension
+
+	// Subprotocols are offered to the server in order of preference, see
+	// Conn.Subprotocol
+	Subprotocols []string
+
+	// Header holds extra request headers for the opening handshake, such
+	// as Authorization. The headers of the handshake itself (Host, Upgrade,
+	// Connection and Sec-WebSocket-*) cannot be overridden here.
+	Header http.Header
+
+	// Origin is sent as the Origin header when set
+	Origin string
+
+	// Cookies are sent with the opening handshake. Like the Authorization
+	// and Cookie entries of Header, they are dropped when a redirect leads
+	// to another host.
+	Cookies []*http.Cookie
+
+	// Dialer opens the TCP connection. Defaults to a zero net.Dialer.
+	Dialer *net.Dialer
+
+	// TLSConfig configures wss:// connections, for instance with custom
+	// RootCAs. ServerName defaults to the host of the URL.
+	TLSConfig *tls.Config
+
+	// Proxy returns the proxy to connect through, or nil for a direct
+	// connection. wss:// connections are tunneled with CONNECT and ws://
+	// requests are sent in absolute form. The request passed in has its
+	// URL scheme mapped to http or https. Defaults to
+	// http.ProxyFromEnvironment, which reads HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// HandshakeTimeout bounds the whole dial, including TLS, redirects and
+	// the opening handshake. Zero means no timeout beyond the context's.
+	HandshakeTimeout time.Duration
+
+	// MaxRedirects is the number of HTTP redirects (301, 302, 303, 307 and
+	// 308) followed during the handshake. Zero disables redirects.
+	// Redirects from wss:// to ws:// are always refused.
+	MaxRedirects int
+}
+
+// ErrTooManyRedirects is returned by DialWithOptions when the server keeps
+// redirecting beyond DialOptions.MaxRedirects.
+var ErrTooManyRedirects = errors.New("ws: too many redirects")
+
+// Dial connects to a WebSocket server
+func Dial(url string) (*Conn, error) {
+	return DialWithOptions(url, DialOptions{})
+}
+
+// DialWithOptions connects to a WebSocket server using the given options
+func DialWithOptions(rawURL string, opts DialOptions) (*Conn, error) {
+	return DialContext(context.Background(), rawURL, &opts)
+}
+
+// DialContext connects to a WebSocket server, giving up when ctx is done
+// before the opening handshake completes. Cancelling ctx afterwards does
+// not affect the returned connection. opts may be nil.
+func DialContext(ctx context.Context, rawURL string, opts *DialOptions) (*Conn, error) {
+	if opts == nil {
+		opts = &DialOptions{}
+	}
+	u, err := parseWSURL(rawURL)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !httpguts.ValidHeaderFieldValue(opts.Origin) {
+		return nil, fmt.Errorf("ws: invalid Origin %q", opts.Origin)
+	}
+	for _, p := range opts.Subprotocols {
+		if !httpguts.ValidHeaderFieldName(p) {
+			return nil, fmt.Errorf("ws: invalid subprotocol %q", p)
+		}
+	}
+	if opts.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.HandshakeTimeout)
+		defer cancel()
 	}
-	defer listener.Close()
 
-	for {
-		conn, err := listener.Accept()
+	for redirects := 0; ; redirects++ {
+		conn, resp, err := dialHandshake(ctx, u, opts)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			return conn, nil
+		}
+		if resp == nil || !isRedirect(resp.StatusCode) || opts.MaxRedirects == 0 {
+			return nil, err
+		}
+		if redirects >= opts.MaxRedirects {
+			return nil, ErrTooManyRedirects
+		}
+		next, err := redirectURL(u, resp)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		go s.handleConnection(conn)
+		if hostPort(next) != hostPort(u) {
+			opts = opts.withoutCredentials()
+		}
+		u = next
 	}
 }
 
-// ListenAndServeTLS starts the WebSocket server with TLS
-func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+// withoutCredentials returns a copy of opts for a redirect to another host,
+// without the Authorization and Cookie headers and the cookies, as net/http
+// does.
+func (o *DialOptions) withoutCredentials() *DialOptions {
+	c := *o
+	c.Header = o.Header.Clone()
+	c.Header.Del("Authorization")
+	c.Header.Del("Cookie")
+	c.Cookies = nil
+	return &c
+}
+
+// dialHandshake performs one opening handshake against u. When the server
+// answers with something other than 101 the response is returned alongside
+// the error.
+func dialHandshake(ctx context.Context, u *url.URL, opts *DialOptions) (*Conn, *http.Response, error) {
+	addr := hostPort(u)
+	proxyURL, err := proxyFor(u, opts)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
+	dialer := opts.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
 	}
-
-	listener, err := tls.Listen("tcp", s.Addr, tlsConfig)
+	dialAddr := addr
+	if proxyURL != nil {
+		dialAddr = hostPort(proxyURL)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", dialAddr)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer listener.Close()
 
-	for {
-		conn, err := listener.Accept()
+	// Unblock the handshake when ctx is done. A deadline taken from ctx
+	// could expire just before ctx reports it, so the error would not be
+	// recognized as the context's
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if proxyURL != nil {
+		tunnel := conn
+		if proxyURL.Scheme == "https" {
+			tunnel, err = proxyTLS(ctx, tunnel, proxyURL, opts)
+		}
+		if err == nil && u.Scheme == "wss" {
+			tunnel, err = proxyConnect(tunnel, addr, proxyURL)
+			// The tunnel reaches the server directly
+			proxyURL = nil
+		}
 		if err != nil {
-			return err
+			conn.Close()
+			return nil, nil, err
 		}
+		conn = tunnel
+	}
 
-		go s.handleConnection(conn)
+	if u.Scheme == "wss" {
+		// Connect with TLS for wss://
+		cfg := &tls.Config{}
+		if opts.TLSConfig != nil {
+			cfg = opts.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		conn = tlsConn
 	}
-}
 
-// handleConnection handles the WebSocket handshake and passes the connection to the handler
-func (s *Server) handleConnection(conn net.Conn) {
-	wsConn, err := Upgrade(conn)
+	// Create the WebSocket handshake request
+	key := generateRandomKey()
+	_, err = conn.Write(handshakeRequest(u, key, opts, proxyURL))
 	if err != nil {
 		conn.Close()
-		return
+		return nil, nil, err
 	}
 
-	s.Handler(wsConn)
-}
+	// Read the handshake response
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
 
-// Upgrade upgrades a TCP connection to a WebSocket connection
-func Upgrade(conn net.Conn) (*Conn, error) {
-	// Buffer to read the HTTP upgrade request
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
+	if err := checkHandshake(resp, key, opts.Subprotocols); err != nil {
+		conn.Close()
+		return nil, resp, err
+	}
+
+	negotiated, err := confirmExtensions(parseExtensions(resp.Header), opts.Extensions)
 	if err != nil {
-		return nil, err
+		conn.Close()
+		return nil, resp, err
 	}
 
-	// Parse the HTTP headers
-	request := string(buf[:n])
-	headers := parseHeaders(request)
+	if !stop() || conn.SetDeadline(time.Time{}) != nil {
+		conn.Close()
+		return nil, nil, ctx.Err()
+	}
 
-	// Check if it's a WebSocket upgrade request
-	if headers["Upgrade"] != "websocket" {
-		return nil, fmt.Errorf("not a WebSocket upgrade request")
+	// Frames sent right after the response may already sit in the reader
+	if br.Buffered() > 0 {
+		conn = &bufferedConn{Conn: conn, r: br}
 	}
 
-	// Get the WebSocket key and generate the accept key
-	key := headers["Sec-WebSocket-Key"]
-	acceptKey := generateAcceptKey(key)
+	wsConn := newConn(conn, false)
+	wsConn.subprotocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	wsConn.setExtensions(negotiated)
+	return wsConn, resp, nil
+}
 
-	// Send the WebSocket handshake response
-	response := "HTTP/1.1 101 Switching Protocols\r\n" +
-		"Upgrade: websocket\r\n" +
-		"Connection: Upgrade\r\n" +
-		"Sec-WebSocket-Accept: " + acceptKey + "\r\n\r\n"
+// handshakeHeaders are set by the dialer and skipped in DialOptions.Header.
+var handshakeHeaders = map[string]bool{
+	"Host":                     true,
+	"Upgrade":                  true,
+	"Connection":               true,
+	"Sec-Websocket-Key":        true,
+	"Sec-Websocket-Version":    true,
+	"Sec-Websocket-Protocol":   true,
+	"Sec-Websocket-Extensions": true,
+}
 
-	_, err = conn.Write([]byte(response))
-	if err != nil {
-		return nil, err
+// handshakeRequest builds the opening handshake request for u, in
+// absolute form with proxy credentials when sent to proxyURL.
+func handshakeRequest(u *url.URL, key string, opts *DialOptions, proxyURL *url.URL) []byte {
+	target := u.RequestURI()
+	if proxyURL != nil {
+		target = "http://" + u.Host + target
 	}
 
-	return &Conn{conn: conn}, nil
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "GET %s HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\n"+
+		"Sec-WebSocket-Version: 13\r\n",
+		target, u.Host, key)
+	if len(opts.Subprotocols) > 0 {
+		b.WriteString("Sec-WebSocket-Protocol: " + strings.Join(opts.Subprotocols, ", ") + "\r\n")
+	}
+	if len(opts.Extensions) > 0 {
+		b.WriteString("Sec-WebSocket-Extensions: " + offerExtensions(opts.Extensions) + "\r\n")
+	}
+	if proxyURL != nil {
+		if auth := proxyAuthorization(proxyURL); auth != "" {
+			b.WriteString("Proxy-Authorization: " + auth + "\r\n")
+		}
+	}
+	if opts.Origin != "" {
+		b.WriteString("Origin: " + opts.Origin + "\r\n")
+	}
+	var cookies []string
+	for _, c := range opts.Cookies {
+		if s := (&http.Cookie{Name: c.Name, Value: c.Value}).String(); s != "" {
+			cookies = append(cookies, s)
+		}
+	}
+	if len(cookies) > 0 {
+		b.WriteString("Cookie: " + strings.Join(cookies, "; ") + "\r\n")
+	}
+	opts.Header.WriteSubset(&b, handshakeHeaders)
+	b.WriteString("\r\n")
+	return b.Bytes()
 }
 
-// Dial connects to a WebSocket server
-func Dial(url string) (*Conn, error) {
-	// Parse the URL to determine if it's ws:// or wss://
-	isSecure := strings.HasPrefix(url, "wss://")
-	hostPort := strings.TrimPrefix(strings.TrimPrefix(url, "ws://"), "wss://")
+// HandshakeError reports a failed opening handshake. Dial returns it when
+// the server's answer does not complete the handshake, and the upgrade
+// functions when the client's request is not a valid one.
+type HandshakeError struct {
+	StatusCode int    // status of the server's response, or the status to answer the client with
+	Reason     string // what was wrong with the handshake
+}
 
-	var conn net.Conn
-	var err error
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("ws: bad handshake (status %d): %s", e.StatusCode, e.Reason)
+}
 
-	if isSecure {
-		// Connect with TLS for wss://
-		conn, err = tls.Dial("tcp", hostPort, &tls.Config{})
-	} else {
-		// Connect without TLS for ws://
-		conn, err = net.Dial("tcp", hostPort)
+// checkHandshake validates the server's response to a handshake sent with
+// key and offering protocols, as required by RFC 6455 section 4.1.
+func checkHandshake(resp *http.Response, key string, protocols []string) error {
+	var reason string
+	protocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	switch {
+	case resp.StatusCode != http.StatusSwitchingProtocols:
+		reason = "unexpected status " + resp.Status
+	case !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket"):
+		reason = "missing Upgrade: websocket header"
+	case !headerContainsToken(resp.Header, "Connection", "upgrade"):
+		reason = "missing Connection: Upgrade header"
+	case resp.Header.Get("Sec-WebSocket-Accept") != generateAcceptKey(key):
+		reason = "Sec-WebSocket-Accept does not match the key"
+	case protocol != "" && !slices.Contains(protocols, protocol):
+		reason = fmt.Sprintf("server selected subprotocol %q that was not offered", protocol)
+	default:
+		return nil
 	}
+	return &HandshakeError{StatusCode: resp.StatusCode, Reason: reason}
+}
 
-	if err != nil {
-		return nil, err
+// selectSubprotocol returns the first subprotocol requested by the client
+// that the server supports, or "" if there is none.
+func selectSubprotocol(h http.Header, supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+	for _, v := range h.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); slices.Contains(supported, p) {
+				return p
+			}
+		}
 	}
+	return ""
+}
 
-	// Create the WebSocket handshake request
-	key := generateRandomKey()
-	request := fmt.Sprintf(
-		"GET / HTTP/1.1\r\n"+
-			"Host: %s\r\n"+
-			"Upgrade: websocket\r\n"+
-			"Connection: Upgrade\r\n"+
-			"Sec-WebSocket-Key: %s\r\n"+
-			"Sec-WebSocket-Version: 13\r\n\r\n",
-		hostPort, key)
-
-	_, err = conn.Write([]byte(request))
-	if err != nil {
-		conn.Close()
-		return nil, err
+// headerContainsToken reports whether the comma-separated header name
+// lists token, compared case-insensitively.
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	// Read the handshake response
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
+// parseWSURL parses a ws:// or wss:// URL.
+func parseWSURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
-
-	// Check if the response is valid
-	response := string(buf[:n])
-	if !strings.Contains(response, "HTTP/1.1 101") || !strings.Contains(response, "Upgrade: websocket") {
-		conn.Close()
-		return nil, fmt.Errorf("invalid handshake response")
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("ws: unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("ws: missing host in %q", rawURL)
 	}
+	return u, nil
+}
 
-	return &Conn{conn: conn}, nil
+// isRedirect reports whether status is an HTTP redirect the dialer follows.
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
 
-// generateRandomKey generates a random key for the WebSocket handshake
-func generateRandomKey() string {
-	key := make([]byte, 16)
-	// In a real implementation, use crypto/rand to generate random bytes
-	for i := range key {
-		key[i] = byte(i)
+// redirectURL resolves the Location of a redirect response against the
+// current URL. http and https targets are mapped to ws and wss; any other
+// scheme, and downgrades from wss to ws, are rejected.
+func redirectURL(current *url.URL, resp *http.Response) (*url.URL, error) {
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil, fmt.Errorf("ws: redirect %d without Location", resp.StatusCode)
 	}
-	return base64.StdEncoding.EncodeToString(key)
+	next, err := current.Parse(loc)
+	if err != nil {
+		return nil, err
+	}
+	switch next.Scheme {
+	case "http":
+		next.Scheme = "ws"
+	case "https":
+		next.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return nil, fmt.Errorf("ws: refusing redirect to scheme %q", next.Scheme)
+	}
+	if current.Scheme == "wss" && next.Scheme == "ws" {
+		return nil, fmt.Errorf("ws: refusing redirect from wss to ws")
+	}
+	return next, nil
 }
 
-// parseHeaders parses HTTP headers
-func parseHeaders(request string) map[string]string {
-	headers := make(map[string]string)
-	lines := strings.Split(request, "\r\n")
+// bufferedConn is a net.Conn whose reads drain the bytes left in the
+// handshake reader before going back to the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
 
-	for _, line := range lines {
-		parts := strings.SplitN(line, ": ", 2)
-		if len(parts) == 2 {
-			headers[parts[0]] = parts[1]
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	if b.r != nil {
+		if b.r.Buffered() > 0 {
+			return b.r.Read(p)
 		}
+		b.r = nil
 	}
+	return b.Conn.Read(p)
+}
 
-	return headers
+// generateRandomKey generates a random key for the WebSocket handshake
+func generateRandomKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
 }
 
 // generateAcceptKey generates the Sec-WebSocket-Accept value
@@ -257,186 +716,118 @@ func generateAcceptKey(key string) string {
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
-// ReadMessage reads a message from the WebSocket connection
+// ReadMessage reads a message from the WebSocket connection.
+// When the peer sends a close frame, or the connection fails, the returned
+// error is a *CloseError carrying the close status.
+// The returned payload is backed by a pooled buffer; callers that are done
+// with it may call Message.Release to hand the buffer back for reuse.
 func (c *Conn) ReadMessage() (*Message, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
 	for {
-		// Read frame header
-		header := make([]byte, 2)
-		_, err := io.ReadFull(c.conn, header)
+		f, err := c.readFrame()
 		if err != nil {
 			return nil, err
 		}
 
-		// Parse basic frame information
-		fin := (header[0] & 0x80) != 0
-		opcode := OpCode(header[0] & 0x0F)
-		masked := (header[1] & 0x80) != 0
-		payloadLen := int(header[1] & 0x7F)
-
-		// Handle extended payload length
-		if payloadLen == 126 {
-			extLen := make([]byte, 2)
-			_, err := io.ReadFull(c.conn, extLen)
-			if err != nil {
-				return nil, err
+		// Ping and pong frames go to their handler or are returned
+		// immediately
+		if f.OpCode >= OpClose {
+			handler := c.controlHandler(f.OpCode)
+			if handler == nil {
+				return &Message{OpCode: f.OpCode, Payload: f.Payload}, nil
 			}
-			payloadLen = int(extLen[0])<<8 | int(extLen[1])
-		} else if payloadLen == 127 {
-			extLen := make([]byte, 8)
-			_, err := io.ReadFull(c.conn, extLen)
+			err := handler(f.Payload)
+			f.Release()
 			if err != nil {
 				return nil, err
 			}
-
-			// Properly handle 8-byte length
-			// First bit must be 0 (unsigned)
-			if extLen[0]&0x80 != 0 {
-				return nil, fmt.Errorf("invalid payload length: most significant bit must be 0")
-			}
-
-			// Calculate the 64-bit length
-			payloadLen64 := uint64(0)
-			for i := 0; i < 8; i++ {
-				payloadLen64 = (payloadLen64 << 8) | uint64(extLen[i])
-			}
-
-			// Check if the length fits in an int
-			if payloadLen64 > uint64(^uint(0)>>1) {
-				return nil, fmt.Errorf("payload too large for this implementation")
-			}
-
-			payloadLen = int(payloadLen64)
+			continue
 		}
 
-		// Read masking key if frame is masked
-		var maskingKey []byte
-		if masked {
-			maskingKey = make([]byte, 4)
-			_, err := io.ReadFull(c.conn, maskingKey)
-			if err != nil {
-				return nil, err
-			}
+		if c.readLimit > 0 && f.OpCode == OpContinuation && int64(len(c.fragmentBuffer)+len(f.Payload)) > c.readLimit {
+			f.Release()
+			putBuffer(c.fragmentBuffer)
+			c.fragmentBuffer = nil
+			return nil, c.tooBig()
 		}
 
-		// Read payload
-		payload := make([]byte, payloadLen)
-		_, err = io.ReadFull(c.conn, payload)
-		if err != nil {
-			return nil, err
+		// Handle fragmented messages
+		if f.OpCode == OpContinuation {
+			// Append this fragment to the buffer and recycle the frame buffer
+			c.fragmentBuffer = appendBuffer(c.fragmentBuffer, f.Payload)
+			f.Release()
+		} else {
+			// This is the first (or only) frame of a message. Hand back
+			// what an abandoned message may have left behind.
+			putBuffer(c.fragmentBuffer)
+			c.fragmentBuffer = f.Payload
 		}
 
-		// Unmask the payload if necessary
-		if masked {
-			for i := 0; i < payloadLen; i++ {
-				payload[i] ^= maskingKey[i%4]
-			}
+		if !f.Fin {
+			// Not the final fragment, continue reading
+			continue
 		}
 
-		// Handle control frames (ping, pong, close)
-		if opcode >= OpClose {
-			// Control frames cannot be fragmented
-			if !fin {
-				return nil, fmt.Errorf("control frames cannot be fragmented")
-			}
-
-			// Return control frames immediately
-			return &Message{OpCode: opcode, Payload: payload}, nil
+		// The message is complete
+		msg := &Message{
+			OpCode:  c.fragmentOpCode,
+			Payload: c.fragmentBuffer,
 		}
 
-		// Handle fragmented messages
-		if opcode == OpContinuation {
-			// This is a continuation frame
-			if c.fragmentBuffer == nil {
-				return nil, fmt.Errorf("received continuation frame but no fragmented message is in progress")
-			}
-
-			// Append this fragment to the buffer
-			c.fragmentBuffer = append(c.fragmentBuffer, payload...)
-
-			if fin {
-				// This is the final fragment, return the complete message
-				msg := &Message{
-					OpCode:  c.fragmentOpCode,
-					Payload: c.fragmentBuffer,
-				}
+		// Clear the fragment buffer
+		c.fragmentBuffer = nil
 
-				// Clear the fragment buffer
-				c.fragmentBuffer = nil
-
-				return msg, nil
+		if len(c.extensions) > 0 {
+			payload, err := c.decodeMessage(msg.Payload, c.fragmentRSV)
+			if errors.Is(err, ErrMessageTooBig) {
+				return nil, c.tooBig()
 			}
+			if err != nil {
+				return nil, c.fail(CloseInvalidFramePayloadData, err)
+			}
+			msg.Payload = payload
+		}
 
-			// Not the final fragment, continue reading
-			continue
-		} else if !fin {
-			// This is the start of a fragmented message
-			c.fragmentBuffer = payload
-			c.fragmentOpCode = opcode
-
-			// Continue reading the next fragment
-			continue
+		if msg.OpCode == OpText && !utf8.Valid(msg.Payload) {
+			msg.Release()
+			return nil, c.fail(CloseInvalidFramePayloadData, errInvalidUTF8)
 		}
 
-		// This is a complete, unfragmented message
-		return &Message{OpCode: opcode, Payload: payload}, nil
+		return msg, nil
 	}
 }
 
-// WriteMessage writes a message to the WebSocket connection
+// WriteMessage writes a message to the WebSocket connection. Data messages
+// larger than the configured max frame size are fragmented automatically.
 func (c *Conn) WriteMessage(opcode OpCode, payload []byte) error {
+	if opcode < OpClose {
+		c.msgMu.Lock()
+		defer c.msgMu.Unlock()
+	}
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
+	return c.writeMessage(opcode, payload)
+}
 
+// writeMessage is WriteMessage without locking.
+func (c *Conn) writeMessage(opcode OpCode, payload []byte) error {
 	if c.closeSent {
 		return fmt.Errorf("connection closed")
 	}
 
-	payloadLen := len(payload)
-
-	// Create frame header
-	var header []byte
-
-	// First byte: FIN bit set (1), RSV1-3 are 0, opcode
-	header = append(header, 0x80|byte(opcode))
-
-	// Second byte: No mask bit (0), and payload length
-	if payloadLen < 126 {
-		header = append(header, byte(payloadLen))
-	} else if payloadLen < 65536 {
-		header = append(header, 126)
-		header = append(header, byte(payloadLen>>8), byte(payloadLen))
-	} else {
-		header = append(header, 127)
-
-		// Properly encode the 8-byte length
-		header = append(header,
-			byte(payloadLen>>56),
-			byte(payloadLen>>48),
-			byte(payloadLen>>40),
-			byte(payloadLen>>32),
-			byte(payloadLen>>24),
-			byte(payloadLen>>16),
-			byte(payloadLen>>8),
-			byte(payloadLen))
-	}
-
-	// Send header followed by payload
-	_, err := c.conn.Write(header)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.conn.Write(payload)
-	if err != nil {
-		return err
+	var rsv byte
+	if len(c.extensions) > 0 && opcode < OpClose {
+		var err error
+		if payload, rsv, err = c.encodeMessage(payload); err != nil {
+			return err
+		}
 	}
 
-	// Mark connection as closed if this was a close frame
-	if opcode == OpClose {
-		c.closeSent = true
+	if c.maxFrameSize > 0 && opcode < OpClose && len(payload) > c.maxFrameSize {
+		return c.writeFragmented(opcode, rsv, payload, c.maxFrameSize)
 	}
-
-	return nil
+	return c.writeFrame(true, rsv, opcode, payload)
 }
 
 // WriteFragmentedMessage writes a large message as multiple fragments
@@ -445,6 +836,8 @@ func (c *Conn) WriteFragmentedMessage(opcode OpCode, payload []byte, fragmentSiz
 		return fmt.Errorf("fragment size must be positive")
 	}
 
+	c.msgMu.Lock()
+	defer c.msgMu.Unlock()
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
 
@@ -452,14 +845,28 @@ func (c *Conn) WriteFragmentedMessage(opcode OpCode, payload []byte, fragmentSiz
 		return fmt.Errorf("connection closed")
 	}
 
+	var rsv byte
+	if len(c.extensions) > 0 {
+		var err error
+		if payload, rsv, err = c.encodeMessage(payload); err != nil {
+			return err
+		}
+	}
+
+	return c.writeFragmented(opcode, rsv, payload, fragmentSize)
+}
+
+// writeFragmented splits payload into frames of at most fragmentSize bytes
+// (without locking). rsv is only set on the first frame.
+func (c *Conn) writeFragmented(opcode OpCode, rsv byte, payload []byte, fragmentSize int) error {
 	totalLen := len(payload)
-	if totalLen == 0 {
-		// Empty message, just send a single frame
-		return c.writeFrame(true, opcode, payload)
+	if totalLen <= fragmentSize {
+		// Fits in one frame, no fragmentation needed
+		return c.writeFrame(true, rsv, opcode, payload)
 	}
 
 	// Send the first fragment
-	if err := c.writeFrame(false, opcode, payload[:fragmentSize]); err != nil {
+	if err := c.writeFrame(false, rsv, opcode, payload[:fragmentSize]); err != nil {
 		return err
 	}
 
@@ -473,7 +880,7 @@ func (c *Conn) WriteFragmentedMessage(opcode OpCode, payload []byte, fragmentSiz
 		// Last fragment?
 		isFinal := (end == totalLen)
 
-		if err := c.writeFrame(isFinal, OpContinuation, payload[offset:end]); err != nil {
+		if err := c.writeFrame(isFinal, 0, OpContinuation, payload[offset:end]); err != nil {
 			return err
 		}
 	}
@@ -481,48 +888,75 @@ func (c *Conn) WriteFragmentedMessage(opcode OpCode, payload []byte, fragmentSiz
 	return nil
 }
 
-// writeFrame writes a single WebSocket frame (without locking)
-func (c *Conn) writeFrame(fin bool, opcode OpCode, payload []byte) error {
-	payloadLen := len(payload)
+// SetMaxFrameSize limits the payload size of individual frames. Outgoing
+// data messages above the limit are split into fragments and incoming frames
+// above it fail the connection with CloseMessageTooBig. Zero means no limit.
+func (c *Conn) SetMaxFrameSize(n int) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.maxFrameSize = n
+}
 
-	// Create frame header
-	var header []byte
+// ErrMessageTooBig is returned by ReadMessage and ReadFrame when the peer
+// sends more than the connection's read limit. The connection is closed
+// with CloseMessageTooBig.
+var ErrMessageTooBig = errors.New("ws: message exceeds read limit")
+
+// DefaultReadLimit is the read limit of new connections, see SetReadLimit.
+const DefaultReadLimit = 32 << 20
+
+// SetReadLimit limits the size of incoming messages to limit bytes: a frame
+// announcing a larger payload is refused before anything is allocated for
+// it, and so is a fragment taking the message, or its decompressed form,
+// over the limit. Connections start with DefaultReadLimit. Zero means no
+// limit, which lets the peer make the connection allocate as much as a
+// frame header announces.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// tooBig fails the connection after the peer exceeded the read limit.
+func (c *Conn) tooBig() error {
+	c.CloseWithCode(CloseMessageTooBig, "")
+	return ErrMessageTooBig
+}
 
-	// First byte: FIN bit, RSV1-3 are 0, opcode
-	finBit := byte(0)
-	if fin {
-		finBit = 0x80
+// writeFrame writes a single WebSocket frame (without locking)
+func (c *Conn) writeFrame(fin bool, rsv byte, opcode OpCode, payload []byte) error {
+	n := encodeHeader(c.writeHdr[:], fin, rsv, opcode, len(payload))
+
+	// Clients mask every frame with a fresh key, RFC 6455 section 5.3. The
+	// payload is masked in a copy as it belongs to the caller.
+	var key []byte
+	if !c.server {
+		c.writeHdr[1] |= 0x80
+		key = c.writeHdr[n : n+4]
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		n += 4
 	}
-	header = append(header, finBit|byte(opcode))
+	header := c.writeHdr[:n]
 
-	// Second byte: No mask bit (0), and payload length
-	if payloadLen < 126 {
-		header = append(header, byte(payloadLen))
-	} else if payloadLen < 65536 {
-		header = append(header, 126)
-		header = append(header, byte(payloadLen>>8), byte(payloadLen))
+	// Send header and payload with a single write: small and masked frames
+	// are copied behind the header, large ones go out with writev
+	var err error
+	if key != nil || len(payload) <= coalesceFrameSize {
+		bp := getScratch(n + len(payload))
+		defer putScratch(bp)
+		buf := *bp
+		copy(buf, header)
+		copy(buf[n:], payload)
+		if key != nil {
+			maskBytes(key, buf[n:])
+		}
+		_, err = c.conn.Write(buf)
 	} else {
-		header = append(header, 127)
-
-		// Properly encode the 8-byte length
-		header = append(header,
-			byte(payloadLen>>56),
-			byte(payloadLen>>48),
-			byte(payloadLen>>40),
-			byte(payloadLen>>32),
-			byte(payloadLen>>24),
-			byte(payloadLen>>16),
-			byte(payloadLen>>8),
-			byte(payloadLen))
-	}
-
-	// Send header followed by payload
-	_, err := c.conn.Write(header)
-	if err != nil {
-		return err
+		c.writeVec = [2][]byte{header, payload}
+		c.writeBufs = c.writeVec[:]
+		_, err = c.writeBufs.WriteTo(c.conn)
+		c.writeVec = [2][]byte{}
 	}
-
-	_, err = c.conn.Write(payload)
 	if err != nil {
 		return err
 	}
@@ -555,10 +989,21 @@ func (c *Conn) WriteFragmentedBinary(data []byte, fragmentSize int) error {
 	return c.WriteFragmentedMessage(OpBinary, data, fragmentSize)
 }
 
-// Close closes the WebSocket connection
+// stopQueue shuts down the outbound queue, if any.
+func (c *Conn) stopQueue() {
+	if q := c.queue.Load(); q != nil {
+		q.stop(ErrQueueClosed)
+	}
+}
+
+// Close sends a close frame and closes the underlying connection right
+// away, without waiting for the peer's reply. Use CloseHandshake to let the
+// peer finish sending first.
 func (c *Conn) Close() error {
+	c.stopQueue()
+	c.stopKeepAlive()
 	// Send close frame if not already sent
-	if !c.closeSent {
+	if !c.sentClose() {
 		err := c.WriteMessage(OpClose, nil)
 		if err != nil {
 			c.conn.Close()
@@ -568,17 +1013,20 @@ func (c *Conn) Close() error {
 	return c.conn.Close()
 }
 
+// sentClose reports whether a close frame was written.
+func (c *Conn) sentClose() bool {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.closeSent
+}
+
 // CloseWithCode closes the WebSocket connection with a status code and reason
 func (c *Conn) CloseWithCode(statusCode uint16, reason string) error {
-	// Create payload with status code and reason
-	payload := make([]byte, 2+len(reason))
-	payload[0] = byte(statusCode >> 8)
-	payload[1] = byte(statusCode)
-	copy(payload[2:], reason)
-
+	c.stopQueue()
+	c.stopKeepAlive()
 	// Send close frame if not already sent
-	if !c.closeSent {
-		err := c.WriteMessage(OpClose, payload)
+	if !c.sentClose() {
+		err := c.WriteMessage(OpClose, closePayload(statusCode, reason))
 		if err != nil {
 			c.conn.Close()
 			return err
@@ -612,6 +1060,19 @@ func (c *Conn) SetDeadline(t time.Time) error {
 	return c.conn.SetDeadline(t)
 }
 
+// Request returns the HTTP request that opened the connection, giving
+// handlers access to its path, query string, headers and cookies.
+// It returns nil for client connections created by Dial.
+func (c *Conn) Request() *http.Request {
+	return c.req
+}
+
+// Subprotocol returns the subprotocol negotiated in the opening handshake,
+// or "" if none was.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
 // LocalAddr returns the local network address
 func (c *Conn) LocalAddr() net.Addr {
 	return c.conn.LocalAddr()
@@ -624,16 +1085,31 @@ func (c *Conn) RemoteAddr() net.Addr {
 
 // IsTLS returns true if the connection is using TLS
 func (c *Conn) IsTLS() bool {
-	_, ok := c.conn.(*tls.Conn)
+	_, ok := c.TLSConnectionState()
 	return ok
 }
 
-// TLSConnectionState returns the TLS connection state if using TLS
+// TLSConnectionState returns the TLS connection state if using TLS,
+// including the SNI server name, the ALPN protocol and verified client
+// certificates. Connections bootstrapped over HTTP/2 report the state of the
+// underlying HTTP/2 connection.
 func (c *Conn) TLSConnectionState() (*tls.ConnectionState, bool) {
-	tlsConn, ok := c.conn.(*tls.Conn)
+	tlsConn, ok := c.netConn().(*tls.Conn)
 	if !ok {
+		if c.req != nil && c.req.TLS != nil {
+			return c.req.TLS, true
+		}
 		return nil, false
 	}
 	state := tlsConn.ConnectionState()
 	return &state, true
 }
+
+// netConn returns the underlying connection, looking through the buffering
+// added by the client handshake.
+func (c *Conn) netConn() net.Conn {
+	if b, ok := c.conn.(*bufferedConn); ok {
+		return b.Conn
+	}
+	return c.conn
+}
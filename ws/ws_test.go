@@ -0,0 +1,89 @@
+package ws
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	got := make(chan string, 1)
+	s := &Server{Subprotocols: []string{"v2", "v1"}, Handler: func(c *Conn) {
+		got <- c.Subprotocol()
+	}}
+	url := serveLoopback(t, s)
+
+	tests := []struct {
+		name    string
+		offered []string
+		want    string
+	}{
+		{"client preference wins", []string{"v1", "v2"}, "v1"},
+		{"unsupported ones skipped", []string{"v3", "v2"}, "v2"},
+		{"no common subprotocol", []string{"v3"}, ""},
+		{"none offered", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := DialWithOptions(url, DialOptions{Subprotocols: tt.offered})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if conn.Subprotocol() != tt.want {
+				t.Errorf("client Subprotocol = %q, want %q", conn.Subprotocol(), tt.want)
+			}
+			if server := <-got; server != tt.want {
+				t.Errorf("server Subprotocol = %q, want %q", server, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHandshakeSubprotocol(t *testing.T) {
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	resp := &http.Response{
+		StatusCode: http.StatusSwitchingProtocols,
+		Header: http.Header{
+			"Upgrade":                {"websocket"},
+			"Connection":             {"Upgrade"},
+			"Sec-Websocket-Accept":   {generateAcceptKey(key)},
+			"Sec-Websocket-Protocol": {"v2"},
+		},
+	}
+	if err := checkHandshake(resp, key, []string{"v1", "v2"}); err != nil {
+		t.Errorf("offered subprotocol: %v", err)
+	}
+	err := checkHandshake(resp, key, []string{"v1"})
+	if err == nil || !strings.Contains(err.Error(), "not offered") {
+		t.Errorf("subprotocol that was not offered = %v, want an error", err)
+	}
+}
+
+func TestMaskingDirection(t *testing.T) {
+	// A server receiving an unmasked frame and a client receiving a masked
+	// one both fail the connection with 1002
+	tests := []struct {
+		name   string
+		server bool
+		frame  []byte
+	}{
+		{"unmasked client frame", true, []byte{0x80 | byte(OpText), 2, 'h', 'i'}},
+		{"masked server frame", false, maskedText("hi")},
+	}
+	for _, tt := range tests {
+		a, b := net.Pipe()
+		c := NewConn(a, tt.server)
+		// The pipe is synchronous: drain the close frame while the rest of
+		// the frame is still being written
+		go io.Copy(io.Discard, b)
+		go b.Write(tt.frame)
+		if _, err := c.ReadMessage(); !IsCloseError(err, CloseProtocolError) {
+			t.Errorf("%s: ReadMessage = %v, want close 1002", tt.name, err)
+		}
+		a.Close()
+		b.Close()
+	}
+}
@@ -0,0 +1,201 @@
+// Package wstest provides in-memory WebSocket connections for unit-testing
+// code built on the ws package without binding real ports.
+package wstest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/edgflow/lux/ws"
+)
+
+// DefaultTimeout bounds how long the Expect helpers wait for a frame.
+var DefaultTimeout = 2 * time.Second
+
+// Pipe returns a connected pair of client and server connections.
+func Pipe() (client, server *ws.Conn) {
+	c, s := net.Pipe()
+	return ws.NewConn(c, false), ws.NewConn(s, true)
+}
+
+// Peer is the raw end of an in-memory connection. It lets tests inject
+// arbitrary frames, including malformed ones, and inspect the frames the
+// connection under test sends.
+type Peer struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mask bool
+}
+
+// NewServerConn returns a server-side connection under test and a client
+// peer driving it. The peer masks its frames as a real client must.
+func NewServerConn() (*ws.Conn, *Peer) {
+	c, s := net.Pipe()
+	return ws.NewConn(s, true), &Peer{conn: c, br: bufio.NewReader(c), mask: true}
+}
+
+// NewClientConn returns a client-side connection under test and a server
+// peer driving it.
+func NewClientConn() (*ws.Conn, *Peer) {
+	c, s := net.Pipe()
+	return ws.NewConn(c, false), &Peer{conn: s, br: bufio.NewReader(s)}
+}
+
+// WriteFrame sends a single frame. It blocks until the connection under test
+// reads it; use Inject to send from a separate goroutine.
+func (p *Peer) WriteFrame(fin bool, opcode ws.OpCode, payload []byte) error {
+	_, err := p.conn.Write(EncodeFrame(fin, opcode, payload, p.mask))
+	return err
+}
+
+// WriteRaw sends bytes verbatim, for malformed-frame tests.
+func (p *Peer) WriteRaw(b []byte) error {
+	_, err := p.conn.Write(b)
+	return err
+}
+
+// Inject writes frames in order from a background goroutine, like a script
+// played against the connection under test. The returned channel yields the
+// first write error, or nil once every frame has been written.
+func (p *Peer) Inject(frames ...ws.Frame) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		for _, f := range frames {
+			if err := p.WriteFrame(f.Fin, f.OpCode, f.Payload); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	return done
+}
+
+// ReadFrame reads the next frame sent by the connection under test, with
+// the payload unmasked.
+func (p *Peer) ReadFrame() (*ws.Frame, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(p.br, hdr[:]); err != nil {
+		return nil, err
+	}
+	f := &ws.Frame{Fin: hdr[0]&0x80 != 0, OpCode: ws.OpCode(hdr[0] & 0x0F)}
+	masked := hdr[1]&0x80 != 0
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(p.br, ext[:]); err != nil {
+			return nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(p.br, ext[:]); err != nil {
+			return nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(p.br, key[:]); err != nil {
+			return nil, err
+		}
+	}
+	f.Payload = make([]byte, n)
+	if _, err := io.ReadFull(p.br, f.Payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		for i := range f.Payload {
+			f.Payload[i] ^= key[i%4]
+		}
+	}
+	return f, nil
+}
+
+// ExpectFrame fails the test unless the next frame has the given opcode and
+// payload.
+func (p *Peer) ExpectFrame(t testing.TB, opcode ws.OpCode, payload []byte) *ws.Frame {
+	t.Helper()
+	f := p.next(t)
+	if f.OpCode != opcode || string(f.Payload) != string(payload) {
+		t.Fatalf("wstest: got frame opcode=%d payload=%q, want opcode=%d payload=%q",
+			f.OpCode, f.Payload, opcode, payload)
+	}
+	return f
+}
+
+// ExpectText fails the test unless the next frame is a text frame with s.
+func (p *Peer) ExpectText(t testing.TB, s string) {
+	t.Helper()
+	p.ExpectFrame(t, ws.OpText, []byte(s))
+}
+
+// ExpectClose fails the test unless the next frame is a close frame with
+// the given status code.
+func (p *Peer) ExpectClose(t testing.TB, code uint16) {
+	t.Helper()
+	f := p.next(t)
+	if f.OpCode != ws.OpClose {
+		t.Fatalf("wstest: got opcode %d, want close frame", f.OpCode)
+	}
+	if len(f.Payload) < 2 {
+		t.Fatalf("wstest: close frame without status code, want %d", code)
+	}
+	if got := binary.BigEndian.Uint16(f.Payload); got != code {
+		t.Fatalf("wstest: got close code %d, want %d", got, code)
+	}
+}
+
+func (p *Peer) next(t testing.TB) *ws.Frame {
+	t.Helper()
+	p.conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+	defer p.conn.SetReadDeadline(time.Time{})
+	f, err := p.ReadFrame()
+	if err != nil {
+		t.Fatalf("wstest: reading frame: %v", err)
+	}
+	return f
+}
+
+// Close closes the peer's end of the pipe.
+func (p *Peer) Close() error {
+	return p.conn.Close()
+}
+
+// EncodeFrame builds the wire form of a frame, masking it with a fixed key
+// when mask is set.
+func EncodeFrame(fin bool, opcode ws.OpCode, payload []byte, mask bool) []byte {
+	b := make([]byte, 0, 14+len(payload))
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, first, maskBit|byte(n))
+	case n < 65536:
+		b = append(b, first, maskBit|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, first, maskBit|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if !mask {
+		return append(b, payload...)
+	}
+	key := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	b = append(b, key[:]...)
+	for i, c := range payload {
+		b = append(b, c^key[i%4])
+	}
+	return b
+}
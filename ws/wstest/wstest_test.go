@@ -0,0 +1,512 @@
+package wstest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edgflow/lux/ws"
+)
+
+func TestServerConnEcho(t *testing.T) {
+	conn, peer := NewServerConn()
+	defer peer.Close()
+
+	go func() {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(msg.OpCode, msg.Payload)
+	}()
+
+	done := peer.Inject(
+		ws.Frame{OpCode: ws.OpText, Payload: []byte("hel")},
+		ws.Frame{OpCode: ws.OpContinuation, Fin: true, Payload: []byte("lo")},
+	)
+	peer.ExpectText(t, "hello")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	client, server := Pipe()
+	go client.WriteText("ping")
+
+	msg, err := server.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.OpCode != ws.OpText || string(msg.Payload) != "ping" {
+		t.Fatalf("got %d %q", msg.OpCode, msg.Payload)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame ws.Frame
+		code  uint16
+	}{
+		{"reserved opcode", ws.Frame{OpCode: 0x3, Fin: true}, ws.CloseProtocolError},
+		{"oversized ping", ws.Frame{OpCode: ws.OpPing, Fin: true, Payload: make([]byte, 126)}, ws.CloseProtocolError},
+		{"stray continuation", ws.Frame{OpCode: ws.OpContinuation, Fin: true}, ws.CloseProtocolError},
+		{"invalid UTF-8", ws.Frame{OpCode: ws.OpText, Fin: true, Payload: []byte{0xff, 0xfe}}, ws.CloseInvalidFramePayloadData},
+		{"invalid close code", ws.Frame{OpCode: ws.OpClose, Fin: true, Payload: []byte{0x03, 0xed}}, ws.CloseProtocolError},
+		{"one-byte close payload", ws.Frame{OpCode: ws.OpClose, Fin: true, Payload: []byte{0x03}}, ws.CloseProtocolError},
+		{"invalid UTF-8 close reason", ws.Frame{OpCode: ws.OpClose, Fin: true, Payload: []byte{0x03, 0xe8, 0xff}}, ws.CloseProtocolError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, peer := NewServerConn()
+			defer peer.Close()
+			go conn.ReadMessage()
+
+			peer.Inject(tt.frame)
+			peer.ExpectClose(t, tt.code)
+		})
+	}
+}
+
+func TestCloseCodesEchoed(t *testing.T) {
+	for _, code := range []uint16{ws.CloseNormalClosure, ws.CloseServiceRestart, ws.CloseTryAgainLater, ws.CloseBadGateway, 3000, 4999} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			conn, peer := NewServerConn()
+			defer peer.Close()
+			conn.SetStrict(true)
+			go conn.ReadMessage()
+
+			peer.Inject(ws.Frame{OpCode: ws.OpClose, Fin: true, Payload: []byte{byte(code >> 8), byte(code)}})
+			peer.ExpectClose(t, code)
+		})
+	}
+}
+
+func TestInterleavedDataFrames(t *testing.T) {
+	conn, peer := NewServerConn()
+	defer peer.Close()
+	go conn.ReadMessage()
+
+	peer.Inject(ws.Frame{OpCode: ws.OpText, Payload: []byte("frag")}, ws.Frame{OpCode: ws.OpBinary, Fin: true})
+	peer.ExpectClose(t, ws.CloseProtocolError)
+}
+
+func TestPingAnsweredByDefault(t *testing.T) {
+	conn, peer := NewServerConn()
+	defer peer.Close()
+	go conn.ReadMessage()
+
+	peer.Inject(ws.Frame{OpCode: ws.OpPing, Fin: true, Payload: []byte("hi")})
+	peer.ExpectFrame(t, ws.OpPong, []byte("hi"))
+}
+
+func TestSetPingHandlerWhileReading(t *testing.T) {
+	conn, peer := NewServerConn()
+	defer peer.Close()
+	go func() {
+		for {
+			if _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	seen := make(chan string, 1)
+	conn.SetPingHandler(func(appData []byte) error {
+		seen <- string(appData)
+		return conn.DefaultPingHandler()(appData)
+	})
+	peer.Inject(ws.Frame{OpCode: ws.OpPing, Fin: true, Payload: []byte("a")})
+	peer.ExpectFrame(t, ws.OpPong, []byte("a"))
+	if got := <-seen; got != "a" {
+		t.Fatalf("handler saw %q", got)
+	}
+}
+
+func TestServerCheckOriginDefault(t *testing.T) {
+	opts := ws.DialOptions{Origin: "https://evil.example"}
+	url := serve(t, &ws.Server{Handler: func(c *ws.Conn) {}})
+	var herr *ws.HandshakeError
+	if _, err := ws.DialWithOptions(url, opts); !errors.As(err, &herr) || herr.StatusCode != http.StatusForbidden {
+		t.Fatalf("cross-origin dial err = %v, want 403", err)
+	}
+
+	url = serve(t, &ws.Server{Handler: func(c *ws.Conn) {}, CheckOrigin: ws.AllowAnyOrigin})
+	conn, err := ws.DialWithOptions(url, opts)
+	if err != nil {
+		t.Fatalf("dial with AllowAnyOrigin: %v", err)
+	}
+	conn.Close()
+}
+
+func TestLivenessMonitor(t *testing.T) {
+	m := ws.NewLivenessMonitor(100 * time.Millisecond)
+	defer m.Stop()
+	readErr := func(c *ws.Conn) <-chan error {
+		errc := make(chan error, 1)
+		go func() {
+			for {
+				if _, err := c.ReadMessage(); err != nil {
+					errc <- err
+					return
+				}
+			}
+		}()
+		return errc
+	}
+
+	// A quiet peer that answers the monitor's pings stays connected
+	live, client := tcpPair(t)
+	readErr(ws.NewConn(client, false))
+	m.Add(live)
+	liveErr := readErr(live)
+
+	// A peer that never answers is closed
+	dead, _ := tcpPair(t)
+	m.Add(dead)
+	deadErr := readErr(dead)
+
+	select {
+	case <-deadErr:
+	case <-time.After(time.Second):
+		t.Fatal("silent connection still open")
+	}
+	select {
+	case err := <-liveErr:
+		t.Fatalf("live connection closed: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestReconnectingConn(t *testing.T) {
+	got := make(chan string, 4)
+	url := serve(t, &ws.Server{Handler: func(c *ws.Conn) {
+		// Control frames are handled by the client, not passed to readers
+		c.Ping([]byte("p"))
+		c.Pong(nil)
+		c.WriteText("hello")
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if msg.OpCode == ws.OpPong {
+				got <- "pong:" + string(msg.Payload)
+				continue
+			}
+			got <- string(msg.Payload)
+		}
+	}})
+
+	rc := ws.NewReconnectingConn(url, ws.ReconnectOptions{BufferSize: 4})
+	defer rc.Close()
+	rc.WriteText("one")
+	rc.WriteText("two")
+
+	msg, err := rc.ReadMessage()
+	if err != nil || string(msg.Payload) != "hello" {
+		t.Fatalf("ReadMessage = %v, %v", msg, err)
+	}
+	seen := map[string]bool{}
+	var order []string
+	for len(seen) < 3 {
+		select {
+		case s := <-got:
+			seen[s] = true
+			if !strings.HasPrefix(s, "pong:") {
+				order = append(order, s)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("server saw %v", seen)
+		}
+	}
+	if !seen["pong:p"] || strings.Join(order, ",") != "one,two" {
+		t.Errorf("server saw %v, buffered writes in order %v", seen, order)
+	}
+}
+
+// tcpPair returns a server connection under benchmark and the raw loopback
+// TCP connection of its client.
+func tcpPair(b testing.TB) (*ws.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { client.Close(); server.Close() })
+	return ws.NewConn(server, true), client
+}
+
+func BenchmarkWriteMessage(b *testing.B) {
+	for _, size := range []int{64, 4 << 10, 64 << 10} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			conn, client := tcpPair(b)
+			go io.Copy(io.Discard, client)
+			payload := make([]byte, size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := conn.WriteMessage(ws.OpBinary, payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadMessage(b *testing.B) {
+	for _, size := range []int{64, 4 << 10, 64 << 10} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			conn, client := tcpPair(b)
+			frame := EncodeFrame(true, ws.OpBinary, make([]byte, size), true)
+			go func() {
+				for {
+					if _, err := client.Write(frame); err != nil {
+						return
+					}
+				}
+			}()
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for b.Loop() {
+				msg, err := conn.ReadMessage()
+				if err != nil {
+					b.Fatal(err)
+				}
+				msg.Release()
+			}
+		})
+	}
+}
+
+// serve runs s on a loopback listener and returns its ws:// URL.
+func serve(t *testing.T, s *ws.Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return "ws://" + ln.Addr().String() + "/"
+}
+
+func TestServerClosesAfterHandler(t *testing.T) {
+	url := serve(t, &ws.Server{Handler: func(c *ws.Conn) {}})
+	conn, err := ws.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var ce *ws.CloseError
+	if _, err := conn.ReadMessage(); !errors.As(err, &ce) {
+		t.Fatalf("ReadMessage after the handler returned = %v, want a close", err)
+	}
+}
+
+func TestServerMaxConns(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	url := serve(t, &ws.Server{MaxConns: 1, Handler: func(c *ws.Conn) { <-release }})
+	conn, err := ws.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A client that never reads must not hold up the next rejection
+	stalled, err := net.Dial("tcp", strings.TrimSuffix(strings.TrimPrefix(url, "ws://"), "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+
+	var herr *ws.HandshakeError
+	if _, err := ws.Dial(url); !errors.As(err, &herr) || herr.StatusCode != 503 {
+		t.Fatalf("Dial over MaxConns = %v, want 503", err)
+	}
+}
+
+func TestDialRedirectDropsCredentials(t *testing.T) {
+	got := make(chan http.Header, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Clone()
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer target.Close()
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/socket", http.StatusFound)
+	}))
+	defer redirector.Close()
+
+	_, err := ws.DialWithOptions("ws"+strings.TrimPrefix(redirector.URL, "http"), ws.DialOptions{
+		Header:       http.Header{"Authorization": {"Bearer secret"}, "X-Trace": {"1"}},
+		Cookies:      []*http.Cookie{{Name: "session", Value: "secret"}},
+		MaxRedirects: 1,
+	})
+	if err == nil {
+		t.Fatal("dial succeeded against a non-WebSocket server")
+	}
+	h := <-got
+	if h.Get("Authorization") != "" || h.Get("Cookie") != "" {
+		t.Errorf("credentials sent to another host: %v", h)
+	}
+	if h.Get("X-Trace") != "1" {
+		t.Errorf("X-Trace = %q, want other headers kept", h.Get("X-Trace"))
+	}
+}
+
+func TestDialInvalidOrigin(t *testing.T) {
+	_, err := ws.DialWithOptions("ws://127.0.0.1:1/", ws.DialOptions{Origin: "http://a\r\nX-Injected: 1"})
+	if err == nil || !strings.Contains(err.Error(), "invalid Origin") {
+		t.Fatalf("err = %v, want invalid Origin", err)
+	}
+}
+
+func TestSendQueueWriteTimeoutScope(t *testing.T) {
+	client, server := Pipe()
+	client.EnableSendQueue(ws.QueueOptions{WriteTimeout: 20 * time.Millisecond})
+	if err := client.SendText("queued"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The queue's deadline must not carry over to later direct writes
+	time.Sleep(50 * time.Millisecond)
+	go server.ReadMessage()
+	if err := client.WriteText("direct"); err != nil {
+		t.Fatalf("direct write after queued write: %v", err)
+	}
+}
+
+func TestDefaultReadLimit(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	server := ws.NewConn(a, true)
+
+	// A masked binary frame announcing 64 MiB, past DefaultReadLimit; the
+	// payload never follows
+	go b.Write([]byte{0x82, 0xff, 0, 0, 0, 0, 0x04, 0, 0, 0, 1, 2, 3, 4})
+	closed := make(chan error, 1)
+	go func() {
+		_, err := ws.NewConn(b, false).ReadMessage()
+		closed <- err
+	}()
+
+	if _, err := server.ReadMessage(); !errors.Is(err, ws.ErrMessageTooBig) {
+		t.Fatalf("server err = %v, want ErrMessageTooBig", err)
+	}
+	var ce *ws.CloseError
+	if err := <-closed; !errors.As(err, &ce) || ce.Code != ws.CloseMessageTooBig {
+		t.Fatalf("client err = %v, want close 1009", err)
+	}
+}
+
+func TestPollerCloseUnblocksWorkers(t *testing.T) {
+	server, client := tcpPair(t)
+	closed := make(chan error, 1)
+	p := ws.NewPoller(1, func(*ws.Conn, *ws.Message) {}, func(c *ws.Conn, err error) { closed <- err })
+	if err := p.Add(server); err != nil {
+		t.Fatal(err)
+	}
+
+	// Start a masked 10-byte frame and stall, leaving the worker reading
+	client.Write([]byte{0x82, 0x8a, 1, 2, 3, 4, 0})
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() { done <- p.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on a worker reading a stalled message")
+	}
+	if err := <-closed; !errors.Is(err, ws.ErrPollerClosed) {
+		t.Fatalf("onClose err = %v, want ErrPollerClosed", err)
+	}
+	if err := p.Add(server); !errors.Is(err, ws.ErrPollerClosed) {
+		t.Fatalf("Add after Close = %v, want ErrPollerClosed", err)
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	t.Run("echoed", func(t *testing.T) {
+		conn, peer := NewServerConn()
+		defer peer.Close()
+		done := make(chan error, 1)
+		go func() { done <- conn.CloseHandshake(ws.CloseGoingAway, "bye", time.Second) }()
+
+		peer.ExpectClose(t, ws.CloseGoingAway)
+		peer.Inject(ws.Frame{OpCode: ws.OpClose, Fin: true, Payload: []byte{0x03, 0xe9}})
+		if err := <-done; err != nil {
+			t.Fatalf("CloseHandshake = %v", err)
+		}
+	})
+	t.Run("no reply", func(t *testing.T) {
+		conn, peer := NewServerConn()
+		defer peer.Close()
+		done := make(chan error, 1)
+		go func() { done <- conn.CloseHandshake(ws.CloseNormalClosure, "", 50*time.Millisecond) }()
+
+		peer.ExpectClose(t, ws.CloseNormalClosure)
+		if err := <-done; !errors.Is(err, ws.ErrCloseTimeout) {
+			t.Fatalf("CloseHandshake = %v, want ErrCloseTimeout", err)
+		}
+	})
+}
+
+func TestStreamingUTF8(t *testing.T) {
+	t.Run("rune split across fragments", func(t *testing.T) {
+		conn, peer := NewServerConn()
+		defer peer.Close()
+		peer.Inject(
+			ws.Frame{OpCode: ws.OpText, Payload: []byte("a\xc3")},
+			ws.Frame{OpCode: ws.OpContinuation, Fin: true, Payload: []byte("\xa9b")},
+		)
+
+		_, r, err := conn.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || string(got) != "aéb" {
+			t.Fatalf("read %q, %v", got, err)
+		}
+	})
+	t.Run("invalid sequence", func(t *testing.T) {
+		conn, peer := NewServerConn()
+		defer peer.Close()
+		go func() {
+			if _, r, err := conn.NextReader(); err == nil {
+				io.ReadAll(r)
+			}
+		}()
+
+		peer.Inject(
+			ws.Frame{OpCode: ws.OpText, Payload: []byte("a\xc3")},
+			ws.Frame{OpCode: ws.OpContinuation, Fin: true, Payload: []byte("(b")},
+		)
+		peer.ExpectClose(t, ws.CloseInvalidFramePayloadData)
+	})
+}